@@ -0,0 +1,144 @@
+package gofacerecognition
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error codes shared by the servers and clients of the package, so a client returns the same
+// typed errors for a remote call as the local call would have
+const (
+	CodeNoFace          = "no_face"
+	CodeBusy            = "busy"
+	CodeUnauthorized    = "unauthorized"
+	CodeNotFound        = "not_found"
+	CodeInvalidArgument = "invalid_argument"
+	CodeUnavailable     = "unavailable"
+	CodeInternal        = "internal"
+)
+
+// errorBody is the JSON body of an HTTP error response
+type errorBody struct {
+	Error      string  `json:"error"`
+	Code       string  `json:"code,omitempty"`
+	RetryAfter float64 `json:"retry_after,omitempty"` // seconds
+}
+
+// ErrorCode returns the wire code for err
+func ErrorCode(err error) string {
+	var (
+		apiErr       *APIError
+		imageErr     *ImageLoadError
+		modelErr     *InvalidModelError
+		landmarksErr *InvalidLandmarksError
+		personErr    *PersonNotFoundError
+		crashErr     *WorkerCrashedError
+		shardErr     *ShardUnavailableError
+		partialErr   *PartialResultsError
+	)
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr.Code
+	case errors.Is(err, ErrNoFace):
+		return CodeNoFace
+	case errors.Is(err, ErrBusy):
+		return CodeBusy
+	case errors.Is(err, ErrUnauthorized):
+		return CodeUnauthorized
+	case errors.As(err, &personErr):
+		return CodeNotFound
+	case errors.As(err, &imageErr), errors.As(err, &modelErr), errors.As(err, &landmarksErr):
+		return CodeInvalidArgument
+	case errors.As(err, &crashErr), errors.As(err, &shardErr), errors.As(err, &partialErr),
+		errors.Is(err, context.DeadlineExceeded):
+		return CodeUnavailable
+	}
+	return CodeInternal
+}
+
+// ErrorStatus returns the HTTP status used for an error code
+func ErrorStatus(code string) int {
+	switch code {
+	case CodeNoFace:
+		return http.StatusUnprocessableEntity
+	case CodeBusy, CodeUnavailable:
+		return http.StatusServiceUnavailable
+	case CodeUnauthorized:
+		return http.StatusUnauthorized
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeInvalidArgument:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// ErrorFromCode rebuilds the typed error for a code received from a server
+func ErrorFromCode(code, message string, retryAfter time.Duration) error {
+	switch code {
+	case CodeNoFace:
+		return &NoFaceFoundError{}
+	case CodeBusy:
+		return &BusyError{RetryAfter: retryAfter}
+	case CodeUnauthorized:
+		// The message is the server's Error(), which already carries the prefix
+		return &UnauthorizedError{Reason: strings.TrimPrefix(message, "unauthorized: ")}
+	case "":
+		code = CodeInternal
+	}
+	return &APIError{Code: code, Message: message}
+}
+
+// WriteHTTPError writes err as a JSON error response with the status of its code
+func WriteHTTPError(w http.ResponseWriter, err error) {
+	code := ErrorCode(err)
+	body := errorBody{Error: err.Error(), Code: code}
+
+	var busy *BusyError
+	if errors.As(err, &busy) && busy.RetryAfter > 0 {
+		body.RetryAfter = busy.RetryAfter.Seconds()
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(body.RetryAfter))))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(ErrorStatus(code))
+	json.NewEncoder(w).Encode(body)
+}
+
+// ReadHTTPError turns a non-2xx response into the typed error the server reported
+// Responses from servers that do not send a code are mapped from their status
+func ReadHTTPError(resp *http.Response) error {
+	var body errorBody
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err := json.Unmarshal(data, &body); err != nil || body.Error == "" {
+		body.Error = resp.Status
+	}
+
+	if body.Code == "" {
+		switch resp.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			body.Code = CodeUnauthorized
+		case http.StatusTooManyRequests:
+			body.Code = CodeBusy
+		case http.StatusNotFound:
+			body.Code = CodeNotFound
+		case http.StatusBadRequest:
+			body.Code = CodeInvalidArgument
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			body.Code = CodeUnavailable
+		}
+	}
+
+	retryAfter := time.Duration(body.RetryAfter * float64(time.Second))
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && retryAfter == 0 {
+		retryAfter = time.Duration(secs) * time.Second
+	}
+	return ErrorFromCode(body.Code, body.Error, retryAfter)
+}
@@ -0,0 +1,101 @@
+package gofacerecognition
+
+import "math"
+
+// ArcFaceChipSize is the side of the chips ArcFace-style models take
+const ArcFaceChipSize = 112
+
+// arcFaceTemplate holds where the eyes, the nose tip and the mouth corners land on a 112x112 chip,
+// in image order (image-left eye first), from insightface's face_align.py, also used by OpenCV's
+// FaceRecognizerSF
+var arcFaceTemplate = [5][2]float64{
+	{38.2946, 51.6963},
+	{73.5318, 51.5014},
+	{56.0252, 71.7366},
+	{41.5493, 92.3655},
+	{70.7299, 92.2041},
+}
+
+// ArcFaceChip returns the ArcFaceChipSize x ArcFaceChipSize crop of a face aligned the way
+// ArcFace-style models were trained: the similarity transform that best maps the eye centers, the
+// nose tip and the mouth corners of landmarks onto the insightface template. Areas outside img, and
+// whole chips of incomplete landmarks, are black
+func ArcFaceChip(img *ImageMatrix, landmarks FaceLandmarks) *ImageMatrix {
+	src := arcFacePoints(landmarks)
+
+	// Least-squares similarity transform dst = [a -b; b a] * src + t
+	var sx, sy, dx, dy float64
+	for i := range src {
+		sx += src[i][0]
+		sy += src[i][1]
+		dx += arcFaceTemplate[i][0]
+		dy += arcFaceTemplate[i][1]
+	}
+	n := float64(len(src))
+	sx, sy, dx, dy = sx/n, sy/n, dx/n, dy/n
+
+	var num1, num2, den float64
+	for i := range src {
+		px, py := src[i][0]-sx, src[i][1]-sy
+		qx, qy := arcFaceTemplate[i][0]-dx, arcFaceTemplate[i][1]-dy
+		num1 += px*qx + py*qy
+		num2 += px*qy - py*qx
+		den += px*px + py*py
+	}
+
+	// Missing landmarks give NaN points, and a black chip like a degenerate transform does
+	out := img.newLike(ArcFaceChipSize, ArcFaceChipSize)
+	if !(den > 0) || math.IsNaN(num1) || math.IsNaN(num2) {
+		return out
+	}
+	a, b := num1/den, num2/den
+	tx, ty := dx-(a*sx-b*sy), dy-(b*sx+a*sy)
+
+	// Inverse mapping: every chip pixel samples the source position it came from
+	scale := a*a + b*b
+	w, h := float64(img.Width), float64(img.Height)
+	for y := 0; y < ArcFaceChipSize; y++ {
+		for x := 0; x < ArcFaceChipSize; x++ {
+			ux, uy := float64(x)-tx, float64(y)-ty
+			srcX := (a*ux + b*uy) / scale
+			srcY := (-b*ux + a*uy) / scale
+			if srcX < -0.5 || srcY < -0.5 || srcX > w-0.5 || srcY > h-0.5 {
+				continue
+			}
+			r, g, bl := img.bilinear(srcX, srcY)
+			out.Set(x, y, r, g, bl)
+		}
+	}
+	return out
+}
+
+// arcFacePoints returns the five points of arcFaceTemplate measured on 68-point landmarks
+func arcFacePoints(l FaceLandmarks) [5][2]float64 {
+	center := func(points []Point) [2]float64 {
+		var c [2]float64
+		for _, p := range points {
+			c[0] += float64(p.X)
+			c[1] += float64(p.Y)
+		}
+		if len(points) > 0 {
+			c[0] /= float64(len(points))
+			c[1] /= float64(len(points))
+		}
+		return c
+	}
+	point := func(points []Point, i int) [2]float64 {
+		if i >= len(points) {
+			return [2]float64{math.NaN(), math.NaN()}
+		}
+		return [2]float64{float64(points[i].X), float64(points[i].Y)}
+	}
+	// NoseBridge ends on the tip of the nose (point 30), TopLip starts and ends its outer contour on
+	// the mouth corners (points 48 and 54)
+	return [5][2]float64{
+		center(l.LeftEye),
+		center(l.RightEye),
+		point(l.NoseBridge, 3),
+		point(l.TopLip, 0),
+		point(l.TopLip, 6),
+	}
+}
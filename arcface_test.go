@@ -0,0 +1,60 @@
+package gofacerecognition
+
+import "testing"
+
+// templateLandmarks places the five ArcFace points at scale times the template, offset by (dx, dy)
+func templateLandmarks(scale, dx, dy float64) FaceLandmarks {
+	p := func(i int) Point {
+		return Point{X: int(arcFaceTemplate[i][0]*scale + dx + 0.5), Y: int(arcFaceTemplate[i][1]*scale + dy + 0.5)}
+	}
+	eye := func(c Point) []Point {
+		// Six points centered on c
+		return []Point{{c.X - 2, c.Y}, {c.X - 1, c.Y - 1}, {c.X + 1, c.Y - 1}, {c.X + 2, c.Y}, {c.X + 1, c.Y + 1}, {c.X - 1, c.Y + 1}}
+	}
+	mouth := make([]Point, 12)
+	mouth[0], mouth[6] = p(3), p(4)
+	return FaceLandmarks{
+		Chin:       make([]Point, 17),
+		LeftEye:    eye(p(0)),
+		RightEye:   eye(p(1)),
+		NoseBridge: []Point{{}, {}, {}, p(2)},
+		TopLip:     mouth,
+	}
+}
+
+func TestArcFaceChipMapsLandmarksOntoTemplate(t *testing.T) {
+	img := NewImageMatrix(400, 400)
+	landmarks := templateLandmarks(2, 50, 30)
+
+	// Mark the nose tip; it must land on the template's nose position in the chip
+	nose := landmarks.NoseBridge[3]
+	for y := nose.Y - 3; y <= nose.Y+3; y++ {
+		for x := nose.X - 3; x <= nose.X+3; x++ {
+			img.Set(x, y, 255, 0, 0)
+		}
+	}
+
+	chip := ArcFaceChip(img, landmarks)
+	if chip.Width != ArcFaceChipSize || chip.Height != ArcFaceChipSize {
+		t.Fatalf("chip is %dx%d", chip.Width, chip.Height)
+	}
+	if r, _, _ := chip.At(int(arcFaceTemplate[2][0]), int(arcFaceTemplate[2][1])); r < 200 {
+		t.Errorf("nose tip not at the template position, red = %d", r)
+	}
+	if r, _, _ := chip.At(int(arcFaceTemplate[0][0]), int(arcFaceTemplate[0][1])); r != 0 {
+		t.Errorf("eye position is red = %d, the mark moved", r)
+	}
+}
+
+func TestArcFaceChipIncompleteLandmarks(t *testing.T) {
+	img := NewImageMatrix(100, 100)
+	for i := range img.Pixels {
+		img.Pixels[i] = 200
+	}
+	chip := ArcFaceChip(img, FaceLandmarks{})
+	for _, v := range chip.Pixels {
+		if v != 0 {
+			t.Fatal("chip of empty landmarks is not black")
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package gofacerecognition
+
+import (
+	"context"
+	"sort"
+)
+
+// asyncCropMargin is the margin, as a fraction of the face size, kept around each face when it is
+// cropped for encoding; the encoder's chip only reaches a quarter of the face size past the box
+const asyncCropMargin = 0.75
+
+// DetectAndEncodeAsync is DetectAndEncode that calls cb with each face as soon as it is encoded,
+// instead of returning all faces at the end, so a UI can render results for crowded group photos
+// progressively. Faces arrive largest first; cb runs on the calling goroutine, which it blocks
+// Config.Preprocessing is applied as in DetectAndEncode. Faces passed to cb before an error stay valid
+func (fr *FaceRecognizer) DetectAndEncodeAsync(img *ImageMatrix, upsampleTimes int, numJitters int, cb func(Face)) error {
+	return fr.detectAndEncodeEach(context.Background(), img, upsampleTimes, numJitters, cb)
+}
+
+// DetectAndEncodeChan is DetectAndEncodeAsync delivering the faces on a channel, which is closed when
+// the image is done. The error channel then yields the error that stopped encoding, or is closed
+// without one. Cancelling ctx stops encoding between faces and abandons any face not yet received
+func (fr *FaceRecognizer) DetectAndEncodeChan(ctx context.Context, img *ImageMatrix, upsampleTimes int, numJitters int) (<-chan Face, <-chan error) {
+	faces := make(chan Face)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(faces)
+		err := fr.detectAndEncodeEach(ctx, img, upsampleTimes, numJitters, func(f Face) {
+			select {
+			case faces <- f:
+			case <-ctx.Done():
+			}
+		})
+		if err != nil {
+			errc <- err
+		}
+	}()
+	return faces, errc
+}
+
+// detectAndEncodeEach detects the faces of img, then encodes them one at a time on a crop around
+// each, so an image with many faces is not copied into C once per face
+func (fr *FaceRecognizer) detectAndEncodeEach(ctx context.Context, img *ImageMatrix, upsampleTimes int, numJitters int, cb func(Face)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	img, original := fr.preprocessImage(img)
+	locations, err := fr.faceLocationsCtx(ctx, img, upsampleTimes, HOG, fr.faceLocations)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(locations, func(i, j int) bool {
+		return locations[i].Area() > locations[j].Area()
+	})
+
+	for _, loc := range locations {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		margin := int(float64(max(loc.Width(), loc.Height())) * asyncCropMargin)
+		window := Rectangle{
+			Top:    max(loc.Top-margin, 0),
+			Right:  min(loc.Right+margin, img.Width),
+			Bottom: min(loc.Bottom+margin, img.Height),
+			Left:   max(loc.Left-margin, 0),
+		}
+		crop := img.Crop(window)
+		local := []Rectangle{{
+			Top:    loc.Top - window.Top,
+			Right:  loc.Right - window.Left,
+			Bottom: loc.Bottom - window.Top,
+			Left:   loc.Left - window.Left,
+		}}
+
+		landmarks, err := fr.FaceLandmarks(crop, local)
+		if err != nil {
+			return err
+		}
+		encodings, err := fr.FaceEncodings(crop, local, numJitters, LandmarkLarge)
+		if err != nil {
+			return err
+		}
+		if len(encodings) == 0 {
+			continue
+		}
+
+		face := Face{Rectangle: loc, Encoding: encodings[0]}
+		if len(landmarks) == 1 {
+			face.Landmarks = translateLandmarks(landmarks[0], window.Left, window.Top)
+		}
+		cb(original(face))
+	}
+	return nil
+}
+
+// translateLandmarks moves every landmark point by (dx, dy)
+func translateLandmarks(l FaceLandmarks, dx, dy int) FaceLandmarks {
+	for _, points := range []*[]Point{&l.Chin, &l.LeftEyebrow, &l.RightEyebrow, &l.NoseBridge, &l.NoseTip, &l.LeftEye, &l.RightEye, &l.TopLip, &l.BottomLip} {
+		moved := make([]Point, len(*points))
+		for i, p := range *points {
+			moved[i] = Point{X: p.X + dx, Y: p.Y + dy}
+		}
+		*points = moved
+	}
+	return l
+}
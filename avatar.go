@@ -0,0 +1,89 @@
+package gofacerecognition
+
+import "math"
+
+// AvatarOptions frames the crops of AutoCropAvatarOptions
+type AvatarOptions struct {
+	Aspect     float64 // width / height of the crop (default 1, square)
+	EyeLinePct float64 // height of the eyes from the top, in percent of the crop height (default 40)
+	// EyeSpanPct is the distance between the eye centers in percent of the crop width (default 30)
+	// Lower values leave more margin around the head
+	EyeSpanPct float64
+	Width      int // output width in pixels (default the resolution of the face in the image)
+}
+
+// AutoCropAvatar crops a profile picture framed on the eyes of face: the eyes are levelled and
+// placed at eyeLinePct percent of the height (default 40), centered horizontally, with the default
+// margins of AvatarOptions. aspect is width / height (default 1)
+// face must carry landmarks, as the faces returned by DetectAndEncode do
+func AutoCropAvatar(img *ImageMatrix, face Face, aspect, eyeLinePct float64) (*ImageMatrix, error) {
+	return AutoCropAvatarOptions(img, face, AvatarOptions{Aspect: aspect, EyeLinePct: eyeLinePct})
+}
+
+// AutoCropAvatarOptions is AutoCropAvatar with every framing setting exposed
+// Parts of the crop beyond the image border repeat the edge pixels
+func AutoCropAvatarOptions(img *ImageMatrix, face Face, opts AvatarOptions) (*ImageMatrix, error) {
+	if opts.Aspect <= 0 {
+		opts.Aspect = 1
+	}
+	if opts.EyeLinePct <= 0 || opts.EyeLinePct >= 100 {
+		opts.EyeLinePct = 40
+	}
+	if opts.EyeSpanPct <= 0 || opts.EyeSpanPct >= 100 {
+		opts.EyeSpanPct = 30
+	}
+
+	var leftEye, rightEye []Point
+	switch lm := face.Landmarks.(type) {
+	case FaceLandmarks:
+		leftEye, rightEye = lm.LeftEye, lm.RightEye
+	case FaceLandmarksSmall:
+		leftEye, rightEye = lm.LeftEye, lm.RightEye
+	}
+	if len(leftEye) == 0 || len(rightEye) == 0 {
+		return nil, &InvalidLandmarksError{Reason: "avatar cropping needs the eye landmarks of the face"}
+	}
+
+	a, b := centroid(leftEye), centroid(rightEye)
+	if a.x > b.x {
+		a, b = b, a
+	}
+	dx, dy := b.x-a.x, b.y-a.y
+	span := math.Hypot(dx, dy)
+	if span < 1 {
+		return nil, &InvalidLandmarksError{Reason: "eyes are too close together to frame the face"}
+	}
+
+	// Crop size in source pixels, and the output size
+	cropW := span * 100 / opts.EyeSpanPct
+	outW := opts.Width
+	if outW <= 0 {
+		outW = int(math.Round(cropW))
+	}
+	outH := max(1, int(math.Round(float64(outW)/opts.Aspect)))
+	scale := cropW / float64(outW) // source pixels per output pixel
+
+	// Bilinear sampling skips pixels when shrinking a lot, so shrink the source first
+	src := img
+	midX, midY := (a.x+b.x)/2, (a.y+b.y)/2
+	if scale >= 2 {
+		src = img.Resize(max(1, int(float64(img.Width)/scale)), max(1, int(float64(img.Height)/scale)))
+		sx, sy := float64(src.Width)/float64(img.Width), float64(src.Height)/float64(img.Height)
+		midX, midY = (midX+0.5)*sx-0.5, (midY+0.5)*sy-0.5
+		scale *= sx
+	}
+
+	// Output pixels are rotated by the roll of the eye line around the eye midpoint
+	cos, sin := dx/span, dy/span
+	eyeLine := float64(outH) * opts.EyeLinePct / 100
+	out := NewImageMatrix(outW, outH)
+	for y := 0; y < outH; y++ {
+		for x := 0; x < outW; x++ {
+			u := (float64(x) + 0.5 - float64(outW)/2) * scale
+			v := (float64(y) + 0.5 - eyeLine) * scale
+			r, g, b := src.bilinear(midX+u*cos-v*sin, midY+u*sin+v*cos)
+			out.Set(x, y, r, g, b)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,15 @@
+#!/bin/sh
+# Builds libfacerec and runs the Python and Node binding tests against it, run from anywhere
+# -a rebuilds cmd/libfacerec even when only gofr.h changed, which the build cache does not track,
+# so a prototype drifting from its Go function fails here instead of in a release
+set -eu
+root=$(cd "$(dirname "$0")/.." && pwd)
+cd "$root"
+
+go build -a -buildmode=c-shared -o libfacerec.so ./cmd/libfacerec
+
+GOFR_LIBRARY="$root/libfacerec.so" python3 -m unittest discover -s bindings/python -v
+
+cd bindings/node
+npm install --no-audit --no-fund
+npm test
@@ -0,0 +1,94 @@
+// gofr.h is the stable C API of libfacerec, built from ./cmd/libfacerec with
+//
+//     go build -buildmode=c-shared -o libfacerec.so ./cmd/libfacerec
+//
+// cmd/libfacerec includes this header, so an exported function whose signature drifts from its
+// prototype here fails the build. Change the API only by adding functions; bindings in other
+// languages rely on the existing signatures and struct layouts
+#ifndef GOFR_H
+#define GOFR_H
+
+#include <stdint.h>
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+// GOFR_API_VERSION is raised whenever a function is added
+#define GOFR_API_VERSION 1
+
+// An RGB image, 3 bytes per pixel; stride is the number of bytes per row
+typedef struct {
+    const uint8_t* pixels;
+    int width;
+    int height;
+    int stride;
+} gofr_image;
+
+typedef struct {
+    int top;
+    int right;
+    int bottom;
+    int left;
+} gofr_rect;
+
+typedef struct {
+    gofr_rect location;
+    double encoding[128];
+} gofr_face;
+
+typedef struct {
+    char* id;
+    char* name;
+    double distance;
+} gofr_match;
+
+// Bits of gofr_quality.issues, the checks of the default quality thresholds the face fails
+enum {
+    GOFR_ISSUE_SMALL_FACE   = 1,
+    GOFR_ISSUE_BLURRY       = 2,
+    GOFR_ISSUE_DARK         = 4,
+    GOFR_ISSUE_OVEREXPOSED  = 8,
+    GOFR_ISSUE_LOW_CONTRAST = 16,
+    GOFR_ISSUE_EXTREME_POSE = 32,
+    GOFR_ISSUE_OCCLUDED     = 64
+};
+
+typedef struct {
+    double sharpness;
+    double brightness;
+    double contrast;
+    int face_size;
+    double inter_eye_distance;
+    double pose_deviation; // 0 when the pose could not be estimated
+    int issues;
+} gofr_quality;
+
+typedef uintptr_t gofr_recognizer;
+typedef uintptr_t gofr_gallery;
+
+// Functions that can fail return -1 or a zero handle and set *err, when err is not NULL, to a
+// message released with gofr_free
+
+int gofr_api_version(void);
+
+gofr_recognizer gofr_open(char* model_dir, char** err);
+void gofr_close(gofr_recognizer rec);
+int gofr_detect_encode(gofr_recognizer rec, gofr_image img, int upsample, int jitters, gofr_face** faces, char** err);
+int gofr_assess_quality(gofr_recognizer rec, gofr_image img, gofr_rect location, gofr_quality* quality, char** err);
+double gofr_distance(double* a, double* b);
+
+gofr_gallery gofr_gallery_open(char* path, char** err);
+void gofr_gallery_close(gofr_gallery gallery);
+int gofr_gallery_save(gofr_gallery gallery, char** err);
+int gofr_gallery_add(gofr_gallery gallery, char* name, double* encodings, int count, char** id, char** err);
+int gofr_identify(gofr_gallery gallery, double* encoding, double tolerance, int limit, gofr_match** matches, char** err);
+
+void gofr_free_matches(gofr_match* matches, int count);
+void gofr_free(void* p);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif
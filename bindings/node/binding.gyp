@@ -0,0 +1,10 @@
+{
+  "targets": [
+    {
+      "target_name": "gofr",
+      "sources": ["gofr.c"],
+      "include_dirs": [".."],
+      "libraries": ["-L<(module_root_dir)/../..", "-lfacerec", "-Wl,-rpath,<(module_root_dir)/../.."]
+    }
+  ]
+}
@@ -0,0 +1,287 @@
+// N-API addon exposing libfacerec to Node, see index.js for the JavaScript API built on it
+// Handles cross into JavaScript as BigInts; errors thrown carry the message of the library
+#include <node_api.h>
+#include <stdlib.h>
+#include <string.h>
+
+#include "gofr.h"
+
+#define CHECK(call)                                                        \
+    do {                                                                   \
+        if ((call) != napi_ok) {                                           \
+            napi_throw_error(env, NULL, "gofr: N-API call failed: " #call); \
+            return NULL;                                                   \
+        }                                                                  \
+    } while (0)
+
+// throw_gofr throws the message of a failed library call and releases it
+static napi_value throw_gofr(napi_env env, char* err) {
+    napi_throw_error(env, NULL, err ? err : "gofr: unknown error");
+    if (err) {
+        gofr_free(err);
+    }
+    return NULL;
+}
+
+static int get_args(napi_env env, napi_callback_info info, size_t want, napi_value* args) {
+    size_t argc = want;
+    if (napi_get_cb_info(env, info, &argc, args, NULL, NULL) != napi_ok || argc < want) {
+        napi_throw_type_error(env, NULL, "gofr: missing arguments");
+        return 0;
+    }
+    return 1;
+}
+
+static int get_handle(napi_env env, napi_value v, uintptr_t* out) {
+    uint64_t h;
+    bool lossless;
+    if (napi_get_value_bigint_uint64(env, v, &h, &lossless) != napi_ok) {
+        napi_throw_type_error(env, NULL, "gofr: expected a handle");
+        return 0;
+    }
+    *out = (uintptr_t)h;
+    return 1;
+}
+
+// get_string returns a copy of a JavaScript string, released with free
+static char* get_string(napi_env env, napi_value v) {
+    size_t len;
+    if (napi_get_value_string_utf8(env, v, NULL, 0, &len) != napi_ok) {
+        napi_throw_type_error(env, NULL, "gofr: expected a string");
+        return NULL;
+    }
+    char* s = malloc(len + 1);
+    napi_get_value_string_utf8(env, v, s, len + 1, &len);
+    return s;
+}
+
+// get_doubles returns the contents of a Float64Array
+static int get_doubles(napi_env env, napi_value v, double** data, size_t* length) {
+    napi_typedarray_type type;
+    napi_value buffer;
+    size_t offset;
+    if (napi_get_typedarray_info(env, v, &type, length, (void**)data, &buffer, &offset) != napi_ok || type != napi_float64_array) {
+        napi_throw_type_error(env, NULL, "gofr: expected a Float64Array");
+        return 0;
+    }
+    return 1;
+}
+
+static napi_value encoding_array(napi_env env, const double* encoding) {
+    napi_value buffer, array;
+    void* data;
+    napi_create_arraybuffer(env, 128 * sizeof(double), &data, &buffer);
+    memcpy(data, encoding, 128 * sizeof(double));
+    napi_create_typedarray(env, napi_float64_array, 128, buffer, 0, &array);
+    return array;
+}
+
+static napi_value api_version(napi_env env, napi_callback_info info) {
+    napi_value result;
+    CHECK(napi_create_int32(env, gofr_api_version(), &result));
+    return result;
+}
+
+// open(modelDir) -> handle
+static napi_value open_recognizer(napi_env env, napi_callback_info info) {
+    napi_value args[1], result;
+    if (!get_args(env, info, 1, args)) return NULL;
+    char* dir = get_string(env, args[0]);
+    if (!dir) return NULL;
+
+    char* err = NULL;
+    gofr_recognizer rec = gofr_open(dir, &err);
+    free(dir);
+    if (!rec) return throw_gofr(env, err);
+    CHECK(napi_create_bigint_uint64(env, rec, &result));
+    return result;
+}
+
+// close(handle)
+static napi_value close_recognizer(napi_env env, napi_callback_info info) {
+    napi_value args[1];
+    uintptr_t rec;
+    if (!get_args(env, info, 1, args) || !get_handle(env, args[0], &rec)) return NULL;
+    gofr_close(rec);
+    return NULL;
+}
+
+// detectEncode(handle, width, height, rgb Uint8Array, upsample, jitters) -> [{top, right, bottom, left, encoding}]
+static napi_value detect_encode(napi_env env, napi_callback_info info) {
+    napi_value args[6], result;
+    uintptr_t rec;
+    int32_t width, height, upsample, jitters;
+    napi_typedarray_type type;
+    size_t length, offset;
+    void* pixels;
+    napi_value buffer;
+    if (!get_args(env, info, 6, args) || !get_handle(env, args[0], &rec)) return NULL;
+    CHECK(napi_get_value_int32(env, args[1], &width));
+    CHECK(napi_get_value_int32(env, args[2], &height));
+    if (napi_get_typedarray_info(env, args[3], &type, &length, &pixels, &buffer, &offset) != napi_ok || type != napi_uint8_array) {
+        napi_throw_type_error(env, NULL, "gofr: expected the pixels as a Uint8Array");
+        return NULL;
+    }
+    if (length < (size_t)width * height * 3) {
+        napi_throw_range_error(env, NULL, "gofr: too few pixels for the image size");
+        return NULL;
+    }
+    CHECK(napi_get_value_int32(env, args[4], &upsample));
+    CHECK(napi_get_value_int32(env, args[5], &jitters));
+
+    gofr_image img = {pixels, width, height, width * 3};
+    gofr_face* faces = NULL;
+    char* err = NULL;
+    int n = gofr_detect_encode(rec, img, upsample, jitters, &faces, &err);
+    if (n < 0) return throw_gofr(env, err);
+
+    CHECK(napi_create_array_with_length(env, n, &result));
+    for (int i = 0; i < n; i++) {
+        napi_value face, v;
+        napi_create_object(env, &face);
+        napi_create_int32(env, faces[i].location.top, &v);
+        napi_set_named_property(env, face, "top", v);
+        napi_create_int32(env, faces[i].location.right, &v);
+        napi_set_named_property(env, face, "right", v);
+        napi_create_int32(env, faces[i].location.bottom, &v);
+        napi_set_named_property(env, face, "bottom", v);
+        napi_create_int32(env, faces[i].location.left, &v);
+        napi_set_named_property(env, face, "left", v);
+        napi_set_named_property(env, face, "encoding", encoding_array(env, faces[i].encoding));
+        napi_set_element(env, result, i, face);
+    }
+    gofr_free(faces);
+    return result;
+}
+
+// distance(a Float64Array, b Float64Array) -> number
+static napi_value distance(napi_env env, napi_callback_info info) {
+    napi_value args[2], result;
+    double *a, *b;
+    size_t la, lb;
+    if (!get_args(env, info, 2, args) || !get_doubles(env, args[0], &a, &la) || !get_doubles(env, args[1], &b, &lb)) return NULL;
+    if (la != 128 || lb != 128) {
+        napi_throw_range_error(env, NULL, "gofr: an encoding has 128 values");
+        return NULL;
+    }
+    CHECK(napi_create_double(env, gofr_distance(a, b), &result));
+    return result;
+}
+
+// galleryOpen(path) -> handle
+static napi_value gallery_open(napi_env env, napi_callback_info info) {
+    napi_value args[1], result;
+    if (!get_args(env, info, 1, args)) return NULL;
+    char* path = get_string(env, args[0]);
+    if (!path) return NULL;
+
+    char* err = NULL;
+    gofr_gallery g = gofr_gallery_open(path, &err);
+    free(path);
+    if (!g) return throw_gofr(env, err);
+    CHECK(napi_create_bigint_uint64(env, g, &result));
+    return result;
+}
+
+// galleryClose(handle)
+static napi_value gallery_close(napi_env env, napi_callback_info info) {
+    napi_value args[1];
+    uintptr_t g;
+    if (!get_args(env, info, 1, args) || !get_handle(env, args[0], &g)) return NULL;
+    gofr_gallery_close(g);
+    return NULL;
+}
+
+// gallerySave(handle)
+static napi_value gallery_save(napi_env env, napi_callback_info info) {
+    napi_value args[1];
+    uintptr_t g;
+    if (!get_args(env, info, 1, args) || !get_handle(env, args[0], &g)) return NULL;
+    char* err = NULL;
+    if (gofr_gallery_save(g, &err) < 0) return throw_gofr(env, err);
+    return NULL;
+}
+
+// galleryAdd(handle, name, encodings Float64Array of 128 values per encoding) -> id
+static napi_value gallery_add(napi_env env, napi_callback_info info) {
+    napi_value args[3], result;
+    uintptr_t g;
+    double* encodings;
+    size_t length;
+    if (!get_args(env, info, 3, args) || !get_handle(env, args[0], &g)) return NULL;
+    if (!get_doubles(env, args[2], &encodings, &length)) return NULL;
+    if (length % 128 != 0) {
+        napi_throw_range_error(env, NULL, "gofr: encodings must hold 128 values each");
+        return NULL;
+    }
+    char* name = get_string(env, args[1]);
+    if (!name) return NULL;
+
+    char* id = NULL;
+    char* err = NULL;
+    int rc = gofr_gallery_add(g, name, encodings, (int)(length / 128), &id, &err);
+    free(name);
+    if (rc < 0) return throw_gofr(env, err);
+    napi_status status = napi_create_string_utf8(env, id, NAPI_AUTO_LENGTH, &result);
+    gofr_free(id);
+    CHECK(status);
+    return result;
+}
+
+// identify(handle, encoding Float64Array, tolerance, limit) -> [{id, name, distance}]
+static napi_value identify(napi_env env, napi_callback_info info) {
+    napi_value args[4], result;
+    uintptr_t g;
+    double* encoding;
+    size_t length;
+    double tolerance;
+    int32_t limit;
+    if (!get_args(env, info, 4, args) || !get_handle(env, args[0], &g) || !get_doubles(env, args[1], &encoding, &length)) return NULL;
+    if (length != 128) {
+        napi_throw_range_error(env, NULL, "gofr: an encoding has 128 values");
+        return NULL;
+    }
+    CHECK(napi_get_value_double(env, args[2], &tolerance));
+    CHECK(napi_get_value_int32(env, args[3], &limit));
+
+    gofr_match* matches = NULL;
+    char* err = NULL;
+    int n = gofr_identify(g, encoding, tolerance, limit, &matches, &err);
+    if (n < 0) return throw_gofr(env, err);
+
+    CHECK(napi_create_array_with_length(env, n, &result));
+    for (int i = 0; i < n; i++) {
+        napi_value match, v;
+        napi_create_object(env, &match);
+        napi_create_string_utf8(env, matches[i].id, NAPI_AUTO_LENGTH, &v);
+        napi_set_named_property(env, match, "id", v);
+        napi_create_string_utf8(env, matches[i].name, NAPI_AUTO_LENGTH, &v);
+        napi_set_named_property(env, match, "name", v);
+        napi_create_double(env, matches[i].distance, &v);
+        napi_set_named_property(env, match, "distance", v);
+        napi_set_element(env, result, i, match);
+    }
+    gofr_free_matches(matches, n);
+    return result;
+}
+
+static napi_value init(napi_env env, napi_value exports) {
+    napi_property_descriptor props[] = {
+        {"apiVersion", NULL, api_version, NULL, NULL, NULL, napi_default, NULL},
+        {"open", NULL, open_recognizer, NULL, NULL, NULL, napi_default, NULL},
+        {"close", NULL, close_recognizer, NULL, NULL, NULL, napi_default, NULL},
+        {"detectEncode", NULL, detect_encode, NULL, NULL, NULL, napi_default, NULL},
+        {"distance", NULL, distance, NULL, NULL, NULL, napi_default, NULL},
+        {"galleryOpen", NULL, gallery_open, NULL, NULL, NULL, napi_default, NULL},
+        {"galleryClose", NULL, gallery_close, NULL, NULL, NULL, napi_default, NULL},
+        {"gallerySave", NULL, gallery_save, NULL, NULL, NULL, napi_default, NULL},
+        {"galleryAdd", NULL, gallery_add, NULL, NULL, NULL, napi_default, NULL},
+        {"identify", NULL, identify, NULL, NULL, NULL, napi_default, NULL},
+    };
+    if (napi_define_properties(env, exports, sizeof(props) / sizeof(props[0]), props) != napi_ok) {
+        return NULL;
+    }
+    return exports;
+}
+
+NAPI_MODULE(NODE_GYP_MODULE_NAME, init)
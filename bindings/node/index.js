@@ -0,0 +1,92 @@
+// Node bindings of libfacerec, see ../gofr.h for the C API they wrap
+//
+//   const gofr = require('gofr');
+//   const rec = new gofr.Recognizer();
+//   const gallery = new gofr.Gallery('faces.json');
+//   for (const face of rec.detectEncode(width, height, rgbPixels)) {
+//     console.log(gallery.identify(face.encoding));
+//   }
+//
+// The addon links against libfacerec.so built in the repository root with
+//   go build -buildmode=c-shared -o libfacerec.so ./cmd/libfacerec
+'use strict';
+
+const native = require('./build/Release/gofr.node');
+
+const API_VERSION = 1;
+if (native.apiVersion() < API_VERSION) {
+  throw new Error(`libfacerec has API version ${native.apiVersion()}, these bindings need ${API_VERSION}`);
+}
+
+const ISSUES = {
+  SMALL_FACE: 1,
+  BLURRY: 2,
+  DARK: 4,
+  OVEREXPOSED: 8,
+  LOW_CONTRAST: 16,
+  EXTREME_POSE: 32,
+  OCCLUDED: 64,
+};
+
+function toEncoding(values) {
+  const e = values instanceof Float64Array ? values : Float64Array.from(values);
+  if (e.length !== 128) {
+    throw new RangeError(`an encoding has 128 values, got ${e.length}`);
+  }
+  return e;
+}
+
+// Recognizer holds models loaded from modelDir, or the package models directory
+class Recognizer {
+  constructor(modelDir = '') {
+    this.handle = native.open(modelDir);
+  }
+
+  // detectEncode returns the faces of an RGB image as {top, right, bottom, left, encoding}
+  detectEncode(width, height, rgb, { upsample = 1, jitters = 1 } = {}) {
+    return native.detectEncode(this.handle, width, height, rgb, upsample, jitters);
+  }
+
+  close() {
+    if (this.handle) {
+      native.close(this.handle);
+      this.handle = 0n;
+    }
+  }
+}
+
+// Gallery holds people and their encodings, saved as JSON at path
+class Gallery {
+  constructor(path) {
+    this.handle = native.galleryOpen(path);
+  }
+
+  // add stores a person with one or more encodings and returns the new ID
+  add(name, encodings) {
+    const flat = new Float64Array(128 * encodings.length);
+    encodings.forEach((e, i) => flat.set(toEncoding(e), i * 128));
+    return native.galleryAdd(this.handle, name, flat);
+  }
+
+  // identify returns the people within tolerance of encoding as {id, name, distance}, closest first
+  identify(encoding, { tolerance = 0.6, limit = 5 } = {}) {
+    return native.identify(this.handle, toEncoding(encoding), tolerance, limit);
+  }
+
+  save() {
+    native.gallerySave(this.handle);
+  }
+
+  close() {
+    if (this.handle) {
+      native.galleryClose(this.handle);
+      this.handle = 0n;
+    }
+  }
+}
+
+function distance(a, b) {
+  return native.distance(toEncoding(a), toEncoding(b));
+}
+
+module.exports = { Recognizer, Gallery, distance, ISSUES, API_VERSION };
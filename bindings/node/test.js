@@ -0,0 +1,57 @@
+// Smoke tests of the Node bindings against a built libfacerec; they need no models
+//
+//   go build -buildmode=c-shared -o libfacerec.so ./cmd/libfacerec
+//   cd bindings/node && npm install && npm test
+'use strict';
+
+const assert = require('node:assert');
+const fs = require('node:fs');
+const os = require('node:os');
+const path = require('node:path');
+const test = require('node:test');
+
+const gofr = require('./index.js');
+
+function encoding(value) {
+  const e = new Float64Array(128);
+  e[0] = value;
+  return e;
+}
+
+test('distance', () => {
+  assert.ok(Math.abs(gofr.distance(encoding(0.3), encoding(0)) - 0.3) < 1e-9);
+  assert.throws(() => gofr.distance([1, 2], encoding(0)), RangeError);
+});
+
+test('gallery roundtrip', () => {
+  const dir = fs.mkdtempSync(path.join(os.tmpdir(), 'gofr-'));
+  const file = path.join(dir, 'faces.json');
+  try {
+    let gallery = new gofr.Gallery(file);
+    const alice = gallery.add('alice', [encoding(0), encoding(0.1)]);
+    gallery.add('bob', [encoding(0.5)]);
+    gallery.save();
+    gallery.close();
+
+    gallery = new gofr.Gallery(file);
+    const matches = gallery.identify(encoding(0.05), { tolerance: 0.3 });
+    assert.deepStrictEqual(matches.map((m) => [m.id, m.name]), [[alice, 'alice']]);
+    assert.ok(Math.abs(matches[0].distance - 0.05) < 1e-9);
+    assert.deepStrictEqual(gallery.identify(encoding(0.9), { tolerance: 0.1 }), []);
+    gallery.close();
+  } finally {
+    fs.rmSync(dir, { recursive: true, force: true });
+  }
+});
+
+test('errors', () => {
+  const dir = fs.mkdtempSync(path.join(os.tmpdir(), 'gofr-'));
+  try {
+    assert.throws(() => new gofr.Recognizer(dir));
+    const gallery = new gofr.Gallery(path.join(dir, 'faces.json'));
+    assert.throws(() => gallery.add('nobody', []));
+    gallery.close();
+  } finally {
+    fs.rmSync(dir, { recursive: true, force: true });
+  }
+});
@@ -0,0 +1,228 @@
+"""ctypes bindings of libfacerec, see bindings/gofr.h for the C API they wrap.
+
+    import gofr
+    with gofr.Recognizer() as rec, gofr.Gallery("faces.json") as gallery:
+        for location, encoding in rec.detect_encode(width, height, rgb_bytes):
+            for person_id, name, distance in gallery.identify(encoding):
+                print(name, distance)
+
+The library is loaded from $GOFR_LIBRARY, or libfacerec.so (.dylib, .dll) on the loader path.
+"""
+
+import ctypes
+import os
+import sys
+
+API_VERSION = 1
+
+ISSUE_SMALL_FACE = 1
+ISSUE_BLURRY = 2
+ISSUE_DARK = 4
+ISSUE_OVEREXPOSED = 8
+ISSUE_LOW_CONTRAST = 16
+ISSUE_EXTREME_POSE = 32
+ISSUE_OCCLUDED = 64
+
+
+class Image(ctypes.Structure):
+    _fields_ = [
+        ("pixels", ctypes.POINTER(ctypes.c_uint8)),
+        ("width", ctypes.c_int),
+        ("height", ctypes.c_int),
+        ("stride", ctypes.c_int),
+    ]
+
+
+class Rect(ctypes.Structure):
+    _fields_ = [
+        ("top", ctypes.c_int),
+        ("right", ctypes.c_int),
+        ("bottom", ctypes.c_int),
+        ("left", ctypes.c_int),
+    ]
+
+
+class Face(ctypes.Structure):
+    _fields_ = [("location", Rect), ("encoding", ctypes.c_double * 128)]
+
+
+class Match(ctypes.Structure):
+    _fields_ = [
+        ("id", ctypes.c_void_p),
+        ("name", ctypes.c_void_p),
+        ("distance", ctypes.c_double),
+    ]
+
+
+class Quality(ctypes.Structure):
+    _fields_ = [
+        ("sharpness", ctypes.c_double),
+        ("brightness", ctypes.c_double),
+        ("contrast", ctypes.c_double),
+        ("face_size", ctypes.c_int),
+        ("inter_eye_distance", ctypes.c_double),
+        ("pose_deviation", ctypes.c_double),
+        ("issues", ctypes.c_int),
+    ]
+
+
+Encoding = ctypes.c_double * 128
+_handle = ctypes.c_size_t  # uintptr_t
+_err = ctypes.POINTER(ctypes.c_void_p)
+
+
+def _load():
+    path = os.environ.get("GOFR_LIBRARY")
+    if not path:
+        path = {"darwin": "libfacerec.dylib", "win32": "libfacerec.dll"}.get(sys.platform, "libfacerec.so")
+    lib = ctypes.CDLL(path)
+
+    signatures = {
+        "gofr_api_version": (ctypes.c_int, []),
+        "gofr_open": (_handle, [ctypes.c_char_p, _err]),
+        "gofr_close": (None, [_handle]),
+        "gofr_detect_encode": (ctypes.c_int, [_handle, Image, ctypes.c_int, ctypes.c_int, ctypes.POINTER(ctypes.POINTER(Face)), _err]),
+        "gofr_assess_quality": (ctypes.c_int, [_handle, Image, Rect, ctypes.POINTER(Quality), _err]),
+        "gofr_distance": (ctypes.c_double, [ctypes.POINTER(ctypes.c_double), ctypes.POINTER(ctypes.c_double)]),
+        "gofr_gallery_open": (_handle, [ctypes.c_char_p, _err]),
+        "gofr_gallery_close": (None, [_handle]),
+        "gofr_gallery_save": (ctypes.c_int, [_handle, _err]),
+        "gofr_gallery_add": (ctypes.c_int, [_handle, ctypes.c_char_p, ctypes.POINTER(ctypes.c_double), ctypes.c_int, _err, _err]),
+        "gofr_identify": (ctypes.c_int, [_handle, ctypes.POINTER(ctypes.c_double), ctypes.c_double, ctypes.c_int, ctypes.POINTER(ctypes.POINTER(Match)), _err]),
+        "gofr_free_matches": (None, [ctypes.POINTER(Match), ctypes.c_int]),
+        "gofr_free": (None, [ctypes.c_void_p]),
+    }
+    for name, (restype, argtypes) in signatures.items():
+        fn = getattr(lib, name)
+        fn.restype, fn.argtypes = restype, argtypes
+
+    version = lib.gofr_api_version()
+    if version < API_VERSION:
+        raise ImportError(f"{path} has API version {version}, these bindings need {API_VERSION}")
+    return lib
+
+
+_lib = _load()
+
+
+class Error(Exception):
+    pass
+
+
+def _take_string(p):
+    """Copy and free a string allocated by the library."""
+    if not p:
+        return ""
+    try:
+        return ctypes.string_at(p).decode()
+    finally:
+        _lib.gofr_free(p)
+
+
+def _check(result, err):
+    if result == -1:
+        raise Error(_take_string(err.value))
+    return result
+
+
+def _encoding(values):
+    if len(values) != 128:
+        raise ValueError(f"an encoding has 128 values, got {len(values)}")
+    return Encoding(*values)
+
+
+def _image(width, height, rgb, stride=0):
+    stride = stride or width * 3
+    if len(rgb) < stride * height:
+        raise ValueError(f"{len(rgb)} bytes are too few for a {width}x{height} image with stride {stride}")
+    buf = (ctypes.c_uint8 * len(rgb)).from_buffer_copy(rgb)
+    return Image(ctypes.cast(buf, ctypes.POINTER(ctypes.c_uint8)), width, height, stride), buf
+
+
+def distance(a, b):
+    """Euclidean distance between two encodings."""
+    return _lib.gofr_distance(_encoding(a), _encoding(b))
+
+
+class Recognizer:
+    """Models loaded from model_dir, or the package models directory."""
+
+    def __init__(self, model_dir=None):
+        err = ctypes.c_void_p()
+        self._h = _lib.gofr_open(model_dir.encode() if model_dir else None, ctypes.byref(err))
+        if not self._h:
+            raise Error(_take_string(err.value))
+
+    def detect_encode(self, width, height, rgb, upsample=1, jitters=1, stride=0):
+        """Faces of an RGB image as (location, encoding) pairs."""
+        img, _keep = _image(width, height, rgb, stride)
+        faces = ctypes.POINTER(Face)()
+        err = ctypes.c_void_p()
+        n = _check(_lib.gofr_detect_encode(self._h, img, upsample, jitters, ctypes.byref(faces), ctypes.byref(err)), err)
+        try:
+            return [(faces[i].location, list(faces[i].encoding)) for i in range(n)]
+        finally:
+            _lib.gofr_free(faces)
+
+    def assess_quality(self, width, height, rgb, location, stride=0):
+        img, _keep = _image(width, height, rgb, stride)
+        quality = Quality()
+        err = ctypes.c_void_p()
+        _check(_lib.gofr_assess_quality(self._h, img, location, ctypes.byref(quality), ctypes.byref(err)), err)
+        return quality
+
+    def close(self):
+        if self._h:
+            _lib.gofr_close(self._h)
+            self._h = 0
+
+    def __enter__(self):
+        return self
+
+    def __exit__(self, *exc):
+        self.close()
+
+
+class Gallery:
+    """People and their encodings, saved as JSON at path."""
+
+    def __init__(self, path):
+        err = ctypes.c_void_p()
+        self._h = _lib.gofr_gallery_open(path.encode(), ctypes.byref(err))
+        if not self._h:
+            raise Error(_take_string(err.value))
+
+    def add(self, name, encodings):
+        """Add a person and return the new ID."""
+        flat = (ctypes.c_double * (128 * len(encodings)))()
+        for i, e in enumerate(encodings):
+            flat[i * 128:(i + 1) * 128] = list(_encoding(e))
+        person_id = ctypes.c_void_p()
+        err = ctypes.c_void_p()
+        _check(_lib.gofr_gallery_add(self._h, name.encode(), flat, len(encodings), ctypes.byref(person_id), ctypes.byref(err)), err)
+        return _take_string(person_id.value)
+
+    def identify(self, encoding, tolerance=0.6, limit=5):
+        """People within tolerance of encoding, closest first, as (id, name, distance) tuples."""
+        matches = ctypes.POINTER(Match)()
+        err = ctypes.c_void_p()
+        n = _check(_lib.gofr_identify(self._h, _encoding(encoding), tolerance, limit, ctypes.byref(matches), ctypes.byref(err)), err)
+        try:
+            return [(ctypes.string_at(matches[i].id).decode(), ctypes.string_at(matches[i].name).decode(), matches[i].distance) for i in range(n)]
+        finally:
+            _lib.gofr_free_matches(matches, n)
+
+    def save(self):
+        err = ctypes.c_void_p()
+        _check(_lib.gofr_gallery_save(self._h, ctypes.byref(err)), err)
+
+    def close(self):
+        if self._h:
+            _lib.gofr_gallery_close(self._h)
+            self._h = 0
+
+    def __enter__(self):
+        return self
+
+    def __exit__(self, *exc):
+        self.close()
@@ -0,0 +1,46 @@
+"""Smoke tests of the Python bindings against a built libfacerec; they need no models.
+
+    go build -buildmode=c-shared -o libfacerec.so ./cmd/libfacerec
+    GOFR_LIBRARY=$PWD/libfacerec.so python3 -m unittest discover bindings/python
+"""
+
+import os
+import tempfile
+import unittest
+
+import gofr
+
+
+def encoding(value):
+    return [value] + [0.0] * 127
+
+
+class BindingsTest(unittest.TestCase):
+    def test_distance(self):
+        self.assertAlmostEqual(gofr.distance(encoding(0.3), encoding(0.0)), 0.3)
+
+    def test_gallery_roundtrip(self):
+        with tempfile.TemporaryDirectory() as tmp:
+            path = os.path.join(tmp, "faces.json")
+            with gofr.Gallery(path) as gallery:
+                alice = gallery.add("alice", [encoding(0.0), encoding(0.1)])
+                gallery.add("bob", [encoding(0.5)])
+                gallery.save()
+
+            with gofr.Gallery(path) as gallery:
+                matches = gallery.identify(encoding(0.05), tolerance=0.3)
+                self.assertEqual([(m[0], m[1]) for m in matches], [(alice, "alice")])
+                self.assertAlmostEqual(matches[0][2], 0.05)
+                self.assertEqual(gallery.identify(encoding(0.9), tolerance=0.1), [])
+
+    def test_errors(self):
+        with tempfile.TemporaryDirectory() as tmp:
+            with self.assertRaises(gofr.Error):
+                gofr.Recognizer(tmp)
+        with gofr.Gallery(os.path.join(tempfile.gettempdir(), "unused.json")) as gallery:
+            with self.assertRaises(gofr.Error):
+                gallery.add("nobody", [])
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,97 @@
+package gofacerecognition
+
+// EyeAspectRatio returns the mean eye aspect ratio (EAR) of both eyes
+// EAR is the ratio of eye height to width; it stays around 0.25 to 0.35 while the eye is open and drops
+// towards 0 when it closes. Returns 0 when the landmarks are incomplete
+func EyeAspectRatio(landmarks FaceLandmarks) float64 {
+	if len(landmarks.LeftEye) < 6 || len(landmarks.RightEye) < 6 {
+		return 0
+	}
+	return (eyeAspectRatio(landmarks.LeftEye) + eyeAspectRatio(landmarks.RightEye)) / 2
+}
+
+// eyeAspectRatio is the ratio of eye height to width for the 6 points of one eye
+func eyeAspectRatio(eye []Point) float64 {
+	width := pointDistance(eye[0], eye[3])
+	if width == 0 {
+		return 0
+	}
+	return (pointDistance(eye[1], eye[5]) + pointDistance(eye[2], eye[4])) / (2 * width)
+}
+
+// BlinkConfig configures a BlinkDetector
+type BlinkConfig struct {
+	ClosedThreshold float64 // EAR below which the eyes count as closed (default 0.21)
+	MinClosedFrames int     // consecutive closed frames needed for a blink (default 2)
+	// MaxClosedFrames is the longest closure still counted as a blink (default 15, half a second at 30fps)
+	// Longer closures are eyes kept shut, which a photo with closed eyes could also produce
+	MaxClosedFrames int
+}
+
+// BlinkDetector counts blinks over a sequence of frames of one face
+// A blink is the eyes closing for a short run of frames and opening again; a static photo never blinks,
+// which makes the blink count a basic passive liveness signal
+type BlinkDetector struct {
+	config  BlinkConfig
+	closed  int // consecutive closed frames so far
+	blinks  int
+	frames  int
+	lastEAR float64
+}
+
+// NewBlinkDetector creates a BlinkDetector
+func NewBlinkDetector(config BlinkConfig) *BlinkDetector {
+	if config.ClosedThreshold <= 0 {
+		config.ClosedThreshold = 0.21
+	}
+	if config.MinClosedFrames <= 0 {
+		config.MinClosedFrames = 2
+	}
+	if config.MaxClosedFrames <= 0 {
+		config.MaxClosedFrames = 15
+	}
+	return &BlinkDetector{config: config}
+}
+
+// AddFrame feeds the landmarks of the next frame and reports whether a blink ended on it
+// Frames with incomplete landmarks are ignored
+func (d *BlinkDetector) AddFrame(landmarks FaceLandmarks) bool {
+	ear := EyeAspectRatio(landmarks)
+	if ear == 0 {
+		return false
+	}
+	d.frames++
+	d.lastEAR = ear
+
+	if ear < d.config.ClosedThreshold {
+		d.closed++
+		return false
+	}
+
+	blinked := d.closed >= d.config.MinClosedFrames && d.closed <= d.config.MaxClosedFrames
+	d.closed = 0
+	if blinked {
+		d.blinks++
+	}
+	return blinked
+}
+
+// Blinks returns the number of blinks seen so far
+func (d *BlinkDetector) Blinks() int {
+	return d.blinks
+}
+
+// Frames returns the number of frames with usable landmarks seen so far
+func (d *BlinkDetector) Frames() int {
+	return d.frames
+}
+
+// LastEAR returns the eye aspect ratio of the latest usable frame
+func (d *BlinkDetector) LastEAR() float64 {
+	return d.lastEAR
+}
+
+// Reset clears the blink count and state, e.g. when tracking a different face
+func (d *BlinkDetector) Reset() {
+	*d = BlinkDetector{config: d.config}
+}
@@ -0,0 +1,30 @@
+package gofacerecognition
+
+// BlurScore returns the variance of the Laplacian of rect, higher is sharper; an empty rect scores
+// the whole image. The region is scaled to 64x64 first, so scores of faces of different sizes compare
+// and a threshold such as 25 works at any resolution
+// Out-of-focus and motion-blurred captures score low, as do featureless regions such as a blank wall
+func BlurScore(img *ImageMatrix, rect Rectangle) float64 {
+	if rect.Area() == 0 {
+		rect = Rectangle{Right: img.Width, Bottom: img.Height}
+	}
+	gray, _ := grayFaceCrop(img, rect, textureSize)
+	return laplacianVariance(gray, textureSize)
+}
+
+// laplacianVariance returns the variance of the 4-neighbour Laplacian of a size x size gray image
+func laplacianVariance(gray []byte, size int) float64 {
+	var sum, sq float64
+	n := 0
+	for y := 1; y < size-1; y++ {
+		for x := 1; x < size-1; x++ {
+			lap := 4*float64(gray[y*size+x]) - float64(gray[(y-1)*size+x]) - float64(gray[(y+1)*size+x]) -
+				float64(gray[y*size+x-1]) - float64(gray[y*size+x+1])
+			sum += lap
+			sq += lap * lap
+			n++
+		}
+	}
+	mean := sum / float64(n)
+	return sq/float64(n) - mean*mean
+}
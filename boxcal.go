@@ -0,0 +1,148 @@
+package gofacerecognition
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+)
+
+// BoxCalibration maps the boxes of one detector onto the framing of another: the center moves by
+// ShiftX box widths and ShiftY box heights, then the box is scaled by ScaleX and ScaleY around it
+//
+// The offset between MMOD and HOG boxes depends on the images, so no fixed calibration ships with the
+// package. Config.MeasureCNNBoxCalibration has the recognizer measure one on the first images it runs
+// the CNN detector on; FaceRecognizer.CNNBoxCalibration returns it for Config.CNNBoxCalibration.
+// To fit one offline, run both detectors on a sample of your own images, pair their boxes with
+// PairBoxes and pass the pairs to CalibrateBoxes
+//
+//	for _, img := range samples {
+//		cnn, _ := fr.FaceLocations(img, 1, gofacerecognition.CNN)
+//		hog, _ := fr.FaceLocations(img, 1, gofacerecognition.HOG)
+//		f, t := gofacerecognition.PairBoxes(cnn, hog, 0.3)
+//		from, to = append(from, f...), append(to, t...)
+//	}
+//	cal, err := gofacerecognition.CalibrateBoxes(from, to)
+type BoxCalibration struct {
+	ScaleX float64 `json:"scale_x"`
+	ScaleY float64 `json:"scale_y"`
+	ShiftX float64 `json:"shift_x"`
+	ShiftY float64 `json:"shift_y"`
+}
+
+// Apply returns r mapped by the calibration
+func (c BoxCalibration) Apply(r Rectangle) Rectangle {
+	w, h := float64(r.Width()), float64(r.Height())
+	cx := float64(r.Left+r.Right)/2 + c.ShiftX*w
+	cy := float64(r.Top+r.Bottom)/2 + c.ShiftY*h
+	hw, hh := w*c.ScaleX/2, h*c.ScaleY/2
+	return Rectangle{
+		Top:    int(math.Round(cy - hh)),
+		Right:  int(math.Round(cx + hw)),
+		Bottom: int(math.Round(cy + hh)),
+		Left:   int(math.Round(cx - hw)),
+	}
+}
+
+// PairBoxes pairs each box of from with the box of to it overlaps most, best overlaps first, and
+// returns the pairs as two slices of equal length; boxes overlapping less than minIoU stay unpaired
+func PairBoxes(from, to []Rectangle, minIoU float64) ([]Rectangle, []Rectangle) {
+	type pair struct {
+		i, j int
+		iou  float64
+	}
+	var pairs []pair
+	for i := range from {
+		for j := range to {
+			if iou := from[i].IoU(to[j]); iou >= minIoU && iou > 0 {
+				pairs = append(pairs, pair{i, j, iou})
+			}
+		}
+	}
+	slices.SortStableFunc(pairs, func(a, b pair) int { return cmp.Compare(b.iou, a.iou) })
+
+	usedFrom, usedTo := make([]bool, len(from)), make([]bool, len(to))
+	var pairedFrom, pairedTo []Rectangle
+	for _, p := range pairs {
+		if usedFrom[p.i] || usedTo[p.j] {
+			continue
+		}
+		usedFrom[p.i], usedTo[p.j] = true, true
+		pairedFrom = append(pairedFrom, from[p.i])
+		pairedTo = append(pairedTo, to[p.j])
+	}
+	return pairedFrom, pairedTo
+}
+
+// CalibrateBoxes fits the calibration mapping each of from onto the box of to at the same index,
+// e.g. CNN and HOG detections of the same faces paired by PairBoxes
+// Medians over the pairs keep a few mismatched pairs from skewing the result
+func CalibrateBoxes(from, to []Rectangle) (BoxCalibration, error) {
+	if len(from) != len(to) {
+		return BoxCalibration{}, fmt.Errorf("calibration needs pairs of boxes, got %d and %d", len(from), len(to))
+	}
+
+	var sx, sy, dx, dy []float64
+	for i := range from {
+		fw, fh := float64(from[i].Width()), float64(from[i].Height())
+		if fw <= 0 || fh <= 0 || to[i].Width() <= 0 || to[i].Height() <= 0 {
+			continue
+		}
+		sx = append(sx, float64(to[i].Width())/fw)
+		sy = append(sy, float64(to[i].Height())/fh)
+		dx = append(dx, float64(to[i].Left+to[i].Right-from[i].Left-from[i].Right)/2/fw)
+		dy = append(dy, float64(to[i].Top+to[i].Bottom-from[i].Top-from[i].Bottom)/2/fh)
+	}
+	if len(sx) == 0 {
+		return BoxCalibration{}, fmt.Errorf("calibration needs at least one pair of non-empty boxes")
+	}
+	return BoxCalibration{ScaleX: medianFloat(sx), ScaleY: medianFloat(sy), ShiftX: medianFloat(dx), ShiftY: medianFloat(dy)}, nil
+}
+
+// boxMeasurementIoU is the overlap a CNN and a HOG box need to count as the same face while measuring
+const boxMeasurementIoU = 0.3
+
+// boxMeasurement collects CNN and HOG boxes of the same faces until it can fit a BoxCalibration
+type boxMeasurement struct {
+	want int // faces to pair before fitting
+
+	mu       sync.Mutex
+	from, to []Rectangle
+	done     bool
+}
+
+// pending reports whether the measurement still needs faces
+func (m *boxMeasurement) pending() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !m.done
+}
+
+// add pairs the CNN and HOG boxes of one image and returns the calibration once want faces are
+// paired; it returns nil before that and after, so the calibration is returned once
+func (m *boxMeasurement) add(cnn, hog []Rectangle) *BoxCalibration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.done {
+		return nil
+	}
+
+	from, to := PairBoxes(cnn, hog, boxMeasurementIoU)
+	m.from, m.to = append(m.from, from...), append(m.to, to...)
+	if len(m.from) < m.want {
+		return nil
+	}
+	cal, err := CalibrateBoxes(m.from, m.to)
+	if err != nil {
+		return nil
+	}
+	m.done, m.from, m.to = true, nil, nil
+	return &cal
+}
+
+func medianFloat(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	return sorted[len(sorted)/2]
+}
@@ -0,0 +1,65 @@
+package gofacerecognition
+
+import "testing"
+
+func TestPairBoxes(t *testing.T) {
+	from := []Rectangle{
+		{Top: 10, Right: 110, Bottom: 110, Left: 10},
+		{Top: 300, Right: 400, Bottom: 400, Left: 300},
+		{Top: 600, Right: 700, Bottom: 700, Left: 600}, // no counterpart
+	}
+	to := []Rectangle{
+		{Top: 305, Right: 410, Bottom: 410, Left: 295},
+		{Top: 5, Right: 115, Bottom: 120, Left: 5},
+	}
+
+	pairedFrom, pairedTo := PairBoxes(from, to, 0.3)
+	if len(pairedFrom) != 2 || len(pairedTo) != 2 {
+		t.Fatalf("got %d and %d boxes, want 2 pairs", len(pairedFrom), len(pairedTo))
+	}
+	for i := range pairedFrom {
+		if pairedFrom[i].IoU(pairedTo[i]) < 0.3 {
+			t.Errorf("pair %d: %v and %v do not overlap", i, pairedFrom[i], pairedTo[i])
+		}
+	}
+
+	cal, err := CalibrateBoxes(pairedFrom, pairedTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(cal.ScaleX > 1) || !(cal.ScaleY > 1) {
+		t.Errorf("calibration %+v does not enlarge the boxes", cal)
+	}
+}
+
+func TestPairBoxesTakesBestOverlapFirst(t *testing.T) {
+	from := []Rectangle{{Top: 0, Right: 100, Bottom: 100, Left: 0}}
+	to := []Rectangle{
+		{Top: 40, Right: 140, Bottom: 140, Left: 40},
+		{Top: 2, Right: 102, Bottom: 102, Left: 2},
+	}
+	_, pairedTo := PairBoxes(from, to, 0.1)
+	if len(pairedTo) != 1 || pairedTo[0] != to[1] {
+		t.Fatalf("paired with %v, want %v", pairedTo, to[1])
+	}
+}
+
+func TestBoxMeasurement(t *testing.T) {
+	m := &boxMeasurement{want: 2}
+	cnn := []Rectangle{{Top: 20, Right: 120, Bottom: 120, Left: 20}}
+	hog := []Rectangle{{Top: 10, Right: 130, Bottom: 130, Left: 10}}
+
+	if cal := m.add(cnn, hog); cal != nil {
+		t.Fatalf("got a calibration after 1 of 2 faces: %+v", *cal)
+	}
+	cal := m.add(cnn, hog)
+	if cal == nil {
+		t.Fatal("no calibration after 2 faces")
+	}
+	if cal.ScaleX != 1.2 || cal.ScaleY != 1.2 || cal.ShiftX != 0 || cal.ShiftY != 0 {
+		t.Fatalf("got %+v, want scales 1.2 and no shift", *cal)
+	}
+	if m.pending() || m.add(cnn, hog) != nil {
+		t.Fatal("measurement still pending after fitting")
+	}
+}
@@ -0,0 +1,163 @@
+package gofacerecognition
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultQualityLevels is the quality ladder of a LatencyBudget without Levels, cheapest first
+// It only uses HOG; add CNN levels at the top when the CNN model is loaded and a GPU is available
+var DefaultQualityLevels = []RequestOptions{
+	{Model: HOG, UpsampleTimes: 0, NumJitters: 1},
+	{Model: HOG, UpsampleTimes: 1, NumJitters: 1},
+	{Model: HOG, UpsampleTimes: 1, NumJitters: 5},
+	{Model: HOG, UpsampleTimes: 2, NumJitters: 5},
+}
+
+// LatencyBudget configures AdaptiveQuality; zero fields other than Target take the defaults
+type LatencyBudget struct {
+	Target time.Duration // detection and encoding time allowed per frame, e.g. 80ms; required
+	// Levels are the settings to choose from, ordered from the cheapest to the most expensive; only
+	// Model, UpsampleTimes and NumJitters are used (default DefaultQualityLevels)
+	Levels   []RequestOptions
+	Window   int     // latest frames of each level the latency model keeps (default 15)
+	Headroom float64 // fraction of Target the predicted latency must stay under (default 0.8)
+	// ProbeInterval is after how many frames the measurements of a level not in use are forgotten,
+	// so a level that was too slow is tried again once the load drops (default 100)
+	ProbeInterval int
+}
+
+func (b LatencyBudget) withDefaults() LatencyBudget {
+	if len(b.Levels) == 0 {
+		b.Levels = DefaultQualityLevels
+	}
+	if b.Window <= 0 {
+		b.Window = 15
+	}
+	if b.Headroom <= 0 || b.Headroom > 1 {
+		b.Headroom = 0.8
+	}
+	if b.ProbeInterval <= 0 {
+		b.ProbeInterval = 100
+	}
+	return b
+}
+
+// minLevelSamples is how many frames a level runs before AdaptiveQuality tries a more expensive one
+const minLevelSamples = 3
+
+// levelLatency is the rolling latency model of one quality level
+type levelLatency struct {
+	detect   []time.Duration // per frame
+	perFace  []time.Duration // encoding time divided by the faces encoded
+	lastUsed int64           // frame counter when the level last reported
+}
+
+func (l *levelLatency) reset() {
+	l.detect, l.perFace = l.detect[:0], l.perFace[:0]
+}
+
+// AdaptiveQuality picks the detection and encoding settings of every frame so its latency fits a
+// budget, from the latencies measured on the hardware it runs on: it steps down the ladder of
+// LatencyBudget.Levels when frames run over and probes the next level up while they fit
+// It is safe for concurrent use
+type AdaptiveQuality struct {
+	budget LatencyBudget
+
+	mu     sync.Mutex
+	level  int
+	frames int64
+	faces  float64 // moving average of the faces per frame
+	levels []levelLatency
+}
+
+// NewAdaptiveQuality creates an AdaptiveQuality starting at the cheapest level
+func NewAdaptiveQuality(budget LatencyBudget) *AdaptiveQuality {
+	budget = budget.withDefaults()
+	return &AdaptiveQuality{budget: budget, levels: make([]levelLatency, len(budget.Levels))}
+}
+
+// Next returns the level and settings to process the next frame with
+func (a *AdaptiveQuality) Next() (int, RequestOptions) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.frames++
+	for i := range a.levels {
+		if i != a.level && a.frames-a.levels[i].lastUsed > int64(a.budget.ProbeInterval) {
+			a.levels[i].reset()
+		}
+	}
+	return a.level, a.budget.Levels[a.level]
+}
+
+// Level returns the current level, an index into LatencyBudget.Levels
+func (a *AdaptiveQuality) Level() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.level
+}
+
+// Observe records how long a frame processed at level took and moves to the level fitting the budget
+func (a *AdaptiveQuality) Observe(level int, detect, encode time.Duration, faces int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if level < 0 || level >= len(a.levels) {
+		return
+	}
+	l := &a.levels[level]
+	l.detect = appendWindow(l.detect, detect, a.budget.Window)
+	if faces > 0 {
+		l.perFace = appendWindow(l.perFace, encode/time.Duration(faces), a.budget.Window)
+	}
+	l.lastUsed = a.frames
+	a.faces = 0.8*a.faces + 0.2*float64(faces)
+
+	target := time.Duration(float64(a.budget.Target) * a.budget.Headroom)
+	current, _ := a.predict(a.level)
+	switch {
+	case current > target && a.level > 0:
+		// Jump to the most expensive cheaper level known to fit, or one step down
+		next := a.level - 1
+		for i := a.level - 1; i >= 0; i-- {
+			if p, ok := a.predict(i); ok && p <= target {
+				next = i
+				break
+			}
+		}
+		a.level = next
+	case current <= target && a.level+1 < len(a.levels) && len(a.levels[a.level].detect) >= minLevelSamples:
+		// Unmeasured levels are probed; measured ones only when they are predicted to fit
+		if p, ok := a.predict(a.level + 1); !ok || p <= target {
+			a.level++
+		}
+	}
+}
+
+// predict returns the expected frame latency of a level, false when the level has no measurements
+// Medians keep a single slow frame, e.g. from a garbage collection, from moving the level
+func (a *AdaptiveQuality) predict(level int) (time.Duration, bool) {
+	l := a.levels[level]
+	if len(l.detect) == 0 {
+		return 0, false
+	}
+	return median(l.detect) + time.Duration(float64(median(l.perFace))*a.faces), true
+}
+
+func appendWindow(window []time.Duration, d time.Duration, size int) []time.Duration {
+	if len(window) >= size {
+		window = append(window[:0], window[len(window)-size+1:]...)
+	}
+	return append(window, d)
+}
+
+func median(window []time.Duration) time.Duration {
+	if len(window) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(window)
+	slices.Sort(sorted)
+	return sorted[len(sorted)/2]
+}
@@ -0,0 +1,168 @@
+package gofacerecognition
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// minCalibrationSubjects is the number of subjects seen by both cameras needed to fit a correction
+const minCalibrationSubjects = 3
+
+// calibrationPrior is how many subjects worth of evidence keep the correction close to identity
+// With few subjects the per-dimension fit would otherwise overfit noise
+const calibrationPrior = 4
+
+// CameraCalibration maps encodings from one camera into the space of a reference camera
+// Each dimension is corrected with an affine transform, and the remaining cross-camera distance
+// inflation is removed with a score offset
+type CameraCalibration struct {
+	CameraID    string       `json:"camera_id"`
+	Scale       FaceEncoding `json:"scale"`
+	Bias        FaceEncoding `json:"bias"`
+	ScoreOffset float64      `json:"score_offset"` // subtracted from distances to probes from this camera
+	Subjects    int          `json:"subjects"`     // number of subjects the calibration was fitted on
+}
+
+// CalibrateCamera learns a CameraCalibration from the same subjects captured on a reference camera and on cameraID
+// Both maps are keyed by subject label; subjects missing from either side are ignored
+func CalibrateCamera(cameraID string, reference, camera map[string][]FaceEncoding) (*CameraCalibration, error) {
+	var labels []string
+	for label, encs := range camera {
+		if len(encs) > 0 && len(reference[label]) > 0 {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+	if len(labels) < minCalibrationSubjects {
+		return nil, fmt.Errorf("calibrating camera %q: %d subjects seen by both cameras, need at least %d", cameraID, len(labels), minCalibrationSubjects)
+	}
+
+	refMeans := make([]FaceEncoding, len(labels))
+	camMeans := make([]FaceEncoding, len(labels))
+	for i, label := range labels {
+		refMeans[i] = AverageEncoding(reference[label])
+		camMeans[i] = AverageEncoding(camera[label])
+	}
+
+	cal := &CameraCalibration{CameraID: cameraID, Subjects: len(labels)}
+	n := float64(len(labels))
+	for d := 0; d < 128; d++ {
+		var mx, my float64
+		for i := range labels {
+			mx += camMeans[i][d]
+			my += refMeans[i][d]
+		}
+		mx /= n
+		my /= n
+
+		var sxx, sxy float64
+		for i := range labels {
+			dx := camMeans[i][d] - mx
+			sxx += dx * dx
+			sxy += dx * (refMeans[i][d] - my)
+		}
+
+		// Ridge regression toward a scale of 1, the prior weighs as much as calibrationPrior average subjects
+		lambda := calibrationPrior * sxx / n
+		scale := 1.0
+		if sxx+lambda > 0 {
+			scale = (sxy + lambda) / (sxx + lambda)
+		}
+		cal.Scale[d] = scale
+		cal.Bias[d] = my - scale*mx
+	}
+
+	// Distance inflation left after the correction, relative to same-camera genuine distances
+	var cross, within float64
+	var nCross, nWithin int
+	for i, label := range labels {
+		for _, enc := range camera[label] {
+			cross += FaceDistance(cal.Apply(enc), refMeans[i])
+			nCross++
+		}
+		if len(reference[label]) > 1 {
+			for _, enc := range reference[label] {
+				within += FaceDistance(enc, refMeans[i])
+				nWithin++
+			}
+		}
+	}
+	if nWithin > 0 {
+		cal.ScoreOffset = math.Max(0, cross/float64(nCross)-within/float64(nWithin))
+	}
+
+	return cal, nil
+}
+
+// Apply maps an encoding from the calibrated camera into the reference camera space
+func (c *CameraCalibration) Apply(enc FaceEncoding) FaceEncoding {
+	var out FaceEncoding
+	for d := range enc {
+		out[d] = c.Scale[d]*enc[d] + c.Bias[d]
+	}
+	return out
+}
+
+// AdjustDistance removes the residual cross-camera inflation from a distance
+func (c *CameraCalibration) AdjustDistance(distance float64) float64 {
+	return math.Max(0, distance-c.ScoreOffset)
+}
+
+// CameraCalibrations holds the calibration of each camera, keyed by camera ID
+// Cameras without an entry, including the reference camera, are used as is
+type CameraCalibrations map[string]*CameraCalibration
+
+// Apply maps an encoding from cameraID into the reference camera space
+func (cc CameraCalibrations) Apply(cameraID string, enc FaceEncoding) FaceEncoding {
+	if c, ok := cc[cameraID]; ok {
+		return c.Apply(enc)
+	}
+	return enc
+}
+
+// AdjustDistance removes the residual inflation of cameraID from a distance
+func (cc CameraCalibrations) AdjustDistance(cameraID string, distance float64) float64 {
+	if c, ok := cc[cameraID]; ok {
+		return c.AdjustDistance(distance)
+	}
+	return distance
+}
+
+// LoadCameraCalibrations reads calibrations saved by SaveCameraCalibrations
+func LoadCameraCalibrations(path string) (CameraCalibrations, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*CameraCalibration
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("decoding camera calibrations %s: %w", path, err)
+	}
+
+	cc := make(CameraCalibrations, len(list))
+	for _, c := range list {
+		cc[c.CameraID] = c
+	}
+	return cc, nil
+}
+
+// SaveCameraCalibrations writes calibrations to a JSON file, sorted by camera ID
+func SaveCameraCalibrations(path string, cc CameraCalibrations) error {
+	list := make([]*CameraCalibration, 0, len(cc))
+	for _, c := range cc {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CameraID < list[j].CameraID
+	})
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
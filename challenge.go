@@ -0,0 +1,206 @@
+package gofacerecognition
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+
+	"github.com/shafiqaimanx/go_face_recognition/security"
+)
+
+// Challenge is a head movement the user is asked to perform during active liveness checks
+type Challenge string
+
+const (
+	ChallengeTurnLeft  Challenge = "turn_left"
+	ChallengeTurnRight Challenge = "turn_right"
+	ChallengeLookUp    Challenge = "look_up"
+	ChallengeLookDown  Challenge = "look_down"
+	ChallengeNod       Challenge = "nod"   // look down, then back to neutral
+	ChallengeShake     Challenge = "shake" // turn to one side, then the other
+)
+
+// AllChallenges lists every supported challenge
+var AllChallenges = []Challenge{
+	ChallengeTurnLeft,
+	ChallengeTurnRight,
+	ChallengeLookUp,
+	ChallengeLookDown,
+	ChallengeNod,
+	ChallengeShake,
+}
+
+// ChallengeStatus is the state of a ChallengeSession after a frame
+type ChallengeStatus string
+
+const (
+	ChallengePending   ChallengeStatus = "pending"   // current challenge not yet performed
+	ChallengePassed    ChallengeStatus = "passed"    // current challenge performed, moving to the next one
+	ChallengeCompleted ChallengeStatus = "completed" // every challenge performed
+	ChallengeFailed    ChallengeStatus = "failed"    // a challenge was not performed within its frame window
+)
+
+// ChallengeConfig configures a ChallengeSession
+type ChallengeConfig struct {
+	// Challenges to perform in order; when empty, Count challenges are drawn at random
+	Challenges []Challenge
+	Count      int // number of random challenges (default 3)
+	// Window is the number of frames allowed per challenge (default 90, about 3 seconds at 30fps)
+	Window         int
+	YawThreshold   float64 // degrees of yaw needed for turn and shake challenges (default 20)
+	PitchThreshold float64 // degrees of pitch needed for look and nod challenges (default 15)
+	// Rand draws the challenges (default security.Random, crypto/rand); a predictable source lets an
+	// attacker prepare a recording of the right movements, so only replace it in tests
+	Rand io.Reader
+}
+
+// ChallengeSession validates a sequence of head movement challenges from per-frame head poses
+// The first frame is taken as the neutral pose, so users should start by facing the camera
+type ChallengeSession struct {
+	config     ChallengeConfig
+	challenges []Challenge
+	current    int
+	stage      int // progress within multi-step challenges
+	side       float64
+	frames     int // frames spent on the current challenge
+	neutral    *HeadPose
+	status     ChallengeStatus
+}
+
+// NewChallengeSession creates a session with the configured or randomly drawn challenges
+func NewChallengeSession(config ChallengeConfig) *ChallengeSession {
+	if config.Count <= 0 {
+		config.Count = 3
+	}
+	if config.Window <= 0 {
+		config.Window = 90
+	}
+	if config.YawThreshold <= 0 {
+		config.YawThreshold = 20
+	}
+	if config.PitchThreshold <= 0 {
+		config.PitchThreshold = 15
+	}
+	if config.Rand == nil {
+		config.Rand = security.Random
+	}
+
+	challenges := append([]Challenge(nil), config.Challenges...)
+	if len(challenges) == 0 {
+		// Draw without immediate repeats so consecutive steps always require new movement
+		for len(challenges) < config.Count {
+			c := AllChallenges[randomIndex(config.Rand, len(AllChallenges))]
+			if len(challenges) > 0 && challenges[len(challenges)-1] == c {
+				continue
+			}
+			challenges = append(challenges, c)
+		}
+	}
+
+	return &ChallengeSession{
+		config:     config,
+		challenges: challenges,
+		status:     ChallengePending,
+	}
+}
+
+// randomIndex returns a uniform index below n read from r
+// A failing source would leave the challenges guessable, so it panics like crypto/rand does
+func randomIndex(r io.Reader, n int) int {
+	i, err := rand.Int(r, big.NewInt(int64(n)))
+	if err != nil {
+		panic(fmt.Sprintf("drawing liveness challenges: %v", err))
+	}
+	return int(i.Int64())
+}
+
+// Challenges returns the full challenge sequence
+func (s *ChallengeSession) Challenges() []Challenge {
+	return append([]Challenge(nil), s.challenges...)
+}
+
+// Current returns the challenge the user should perform now, false once the session is over
+func (s *ChallengeSession) Current() (Challenge, bool) {
+	if s.status == ChallengeCompleted || s.status == ChallengeFailed {
+		return "", false
+	}
+	return s.challenges[s.current], true
+}
+
+// Status returns the state after the latest frame
+func (s *ChallengeSession) Status() ChallengeStatus {
+	return s.status
+}
+
+// AddFrame feeds the head pose of the next frame and returns the updated status
+func (s *ChallengeSession) AddFrame(pose HeadPose) ChallengeStatus {
+	if s.status == ChallengeCompleted || s.status == ChallengeFailed {
+		return s.status
+	}
+
+	if s.neutral == nil {
+		s.neutral = &pose
+		s.status = ChallengePending
+		return s.status
+	}
+
+	s.frames++
+	if s.performed(pose) {
+		s.current++
+		s.stage, s.side, s.frames = 0, 0, 0
+		if s.current == len(s.challenges) {
+			s.status = ChallengeCompleted
+		} else {
+			s.status = ChallengePassed
+		}
+		return s.status
+	}
+
+	if s.frames >= s.config.Window {
+		s.status = ChallengeFailed
+	} else {
+		s.status = ChallengePending
+	}
+	return s.status
+}
+
+// performed advances the current challenge with one pose and reports whether it is done
+func (s *ChallengeSession) performed(pose HeadPose) bool {
+	yaw := pose.Yaw - s.neutral.Yaw
+	pitch := pose.Pitch - s.neutral.Pitch
+	yawThr, pitchThr := s.config.YawThreshold, s.config.PitchThreshold
+
+	switch s.challenges[s.current] {
+	case ChallengeTurnLeft:
+		return yaw >= yawThr
+	case ChallengeTurnRight:
+		return yaw <= -yawThr
+	case ChallengeLookUp:
+		return pitch >= pitchThr
+	case ChallengeLookDown:
+		return pitch <= -pitchThr
+
+	case ChallengeNod:
+		if s.stage == 0 {
+			if pitch <= -pitchThr {
+				s.stage = 1
+			}
+			return false
+		}
+		return math.Abs(pitch) <= pitchThr/2
+
+	case ChallengeShake:
+		if s.stage == 0 {
+			if math.Abs(yaw) >= yawThr {
+				s.stage = 1
+				s.side = math.Copysign(1, yaw)
+			}
+			return false
+		}
+		return yaw*s.side <= -yawThr
+	}
+
+	return false
+}
@@ -0,0 +1,326 @@
+package gofacerecognition
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const chipCacheExt = ".chip"
+
+var chipMagic = [4]byte{'G', 'F', 'C', '1'}
+
+// ImageHash returns a content hash of an image, used as a cache key
+func ImageHash(img *ImageMatrix) string {
+	h := sha256.New()
+	var dims [8]byte
+	binary.LittleEndian.PutUint32(dims[0:4], uint32(img.Width))
+	binary.LittleEndian.PutUint32(dims[4:8], uint32(img.Height))
+	h.Write(dims[:])
+	for y := 0; y < img.Height; y++ {
+		h.Write(img.Pixels[y*img.Stride : y*img.Stride+img.Width*img.bytesPerPixel()])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type chipCacheEntry struct {
+	name string
+	size int64
+}
+
+// ChipCache is an on-disk LRU cache of face chips keyed by image hash and face rectangle
+// Recency survives restarts through file modification times
+// It is safe for concurrent use
+type ChipCache struct {
+	dir      string
+	maxBytes int64
+
+	mu     sync.Mutex
+	lru    *list.List // front is most recently used
+	index  map[string]*list.Element
+	images map[string]map[string]Rectangle // chip names and faces by image hash
+	size   int64
+}
+
+// OpenChipCache opens or creates a cache in dir that holds at most maxBytes of chips (0 = unlimited)
+func OpenChipCache(dir string, maxBytes int64) (*ChipCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create chip cache directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type existing struct {
+		entry chipCacheEntry
+		mtime time.Time
+	}
+	var files []existing
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), chipCacheExt) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, existing{chipCacheEntry{e.Name(), info.Size()}, info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].mtime.After(files[j].mtime)
+	})
+
+	c := &ChipCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		index:    make(map[string]*list.Element),
+		images:   make(map[string]map[string]Rectangle),
+	}
+	for _, f := range files {
+		c.index[f.entry.name] = c.lru.PushBack(f.entry)
+		c.size += f.entry.size
+		c.addImage(f.entry.name)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evict()
+
+	return c, nil
+}
+
+// Size returns the total size of cached chips in bytes
+func (c *ChipCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Len returns the number of cached chips
+func (c *ChipCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Get returns the cached chip for a face in an image
+func (c *ChipCache) Get(imageHash string, rect Rectangle) (*ImageMatrix, bool) {
+	name := chipCacheName(imageHash, rect)
+
+	c.mu.Lock()
+	elem, ok := c.index[name]
+	if ok {
+		c.lru.MoveToFront(elem)
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return nil, false
+	}
+
+	path := filepath.Join(c.dir, name)
+	chip, err := readChip(path)
+	if err != nil {
+		c.mu.Lock()
+		c.remove(name)
+		c.mu.Unlock()
+		return nil, false
+	}
+
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return chip, true
+}
+
+// Faces returns the rectangles of the cached chips of an image, largest first
+func (c *ChipCache) Faces(imageHash string) []Rectangle {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rects := make([]Rectangle, 0, len(c.images[imageHash]))
+	for _, r := range c.images[imageHash] {
+		rects = append(rects, r)
+	}
+	sort.Slice(rects, func(i, j int) bool {
+		if a, b := rects[i].Area(), rects[j].Area(); a != b {
+			return a > b
+		}
+		if rects[i].Top != rects[j].Top {
+			return rects[i].Top < rects[j].Top
+		}
+		return rects[i].Left < rects[j].Left
+	})
+	return rects
+}
+
+// Put stores a chip for a face in an image, evicting the least recently used chips if needed
+func (c *ChipCache) Put(imageHash string, rect Rectangle, chip *ImageMatrix) error {
+	name := chipCacheName(imageHash, rect)
+	path := filepath.Join(c.dir, name)
+
+	size, err := writeChip(path, chip)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.index[name]; ok {
+		c.size -= elem.Value.(chipCacheEntry).size
+		c.lru.Remove(elem)
+	}
+	c.index[name] = c.lru.PushFront(chipCacheEntry{name, size})
+	c.size += size
+	c.addImage(name)
+	c.evict()
+
+	return nil
+}
+
+// Clear removes every cached chip
+func (c *ChipCache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var firstErr error
+	for name := range c.index {
+		if err := c.remove(name); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// evict drops the least recently used chips until the cache fits; callers hold c.mu
+func (c *ChipCache) evict() {
+	if c.maxBytes <= 0 {
+		return
+	}
+	for c.size > c.maxBytes && c.lru.Len() > 0 {
+		c.remove(c.lru.Back().Value.(chipCacheEntry).name)
+	}
+}
+
+// remove deletes a chip from the index and disk; callers hold c.mu
+func (c *ChipCache) remove(name string) error {
+	elem, ok := c.index[name]
+	if !ok {
+		return nil
+	}
+	c.size -= elem.Value.(chipCacheEntry).size
+	c.lru.Remove(elem)
+	delete(c.index, name)
+	if hash, _, ok := parseChipCacheName(name); ok {
+		delete(c.images[hash], name)
+		if len(c.images[hash]) == 0 {
+			delete(c.images, hash)
+		}
+	}
+
+	if err := os.Remove(filepath.Join(c.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// addImage records a chip under its image hash; callers hold c.mu
+func (c *ChipCache) addImage(name string) {
+	hash, rect, ok := parseChipCacheName(name)
+	if !ok {
+		return
+	}
+	if c.images[hash] == nil {
+		c.images[hash] = make(map[string]Rectangle)
+	}
+	c.images[hash][name] = rect
+}
+
+func chipCacheName(imageHash string, rect Rectangle) string {
+	return fmt.Sprintf("%s_%d_%d_%d_%d%s", imageHash, rect.Top, rect.Right, rect.Bottom, rect.Left, chipCacheExt)
+}
+
+// parseChipCacheName is the inverse of chipCacheName
+func parseChipCacheName(name string) (string, Rectangle, bool) {
+	fields := strings.Split(strings.TrimSuffix(name, chipCacheExt), "_")
+	if len(fields) != 5 {
+		return "", Rectangle{}, false
+	}
+	var coords [4]int
+	for i, f := range fields[1:] {
+		v, err := strconv.Atoi(f)
+		if err != nil {
+			return "", Rectangle{}, false
+		}
+		coords[i] = v
+	}
+	return fields[0], Rectangle{Top: coords[0], Right: coords[1], Bottom: coords[2], Left: coords[3]}, true
+}
+
+// writeChip stores a chip as [magic][width uint32][height uint32][RGB pixels]
+func writeChip(path string, chip *ImageMatrix) (int64, error) {
+	if chip.IsGray() {
+		chip = chip.ToRGB()
+	}
+	buf := make([]byte, 12, 12+chip.Width*chip.Height*3)
+	copy(buf[0:4], chipMagic[:])
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(chip.Width))
+	binary.LittleEndian.PutUint32(buf[8:12], uint32(chip.Height))
+	for y := 0; y < chip.Height; y++ {
+		buf = append(buf, chip.Pixels[y*chip.Stride:y*chip.Stride+chip.Width*3]...)
+	}
+
+	// A unique temp file in the same directory, so concurrent writers of one chip never share it and
+	// the rename stays on one filesystem
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	return int64(len(buf)), nil
+}
+
+func readChip(path string) (*ImageMatrix, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 || [4]byte(data[0:4]) != chipMagic {
+		return nil, fmt.Errorf("invalid chip file %s", path)
+	}
+
+	width := int(binary.LittleEndian.Uint32(data[4:8]))
+	height := int(binary.LittleEndian.Uint32(data[8:12]))
+	if len(data)-12 != width*height*3 {
+		return nil, fmt.Errorf("truncated chip file %s", path)
+	}
+
+	chip := NewImageMatrix(width, height)
+	copy(chip.Pixels, data[12:])
+	return chip, nil
+}
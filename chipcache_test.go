@@ -0,0 +1,46 @@
+package gofacerecognition
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChipCacheFaces(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := OpenChipCache(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	small := Rectangle{Top: 10, Right: 60, Bottom: 60, Left: 10}
+	large := Rectangle{Top: 100, Right: 300, Bottom: 300, Left: 100}
+	for _, r := range []Rectangle{small, large} {
+		if err := cache.Put("abc", r, NewImageMatrix(4, 4)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cache.Put("other", small, NewImageMatrix(4, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Rectangle{large, small}
+	if got := cache.Faces("abc"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Faces = %v, want %v", got, want)
+	}
+
+	// The index is rebuilt from the file names when the cache is opened again
+	reopened, err := OpenChipCache(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.Faces("abc"); !reflect.DeepEqual(got, want) {
+		t.Errorf("after reopening, Faces = %v, want %v", got, want)
+	}
+
+	if err := reopened.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.Faces("abc"); len(got) != 0 {
+		t.Errorf("after Clear, Faces = %v", got)
+	}
+}
@@ -0,0 +1,207 @@
+package gofacerecognition
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// DistanceFunc measures the distance between two encodings, smaller is more similar
+type DistanceFunc func(a, b FaceEncoding) float64
+
+// NoiseLabel is the cluster label DBSCAN gives to encodings that belong to no cluster
+const NoiseLabel = -1
+
+// ClusterResult holds the output of KMeans and DBSCAN
+type ClusterResult struct {
+	Labels    []int          // cluster of each input encoding, NoiseLabel for DBSCAN outliers
+	Centroids []FaceEncoding // mean encoding of each cluster, indexed by label
+}
+
+// Members returns the indices of the encodings assigned to label
+func (r ClusterResult) Members(label int) []int {
+	var members []int
+	for i, l := range r.Labels {
+		if l == label {
+			members = append(members, i)
+		}
+	}
+	return members
+}
+
+// KMeansConfig configures KMeans
+type KMeansConfig struct {
+	K             int          // number of clusters, required
+	MaxIterations int          // default 100
+	Distance      DistanceFunc // default FaceDistance
+	Rand          *rand.Rand   // seeds k-means++ initialization
+}
+
+// KMeans partitions encodings into K clusters, initialized with k-means++
+// Use it when the number of people is known; otherwise prefer DBSCAN or ClusterEncodings
+func KMeans(encodings []FaceEncoding, config KMeansConfig) (ClusterResult, error) {
+	if config.K <= 0 || config.K > len(encodings) {
+		return ClusterResult{}, fmt.Errorf("kmeans: K must be between 1 and the number of encodings (%d), got %d", len(encodings), config.K)
+	}
+	if config.MaxIterations <= 0 {
+		config.MaxIterations = 100
+	}
+	if config.Distance == nil {
+		config.Distance = FaceDistance
+	}
+	if config.Rand == nil {
+		config.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	centroids := kmeansPlusPlus(encodings, config)
+	labels := make([]int, len(encodings))
+	for i := range labels {
+		labels[i] = -1
+	}
+
+	for iter := 0; iter < config.MaxIterations; iter++ {
+		changed := false
+		for i, enc := range encodings {
+			best, bestDist := 0, math.Inf(1)
+			for c, centroid := range centroids {
+				if d := config.Distance(enc, centroid); d < bestDist {
+					best, bestDist = c, d
+				}
+			}
+			if labels[i] != best {
+				labels[i] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+
+		result := ClusterResult{Labels: labels}
+		for c := range centroids {
+			// Keep the previous centroid when a cluster loses all its members
+			if members := result.Members(c); len(members) > 0 {
+				centroids[c] = meanOf(encodings, members)
+			}
+		}
+	}
+
+	return ClusterResult{Labels: labels, Centroids: centroids}, nil
+}
+
+// kmeansPlusPlus picks initial centroids, each with probability proportional to its squared distance to the closest pick
+func kmeansPlusPlus(encodings []FaceEncoding, config KMeansConfig) []FaceEncoding {
+	centroids := []FaceEncoding{encodings[config.Rand.Intn(len(encodings))]}
+	dist := make([]float64, len(encodings))
+
+	for len(centroids) < config.K {
+		var total float64
+		for i, enc := range encodings {
+			d := math.Inf(1)
+			for _, c := range centroids {
+				d = math.Min(d, config.Distance(enc, c))
+			}
+			dist[i] = d * d
+			total += dist[i]
+		}
+
+		// Every remaining encoding duplicates a centroid, any pick will do
+		if total == 0 {
+			centroids = append(centroids, encodings[config.Rand.Intn(len(encodings))])
+			continue
+		}
+
+		target := config.Rand.Float64() * total
+		pick := len(encodings) - 1
+		for i, d := range dist {
+			target -= d
+			if target <= 0 {
+				pick = i
+				break
+			}
+		}
+		centroids = append(centroids, encodings[pick])
+	}
+	return centroids
+}
+
+// DBSCANConfig configures DBSCAN
+type DBSCANConfig struct {
+	Eps       float64      // neighbourhood radius (default 0.5)
+	MinPoints int          // encodings within Eps needed to form a cluster core, including itself (default 3)
+	Distance  DistanceFunc // default FaceDistance
+}
+
+// DBSCAN groups encodings by density without knowing the number of people in advance
+// Encodings that are not close to any dense group are labeled NoiseLabel
+func DBSCAN(encodings []FaceEncoding, config DBSCANConfig) ClusterResult {
+	if config.Eps <= 0 {
+		config.Eps = 0.5
+	}
+	if config.MinPoints <= 0 {
+		config.MinPoints = 3
+	}
+	if config.Distance == nil {
+		config.Distance = FaceDistance
+	}
+
+	const unvisited = -2
+	labels := make([]int, len(encodings))
+	for i := range labels {
+		labels[i] = unvisited
+	}
+
+	neighbours := func(i int) []int {
+		var n []int
+		for j, enc := range encodings {
+			if config.Distance(encodings[i], enc) <= config.Eps {
+				n = append(n, j)
+			}
+		}
+		return n
+	}
+
+	cluster := 0
+	for i := range encodings {
+		if labels[i] != unvisited {
+			continue
+		}
+		seeds := neighbours(i)
+		if len(seeds) < config.MinPoints {
+			labels[i] = NoiseLabel
+			continue
+		}
+
+		labels[i] = cluster
+		for k := 0; k < len(seeds); k++ {
+			j := seeds[k]
+			if labels[j] == NoiseLabel {
+				// Border point, reachable from a core but not a core itself
+				labels[j] = cluster
+			}
+			if labels[j] != unvisited {
+				continue
+			}
+			labels[j] = cluster
+			if n := neighbours(j); len(n) >= config.MinPoints {
+				seeds = append(seeds, n...)
+			}
+		}
+		cluster++
+	}
+
+	result := ClusterResult{Labels: labels, Centroids: make([]FaceEncoding, cluster)}
+	for c := range result.Centroids {
+		result.Centroids[c] = meanOf(encodings, result.Members(c))
+	}
+	return result
+}
+
+func meanOf(encodings []FaceEncoding, indices []int) FaceEncoding {
+	selected := make([]FaceEncoding, len(indices))
+	for i, idx := range indices {
+		selected[i] = encodings[idx]
+	}
+	return AverageEncoding(selected)
+}
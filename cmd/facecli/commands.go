@@ -0,0 +1,548 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+	"github.com/shafiqaimanx/go_face_recognition/internal/cli"
+)
+
+// faceJSON is a face of the detect, encode and cluster output
+type faceJSON struct {
+	File      string                `json:"file,omitempty"`
+	Rectangle facerec.Rectangle     `json:"rectangle"`
+	Score     *float64              `json:"score,omitempty"`
+	Encoding  *facerec.FaceEncoding `json:"encoding,omitempty"`
+}
+
+func runDetect(args []string) error {
+	fs := flag.NewFlagSet("detect", flag.ContinueOnError)
+	rf := addRecognizerFlags(fs)
+	positional, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return cli.UsageErrorf("usage: facecli detect <image> [--model hog] [--upsample 1]")
+	}
+
+	fr, err := rf.newRecognizer()
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	img, err := facerec.LoadImageFile(positional[0])
+	if err != nil {
+		return err
+	}
+	faces, err := fr.FaceLocationsWithScores(img, *rf.upsample, facerec.DetectionModel(*rf.model))
+	if err != nil {
+		return err
+	}
+
+	out := struct {
+		File   string     `json:"file"`
+		Width  int        `json:"width"`
+		Height int        `json:"height"`
+		Faces  []faceJSON `json:"faces"`
+	}{File: positional[0], Width: img.Width, Height: img.Height, Faces: []faceJSON{}}
+	for _, f := range faces {
+		score := f.Score
+		out.Faces = append(out.Faces, faceJSON{Rectangle: f.Rectangle, Score: &score})
+	}
+	return printJSON(out)
+}
+
+func runEncode(args []string) error {
+	fs := flag.NewFlagSet("encode", flag.ContinueOnError)
+	rf := addRecognizerFlags(fs)
+	out := fs.String("o", "", "write the encodings to this file instead of stdout")
+	largest := fs.Bool("largest", false, "encode only the largest face")
+	positional, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return cli.UsageErrorf("usage: facecli encode <image> [-o enc.json] [--largest]")
+	}
+
+	fr, err := rf.newRecognizer()
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	img, err := facerec.LoadImageFile(positional[0])
+	if err != nil {
+		return err
+	}
+	maxFaces := math.MaxInt32
+	if *largest {
+		maxFaces = 1
+	}
+	faces, err := fr.EncodeLargestFaces(img, rf.options(maxFaces))
+	if err != nil {
+		return err
+	}
+	if len(faces) == 0 {
+		return fmt.Errorf("%s: %w", positional[0], facerec.ErrNoFace)
+	}
+
+	encoded := make([]faceJSON, len(faces))
+	for i, f := range faces {
+		encoded[i] = faceJSON{File: positional[0], Rectangle: f.Rectangle, Encoding: &f.Encoding}
+	}
+	if *out == "" {
+		return printJSON(encoded)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	err = writeJSON(f, encoded)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	rf := addRecognizerFlags(fs)
+	tolerance := fs.Float64("tolerance", 0.6, "maximum distance for the faces to match")
+	positional, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return cli.UsageErrorf("usage: facecli compare <image1> <image2> [--tolerance 0.6]")
+	}
+
+	fr, err := rf.newRecognizer()
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	var faces [2]facerec.Face
+	for i, path := range positional {
+		face, _, err := encodeLargest(fr, path, rf)
+		if err != nil {
+			return err
+		}
+		faces[i] = face
+	}
+
+	distance := facerec.FaceDistance(faces[0].Encoding, faces[1].Encoding)
+	match := distance <= *tolerance
+	err = printJSON(struct {
+		Match      bool              `json:"match"`
+		Distance   float64           `json:"distance"`
+		Confidence float64           `json:"confidence"`
+		Tolerance  float64           `json:"tolerance"`
+		Face1      facerec.Rectangle `json:"face1"`
+		Face2      facerec.Rectangle `json:"face2"`
+	}{match, distance, facerec.DistanceToConfidence(distance, *tolerance), *tolerance, faces[0].Rectangle, faces[1].Rectangle})
+	if err != nil {
+		return err
+	}
+	if !match {
+		return cli.ExitStatus(cli.ExitNoMatch)
+	}
+	return nil
+}
+
+func runEnroll(args []string) error {
+	fs := flag.NewFlagSet("enroll", flag.ContinueOnError)
+	rf := addRecognizerFlags(fs)
+	dbPath := fs.String("db", "faces.json", "face database, created if missing")
+	name := fs.String("name", "", "name of the new person")
+	id := fs.String("id", "", "add the images to this existing person instead")
+	minSamples := fs.Int("min-samples", 1, "images that must pass the quality checks")
+	positional, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 || (*name == "") == (*id == "") {
+		return cli.UsageErrorf("usage: facecli enroll --db faces.json (--name NAME | --id ID) <image>...")
+	}
+
+	db, err := facerec.OpenFaceDB(*dbPath)
+	if err != nil {
+		return err
+	}
+	if *id != "" {
+		if _, ok := db.Get(*id); !ok {
+			return &facerec.PersonNotFoundError{ID: *id}
+		}
+	}
+
+	fr, err := rf.newRecognizer()
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	enroller := facerec.NewEnroller(fr, facerec.EnrollerConfig{
+		MinSamples:    *minSamples,
+		UpsampleTimes: *rf.upsample,
+		NumJitters:    *rf.jitters,
+		Model:         facerec.DetectionModel(*rf.model),
+	})
+	type rejected struct {
+		File   string               `json:"file"`
+		Reason facerec.RejectReason `json:"reason"`
+	}
+	var rejects []rejected
+	for _, path := range positional {
+		img, err := facerec.LoadImageFile(path)
+		if err != nil {
+			return err
+		}
+		sample, err := enroller.Add(img)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if !sample.Accepted {
+			rejects = append(rejects, rejected{path, sample.Reason})
+		}
+	}
+
+	result, err := enroller.Result()
+	if err != nil {
+		printJSON(struct {
+			Rejected []rejected `json:"rejected"`
+		}{rejects})
+		return err
+	}
+	// Outliers are only known once every sample is in
+	var sources []string
+	for _, s := range result.Samples {
+		if s.Reason == facerec.RejectOutlier {
+			rejects = append(rejects, rejected{positional[s.Index], s.Reason})
+		}
+		if s.Accepted {
+			abs, err := filepath.Abs(positional[s.Index])
+			if err != nil {
+				return err
+			}
+			sources = append(sources, abs)
+		}
+	}
+
+	if *id == "" {
+		if *id, err = db.Add(*name, result.Encodings, nil); err != nil {
+			return err
+		}
+	} else {
+		for _, enc := range result.Encodings {
+			if err := db.AddEncoding(*id, enc); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Sources let goface db reencode recompute the encodings with another model
+	person, _ := db.Get(*id)
+	for _, src := range sources {
+		if !slices.Contains(person.Sources, src) {
+			person.Sources = append(person.Sources, src)
+		}
+	}
+	if err := db.Update(person); err != nil {
+		return err
+	}
+	if err := db.Save(); err != nil {
+		return err
+	}
+
+	// Poses cover the images of this run only, earlier images of the person are not re-read
+	return printJSON(struct {
+		ID        string                     `json:"id"`
+		Name      string                     `json:"name"`
+		Encodings int                        `json:"encodings"`
+		Rejected  []rejected                 `json:"rejected,omitempty"`
+		Poses     facerec.PoseCoverageReport `json:"poses"`
+	}{person.ID, person.Name, len(person.Encodings), rejects, result.Coverage})
+}
+
+func runIdentify(args []string) error {
+	fs := flag.NewFlagSet("identify", flag.ContinueOnError)
+	rf := addRecognizerFlags(fs)
+	dbPath := fs.String("db", "faces.json", "face database")
+	tolerance := fs.Float64("tolerance", 0.6, "maximum distance for a match")
+	candidates := fs.Int("candidates", 1, "closest people listed per face")
+	positional, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return cli.UsageErrorf("usage: facecli identify --db faces.json <image> [--tolerance 0.6]")
+	}
+
+	if _, err := os.Stat(*dbPath); err != nil {
+		return err
+	}
+	db, err := facerec.OpenFaceDB(*dbPath)
+	if err != nil {
+		return err
+	}
+
+	fr, err := rf.newRecognizer()
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	img, err := facerec.LoadImageFile(positional[0])
+	if err != nil {
+		return err
+	}
+	faces, err := fr.Identify(img, db, facerec.IdentifyOptions{
+		Tolerance:     *tolerance,
+		UpsampleTimes: *rf.upsample,
+		NumJitters:    *rf.jitters,
+		Model:         facerec.DetectionModel(*rf.model),
+		Candidates:    *candidates,
+	})
+	if err != nil {
+		return err
+	}
+
+	type candidate struct {
+		ID       string  `json:"id"`
+		Name     string  `json:"name"`
+		Distance float64 `json:"distance"`
+	}
+	type identified struct {
+		Rectangle  facerec.Rectangle `json:"rectangle"`
+		Known      bool              `json:"known"`
+		ID         string            `json:"id,omitempty"`
+		Name       string            `json:"name,omitempty"`
+		Confidence float64           `json:"confidence"`
+		Candidates []candidate       `json:"candidates,omitempty"`
+	}
+	out := []identified{}
+	for _, f := range faces {
+		face := identified{Rectangle: f.Rectangle, Known: f.Known, ID: f.PersonID, Name: f.Name, Confidence: f.Confidence}
+		for _, c := range f.Candidates {
+			face.Candidates = append(face.Candidates, candidate{c.Person.ID, c.Person.Name, c.Distance})
+		}
+		out = append(out, face)
+	}
+	return printJSON(out)
+}
+
+func runCluster(args []string) error {
+	flags := flag.NewFlagSet("cluster", flag.ContinueOnError)
+	rf := addRecognizerFlags(flags)
+	eps := flags.Float64("eps", 0.5, "maximum distance between faces of the same person")
+	minPoints := flags.Int("min-points", 2, "faces needed to form a group")
+	positional, err := cli.ParseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return cli.UsageErrorf("usage: facecli cluster <dir> [--eps 0.5] [--min-points 2]")
+	}
+
+	var paths []string
+	err = filepath.WalkDir(positional[0], func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && cli.IsImageFile(path) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fr, err := rf.newRecognizer()
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	var faces []faceJSON
+	var encodings []facerec.FaceEncoding
+	for _, path := range paths {
+		img, err := facerec.LoadImageFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping %s: %v\n", path, err)
+			continue
+		}
+		found, err := fr.EncodeLargestFaces(img, rf.options(math.MaxInt32))
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		for _, f := range found {
+			faces = append(faces, faceJSON{File: path, Rectangle: f.Rectangle})
+			encodings = append(encodings, f.Encoding)
+		}
+	}
+
+	result := facerec.DBSCAN(encodings, facerec.DBSCANConfig{Eps: *eps, MinPoints: *minPoints})
+	out := struct {
+		Clusters [][]faceJSON `json:"clusters"`
+		Noise    []faceJSON   `json:"noise"`
+	}{Clusters: [][]faceJSON{}, Noise: []faceJSON{}}
+	for label := range result.Centroids {
+		var members []faceJSON
+		for _, i := range result.Members(label) {
+			members = append(members, faces[i])
+		}
+		out.Clusters = append(out.Clusters, members)
+	}
+	for _, i := range result.Members(facerec.NoiseLabel) {
+		out.Noise = append(out.Noise, faces[i])
+	}
+	return printJSON(out)
+}
+
+func runModelsDownload(args []string) error {
+	fs := flag.NewFlagSet("models download", flag.ContinueOnError)
+	dir := fs.String("dir", facerec.DefaultModelsDir(), "models directory")
+	checksums := fs.String("checksums", "", "sha256sum-style file of digests replacing the pinned ones, for mirrors")
+	positional, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return cli.UsageErrorf("usage: facecli models download [--dir DIR] [--checksums FILE]")
+	}
+	opts := facerec.DownloadOptions{Progress: stderrProgress}
+	if opts.Checksums, err = readChecksums(*checksums); err != nil {
+		return err
+	}
+	return facerec.EnsureModelsWithOptions(*dir, opts)
+}
+
+// readChecksums parses a sha256sum-style file, nil when path is empty
+func readChecksums(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sums, err := facerec.ParseModelChecksums(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return sums, nil
+}
+
+func runModelsStatus(args []string) error {
+	fs := flag.NewFlagSet("models status", flag.ContinueOnError)
+	dir := fs.String("dir", facerec.DefaultModelsDir(), "models directory")
+	verify := fs.Bool("verify", false, "check the SHA-256 digest of every present model against its pinned digest")
+	checksums := fs.String("checksums", "", "sha256sum-style file of digests replacing the pinned ones, for mirrors")
+	positional, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return cli.UsageErrorf("usage: facecli models status [--dir DIR] [--verify] [--checksums FILE]")
+	}
+	sums, err := readChecksums(*checksums)
+	if err != nil {
+		return err
+	}
+
+	type status struct {
+		Name     string `json:"name"`
+		Required bool   `json:"required"`
+		Present  bool   `json:"present"`
+		Size     int64  `json:"size,omitempty"`
+		Verified bool   `json:"verified,omitempty"`
+		Error    string `json:"error,omitempty"`
+	}
+
+	var out []status
+	missing := false
+	for _, m := range facerec.AllModels {
+		if d, ok := sums[m.Name]; ok {
+			m.SHA256 = d
+		}
+		s := status{Name: m.Name, Required: m.Required}
+		path := filepath.Join(*dir, m.Name)
+		if info, err := os.Stat(path); err == nil {
+			s.Present, s.Size = true, info.Size()
+			switch {
+			case !*verify:
+			case m.SHA256 == "":
+				s.Error = (&facerec.UnpinnedModelError{Model: m.Name}).Error()
+			default:
+				if err := facerec.VerifyModel(path, m.SHA256); err != nil {
+					s.Error = err.Error()
+				} else {
+					s.Verified = true
+				}
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			s.Error = err.Error()
+		}
+		missing = missing || (m.Required && (!s.Present || s.Error != ""))
+		out = append(out, s)
+	}
+
+	if err := printJSON(out); err != nil {
+		return err
+	}
+	if missing {
+		return cli.ExitStatus(cli.ExitFailure)
+	}
+	return nil
+}
+
+// runModelsChecksums prints the digests of the local models in sha256sum format, to pin them in
+// facerec.AllModels or to pass a mirror's models to --checksums
+func runModelsChecksums(args []string) error {
+	fs := flag.NewFlagSet("models checksums", flag.ContinueOnError)
+	dir := fs.String("dir", facerec.DefaultModelsDir(), "models directory")
+	positional, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return cli.UsageErrorf("usage: facecli models checksums [--dir DIR]")
+	}
+	for _, m := range facerec.AllModels {
+		digest, err := facerec.ModelDigest(filepath.Join(*dir, m.Name))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s  %s\n", digest, m.Name)
+	}
+	return nil
+}
+
+// encodeLargest loads an image file and encodes its largest face
+func encodeLargest(fr *facerec.FaceRecognizer, path string, rf recognizerFlags) (facerec.Face, *facerec.ImageMatrix, error) {
+	img, err := facerec.LoadImageFile(path)
+	if err != nil {
+		return facerec.Face{}, nil, err
+	}
+	faces, err := fr.EncodeLargestFaces(img, rf.options(1))
+	if err != nil {
+		return facerec.Face{}, nil, err
+	}
+	if len(faces) == 0 {
+		return facerec.Face{}, nil, fmt.Errorf("%s: %w", path, facerec.ErrNoFace)
+	}
+	return faces[0], img, nil
+}
@@ -0,0 +1,106 @@
+// Command facecli runs one-off face recognition tasks from scripts, printing JSON to stdout
+//
+//	facecli detect <image>
+//	facecli encode <image> [-o enc.json]
+//	facecli compare <image1> <image2>
+//	facecli enroll --db faces.json --name NAME <image>...
+//	facecli identify --db faces.json <image>
+//	facecli cluster <dir>
+//	facecli models download|status|checksums
+//
+// Exit codes: 0 success (and match for compare), 1 no match, 2 no face found, 11 usage error,
+// 12 any other failure; errors are printed to stderr
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+	"github.com/shafiqaimanx/go_face_recognition/internal/cli"
+)
+
+var commands = []*cli.Command{
+	{Name: "detect", Args: "<image>", Summary: "print the faces of an image with their detector scores", Run: runDetect},
+	{Name: "encode", Args: "<image>", Summary: "write the encodings of the faces of an image", Run: runEncode},
+	{Name: "compare", Args: "<image1> <image2>", Summary: "compare the largest faces of two images (exit 0 match, 1 no match, 2 no face)", Run: runCompare},
+	{Name: "enroll", Args: "<image>...", Summary: "add a person to a face database from the images passing the quality checks", Run: runEnroll},
+	{Name: "identify", Args: "<image>", Summary: "match the faces of an image against a face database", Run: runIdentify},
+	{Name: "cluster", Args: "<dir>", Summary: "group the faces of the images under a directory by person", Run: runCluster},
+	{Name: "models", Summary: "manage the model files", Subcommands: []*cli.Command{
+		{Name: "download", Summary: "download missing or corrupt models", Run: runModelsDownload},
+		{Name: "status", Summary: "list the models and whether they are present", Run: runModelsStatus},
+		{Name: "checksums", Summary: "print the SHA-256 digests of the local models in sha256sum format", Run: runModelsChecksums},
+	}},
+}
+
+func main() {
+	os.Exit(cli.Dispatch("facecli", commands, os.Args[1:]))
+}
+
+// recognizerFlags are the flags of every command that runs the models
+type recognizerFlags struct {
+	modelDir *string
+	model    *string
+	upsample *int
+	jitters  *int
+}
+
+func addRecognizerFlags(fs *flag.FlagSet) recognizerFlags {
+	return recognizerFlags{
+		modelDir: fs.String("models", "", "models directory (defaults to the package models directory)"),
+		model:    fs.String("model", "hog", "detection model, hog or cnn"),
+		upsample: fs.Int("upsample", 1, "number of times to upsample images for detection"),
+		jitters:  fs.Int("jitters", 1, "number of jitters when encoding"),
+	}
+}
+
+// options returns the detection settings of the flags, keeping maxFaces faces per image
+func (f recognizerFlags) options(maxFaces int) facerec.RequestOptions {
+	return facerec.RequestOptions{
+		Model:         facerec.DetectionModel(*f.model),
+		UpsampleTimes: *f.upsample,
+		NumJitters:    *f.jitters,
+		MaxFaces:      maxFaces,
+	}
+}
+
+// newRecognizer loads the models, downloading missing ones first
+func (f recognizerFlags) newRecognizer() (*facerec.FaceRecognizer, error) {
+	if m := facerec.DetectionModel(*f.model); m != facerec.HOG && m != facerec.CNN {
+		return nil, cli.UsageErrorf("--model must be hog or cnn, got %q", *f.model)
+	}
+	dir := *f.modelDir
+	if dir == "" {
+		dir = facerec.DefaultModelsDir()
+	}
+	if err := facerec.EnsureModelsWithOptions(dir, facerec.DownloadOptions{Progress: stderrProgress}); err != nil {
+		return nil, err
+	}
+	return facerec.NewFaceRecognizer(facerec.Config{
+		ModelPaths: facerec.DefaultModelPaths(dir),
+		NumJitters: *f.jitters,
+	})
+}
+
+// stderrProgress reports finished model downloads on stderr, keeping stdout for the JSON output
+func stderrProgress(name string, downloaded, total int64) {
+	if total >= 0 && downloaded == total {
+		fmt.Fprintf(os.Stderr, "downloaded %s (%.2f MB)\n", name, float64(total)/(1024*1024))
+	}
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v any) error {
+	return writeJSON(os.Stdout, v)
+}
+
+// writeJSON writes v to w as indented JSON
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
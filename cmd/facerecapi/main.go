@@ -0,0 +1,185 @@
+// Command facerecapi runs the JSON HTTP API of package httpapi as a standalone service
+//
+//	facerecapi --addr :8080 --db faces.json
+//
+// /identify is served when --db is given, and GET /metrics in the Prometheus text format with
+// --metrics. With --telemetry-endpoint aggregate counters, never faces or images, are posted to
+// that endpoint every --telemetry-interval. On SIGINT or SIGTERM requests in flight finish before
+// the models are released
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+	"github.com/shafiqaimanx/go_face_recognition/httpapi"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		log.Fatal(err)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("facerecapi", flag.ContinueOnError)
+	addr := fs.String("addr", ":8080", "listen address")
+	dbPath := fs.String("db", "", "face database to serve /identify from")
+	workers := fs.Int("workers", runtime.NumCPU(), "recognizers serving requests in parallel, each loads its own models")
+	modelDir := fs.String("models", "", "models directory (defaults to the package models directory)")
+	upsample := fs.Int("upsample", 1, "default number of times to upsample images for detection")
+	jitters := fs.Int("jitters", 1, "default number of jitters when encoding")
+	maxUpsample := fs.Int("max-upsample", 2, "highest upsample a request may ask for")
+	maxJitters := fs.Int("max-jitters", 10, "highest jitters a request may ask for")
+	maxFaces := fs.Int("max-faces", 10, "most faces per image a request may ask for")
+	allowCNN := fs.Bool("allow-cnn", false, "let requests pick the CNN detector with model=cnn")
+	maxUpload := fs.Int64("max-upload", 20<<20, "largest request body in bytes")
+	maxPixels := fs.Int("max-pixels", facerec.DefaultMaxImagePixels, "largest image in pixels, checked before decoding")
+	queueTimeout := fs.Duration("queue-timeout", 10*time.Second, "how long a request waits for a free recognizer before a 503")
+	slowRequest := fs.Duration("slow-request", 0, "log the stage timings of requests taking at least this long (0 disables)")
+	verbose := fs.Bool("verbose", false, "log model loading and every native call of the recognizers")
+	metrics := fs.Bool("metrics", false, "serve detection and encoding latency and pool utilization at GET /metrics")
+	telemetryEndpoint := fs.String("telemetry-endpoint", "", "opt in to posting aggregate health counters to this URL (empty disables)")
+	telemetryInterval := fs.Duration("telemetry-interval", 5*time.Minute, "time between telemetry reports")
+	telemetryID := fs.String("telemetry-id", "", "instance ID of the telemetry reports (default random per process)")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 25*time.Second, "how long requests in flight may take to finish on shutdown")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	config := httpapi.Config{
+		Limits: facerec.RequestLimits{
+			Defaults:    facerec.RequestOptions{Model: facerec.HOG, UpsampleTimes: *upsample, NumJitters: *jitters},
+			Models:      []facerec.DetectionModel{facerec.HOG},
+			MaxUpsample: *maxUpsample,
+			MaxJitters:  *maxJitters,
+			MaxFaces:    *maxFaces,
+		},
+		MaxUploadBytes: *maxUpload,
+		MaxImagePixels: *maxPixels,
+		QueueTimeout:   *queueTimeout,
+		SlowLog:        &facerec.SlowLog{Threshold: *slowRequest},
+	}
+	if *allowCNN {
+		config.Limits.Models = append(config.Limits.Models, facerec.CNN)
+	}
+
+	if *dbPath != "" {
+		db, err := facerec.OpenFaceDB(*dbPath)
+		if err != nil {
+			return err
+		}
+		config.DB = db
+		log.Printf("loaded %d people from %s", db.Len(), *dbPath)
+	}
+
+	if *modelDir == "" {
+		*modelDir = facerec.DefaultModelsDir()
+	}
+	downloads := facerec.DownloadOptions{Progress: facerec.LogProgress(slog.Default()), Logger: slog.Default()}
+	if err := facerec.EnsureModelsWithOptions(*modelDir, downloads); err != nil {
+		return err
+	}
+	recConfig := facerec.Config{
+		ModelPaths: facerec.DefaultModelPaths(*modelDir),
+		NumJitters: *jitters,
+		Logger:     slog.Default(),
+	}
+	if *verbose {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+	}
+	var err error
+	var collector *facerec.PrometheusMetrics
+	if *metrics {
+		collector = facerec.NewPrometheusMetrics(nil)
+		recConfig.Metrics = collector
+	}
+	var telemetry *facerec.Telemetry
+	if *telemetryEndpoint != "" {
+		telemetry, err = facerec.NewTelemetry(facerec.TelemetryConfig{
+			Endpoint:   *telemetryEndpoint,
+			Interval:   *telemetryInterval,
+			InstanceID: *telemetryID,
+			Logger:     slog.Default(),
+		})
+		if err != nil {
+			return err
+		}
+		if collector != nil {
+			recConfig.Metrics = facerec.MultiMetrics(collector, telemetry)
+		} else {
+			recConfig.Metrics = telemetry
+		}
+	}
+	pool, err := facerec.NewRecognizerPool(recConfig, *workers)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	config.Pool = pool
+
+	handler := httpapi.NewHandler(config)
+	if collector != nil {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", collector)
+		mux.Handle("/", handler)
+		handler = mux
+	}
+	srv := &http.Server{Addr: *addr, Handler: handler}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+	log.Printf("listening on %s with %d workers", *addr, pool.Size())
+
+	telemetryDone := make(chan struct{})
+	if telemetry != nil {
+		go func() {
+			telemetry.Run(ctx)
+			close(telemetryDone)
+		}()
+	} else {
+		close(telemetryDone)
+	}
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down, waiting up to %s for requests in flight", *shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("http shutdown: %w", err))
+	}
+	if err := pool.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("pool shutdown: %w", err))
+	}
+	<-telemetryDone
+	return errors.Join(errs...)
+}
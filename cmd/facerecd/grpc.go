@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+)
+
+// gRPC status codes, see https://grpc.github.io/grpc/core/md_doc_statuscodes.html
+const (
+	codeOK                 = 0
+	codeCanceled           = 1
+	codeInvalidArgument    = 3
+	codeDeadlineExceeded   = 4
+	codeNotFound           = 5
+	codeResourceExhausted  = 8
+	codeFailedPrecondition = 9
+	codeUnimplemented      = 12
+	codeInternal           = 13
+	codeUnavailable        = 14
+	codeUnauthenticated    = 16
+)
+
+// unaryMethod handles one encoded request message and returns the encoded response
+type unaryMethod func(ctx context.Context, req []byte) ([]byte, error)
+
+// grpcError is an error of the transport itself, with its gRPC status code
+type grpcError struct {
+	code    int
+	message string
+}
+
+func (e *grpcError) Error() string {
+	return e.message
+}
+
+// grpcHandler serves unary gRPC methods over HTTP/2, following
+// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md
+// Compressed messages and streaming are not supported, which no method of facerec.proto needs
+type grpcHandler struct {
+	methods    map[string]unaryMethod // keyed by path, e.g. "/facerec.v1.FaceRecognition/Detect"
+	maxMessage int
+}
+
+func (h *grpcHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 {
+		http.Error(w, "gRPC requires HTTP/2", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "application/grpc" && !strings.HasPrefix(ct, "application/grpc+proto") && !strings.HasPrefix(ct, "application/grpc;") {
+		http.Error(w, "unsupported content type "+ct, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message, Facerec-Code")
+
+	method, ok := h.methods[r.URL.Path]
+	if !ok {
+		writeStatus(w, &grpcError{codeUnimplemented, "unknown method " + r.URL.Path})
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), metadataKey{}, r.Header)
+	if v := r.Header.Get("Grpc-Timeout"); v != "" {
+		timeout, err := parseGRPCTimeout(v)
+		if err != nil {
+			writeStatus(w, &grpcError{codeInvalidArgument, err.Error()})
+			return
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req, err := readMessage(r.Body, h.maxMessage)
+	if err != nil {
+		writeStatus(w, err)
+		return
+	}
+	resp, err := method(ctx, req)
+	if err != nil {
+		writeStatus(w, err)
+		return
+	}
+
+	frame := make([]byte, 5, 5+len(resp))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(resp)))
+	w.Write(append(frame, resp...))
+	writeStatus(w, nil)
+}
+
+type metadataKey struct{}
+
+// callMetadata returns the request headers of a call, which carry its gRPC metadata
+func callMetadata(ctx context.Context) http.Header {
+	h, _ := ctx.Value(metadataKey{}).(http.Header)
+	return h
+}
+
+// readMessage reads the single length-prefixed message of a unary request
+func readMessage(body io.Reader, maxMessage int) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		return nil, &grpcError{codeInvalidArgument, "missing request message"}
+	}
+	if prefix[0] != 0 {
+		return nil, &grpcError{codeUnimplemented, "compressed messages are not supported"}
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if int64(size) > int64(maxMessage) {
+		return nil, &grpcError{codeResourceExhausted, fmt.Sprintf("request message of %d bytes is above the limit of %d", size, maxMessage)}
+	}
+
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(body, msg); err != nil {
+		return nil, &grpcError{codeInvalidArgument, "truncated request message"}
+	}
+	return msg, nil
+}
+
+// writeStatus sends the status trailers of a call, err nil meaning OK
+func writeStatus(w http.ResponseWriter, err error) {
+	code, message, facerecCode := grpcStatus(err)
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set("Grpc-Message", percentEncode(message))
+	}
+	if facerecCode != "" {
+		w.Header().Set("Facerec-Code", facerecCode)
+	}
+}
+
+// grpcStatus maps an error to its gRPC status and the package error code, see facerec.ErrorCode
+func grpcStatus(err error) (code int, message, facerecCode string) {
+	var gerr *grpcError
+	switch {
+	case err == nil:
+		return codeOK, "", ""
+	case errors.As(err, &gerr):
+		return gerr.code, gerr.message, ""
+	case errors.Is(err, context.Canceled):
+		return codeCanceled, err.Error(), ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return codeDeadlineExceeded, err.Error(), ""
+	}
+
+	facerecCode = facerec.ErrorCode(err)
+	switch facerecCode {
+	case facerec.CodeNoFace:
+		code = codeFailedPrecondition
+	case facerec.CodeBusy:
+		code = codeResourceExhausted
+	case facerec.CodeUnauthorized:
+		code = codeUnauthenticated
+	case facerec.CodeNotFound:
+		code = codeNotFound
+	case facerec.CodeInvalidArgument:
+		code = codeInvalidArgument
+	case facerec.CodeUnavailable:
+		code = codeUnavailable
+	default:
+		code = codeInternal
+	}
+	return code, err.Error(), facerecCode
+}
+
+// percentEncode escapes a grpc-message value, which must be printable ASCII
+func percentEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c >= 0x20 && c <= 0x7e && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// parseGRPCTimeout parses a grpc-timeout header, at most 8 digits followed by a unit
+func parseGRPCTimeout(v string) (time.Duration, error) {
+	if len(v) < 2 || len(v) > 9 {
+		return 0, fmt.Errorf("bad grpc-timeout %q", v)
+	}
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad grpc-timeout %q", v)
+	}
+
+	units := map[byte]time.Duration{
+		'H': time.Hour, 'M': time.Minute, 'S': time.Second,
+		'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond,
+	}
+	unit, ok := units[v[len(v)-1]]
+	if !ok {
+		return 0, fmt.Errorf("bad grpc-timeout unit in %q", v)
+	}
+	return time.Duration(n) * unit, nil
+}
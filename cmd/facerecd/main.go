@@ -0,0 +1,169 @@
+// Command facerecd serves face detection, encoding, identification and enrollment over gRPC,
+// for services written in other languages; the API is defined in facerec.proto
+//
+// The server speaks gRPC over cleartext HTTP/2 (h2c), or over TLS with --tls-cert and --tls-key.
+// Requests are handled by a pool of recognizers against one face database, which every
+// enrollment is saved to. Enroll calls must carry "authorization: Bearer <token>" metadata with the
+// token of --enroll-token-file or FACERECD_ENROLL_TOKEN; without one Enroll is refused. On SIGINT or SIGTERM calls in flight finish before the models are released
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+)
+
+// maxMessageBytes bounds request messages, which hold encoded images
+const maxMessageBytes = 32 << 20
+
+// enrollTokenEnv holds the Enroll bearer token when --enroll-token-file is not given
+const enrollTokenEnv = "FACERECD_ENROLL_TOKEN"
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		log.Fatal(err)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("facerecd", flag.ContinueOnError)
+	addr := fs.String("addr", ":50051", "listen address")
+	dbPath := fs.String("db", "faces.json", "face database used by Identify and written by Enroll, created if missing")
+	workers := fs.Int("workers", runtime.NumCPU(), "recognizers serving calls in parallel, each loads its own models")
+	modelDir := fs.String("models", "", "models directory (defaults to the package models directory)")
+	upsample := fs.Int("upsample", 1, "default number of times to upsample images for detection")
+	jitters := fs.Int("jitters", 1, "default number of jitters when encoding")
+	maxUpsample := fs.Int("max-upsample", 2, "highest upsample a call may ask for")
+	maxJitters := fs.Int("max-jitters", 10, "highest jitters a call may ask for")
+	maxFaces := fs.Int("max-faces", 10, "most faces per image a call may ask for")
+	allowCNN := fs.Bool("allow-cnn", false, "let calls pick the CNN detector with model \"cnn\"")
+	enrollTokenFile := fs.String("enroll-token-file", "", "file holding the bearer token Enroll calls must present (default $"+enrollTokenEnv+")")
+	tlsCert := fs.String("tls-cert", "", "serve TLS with this certificate file")
+	tlsKey := fs.String("tls-key", "", "private key of --tls-cert")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 25*time.Second, "how long calls in flight may take to finish on shutdown")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		return errors.New("--tls-cert and --tls-key must be given together")
+	}
+
+	limits := facerec.RequestLimits{
+		Defaults:    facerec.RequestOptions{Model: facerec.HOG, UpsampleTimes: *upsample, NumJitters: *jitters},
+		Models:      []facerec.DetectionModel{facerec.HOG},
+		MaxUpsample: *maxUpsample,
+		MaxJitters:  *maxJitters,
+		MaxFaces:    *maxFaces,
+	}
+	if *allowCNN {
+		limits.Models = append(limits.Models, facerec.CNN)
+	}
+
+	enrollToken, err := loadEnrollToken(*enrollTokenFile)
+	if err != nil {
+		return err
+	}
+	if len(enrollToken) == 0 {
+		log.Printf("no enroll token configured, Enroll calls are refused")
+	}
+
+	db, err := facerec.OpenFaceDB(*dbPath)
+	if err != nil {
+		return err
+	}
+	log.Printf("loaded %d people from %s", db.Len(), *dbPath)
+
+	if *modelDir == "" {
+		*modelDir = facerec.DefaultModelsDir()
+	}
+	downloads := facerec.DownloadOptions{Progress: facerec.LogProgress(slog.Default()), Logger: slog.Default()}
+	if err := facerec.EnsureModelsWithOptions(*modelDir, downloads); err != nil {
+		return err
+	}
+	pool, err := facerec.NewRecognizerPool(facerec.Config{
+		ModelPaths: facerec.DefaultModelPaths(*modelDir),
+		NumJitters: *jitters,
+	}, *workers)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	svc := &service{pool: pool, db: db, limits: limits, enrollToken: enrollToken}
+	var protocols http.Protocols
+	if *tlsCert != "" {
+		protocols.SetHTTP2(true)
+	} else {
+		protocols.SetUnencryptedHTTP2(true)
+	}
+	srv := &http.Server{
+		Addr:      *addr,
+		Handler:   &grpcHandler{methods: svc.methods(), maxMessage: maxMessageBytes},
+		Protocols: &protocols,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if *tlsCert != "" {
+			serveErr <- srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+		} else {
+			serveErr <- srv.ListenAndServe()
+		}
+	}()
+	log.Printf("serving gRPC on %s with %d workers", *addr, pool.Size())
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down, waiting up to %s for calls in flight", *shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("grpc shutdown: %w", err))
+	}
+	if err := pool.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("pool shutdown: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// loadEnrollToken reads the Enroll bearer token from path, or from enrollTokenEnv when path is empty
+func loadEnrollToken(path string) ([]byte, error) {
+	token := os.Getenv(enrollTokenEnv)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if token = strings.TrimSpace(string(data)); token == "" {
+			return nil, fmt.Errorf("enroll token file %s is empty", path)
+		}
+	}
+	return []byte(token), nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import facerec "github.com/shafiqaimanx/go_face_recognition"
+
+// Requests of facerec.proto are only decoded and responses only encoded, as the server needs
+
+// decodeOptions reads an Options message into the package's per-request options
+func decodeOptions(b []byte) (facerec.RequestOptions, error) {
+	var o facerec.RequestOptions
+	err := decodeFields(b, func(f wireField) error {
+		switch f.num {
+		case 1:
+			o.Model = facerec.DetectionModel(f.string())
+		case 2:
+			o.UpsampleTimes = f.int()
+		case 3:
+			o.NumJitters = f.int()
+		case 4:
+			o.Tolerance = f.double()
+		case 5:
+			o.MaxFaces = f.int()
+		}
+		return nil
+	})
+	return o, err
+}
+
+// imageRequest holds DetectRequest, EncodeRequest and IdentifyRequest, which share their first fields
+type imageRequest struct {
+	image      []byte
+	options    facerec.RequestOptions
+	candidates int // IdentifyRequest only
+}
+
+func (r *imageRequest) unmarshal(b []byte) error {
+	return decodeFields(b, func(f wireField) (err error) {
+		switch f.num {
+		case 1:
+			r.image = f.bytes()
+		case 2:
+			r.options, err = decodeOptions(f.bytes())
+		case 3:
+			r.candidates = f.int()
+		}
+		return err
+	})
+}
+
+type enrollRequest struct {
+	personID string
+	name     string
+	images   [][]byte
+	metadata map[string]string
+	options  facerec.RequestOptions
+}
+
+func (r *enrollRequest) unmarshal(b []byte) error {
+	return decodeFields(b, func(f wireField) (err error) {
+		switch f.num {
+		case 1:
+			r.personID = f.string()
+		case 2:
+			r.name = f.string()
+		case 3:
+			r.images = append(r.images, f.bytes())
+		case 4:
+			// Map entries are messages of key = 1 and value = 2
+			var key, value string
+			err = decodeFields(f.bytes(), func(e wireField) error {
+				switch e.num {
+				case 1:
+					key = e.string()
+				case 2:
+					value = e.string()
+				}
+				return nil
+			})
+			if r.metadata == nil {
+				r.metadata = make(map[string]string)
+			}
+			r.metadata[key] = value
+		case 5:
+			r.options, err = decodeOptions(f.bytes())
+		}
+		return err
+	})
+}
+
+func marshalRectangle(r facerec.Rectangle) []byte {
+	var b []byte
+	b = appendInt32(b, 1, r.Top)
+	b = appendInt32(b, 2, r.Right)
+	b = appendInt32(b, 3, r.Bottom)
+	b = appendInt32(b, 4, r.Left)
+	return b
+}
+
+func marshalDetectResponse(faces []facerec.ScoredRectangle, width, height int) []byte {
+	var b []byte
+	for _, f := range faces {
+		var face []byte
+		face = appendMessage(face, 1, marshalRectangle(f.Rectangle))
+		face = appendDouble(face, 2, f.Score)
+		b = appendMessage(b, 1, face)
+	}
+	b = appendInt32(b, 2, width)
+	b = appendInt32(b, 3, height)
+	return b
+}
+
+func marshalEncodeResponse(faces []facerec.Face) []byte {
+	var b []byte
+	for _, f := range faces {
+		var face []byte
+		face = appendMessage(face, 1, marshalRectangle(f.Rectangle))
+		face = appendPackedDoubles(face, 2, f.Encoding[:])
+		b = appendMessage(b, 1, face)
+	}
+	return b
+}
+
+func marshalIdentifyResponse(faces []facerec.IdentifiedFace) []byte {
+	var b []byte
+	for _, f := range faces {
+		var face []byte
+		face = appendMessage(face, 1, marshalRectangle(f.Rectangle))
+		face = appendBool(face, 2, f.Known)
+		face = appendString(face, 3, f.PersonID)
+		face = appendString(face, 4, f.Name)
+		face = appendDouble(face, 5, f.Distance)
+		face = appendDouble(face, 6, f.Confidence)
+		for _, c := range f.Candidates {
+			var cand []byte
+			cand = appendString(cand, 1, c.Person.ID)
+			cand = appendString(cand, 2, c.Person.Name)
+			cand = appendDouble(cand, 3, c.Distance)
+			face = appendMessage(face, 7, cand)
+		}
+		b = appendMessage(b, 1, face)
+	}
+	return b
+}
+
+func marshalEnrollResponse(personID string, encodings int) []byte {
+	var b []byte
+	b = appendString(b, 1, personID)
+	b = appendInt32(b, 2, encodings)
+	return b
+}
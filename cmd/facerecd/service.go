@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+)
+
+// Bounds on request sizes beyond the per-request options of facerec.RequestLimits
+const (
+	maxCandidates   = 20
+	maxEnrollImages = 32
+)
+
+// service implements the FaceRecognition service of facerec.proto
+type service struct {
+	pool   *facerec.RecognizerPool
+	db     *facerec.FaceDB
+	limits facerec.RequestLimits
+	// enrollToken is the bearer token Enroll calls must present; Enroll is refused when it is empty
+	enrollToken []byte
+	// enrollMu keeps the database file consistent with the enrollments saved to it
+	enrollMu sync.Mutex
+}
+
+// methods returns the handlers of the service, keyed by their gRPC path
+func (s *service) methods() map[string]unaryMethod {
+	const prefix = "/facerec.v1.FaceRecognition/"
+	return map[string]unaryMethod{
+		prefix + "Detect":              s.detect,
+		prefix + "Encode":              s.encode,
+		prefix + "Identify":            s.identify,
+		prefix + "Enroll":              s.enroll,
+		"/grpc.health.v1.Health/Check": healthCheck,
+	}
+}
+
+// healthCheck answers the standard gRPC health check with SERVING, for load balancers and orchestrators
+func healthCheck(ctx context.Context, req []byte) ([]byte, error) {
+	return appendVarint(nil, 1, 1), nil
+}
+
+func (s *service) detect(ctx context.Context, b []byte) ([]byte, error) {
+	img, opts, _, err := s.readImageRequest(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var faces []facerec.ScoredRectangle
+	err = s.pool.WithRecognizer(ctx, func(fr *facerec.FaceRecognizer) error {
+		faces, err = fr.FaceLocationsWithScores(img, opts.UpsampleTimes, opts.Model)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(faces, func(i, j int) bool {
+		return faces[i].Area() > faces[j].Area()
+	})
+	return marshalDetectResponse(faces[:min(len(faces), opts.MaxFaces)], img.Width, img.Height), nil
+}
+
+func (s *service) encode(ctx context.Context, b []byte) ([]byte, error) {
+	img, opts, _, err := s.readImageRequest(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var faces []facerec.Face
+	err = s.pool.WithRecognizer(ctx, func(fr *facerec.FaceRecognizer) error {
+		faces, err = fr.EncodeLargestFaces(img, opts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return marshalEncodeResponse(faces), nil
+}
+
+func (s *service) identify(ctx context.Context, b []byte) ([]byte, error) {
+	img, opts, req, err := s.readImageRequest(b)
+	if err != nil {
+		return nil, err
+	}
+	if req.candidates < 0 || req.candidates > maxCandidates {
+		return nil, invalidArgumentf("candidates must be between 0 and %d", maxCandidates)
+	}
+
+	var faces []facerec.IdentifiedFace
+	err = s.pool.WithRecognizer(ctx, func(fr *facerec.FaceRecognizer) error {
+		faces, err = fr.Identify(img, s.db, facerec.IdentifyOptions{
+			Tolerance:     opts.Tolerance,
+			UpsampleTimes: opts.UpsampleTimes,
+			NumJitters:    opts.NumJitters,
+			Model:         opts.Model,
+			Candidates:    req.candidates,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(faces, func(i, j int) bool {
+		return faces[i].Rectangle.Area() > faces[j].Rectangle.Area()
+	})
+	return marshalIdentifyResponse(faces[:min(len(faces), opts.MaxFaces)]), nil
+}
+
+func (s *service) enroll(ctx context.Context, b []byte) ([]byte, error) {
+	if err := s.authorizeEnroll(ctx); err != nil {
+		return nil, err
+	}
+	var req enrollRequest
+	if err := req.unmarshal(b); err != nil {
+		return nil, invalidArgumentf("bad request message: %v", err)
+	}
+	switch {
+	case req.personID == "" && req.name == "":
+		return nil, invalidArgumentf("name is required to enroll a new person")
+	case len(req.images) == 0:
+		return nil, invalidArgumentf("at least one image is required")
+	case len(req.images) > maxEnrollImages:
+		return nil, invalidArgumentf("at most %d images can be enrolled per request", maxEnrollImages)
+	}
+	if req.personID != "" {
+		if _, ok := s.db.Get(req.personID); !ok {
+			return nil, &facerec.PersonNotFoundError{ID: req.personID}
+		}
+	}
+	opts, err := s.limits.Resolve(req.options)
+	if err != nil {
+		return nil, err
+	}
+	// Only the largest face of every image is the person being enrolled
+	opts.MaxFaces = 1
+
+	var encodings []facerec.FaceEncoding
+	err = s.pool.WithRecognizer(ctx, func(fr *facerec.FaceRecognizer) error {
+		for i, data := range req.images {
+			img, err := facerec.LoadImageBytes(data)
+			if err != nil {
+				return fmt.Errorf("image %d: %w", i, err)
+			}
+			faces, err := fr.EncodeLargestFaces(img, opts)
+			if err != nil {
+				return fmt.Errorf("image %d: %w", i, err)
+			}
+			if len(faces) == 0 {
+				return fmt.Errorf("image %d: %w", i, facerec.ErrNoFace)
+			}
+			encodings = append(encodings, faces[0].Encoding)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	id, count, err := s.saveEnrollment(req, encodings)
+	if err != nil {
+		return nil, err
+	}
+	return marshalEnrollResponse(id, count), nil
+}
+
+// saveEnrollment adds the encodings to the database and saves it, returning the person ID and its
+// encoding count. The enrollment is undone when it cannot be saved, so the database served does not
+// hold people that are lost on the next restart
+func (s *service) saveEnrollment(req enrollRequest, encodings []facerec.FaceEncoding) (string, int, error) {
+	s.enrollMu.Lock()
+	defer s.enrollMu.Unlock()
+
+	var id string
+	var rollback func() error
+	if req.personID == "" {
+		var err error
+		if id, err = s.db.Add(req.name, encodings, req.metadata); err != nil {
+			return "", 0, err
+		}
+		rollback = func() error { return s.db.Remove(id) }
+	} else {
+		id = req.personID
+		before, ok := s.db.Get(id)
+		if !ok {
+			return "", 0, &facerec.PersonNotFoundError{ID: id}
+		}
+		after := before
+		after.Encodings = append(append([]facerec.FaceEncoding(nil), before.Encodings...), encodings...)
+		if err := s.db.Update(after); err != nil {
+			return "", 0, err
+		}
+		rollback = func() error { return s.db.Update(before) }
+	}
+	if err := s.db.Save(); err != nil {
+		if rerr := rollback(); rerr != nil {
+			return "", 0, fmt.Errorf("saving face database: %w (undoing the enrollment failed too: %v)", err, rerr)
+		}
+		return "", 0, fmt.Errorf("saving face database: %w", err)
+	}
+
+	person, _ := s.db.Get(id)
+	return id, len(person.Encodings), nil
+}
+
+// authorizeEnroll checks the bearer token in the authorization metadata of an Enroll call
+func (s *service) authorizeEnroll(ctx context.Context) error {
+	if len(s.enrollToken) == 0 {
+		return &facerec.UnauthorizedError{Reason: "enrollment is disabled, start facerecd with --enroll-token-file or " + enrollTokenEnv}
+	}
+	token, ok := strings.CutPrefix(callMetadata(ctx).Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), s.enrollToken) != 1 {
+		return &facerec.UnauthorizedError{Reason: "missing or invalid bearer token"}
+	}
+	return nil
+}
+
+// readImageRequest decodes an image request, resolves its options and loads its image
+func (s *service) readImageRequest(b []byte) (*facerec.ImageMatrix, facerec.RequestOptions, imageRequest, error) {
+	var req imageRequest
+	if err := req.unmarshal(b); err != nil {
+		return nil, facerec.RequestOptions{}, req, invalidArgumentf("bad request message: %v", err)
+	}
+	opts, err := s.limits.Resolve(req.options)
+	if err != nil {
+		return nil, opts, req, err
+	}
+	if len(req.image) == 0 {
+		return nil, opts, req, invalidArgumentf("image is required")
+	}
+	img, err := facerec.LoadImageBytes(req.image)
+	if err != nil {
+		return nil, opts, req, err
+	}
+	return img, opts, req, nil
+}
+
+// invalidArgumentf returns an error reported with INVALID_ARGUMENT and the invalid_argument code
+func invalidArgumentf(format string, args ...any) error {
+	return &facerec.APIError{Code: facerec.CodeInvalidArgument, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+)
+
+func TestAuthorizeEnroll(t *testing.T) {
+	call := func(authorization string) context.Context {
+		h := http.Header{}
+		if authorization != "" {
+			h.Set("Authorization", authorization)
+		}
+		return context.WithValue(context.Background(), metadataKey{}, h)
+	}
+
+	disabled := &service{}
+	if err := disabled.authorizeEnroll(call("Bearer secret")); !errors.Is(err, &facerec.UnauthorizedError{}) {
+		t.Errorf("without a token: got %v, want UnauthorizedError", err)
+	}
+
+	s := &service{enrollToken: []byte("secret")}
+	for _, authorization := range []string{"", "secret", "Bearer other", "Basic secret"} {
+		if err := s.authorizeEnroll(call(authorization)); !errors.Is(err, &facerec.UnauthorizedError{}) {
+			t.Errorf("%q: got %v, want UnauthorizedError", authorization, err)
+		}
+	}
+	if err := s.authorizeEnroll(call("Bearer secret")); err != nil {
+		t.Errorf("valid token: %v", err)
+	}
+}
+
+func TestSaveEnrollmentRollsBack(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "db")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	db, err := facerec.OpenFaceDB(filepath.Join(dir, "faces.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &service{db: db}
+	encodings := []facerec.FaceEncoding{{0: 1}}
+
+	id, count, err := s.saveEnrollment(enrollRequest{name: "Ada"}, encodings)
+	if err != nil || count != 1 {
+		t.Fatalf("enrolling: %d encodings, %v", count, err)
+	}
+
+	// Saving fails once the directory is gone
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.saveEnrollment(enrollRequest{name: "Grace"}, encodings); err == nil {
+		t.Fatal("expected the save to fail")
+	}
+	if db.Len() != 1 {
+		t.Errorf("failed enrollment of a new person left %d people, want 1", db.Len())
+	}
+	if _, _, err := s.saveEnrollment(enrollRequest{personID: id}, encodings); err == nil {
+		t.Fatal("expected the save to fail")
+	}
+	if p, _ := db.Get(id); len(p.Encodings) != 1 {
+		t.Errorf("failed enrollment of an existing person left %d encodings, want 1", len(p.Encodings))
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// The messages of facerec.proto are encoded by hand with the helpers below, which keeps the
+// module free of the protobuf and gRPC runtimes; see https://protobuf.dev/programming-guides/encoding
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("truncated protobuf message")
+
+func appendTag(b []byte, field, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+// appendVarint appends a varint field, omitting the proto3 default 0
+func appendVarint(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	return binary.AppendUvarint(appendTag(b, field, wireVarint), v)
+}
+
+// appendInt32 appends an int32 field, negative values take ten bytes as in the reference encoders
+func appendInt32(b []byte, field int, v int) []byte {
+	return appendVarint(b, field, uint64(int64(int32(v))))
+}
+
+func appendBool(b []byte, field int, v bool) []byte {
+	if !v {
+		return b
+	}
+	return appendVarint(b, field, 1)
+}
+
+func appendDouble(b []byte, field int, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	return binary.LittleEndian.AppendUint64(appendTag(b, field, wireFixed64), math.Float64bits(v))
+}
+
+func appendString(b []byte, field int, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = binary.AppendUvarint(appendTag(b, field, wireBytes), uint64(len(v)))
+	return append(b, v...)
+}
+
+// appendMessage appends an embedded message, also when it is empty so repeated entries keep their place
+func appendMessage(b []byte, field int, msg []byte) []byte {
+	b = binary.AppendUvarint(appendTag(b, field, wireBytes), uint64(len(msg)))
+	return append(b, msg...)
+}
+
+// appendPackedDoubles appends a repeated double field in the packed encoding proto3 uses by default
+func appendPackedDoubles(b []byte, field int, vs []float64) []byte {
+	if len(vs) == 0 {
+		return b
+	}
+	b = binary.AppendUvarint(appendTag(b, field, wireBytes), uint64(8*len(vs)))
+	for _, v := range vs {
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+	}
+	return b
+}
+
+// wireField is one decoded field; scalar values are in bits, length-delimited ones in data
+type wireField struct {
+	num      int
+	wireType int
+	bits     uint64
+	data     []byte
+}
+
+func (f wireField) int() int {
+	if f.wireType != wireVarint {
+		return 0
+	}
+	return int(int32(f.bits))
+}
+
+func (f wireField) bool() bool {
+	return f.wireType == wireVarint && f.bits != 0
+}
+
+func (f wireField) double() float64 {
+	if f.wireType != wireFixed64 {
+		return 0
+	}
+	return math.Float64frombits(f.bits)
+}
+
+func (f wireField) string() string {
+	return string(f.bytes())
+}
+
+func (f wireField) bytes() []byte {
+	if f.wireType != wireBytes {
+		return nil
+	}
+	return f.data
+}
+
+// doubles returns the values of a repeated double field, packed or not
+func (f wireField) doubles() ([]float64, error) {
+	switch f.wireType {
+	case wireFixed64:
+		return []float64{f.double()}, nil
+	case wireBytes:
+		if len(f.data)%8 != 0 {
+			return nil, fmt.Errorf("field %d: packed doubles of %d bytes", f.num, len(f.data))
+		}
+		vs := make([]float64, len(f.data)/8)
+		for i := range vs {
+			vs[i] = math.Float64frombits(binary.LittleEndian.Uint64(f.data[8*i:]))
+		}
+		return vs, nil
+	}
+	return nil, nil
+}
+
+// decodeFields calls fn with every field of a message in order; unknown fields are for fn to ignore
+func decodeFields(b []byte, fn func(f wireField) error) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errTruncated
+		}
+		b = b[n:]
+
+		f := wireField{num: int(tag >> 3), wireType: int(tag & 7)}
+		if f.num <= 0 {
+			return fmt.Errorf("invalid protobuf field number %d", f.num)
+		}
+		switch f.wireType {
+		case wireVarint:
+			if f.bits, n = binary.Uvarint(b); n <= 0 {
+				return errTruncated
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return errTruncated
+			}
+			f.bits, b = binary.LittleEndian.Uint64(b), b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return errTruncated
+			}
+			f.bits, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || size > uint64(len(b)-n) {
+				return errTruncated
+			}
+			f.data, b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", f.wireType)
+		}
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
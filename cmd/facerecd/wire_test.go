@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+)
+
+func TestWireRoundTrip(t *testing.T) {
+	var b []byte
+	b = appendInt32(b, 1, -7)
+	b = appendBool(b, 2, true)
+	b = appendDouble(b, 3, 0.25)
+	b = appendString(b, 4, "hello")
+	b = appendMessage(b, 5, nil)
+	b = appendPackedDoubles(b, 6, []float64{1, -2.5, math.MaxFloat64})
+	b = appendVarint(b, 7, 0) // omitted
+
+	var got []wireField
+	if err := decodeFields(b, func(f wireField) error {
+		got = append(got, f)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 6 {
+		t.Fatalf("decoded %d fields, want 6", len(got))
+	}
+	if got[0].int() != -7 || !got[1].bool() || got[2].double() != 0.25 || got[3].string() != "hello" || len(got[4].bytes()) != 0 {
+		t.Errorf("scalars decoded as %+v", got[:5])
+	}
+	doubles, err := got[5].doubles()
+	if err != nil || !reflect.DeepEqual(doubles, []float64{1, -2.5, math.MaxFloat64}) {
+		t.Errorf("packed doubles decoded as %v, %v", doubles, err)
+	}
+}
+
+func TestWireTruncated(t *testing.T) {
+	double := appendDouble(nil, 1, 3)
+	full := appendString(double, 2, "truncated")
+	for n := 1; n < len(full); n++ {
+		if n == len(double) {
+			continue // ends between the two fields
+		}
+		err := decodeFields(full[:n], func(wireField) error { return nil })
+		if !errors.Is(err, errTruncated) {
+			t.Errorf("%d of %d bytes: got %v, want errTruncated", n, len(full), err)
+		}
+	}
+}
+
+func TestEnrollRequestRoundTrip(t *testing.T) {
+	var opts []byte
+	opts = appendString(opts, 1, string(facerec.CNN))
+	opts = appendInt32(opts, 2, 2)
+	opts = appendInt32(opts, 3, 5)
+	opts = appendDouble(opts, 4, 0.5)
+	opts = appendInt32(opts, 5, 1)
+
+	var b []byte
+	b = appendString(b, 1, "p1")
+	b = appendString(b, 2, "Ada")
+	b = appendMessage(b, 3, []byte{0xff, 0xd8})
+	b = appendMessage(b, 3, []byte{0x89, 'P'})
+	b = appendMessage(b, 4, appendString(appendString(nil, 1, "team"), 2, "blue"))
+	b = appendMessage(b, 5, opts)
+
+	var req enrollRequest
+	if err := req.unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	want := enrollRequest{
+		personID: "p1",
+		name:     "Ada",
+		images:   [][]byte{{0xff, 0xd8}, {0x89, 'P'}},
+		metadata: map[string]string{"team": "blue"},
+		options:  facerec.RequestOptions{Model: facerec.CNN, UpsampleTimes: 2, NumJitters: 5, Tolerance: 0.5, MaxFaces: 1},
+	}
+	if !reflect.DeepEqual(req, want) {
+		t.Errorf("got %+v, want %+v", req, want)
+	}
+}
+
+func TestMarshalEncodeResponse(t *testing.T) {
+	var enc facerec.FaceEncoding
+	for i := range enc {
+		enc[i] = float64(i) / 128
+	}
+	face := facerec.Face{Rectangle: facerec.Rectangle{Top: 1, Right: 20, Bottom: 30, Left: 2}, Encoding: enc}
+
+	var faces [][]byte
+	err := decodeFields(marshalEncodeResponse([]facerec.Face{face}), func(f wireField) error {
+		faces = append(faces, f.bytes())
+		return nil
+	})
+	if err != nil || len(faces) != 1 {
+		t.Fatalf("got %d faces, %v", len(faces), err)
+	}
+
+	var rect facerec.Rectangle
+	var encoding []float64
+	err = decodeFields(faces[0], func(f wireField) (err error) {
+		switch f.num {
+		case 1:
+			err = decodeFields(f.bytes(), func(r wireField) error {
+				switch r.num {
+				case 1:
+					rect.Top = r.int()
+				case 2:
+					rect.Right = r.int()
+				case 3:
+					rect.Bottom = r.int()
+				case 4:
+					rect.Left = r.int()
+				}
+				return nil
+			})
+		case 2:
+			encoding, err = f.doubles()
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rect != face.Rectangle || !reflect.DeepEqual(encoding, enc[:]) {
+		t.Errorf("got %v %v, want %v %v", rect, encoding, face.Rectangle, enc)
+	}
+}
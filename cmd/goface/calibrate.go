@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+	"github.com/shafiqaimanx/go_face_recognition/internal/cli"
+)
+
+// runCalibrate fits a cross-camera correction from the same subjects captured on two cameras
+// Each directory holds one subdirectory per subject, named after the subject, with that subject's images
+func runCalibrate(args []string) error {
+	fs := flag.NewFlagSet("calibrate", flag.ContinueOnError)
+	refDir := fs.String("reference", "", "directory of subject images from the reference camera")
+	camDir := fs.String("camera", "", "directory of subject images from the camera to calibrate")
+	cameraID := fs.String("camera-id", "", "ID of the camera to calibrate")
+	out := fs.String("out", "calibrations.json", "calibration file, existing entries for other cameras are kept")
+	modelDir := fs.String("models", "", "models directory (defaults to the package models directory)")
+	jitters := fs.Int("jitters", 1, "number of jitters per encoding")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *refDir == "" || *camDir == "" || *cameraID == "" {
+		return cli.UsageErrorf("--reference, --camera and --camera-id are required")
+	}
+
+	fr, err := newRecognizer(*modelDir, *jitters)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	reference, err := encodeSubjects(fr, *refDir, *jitters)
+	if err != nil {
+		return err
+	}
+	camera, err := encodeSubjects(fr, *camDir, *jitters)
+	if err != nil {
+		return err
+	}
+
+	cal, err := facerec.CalibrateCamera(*cameraID, reference, camera)
+	if err != nil {
+		return err
+	}
+
+	calibrations, err := facerec.LoadCameraCalibrations(*out)
+	if errors.Is(err, os.ErrNotExist) {
+		calibrations = facerec.CameraCalibrations{}
+	} else if err != nil {
+		return err
+	}
+	calibrations[cal.CameraID] = cal
+
+	if err := facerec.SaveCameraCalibrations(*out, calibrations); err != nil {
+		return err
+	}
+
+	fmt.Printf("calibrate: camera %s fitted on %d subjects, score offset %.4f, saved to %s\n", cal.CameraID, cal.Subjects, cal.ScoreOffset, *out)
+	return nil
+}
+
+// encodeSubjects encodes the largest face of every image in each subject subdirectory of dir
+func encodeSubjects(fr *facerec.FaceRecognizer, dir string, jitters int) (map[string][]facerec.FaceEncoding, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	subjects := make(map[string][]facerec.FaceEncoding)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		files, err := os.ReadDir(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if file.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name(), file.Name())
+
+			img, err := facerec.LoadImageFile(path)
+			if err != nil {
+				fmt.Printf("calibrate: skipping %s: %v\n", path, err)
+				continue
+			}
+			locations, err := fr.FaceLocations(img, 1, facerec.HOG)
+			if err != nil {
+				return nil, err
+			}
+			if len(locations) == 0 {
+				fmt.Printf("calibrate: no face in %s\n", path)
+				continue
+			}
+
+			encs, err := fr.FaceEncodings(img, facerec.LargestFaces(locations, 1), jitters, facerec.LandmarkLarge)
+			if err != nil {
+				return nil, err
+			}
+			subjects[entry.Name()] = append(subjects[entry.Name()], encs...)
+		}
+	}
+	return subjects, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+	"github.com/shafiqaimanx/go_face_recognition/internal/cli"
+)
+
+// runCompare checks whether two images show the same person and reports the decision through the exit code
+// The largest face of each image is compared, so the command can gate scripts and CI jobs directly
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	tolerance := fs.Float64("tolerance", 0.6, "maximum distance for the faces to match")
+	quiet := fs.Bool("quiet", false, "print only the decision: match, no-match or no-face")
+	jitters := fs.Int("jitters", 1, "encoding jitters per face")
+	upsample := fs.Int("upsample", 1, "number of times to upsample images for detection")
+	modelDir := fs.String("models", "", "models directory (defaults to the package models directory)")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if len(positional) != 2 {
+		return cli.UsageErrorf("usage: goface compare <image1> <image2> [--tolerance 0.6] [--quiet]")
+	}
+
+	fr, err := newRecognizer(*modelDir, *jitters)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	var encodings [2]facerec.FaceEncoding
+	for i, path := range positional {
+		img, err := facerec.LoadImageFile(path)
+		if err != nil {
+			return err
+		}
+		locations, err := fr.FaceLocations(img, *upsample, facerec.HOG)
+		if err != nil {
+			return err
+		}
+		if len(locations) == 0 {
+			if *quiet {
+				fmt.Println("no-face")
+			} else {
+				fmt.Printf("no face in %s\n", path)
+			}
+			return cli.ExitStatus(cli.ExitNoFace)
+		}
+
+		encs, err := fr.FaceEncodings(img, facerec.LargestFaces(locations, 1), *jitters, facerec.LandmarkLarge)
+		if err != nil {
+			return err
+		}
+		if len(encs) == 0 {
+			return fmt.Errorf("no encoding produced for %s", path)
+		}
+		encodings[i] = encs[0]
+	}
+
+	distance := facerec.FaceDistance(encodings[0], encodings[1])
+	match := distance <= *tolerance
+	switch {
+	case *quiet && match:
+		fmt.Println("match")
+	case *quiet:
+		fmt.Println("no-match")
+	case match:
+		fmt.Printf("match distance=%.4f tolerance=%.2f\n", distance, *tolerance)
+	default:
+		fmt.Printf("no match distance=%.4f tolerance=%.2f\n", distance, *tolerance)
+	}
+
+	if !match {
+		return cli.ExitStatus(cli.ExitNoMatch)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+	"github.com/shafiqaimanx/go_face_recognition/internal/cli"
+)
+
+// encodedImage is the largest face of one image, ok is false when no face was found or the image failed to load
+type encodedImage struct {
+	Path     string
+	Encoding facerec.FaceEncoding
+	OK       bool
+}
+
+// runCompareAll computes the distance between every image of dir1 and every image of dir2
+// With a single directory the images are compared with each other, which is how duplicate identities are found
+func runCompareAll(args []string) error {
+	fs := flag.NewFlagSet("compare-all", flag.ContinueOnError)
+	csvPath := fs.String("csv", "", "write the distance matrix to this file (default stdout, with the summary on stderr)")
+	tolerance := fs.Float64("tolerance", 0.6, "maximum distance for a best match to count as a match")
+	jitters := fs.Int("jitters", 1, "encoding jitters per face")
+	upsample := fs.Int("upsample", 1, "number of times to upsample images for detection")
+	modelDir := fs.String("models", "", "models directory (defaults to the package models directory)")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if len(positional) != 1 && len(positional) != 2 {
+		return cli.UsageErrorf("usage: goface compare-all <dir1> [dir2] [--csv out.csv]")
+	}
+	self := len(positional) == 1
+
+	fr, err := newRecognizer(*modelDir, *jitters)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	rows, err := encodeDir(fr, positional[0], *upsample, *jitters)
+	if err != nil {
+		return err
+	}
+	cols := rows
+	if !self {
+		if cols, err = encodeDir(fr, positional[1], *upsample, *jitters); err != nil {
+			return err
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	summary := io.Writer(os.Stdout)
+	if *csvPath == "" {
+		summary = os.Stderr
+	} else {
+		f, err := os.Create(*csvPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w := csv.NewWriter(out)
+	header := []string{"file"}
+	for _, c := range cols {
+		header = append(header, c.Path)
+	}
+	header = append(header, "best_match", "best_distance")
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	for i, r := range rows {
+		record := []string{r.Path}
+		best, bestDist := -1, math.Inf(1)
+		for j, c := range cols {
+			if !r.OK || !c.OK {
+				record = append(record, "")
+				continue
+			}
+			d := facerec.FaceDistance(r.Encoding, c.Encoding)
+			record = append(record, strconv.FormatFloat(d, 'f', 4, 64))
+			if self && i == j {
+				continue
+			}
+			if d < bestDist {
+				best, bestDist = j, d
+			}
+		}
+
+		switch {
+		case !r.OK:
+			record = append(record, "", "")
+			fmt.Fprintf(summary, "%s: no face\n", r.Path)
+		case best < 0:
+			record = append(record, "", "")
+			fmt.Fprintf(summary, "%s: nothing to compare with\n", r.Path)
+		default:
+			record = append(record, cols[best].Path, strconv.FormatFloat(bestDist, 'f', 4, 64))
+			verdict := "no match"
+			if bestDist <= *tolerance {
+				verdict = "match"
+			}
+			fmt.Fprintf(summary, "%s: best %s distance=%.4f (%s)\n", r.Path, cols[best].Path, bestDist, verdict)
+		}
+
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+// encodeDir encodes the largest face of every image in dir, in name order
+// Images that fail to load or contain no face are kept with OK unset so the matrix still lists them
+func encodeDir(fr *facerec.FaceRecognizer, dir string, upsample, jitters int) ([]encodedImage, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	var images []encodedImage
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() || !cli.IsImageFile(path) {
+			continue
+		}
+		enc := encodedImage{Path: path}
+
+		img, err := facerec.LoadImageFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "compare-all: skipping %s: %v\n", path, err)
+			images = append(images, enc)
+			continue
+		}
+		locations, err := fr.FaceLocations(img, upsample, facerec.HOG)
+		if err != nil {
+			return nil, err
+		}
+		if len(locations) > 0 {
+			encs, err := fr.FaceEncodings(img, facerec.LargestFaces(locations, 1), jitters, facerec.LandmarkLarge)
+			if err != nil {
+				return nil, err
+			}
+			if len(encs) > 0 {
+				enc.Encoding, enc.OK = encs[0], true
+			}
+		}
+		images = append(images, enc)
+	}
+	return images, nil
+}
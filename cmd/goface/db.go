@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+	"github.com/shafiqaimanx/go_face_recognition/internal/cli"
+)
+
+// runDBReencode re-encodes every person's source images with another model and stores
+// the results next to the existing encodings, so both can be matched during a migration
+func runDBReencode(args []string) error {
+	fs := flag.NewFlagSet("db reencode", flag.ContinueOnError)
+	dbPath := fs.String("db", "", "face database file")
+	backend := fs.String("backend", facerec.DlibModelID, "encoder to re-encode with ("+strings.Join(facerec.EncoderBackends(), ", ")+")")
+	modelDir := fs.String("models", "", "models directory (defaults to the package models directory)")
+	chipDir := fs.String("chips", "", "crop cache directory; cached chips skip detection and new ones are added")
+	jitters := fs.Int("jitters", 1, "number of jitters for the dlib encoder")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *dbPath == "" {
+		return cli.UsageErrorf("--db is required")
+	}
+	if !slices.Contains(facerec.EncoderBackends(), *backend) {
+		return cli.UsageErrorf("backend %q is not available in this build (available: %s)", *backend, strings.Join(facerec.EncoderBackends(), ", "))
+	}
+
+	db, err := facerec.OpenFaceDB(*dbPath)
+	if err != nil {
+		return err
+	}
+
+	var opts facerec.ReencodeOptions
+	if *chipDir != "" {
+		if opts.Chips, err = facerec.OpenChipCache(*chipDir, 0); err != nil {
+			return err
+		}
+	}
+	opts.OnSkip = func(p facerec.Person, source string, err error) {
+		fmt.Printf("reencode: %s: %v\n", p.Name, err)
+	}
+
+	if *modelDir == "" {
+		*modelDir = facerec.DefaultModelsDir()
+	}
+	fr, err := newRecognizer(*modelDir, *jitters)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	encoder, err := facerec.NewEncoder(*backend, fr, *modelDir)
+	if err != nil {
+		return err
+	}
+	// Backends with a model of their own hold native resources, the dlib one is fr itself
+	if closer, ok := encoder.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	updated, skipped, err := facerec.ReencodeGallery(db, fr, encoder, opts)
+	if err != nil {
+		return err
+	}
+	if err := db.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("reencode: %d people re-encoded with %s, %d skipped (no usable sources)\n", updated, encoder.ModelID(), skipped)
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/shafiqaimanx/go_face_recognition/internal/cli"
+)
+
+// completion reads the command table, so it is added in init to avoid an initialization cycle
+func init() {
+	commands = append(commands, &cli.Command{Name: "completion", Args: "bash|zsh|fish", Summary: "print a shell completion script", Run: runCompletion})
+}
+
+// commandSchema is the --describe representation of a command
+type commandSchema struct {
+	Name        string          `json:"name"`
+	Args        string          `json:"args,omitempty"`
+	Summary     string          `json:"summary"`
+	Flags       []flagSchema    `json:"flags,omitempty"`
+	Subcommands []commandSchema `json:"subcommands,omitempty"`
+}
+
+// flagSchema is the --describe representation of a flag
+type flagSchema struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"` // bool, string, int, float, duration, ...
+	Default string `json:"default"`
+	Usage   string `json:"usage"`
+}
+
+// schema returns the command tree with the flags of every command
+func schema(list []*cli.Command) []commandSchema {
+	out := make([]commandSchema, 0, len(list))
+	for _, cmd := range list {
+		cs := commandSchema{Name: cmd.Name, Args: cmd.Args, Summary: cmd.Summary}
+		if cmd.Subcommands != nil {
+			cs.Subcommands = schema(cmd.Subcommands)
+		} else {
+			cs.Flags = commandFlags(cmd)
+		}
+		out = append(out, cs)
+	}
+	return out
+}
+
+// commandFlags runs cmd in describe mode, where it registers its flags and returns before doing any work
+func commandFlags(cmd *cli.Command) []flagSchema {
+	describing, describedFlags = true, nil
+	cmd.Run(nil)
+	fs := describedFlags
+	describing, describedFlags = false, nil
+
+	if fs == nil {
+		return nil
+	}
+
+	var flags []flagSchema
+	fs.VisitAll(func(f *flag.Flag) {
+		typ, usage := flag.UnquoteUsage(f)
+		if typ == "" {
+			typ = "bool"
+		}
+		if typ == "value" {
+			typ = "string"
+		}
+		flags = append(flags, flagSchema{Name: f.Name, Type: typ, Default: f.DefValue, Usage: usage})
+	})
+	return flags
+}
+
+// describe writes the full command and flag schema as JSON
+func describe(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(commandSchema{
+		Name:        "goface",
+		Summary:     "command-line front end for go_face_recognition",
+		Subcommands: schema(commands),
+	})
+}
+
+func runCompletion(args []string) error {
+	fs := flag.NewFlagSet("completion", flag.ContinueOnError)
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return cli.UsageErrorf("usage: goface completion bash|zsh|fish")
+	}
+
+	tree := schema(commands)
+	switch positional[0] {
+	case "bash":
+		writeBashCompletion(os.Stdout, tree)
+	case "zsh":
+		// zsh can run bash completion functions through bashcompinit
+		fmt.Fprintln(os.Stdout, "autoload -U +X bashcompinit && bashcompinit")
+		writeBashCompletion(os.Stdout, tree)
+	case "fish":
+		writeFishCompletion(os.Stdout, tree)
+	default:
+		return cli.UsageErrorf("unsupported shell %q (bash, zsh, fish)", positional[0])
+	}
+	return nil
+}
+
+func writeBashCompletion(w io.Writer, tree []commandSchema) {
+	fmt.Fprintln(w, "# goface bash completion, load with: source <(goface completion bash)")
+	fmt.Fprintln(w, "_goface() {")
+	fmt.Fprintln(w, `    local cur="${COMP_WORDS[COMP_CWORD]}"`)
+	fmt.Fprintln(w, `    local cmd="${COMP_WORDS[1]}" sub="${COMP_WORDS[2]}"`)
+	fmt.Fprintln(w, `    if [ "$COMP_CWORD" -eq 1 ]; then`)
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(append(names(tree), "--describe"), " "))
+	fmt.Fprintln(w, "        return")
+	fmt.Fprintln(w, "    fi")
+	fmt.Fprintln(w, `    case "$cmd" in`)
+	for _, c := range tree {
+		if c.Subcommands != nil {
+			fmt.Fprintf(w, "    %s)\n", c.Name)
+			fmt.Fprintln(w, `        if [ "$COMP_CWORD" -eq 2 ]; then`)
+			fmt.Fprintf(w, "            COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(names(c.Subcommands), " "))
+			fmt.Fprintln(w, "            return")
+			fmt.Fprintln(w, "        fi")
+			fmt.Fprintln(w, `        case "$sub" in`)
+			for _, s := range c.Subcommands {
+				fmt.Fprintf(w, "        %s) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", s.Name, flagWords(s.Flags))
+			}
+			fmt.Fprintln(w, "        esac")
+			fmt.Fprintln(w, "        ;;")
+			continue
+		}
+		words := flagWords(c.Flags)
+		if c.Name == "completion" {
+			words = "bash zsh fish"
+		}
+		fmt.Fprintf(w, "    %s)\n", c.Name)
+		fmt.Fprintf(w, "        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", words)
+		if c.Args != "" && c.Name != "completion" {
+			fmt.Fprintln(w, `        [[ "$cur" != -* ]] && COMPREPLY=($(compgen -f -- "$cur"))`)
+		}
+		fmt.Fprintln(w, "        ;;")
+	}
+	fmt.Fprintln(w, "    esac")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -o default -F _goface goface")
+}
+
+func writeFishCompletion(w io.Writer, tree []commandSchema) {
+	fmt.Fprintln(w, "# goface fish completion, load with: goface completion fish | source")
+	fmt.Fprintln(w, "complete -c goface -f")
+	fmt.Fprintln(w, "complete -c goface -n __fish_use_subcommand -l describe -d 'print the command and flag schema as JSON'")
+	for _, c := range tree {
+		fmt.Fprintf(w, "complete -c goface -n __fish_use_subcommand -a %s -d %s\n", c.Name, fishQuote(c.Summary))
+		cond := "__fish_seen_subcommand_from " + c.Name
+		for _, s := range c.Subcommands {
+			fmt.Fprintf(w, "complete -c goface -n '%s' -a %s -d %s\n", cond, s.Name, fishQuote(s.Summary))
+			for _, f := range s.Flags {
+				fmt.Fprintf(w, "complete -c goface -n '%s; and __fish_seen_subcommand_from %s' -l %s -d %s\n", cond, s.Name, f.Name, fishQuote(f.Usage))
+			}
+		}
+		for _, f := range c.Flags {
+			fmt.Fprintf(w, "complete -c goface -n '%s' -l %s -d %s\n", cond, f.Name, fishQuote(f.Usage))
+		}
+		if c.Name == "completion" {
+			fmt.Fprintf(w, "complete -c goface -n '%s' -a 'bash zsh fish'\n", cond)
+		}
+	}
+}
+
+func names(list []commandSchema) []string {
+	out := make([]string, len(list))
+	for i, c := range list {
+		out[i] = c.Name
+	}
+	return out
+}
+
+func flagWords(flags []flagSchema) string {
+	words := make([]string, len(flags))
+	for i, f := range flags {
+		words[i] = "--" + f.Name
+	}
+	return strings.Join(words, " ")
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", `\'`) + "'"
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+	"github.com/shafiqaimanx/go_face_recognition/internal/cli"
+)
+
+// historyRecord is one line of "goface history --output jsonl", the encoding is left out
+type historyRecord struct {
+	ID         string            `json:"id"`
+	Time       time.Time         `json:"time"`
+	CameraID   string            `json:"camera_id,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	Rectangle  facerec.Rectangle `json:"rectangle"`
+	PersonID   string            `json:"person_id,omitempty"`
+	Name       string            `json:"name,omitempty"`
+	Distance   float64           `json:"distance,omitempty"`
+	Confidence float64           `json:"confidence,omitempty"`
+	Snapshot   string            `json:"snapshot,omitempty"`
+}
+
+// runHistory lists recorded sightings, answering "when and where was this person seen?"
+func runHistory(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	storePath := fs.String("store", "sightings.jsonl", "sighting log written by goface watch --store")
+	person := fs.String("person", "", "person ID or name")
+	unknown := fs.Bool("unknown", false, "only list unrecognized faces")
+	camera := fs.String("camera", "", "only list sightings from this camera")
+	from := fs.String("from", "", "start time, RFC 3339 or YYYY-MM-DD, or a duration like 24h meaning that long ago")
+	to := fs.String("to", "", "end time (exclusive), same formats as --from")
+	limit := fs.Int("limit", 0, "show at most this many of the most recent sightings")
+	output := fs.String("output", "text", "output format: text or jsonl")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if len(positional) != 0 {
+		return cli.UsageErrorf("usage: goface history [--person alice] [--from 2024-01-01] [--to 24h]")
+	}
+	if *output != "text" && *output != "jsonl" {
+		return cli.UsageErrorf("unknown --output %q (text, jsonl)", *output)
+	}
+
+	q := facerec.SightingQuery{Person: *person, CameraID: *camera, Unknown: *unknown, Limit: *limit}
+	if q.From, err = parseTimeFlag(*from); err != nil {
+		return cli.UsageErrorf("--from: %v", err)
+	}
+	if q.To, err = parseTimeFlag(*to); err != nil {
+		return cli.UsageErrorf("--to: %v", err)
+	}
+
+	// Opening creates missing logs, which would hide a mistyped path
+	if _, err := os.Stat(*storePath); err != nil {
+		return err
+	}
+	store, err := facerec.OpenSightingStore(*storePath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	store.OnCorruptLine = func(offset int64, err error) {
+		fmt.Fprintf(os.Stderr, "skipping corrupt sighting at offset %d: %v\n", offset, err)
+	}
+
+	sightings, err := store.Query(q)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, s := range sightings {
+		if *output == "jsonl" {
+			enc.Encode(historyRecord{
+				ID: s.ID, Time: s.Time, CameraID: s.CameraID, Source: s.Source, Rectangle: s.Rectangle,
+				PersonID: s.PersonID, Name: s.Name, Distance: s.Distance, Confidence: s.Confidence, Snapshot: s.Snapshot,
+			})
+			continue
+		}
+
+		who := "unknown"
+		if s.PersonID != "" {
+			who = fmt.Sprintf("%s (%.0f%%)", s.Name, s.Confidence*100)
+		}
+		line := fmt.Sprintf("%s  %-12s %s", s.Time.Local().Format("2006-01-02 15:04:05"), s.CameraID, who)
+		if s.Snapshot != "" {
+			line += "  " + s.Snapshot
+		} else if s.Source != "" {
+			line += "  " + s.Source
+		}
+		fmt.Println(line)
+	}
+	if *output == "text" {
+		fmt.Fprintf(os.Stderr, "%d sightings\n", len(sightings))
+	}
+	return nil
+}
+
+// parseTimeFlag accepts RFC 3339, a date, a local date and time, or a duration meaning that long ago
+func parseTimeFlag(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as a time", v)
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+	"github.com/shafiqaimanx/go_face_recognition/internal/cli"
+)
+
+// indexRecord is one line of the "goface index" output, written once an image is done
+type indexRecord struct {
+	File   string        `json:"file"`
+	Width  int           `json:"width,omitempty"`
+	Height int           `json:"height,omitempty"`
+	Faces  []indexedFace `json:"faces,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// indexedFace is a face of an indexRecord, in the coordinates of the original image
+type indexedFace struct {
+	Rectangle facerec.Rectangle    `json:"rectangle"`
+	Encoding  facerec.FaceEncoding `json:"encoding"`
+}
+
+// indexStats are the running totals shown by the progress bar and the final report
+type indexStats struct {
+	done, faces, noFace, failed int
+}
+
+// runIndex encodes every face of every image under a directory with a pool of workers
+// Each image becomes one JSON line of --out, written when the image is complete, so the output
+// doubles as the checkpoint: running the same command again skips the images already in it
+func runIndex(args []string) error {
+	fset := flag.NewFlagSet("index", flag.ContinueOnError)
+	workers := fset.Int("workers", runtime.NumCPU(), "parallel decode+encode workers, each loads its own models")
+	out := fset.String("out", "faces.jsonl", "output file, one JSON line per image; also the resume checkpoint")
+	indexPath := fset.String("index", "", "when done, build a search index of every face in --out and save it here")
+	maxDim := fset.Int("max-dim", 1600, "downscale images so neither side exceeds this before detection (0 keeps full size)")
+	upsample := fset.Int("upsample", 1, "number of times to upsample images for detection")
+	jitters := fset.Int("jitters", 1, "number of jitters when encoding")
+	retryFailed := fset.Bool("retry-failed", false, "process images again that failed in a previous run")
+	quiet := fset.Bool("quiet", false, "no progress bar")
+	modelDir := fset.String("models", "", "models directory (defaults to the package models directory)")
+	positional, err := parseFlags(fset, args)
+	if err != nil {
+		return err
+	}
+
+	if len(positional) != 1 {
+		return cli.UsageErrorf("usage: goface index <dir> [--workers N] [--out faces.jsonl] [--index faces.gfix]")
+	}
+	if *workers < 1 {
+		return cli.UsageErrorf("--workers must be at least 1")
+	}
+
+	// Absolute paths keep the checkpoint valid when resuming from another working directory
+	root, err := filepath.Abs(positional[0])
+	if err != nil {
+		return err
+	}
+
+	done, err := readIndexCheckpoint(*out, *retryFailed)
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && cli.IsImageFile(path) && !done[path] {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	skipped := len(done)
+
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	config, err := recognizerConfig(*modelDir, *jitters)
+	if err != nil {
+		return err
+	}
+	pool, err := facerec.NewRecognizerPool(config, min(*workers, max(len(paths), 1)))
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	// Interrupting or terminating stops handing out images; those in flight are finished and written
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	jobs := make(chan string)
+	go func() {
+		defer close(jobs)
+		for _, path := range paths {
+			select {
+			case jobs <- path:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	records := make(chan indexRecord, *workers)
+	var wg sync.WaitGroup
+	for i := 0; i < pool.Size(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fr, err := pool.Acquire(context.Background())
+			if err != nil {
+				return
+			}
+			defer pool.Release(fr)
+			for path := range jobs {
+				records <- indexImage(fr, path, *maxDim, *upsample, *jitters)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(records)
+	}()
+
+	start := time.Now()
+	var stats indexStats
+	var mu sync.Mutex
+	progressDone := make(chan struct{})
+	if !*quiet {
+		go func() {
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					mu.Lock()
+					s := stats
+					mu.Unlock()
+					fmt.Fprint(os.Stderr, "\r"+indexProgress(s, len(paths), time.Since(start)))
+				case <-progressDone:
+					return
+				}
+			}
+		}()
+	}
+
+	enc := json.NewEncoder(w)
+	var writeErr error
+	for rec := range records {
+		if writeErr == nil {
+			if writeErr = enc.Encode(rec); writeErr == nil && len(records) == 0 {
+				// Flush whenever the workers are ahead, so an interrupted run loses as little as possible
+				writeErr = w.Flush()
+			}
+			if writeErr != nil {
+				stop()
+			}
+		}
+
+		mu.Lock()
+		stats.done++
+		switch {
+		case rec.Error != "":
+			stats.failed++
+		case len(rec.Faces) == 0:
+			stats.noFace++
+		default:
+			stats.faces += len(rec.Faces)
+		}
+		mu.Unlock()
+	}
+	close(progressDone)
+	if writeErr == nil {
+		writeErr = w.Flush()
+	}
+
+	elapsed := time.Since(start)
+	if !*quiet {
+		fmt.Fprintln(os.Stderr, "\r"+indexProgress(stats, len(paths), elapsed))
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(stats.done) / elapsed.Seconds()
+	}
+	fmt.Printf("index: %d images processed in %s (%.1f images/s), %d skipped from a previous run\n", stats.done, elapsed.Round(time.Second), rate, skipped)
+	fmt.Printf("index: %d faces found, %d images without faces, %d failures\n", stats.faces, stats.noFace, stats.failed)
+	if remaining := len(paths) - stats.done; remaining > 0 {
+		fmt.Printf("index: interrupted with %d images left, run the same command again to resume\n", remaining)
+		return nil
+	}
+
+	if *indexPath != "" {
+		n, err := buildFaceIndex(*out, *indexPath)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("index: %d faces written to %s\n", n, *indexPath)
+	}
+	return nil
+}
+
+// indexImage decodes, downscales, detects and encodes one image
+func indexImage(fr *facerec.FaceRecognizer, path string, maxDim, upsample, jitters int) indexRecord {
+	rec := indexRecord{File: path}
+
+	img, err := facerec.LoadImageFile(path)
+	if err != nil {
+		rec.Error = err.Error()
+		return rec
+	}
+	rec.Width, rec.Height = img.Width, img.Height
+
+	// Faces in large photos stay well above the encoder's 150px chip after downscaling,
+	// while detection time falls with the pixel count
+	scaled := img.ResizeMaxDim(maxDim)
+	scale := float64(img.Width) / float64(scaled.Width)
+
+	faces, err := fr.DetectAndEncode(scaled, upsample, jitters)
+	if err != nil {
+		rec.Error = err.Error()
+		return rec
+	}
+
+	for _, face := range faces {
+		r := face.Rectangle
+		rec.Faces = append(rec.Faces, indexedFace{
+			Rectangle: facerec.Rectangle{
+				Top:    int(float64(r.Top) * scale),
+				Right:  min(int(float64(r.Right)*scale), img.Width),
+				Bottom: min(int(float64(r.Bottom)*scale), img.Height),
+				Left:   int(float64(r.Left) * scale),
+			},
+			Encoding: face.Encoding,
+		})
+	}
+	return rec
+}
+
+// indexProgress renders the progress bar line
+func indexProgress(s indexStats, total int, elapsed time.Duration) string {
+	const width = 30
+	frac := 1.0
+	if total > 0 {
+		frac = float64(s.done) / float64(total)
+	}
+	filled := int(frac * width)
+	bar := strings.Repeat("#", filled) + strings.Repeat(".", width-filled)
+
+	rate, eta := 0.0, "--"
+	if secs := elapsed.Seconds(); secs > 0 && s.done > 0 {
+		rate = float64(s.done) / secs
+		eta = (time.Duration(float64(total-s.done)/rate) * time.Second).Round(time.Second).String()
+	}
+	return fmt.Sprintf("[%s] %d/%d %5.1f%% %.1f img/s ETA %s faces %d failed %d ", bar, s.done, total, frac*100, rate, eta, s.faces, s.failed)
+}
+
+// readIndexCheckpoint returns the images already recorded in an output file
+// A line cut off by a crash is truncated away so appending starts on a clean line
+func readIndexCheckpoint(path string, retryFailed bool) (map[string]bool, error) {
+	done := make(map[string]bool)
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var offset int64
+	err = scanIndexRecords(f, func(rec indexRecord, end int64) {
+		offset = end
+		if rec.Error == "" || !retryFailed {
+			done[rec.File] = true
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if info, err := f.Stat(); err == nil && info.Size() > offset {
+		if err := f.Truncate(offset); err != nil {
+			return nil, err
+		}
+	}
+	return done, nil
+}
+
+// scanIndexRecords calls fn with every complete record of r and the offset just past it
+func scanIndexRecords(r io.Reader, fn func(rec indexRecord, end int64)) error {
+	br := bufio.NewReaderSize(r, 1<<20)
+	var offset int64
+	for {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// Without its newline the last line may be incomplete, it is rewritten on resume
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		offset += int64(len(line))
+
+		var rec indexRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("corrupt record ending at byte %d: %w", offset, err)
+		}
+		fn(rec, offset)
+	}
+}
+
+// buildFaceIndex loads every face of the output file into a FaceIndex and saves it
+// Faces are identified as "<file>#<n>", n counting the faces of the file from 0
+func buildFaceIndex(out, indexPath string) (int, error) {
+	f, err := os.Open(out)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	ix := facerec.NewFaceIndex(facerec.DefaultIndexConfig())
+	err = scanIndexRecords(f, func(rec indexRecord, _ int64) {
+		for i, face := range rec.Faces {
+			ix.Insert(fmt.Sprintf("%s#%d", rec.File, i), face.Encoding)
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	return ix.Len(), ix.Save(indexPath)
+}
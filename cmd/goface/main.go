@@ -0,0 +1,109 @@
+// Command goface is a command-line front end for the go_face_recognition package
+//
+// Exit codes:
+//
+//	0   success; for compare, the faces match
+//	1   compare: the faces do not match
+//	2   no face found in an input image
+//	11  usage error (unknown command, bad or missing flags)
+//	12  runtime error (models, I/O, native failures)
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+	"github.com/shafiqaimanx/go_face_recognition/internal/cli"
+)
+
+var commands = []*cli.Command{
+	{Name: "compare", Args: "<image1> <image2>", Summary: "check whether two images show the same person (exit 0 match, 1 no match, 2 no face)", Run: runCompare},
+	{Name: "compare-all", Args: "<dir1> [dir2]", Summary: "write the pairwise distance matrix of two image directories with the best match per file", Run: runCompareAll},
+	{Name: "index", Args: "<dir>", Summary: "bulk-encode every face under a directory in parallel, resumable, with progress and ETA", Run: runIndex},
+	{Name: "history", Summary: "list recorded sightings of a person, camera or time range", Run: runHistory},
+	{Name: "serve", Summary: "HTTP API over the sighting archive: POST /search finds past sightings of a photo's face", Run: runServe},
+	{Name: "soak", Summary: "run randomized detect/encode cycles and fail on native memory growth", Run: runSoak},
+	{Name: "db", Summary: "manage face databases", Subcommands: []*cli.Command{
+		{Name: "reencode", Summary: "re-encode every person's source images or cached chips with another model", Run: runDBReencode},
+	}},
+	{Name: "calibrate", Summary: "fit a cross-camera encoding correction from shared subjects", Run: runCalibrate},
+	{Name: "tui", Args: "[name=]<dir>...", Summary: "live terminal dashboard of FPS, queues, drops and identifications per camera directory", Run: runTUI},
+	{Name: "watch", Args: "<dir>", Summary: "detect and identify faces in a directory of images, optionally following new files", Run: runWatch},
+}
+
+func main() {
+	// goface can serve as the worker binary for facerec.IsolatedRecognizer
+	facerec.RunWorkerIfRequested()
+
+	if len(os.Args) < 2 {
+		cli.Usage("goface", commands, "goface --describe")
+		os.Exit(cli.ExitUsage)
+	}
+
+	if os.Args[1] == "--describe" || os.Args[1] == "-describe" {
+		if err := describe(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "goface: %v\n", err)
+			os.Exit(cli.ExitFailure)
+		}
+		return
+	}
+
+	os.Exit(cli.Dispatch("goface", commands, os.Args[1:]))
+}
+
+// describing makes parseFlags record the flag set of a command instead of parsing, see describe
+var (
+	describing     bool
+	describedFlags *flag.FlagSet
+)
+
+// parseFlags parses flags that may appear before or after positional arguments and returns the positionals
+// Commands return its error as it is; while describing it is ExitStatus(0), so they stop without
+// doing any work
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	if describing {
+		describedFlags = fs
+		return nil, cli.ExitStatus(0)
+	}
+
+	return cli.ParseFlags(fs, args)
+}
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// newRecognizer builds a FaceRecognizer from the default config, optionally overriding the models directory
+func newRecognizer(modelDir string, jitters int) (*facerec.FaceRecognizer, error) {
+	config, err := recognizerConfig(modelDir, jitters)
+	if err != nil {
+		return nil, err
+	}
+	return facerec.NewFaceRecognizer(config)
+}
+
+// recognizerConfig returns the default config for modelDir, downloading missing models first
+func recognizerConfig(modelDir string, jitters int) (facerec.Config, error) {
+	if modelDir == "" {
+		modelDir = facerec.DefaultModelsDir()
+	}
+
+	if err := facerec.EnsureModelsWithOptions(modelDir, facerec.DownloadOptions{Progress: facerec.TerminalProgress}); err != nil {
+		return facerec.Config{}, err
+	}
+	return facerec.Config{
+		ModelPaths: facerec.DefaultModelPaths(modelDir),
+		NumJitters: jitters,
+	}, nil
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+	"github.com/shafiqaimanx/go_face_recognition/internal/cli"
+	"github.com/shafiqaimanx/go_face_recognition/security"
+)
+
+// maxUploadBytes bounds probe photos accepted by the server
+const maxUploadBytes = 20 << 20
+
+// searchResult is one entry of the POST /search response
+type searchResult struct {
+	Distance   float64           `json:"distance"`
+	SightingID string            `json:"sighting_id"`
+	Time       time.Time         `json:"time"`
+	CameraID   string            `json:"camera_id,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	TrackID    string            `json:"track_id,omitempty"`
+	Rectangle  facerec.Rectangle `json:"rectangle"`
+	PersonID   string            `json:"person_id,omitempty"`
+	Name       string            `json:"name,omitempty"`
+	Snapshot   string            `json:"snapshot,omitempty"`
+}
+
+// searchResponse is the body of a POST /search response
+type searchResponse struct {
+	Probe   facerec.Rectangle `json:"probe"` // face of the uploaded photo that was searched for
+	Results []searchResult    `json:"results"`
+	// Faces holds every face searched for, largest first, when the request set max_faces above 1
+	Faces []faceSearch `json:"faces,omitempty"`
+}
+
+// faceSearch is the search for one face of the uploaded photo
+type faceSearch struct {
+	Probe   facerec.Rectangle `json:"probe"`
+	Results []searchResult    `json:"results"`
+}
+
+// runServe serves an HTTP API over the sighting archive
+//
+//	POST /search?k=20&tolerance=0.6&model=hog&upsample=1&jitters=1&max_faces=1
+//
+// takes a photo, as the raw body or the "image" field of a multipart form, and returns the past
+// sightings of its largest face ranked by distance
+// model, upsample, jitters, tolerance and max_faces override the server defaults for the request,
+// within the --max-* limits; with max_faces above 1 the largest faces are searched for separately
+//
+// With --db the server also acts as a gallery shard for facerec.Coordinator, answering POST /match
+// with the closest people of the database, and GET /replicate with its changes; both only serve
+// requests signed with the key ring shared by the nodes (--peer-keys or $GOFACE_PEER_KEY)
+// Every --peer is polled for changes to the database, which are merged last-writer-wins and saved
+//
+// On SIGINT or SIGTERM the server stops accepting connections, lets requests in flight finish
+// within --shutdown-timeout, saves and flushes its stores and only then releases the models
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", ":8080", "listen address")
+	storePath := fs.String("store", "sightings.jsonl", "sighting log written by goface watch --store")
+	upsample := fs.Int("upsample", 1, "default number of times to upsample probe photos for detection")
+	jitters := fs.Int("jitters", 1, "default number of jitters when encoding probe faces")
+	maxUpsample := fs.Int("max-upsample", 2, "highest upsample a request may ask for")
+	maxJitters := fs.Int("max-jitters", 10, "highest jitters a request may ask for")
+	maxFaces := fs.Int("max-faces", 10, "most faces of a photo a request may search for")
+	allowCNN := fs.Bool("allow-cnn", false, "let requests pick the CNN detector with model=cnn")
+	modelDir := fs.String("models", "", "models directory (defaults to the package models directory)")
+	dbPath := fs.String("db", "", "face database shard to serve at POST /match")
+	nodeID := fs.String("node-id", "", "replica ID of this node for --db (defaults to the one stored in the database)")
+	syncInterval := fs.Duration("sync-interval", 5*time.Second, "how often --peer nodes are polled for changes")
+	peerKeys := fs.String("peer-keys", "", "key ring shared by the nodes, signing and checking /match and /replicate requests (defaults to a key in $"+peerKeyEnv+")")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 25*time.Second, "how long in-flight requests may take to finish on shutdown")
+	var peers stringList
+	fs.Var(&peers, "peer", "base URL of another node serving the same database, repeatable")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return cli.UsageErrorf("usage: goface serve [--addr :8080] [--store sightings.jsonl] [--db shard.json [--peer url]...]")
+	}
+	if (len(peers) > 0 || *nodeID != "") && *dbPath == "" {
+		return cli.UsageErrorf("--peer and --node-id require --db")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	mux := http.NewServeMux()
+	var db *facerec.FaceDB
+	replDone := make(chan struct{})
+	if *dbPath != "" {
+		var err error
+		if db, err = facerec.OpenFaceDB(*dbPath); err != nil {
+			return err
+		}
+		if *nodeID != "" {
+			db.SetNodeID(*nodeID)
+		}
+		keys, err := loadPeerKeys(*peerKeys)
+		if err != nil {
+			return err
+		}
+		mux.Handle("/match", facerec.NewMatcherHandler(db, keys))
+		mux.Handle("/replicate", facerec.NewReplicationHandler(db, keys))
+		log.Printf("serving shard %s at /match as node %s", *dbPath, db.NodeID())
+
+		if len(peers) > 0 {
+			config := facerec.ReplicatorConfig{
+				Peers:    peers,
+				Interval: *syncInterval,
+				Keys:     keys,
+				Save:     true,
+				OnError:  func(peer string, err error) { log.Printf("replication: %v", err) },
+			}
+			if err := config.Validate(); err != nil {
+				return err
+			}
+			repl := facerec.NewReplicator(db, config)
+			go func() {
+				defer close(replDone)
+				repl.Run(ctx)
+			}()
+		}
+	}
+	if *dbPath == "" || len(peers) == 0 {
+		close(replDone)
+	}
+
+	store, err := facerec.OpenSightingStore(*storePath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	store.OnCorruptLine = func(offset int64, err error) {
+		log.Printf("skipping corrupt sighting at offset %d of %s: %v", offset, *storePath, err)
+	}
+
+	index, err := facerec.NewSightingIndex(store, facerec.DefaultIndexConfig())
+	if err != nil {
+		return err
+	}
+	log.Printf("indexed %d sightings from %s", index.Len(), *storePath)
+
+	fr, err := newRecognizer(*modelDir, 1)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	limits := facerec.RequestLimits{
+		Defaults:    facerec.RequestOptions{Model: facerec.HOG, UpsampleTimes: *upsample, NumJitters: *jitters},
+		Models:      []facerec.DetectionModel{facerec.HOG},
+		MaxUpsample: *maxUpsample,
+		MaxJitters:  *maxJitters,
+		MaxFaces:    *maxFaces,
+	}
+	if *allowCNN {
+		limits.Models = append(limits.Models, facerec.CNN)
+	}
+	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		handleSearch(w, r, fr, index, limits)
+	})
+
+	srv := &http.Server{Addr: *addr, Handler: mux}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+	log.Printf("listening on %s", *addr)
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down, waiting up to %s for requests in flight", *shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("http shutdown: %w", err))
+	}
+	select {
+	case <-replDone:
+	case <-shutdownCtx.Done():
+		errs = append(errs, errors.New("replication still running at shutdown deadline"))
+	}
+	if db != nil && len(peers) > 0 {
+		errs = append(errs, db.Save())
+	}
+	errs = append(errs, store.Flush())
+	return errors.Join(errs...)
+}
+
+// peerKeyEnv holds the secret shared by the nodes when no --peer-keys ring is given, as "hex:..." or
+// "base64:...", see security.ParseSecret
+const peerKeyEnv = "GOFACE_PEER_KEY"
+
+// loadPeerKeys loads the key ring at path, or the single key in $GOFACE_PEER_KEY without one
+func loadPeerKeys(path string) (*security.KeyRing, error) {
+	if path != "" {
+		return security.LoadKeyRing(path)
+	}
+	key, err := security.KeyFromEnv(peerKeyEnv)
+	if err != nil {
+		return nil, fmt.Errorf("--db needs a key shared with the other nodes, pass --peer-keys or set %s: %w", peerKeyEnv, err)
+	}
+	return security.NewKeyRing(key), nil
+}
+
+func handleSearch(w http.ResponseWriter, r *http.Request, fr *facerec.FaceRecognizer, index *facerec.SightingIndex, limits facerec.RequestLimits) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		httpError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+
+	k := 20
+	if v := r.URL.Query().Get("k"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			badRequest(w, "bad k")
+			return
+		}
+		k = n
+	}
+	opts, err := facerec.ParseRequestOptions(r.URL.Query())
+	if err == nil {
+		opts, err = limits.Resolve(opts)
+	}
+	if err != nil {
+		facerec.WriteHTTPError(w, err)
+		return
+	}
+
+	data, err := readUpload(w, r)
+	if err != nil {
+		badRequest(w, err.Error())
+		return
+	}
+	img, err := facerec.LoadImageBytes(data)
+	if err != nil {
+		facerec.WriteHTTPError(w, err)
+		return
+	}
+
+	locations, err := fr.FaceLocations(img, opts.UpsampleTimes, opts.Model)
+	if err != nil {
+		facerec.WriteHTTPError(w, err)
+		return
+	}
+	if len(locations) == 0 {
+		facerec.WriteHTTPError(w, facerec.ErrNoFace)
+		return
+	}
+	probes := facerec.LargestFaces(locations, opts.MaxFaces)
+	encodings, err := fr.FaceEncodings(img, probes, opts.NumJitters, facerec.LandmarkLarge)
+	if err == nil && len(encodings) != len(probes) {
+		err = errors.New("no encoding computed")
+	}
+	if err != nil {
+		facerec.WriteHTTPError(w, fmt.Errorf("failed to encode face: %w", err))
+		return
+	}
+
+	// Pick up sightings recorded since the last request
+	if err := index.Refresh(); err != nil {
+		log.Printf("search: refreshing index: %v", err)
+	}
+
+	var resp searchResponse
+	for i, probe := range probes {
+		search := faceSearch{Probe: probe, Results: []searchResult{}}
+		for _, m := range index.Search(encodings[i], k, opts.Tolerance) {
+			s := m.Sighting
+			search.Results = append(search.Results, searchResult{
+				Distance: m.Distance, SightingID: s.ID, Time: s.Time, CameraID: s.CameraID, Source: s.Source,
+				TrackID: s.TrackID, Rectangle: s.Rectangle, PersonID: s.PersonID, Name: s.Name, Snapshot: s.Snapshot,
+			})
+		}
+		if i == 0 {
+			resp.Probe, resp.Results = search.Probe, search.Results
+		}
+		if opts.MaxFaces > 1 {
+			resp.Faces = append(resp.Faces, search)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// readUpload returns the image of a request, from the "image" multipart field or the raw body
+func readUpload(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+
+	if err := r.ParseMultipartForm(maxUploadBytes); err == nil {
+		f, _, err := r.FormFile("image")
+		if err != nil {
+			return nil, errors.New(`multipart requests need an "image" file field`)
+		}
+		defer f.Close()
+		return io.ReadAll(f)
+	} else if !errors.Is(err, http.ErrNotMultipart) {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty request body")
+	}
+	return data, nil
+}
+
+// badRequest reports an invalid request with the package's error codes, see facerec.WriteHTTPError
+func badRequest(w http.ResponseWriter, msg string) {
+	facerec.WriteHTTPError(w, &facerec.APIError{Code: facerec.CodeInvalidArgument, Message: msg})
+}
+
+func httpError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
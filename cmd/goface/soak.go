@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+	"github.com/shafiqaimanx/go_face_recognition/internal/cli"
+)
+
+// soakSample is a single memory measurement taken during a soak run
+type soakSample struct {
+	Elapsed     time.Duration
+	RSS         uint64
+	Outstanding int64 // C buffers allocated but not yet freed
+	Cycles      int
+}
+
+func runSoak(args []string) error {
+	fs := flag.NewFlagSet("soak", flag.ContinueOnError)
+	hours := fs.Float64("hours", 1, "how long to run, in hours (fractions allowed)")
+	imageDir := fs.String("images", "", "directory of sample images (random noise images are used when empty)")
+	modelDir := fs.String("models", "", "models directory (defaults to the package models directory)")
+	interval := fs.Duration("interval", time.Minute, "how often to sample memory usage")
+	windows := fs.Int("windows", 5, "number of windows compared when checking for monotonic growth")
+	growth := fs.Float64("max-growth", 0.05, "allowed RSS growth between the first and last window before failing")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "random seed for reproducible runs")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *hours <= 0 {
+		return cli.UsageErrorf("--hours must be positive")
+	}
+	if *windows < 2 {
+		return cli.UsageErrorf("--windows must be at least 2")
+	}
+
+	rng := rand.New(rand.NewSource(*seed))
+
+	images, err := loadSoakImages(*imageDir, rng)
+	if err != nil {
+		return err
+	}
+
+	fr, err := newRecognizer(*modelDir, 1)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	start := time.Now()
+	deadline := start.Add(time.Duration(*hours * float64(time.Hour)))
+	nextSample := start
+	cycles := 0
+	var samples []soakSample
+
+	fmt.Printf("soak: %d images, running until %s (seed %d)\n", len(images), deadline.Format(time.RFC3339), *seed)
+
+	for time.Now().Before(deadline) {
+		img := images[rng.Intn(len(images))]
+		upsample := 1 + rng.Intn(2)
+		jitters := 1 + rng.Intn(3)
+
+		if _, err := fr.DetectAndEncode(img, upsample, jitters); err != nil {
+			return fmt.Errorf("cycle %d: %w", cycles, err)
+		}
+		cycles++
+
+		if now := time.Now(); !now.Before(nextSample) {
+			s := takeSoakSample(now.Sub(start), cycles)
+			samples = append(samples, s)
+			fmt.Printf("soak: %8s cycles=%d rss=%.1fMB outstanding=%d\n",
+				s.Elapsed.Truncate(time.Second), s.Cycles, float64(s.RSS)/(1024*1024), s.Outstanding)
+			nextSample = now.Add(*interval)
+		}
+	}
+	samples = append(samples, takeSoakSample(time.Since(start), cycles))
+
+	return checkSoakSamples(samples, *windows, *growth)
+}
+
+// loadSoakImages loads every decodable image in dir, or synthesizes noise images when dir is empty
+func loadSoakImages(dir string, rng *rand.Rand) ([]*facerec.ImageMatrix, error) {
+	if dir == "" {
+		images := make([]*facerec.ImageMatrix, 8)
+		for i := range images {
+			w, h := 160+rng.Intn(480), 160+rng.Intn(480)
+			img := facerec.NewImageMatrix(w, h)
+			rng.Read(img.Pixels)
+			images[i] = img
+		}
+		return images, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []*facerec.ImageMatrix
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		img, err := facerec.LoadImageFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		images = append(images, img)
+	}
+
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no decodable images in %s", dir)
+	}
+	return images, nil
+}
+
+func takeSoakSample(elapsed time.Duration, cycles int) soakSample {
+	allocs, frees := facerec.NativeAllocStats()
+	return soakSample{
+		Elapsed:     elapsed,
+		RSS:         residentSetSize(),
+		Outstanding: allocs - frees,
+		Cycles:      cycles,
+	}
+}
+
+// checkSoakSamples fails when C buffers leaked or RSS grew in every window
+func checkSoakSamples(samples []soakSample, windows int, maxGrowth float64) error {
+	last := samples[len(samples)-1]
+	if last.Outstanding != 0 {
+		return fmt.Errorf("%d C buffers still allocated after %d cycles", last.Outstanding, last.Cycles)
+	}
+
+	if len(samples) < windows {
+		fmt.Printf("soak: only %d samples, skipping growth check (increase --hours or lower --interval)\n", len(samples))
+		return nil
+	}
+
+	// Compare the peak RSS of consecutive windows; a leak shows up as a strictly rising peak
+	size := len(samples) / windows
+	peaks := make([]uint64, windows)
+	for w := 0; w < windows; w++ {
+		for _, s := range samples[w*size : (w+1)*size] {
+			peaks[w] = max(peaks[w], s.RSS)
+		}
+	}
+
+	monotonic := true
+	for w := 1; w < windows; w++ {
+		if peaks[w] <= peaks[w-1] {
+			monotonic = false
+			break
+		}
+	}
+
+	ratio := float64(peaks[windows-1])/float64(peaks[0]) - 1
+	fmt.Printf("soak: %d cycles, RSS growth %.1f%% across %d windows\n", last.Cycles, ratio*100, windows)
+
+	if monotonic && ratio > maxGrowth {
+		return fmt.Errorf("RSS grew monotonically by %.1f%% (limit %.1f%%)", ratio*100, maxGrowth*100)
+	}
+	return nil
+}
+
+// residentSetSize returns the process RSS in bytes, falling back to the Go runtime's view on non-Linux systems
+func residentSetSize() uint64 {
+	if data, err := os.ReadFile("/proc/self/statm"); err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) > 1 {
+			if pages, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+				return pages * uint64(os.Getpagesize())
+			}
+		}
+	}
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.Sys
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+	"github.com/shafiqaimanx/go_face_recognition/internal/cli"
+)
+
+// tuiCamera is one monitored source: a directory that a camera or frame grabber writes images into
+type tuiCamera struct {
+	name   string
+	dir    string
+	frames chan image.Image
+	vp     *facerec.VideoProcessor
+
+	queueDropped atomic.Int64 // frames dropped because the queue in front of the processor was full
+	loadErrors   atomic.Int64
+	lastErr      atomic.Value // string
+
+	lastProcessed int64
+	fps           float64
+}
+
+// tuiSighting is a line of the recent identifications panel
+type tuiSighting struct {
+	time     time.Time
+	camera   string
+	name     string
+	distance float64
+}
+
+// runTUI shows a live terminal dashboard of a detection pipeline over one or more camera directories
+// It uses plain ANSI escape codes so it works over SSH without extra dependencies
+func runTUI(args []string) error {
+	fs := flag.NewFlagSet("tui", flag.ContinueOnError)
+	dbPath := fs.String("db", "", "face database to identify faces against")
+	tolerance := fs.Float64("tolerance", 0.6, "match tolerance for identification")
+	workers := fs.Int("workers", 1, "frames processed in parallel per camera")
+	queue := fs.Int("queue", 8, "frames buffered per camera before new ones are dropped")
+	interval := fs.Duration("interval", 500*time.Millisecond, "polling interval for new frames")
+	refresh := fs.Duration("refresh", time.Second, "dashboard refresh interval")
+	recent := fs.Int("recent", 10, "number of recent identifications shown")
+	modelDir := fs.String("models", "", "models directory (defaults to the package models directory)")
+	var pluginPaths stringList
+	fs.Var(&pluginPaths, "plugin", "load a plugin (.so Go plugin or executable), may be repeated")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if len(positional) == 0 {
+		return cli.UsageErrorf("usage: goface tui [name=]<dir>... [--db faces.db]")
+	}
+	if *queue < 1 {
+		*queue = 1
+	}
+	if *recent < 1 {
+		*recent = 1
+	}
+
+	var db *facerec.FaceDB
+	if *dbPath != "" {
+		var err error
+		if db, err = facerec.OpenFaceDB(*dbPath); err != nil {
+			return err
+		}
+	}
+
+	var plugins []facerec.Plugin
+	defer func() { facerec.ClosePlugins(plugins) }()
+	for _, path := range pluginPaths {
+		p, err := facerec.LoadPlugin(path)
+		if err != nil {
+			return err
+		}
+		plugins = append(plugins, p)
+	}
+
+	fr, err := newRecognizer(*modelDir, 1)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	var mu sync.Mutex
+	var sightings []tuiSighting
+
+	var wg sync.WaitGroup
+	cameras := make([]*tuiCamera, len(positional))
+	for i, arg := range positional {
+		cam := &tuiCamera{name: filepath.Base(arg), dir: arg, frames: make(chan image.Image, *queue)}
+		if name, dir, found := strings.Cut(arg, "="); found {
+			cam.name, cam.dir = name, dir
+		}
+		cam.lastErr.Store("")
+		cam.vp = facerec.NewVideoProcessor(fr, facerec.VideoConfig{
+			Workers:      *workers,
+			DropWhenBusy: true,
+			DB:           db,
+			Tolerance:    *tolerance,
+			CameraID:     cam.name,
+			Plugins:      plugins,
+		})
+		cameras[i] = cam
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			cam.feed(ctx, *interval)
+		}()
+		go func() {
+			defer wg.Done()
+			for result := range cam.vp.Run(ctx, cam.frames) {
+				// Plugin sink failures are reported alongside the faces, so keep going
+				if result.Err != nil {
+					cam.lastErr.Store(result.Err.Error())
+				}
+				mu.Lock()
+				for _, face := range result.Faces {
+					if face.Name == "" {
+						continue
+					}
+					sightings = append(sightings, tuiSighting{time: result.Timestamp, camera: cam.name, name: face.Name, distance: face.Distance})
+				}
+				if len(sightings) > *recent {
+					sightings = sightings[len(sightings)-*recent:]
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// Hide the cursor while drawing and restore it on exit
+	fmt.Print("\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\n")
+
+	started := time.Now()
+	last := started
+	ticker := time.NewTicker(*refresh)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		elapsed := now.Sub(last).Seconds()
+		last = now
+		for _, cam := range cameras {
+			processed := cam.vp.Stats().Processed
+			if elapsed > 0 {
+				cam.fps = float64(processed-cam.lastProcessed) / elapsed
+			}
+			cam.lastProcessed = processed
+		}
+
+		mu.Lock()
+		recentCopy := append([]tuiSighting(nil), sightings...)
+		mu.Unlock()
+		renderTUI(os.Stdout, cameras, recentCopy, db != nil, now.Sub(started))
+
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// feed polls the camera directory and queues new frames, dropping them when the queue is full
+func (c *tuiCamera) feed(ctx context.Context, interval time.Duration) {
+	defer close(c.frames)
+
+	poller := newDirPoller(c.dir)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Frames already in the directory are history, only new ones are live
+	if _, err := poller.poll(false); err != nil {
+		c.lastErr.Store(err.Error())
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		paths, err := poller.poll(true)
+		if err != nil {
+			c.lastErr.Store(err.Error())
+		}
+		for _, path := range paths {
+			img, err := facerec.LoadImageFile(path)
+			if err != nil {
+				c.loadErrors.Add(1)
+				c.lastErr.Store(err.Error())
+				continue
+			}
+			select {
+			case c.frames <- img.ToGoImage():
+			default:
+				c.queueDropped.Add(1)
+			}
+		}
+	}
+}
+
+// renderTUI redraws the whole dashboard from the top left corner
+func renderTUI(w io.Writer, cameras []*tuiCamera, sightings []tuiSighting, identifying bool, uptime time.Duration) {
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	fmt.Fprintf(&b, "\x1b[1mgoface tui\x1b[0m  uptime %s  (Ctrl-C to quit)\n\n", uptime.Truncate(time.Second))
+
+	fmt.Fprintf(&b, "\x1b[1m%-16s %7s %9s %9s %7s %9s %7s\x1b[0m\n", "CAMERA", "FPS", "RECEIVED", "PROCESSED", "QUEUE", "DROPPED", "ERRORS")
+	for _, cam := range cameras {
+		stats := cam.vp.Stats()
+		queue := fmt.Sprintf("%d/%d", len(cam.frames)+int(stats.InFlight), cap(cam.frames))
+		dropped := stats.Dropped + cam.queueDropped.Load()
+		fmt.Fprintf(&b, "%-16s %7.1f %9d %9d %7s %9d %7d\n",
+			truncate(cam.name, 16), cam.fps, stats.Received, stats.Processed, queue, dropped, cam.loadErrors.Load())
+		if msg, _ := cam.lastErr.Load().(string); msg != "" {
+			fmt.Fprintf(&b, "  \x1b[31mlast error: %s\x1b[0m\n", truncate(msg, 70))
+		}
+	}
+
+	b.WriteString("\n\x1b[1mRecent identifications\x1b[0m\n")
+	switch {
+	case !identifying:
+		b.WriteString("  (no --db given, faces are detected but not identified)\n")
+	case len(sightings) == 0:
+		b.WriteString("  none yet\n")
+	}
+	for i := len(sightings) - 1; i >= 0; i-- {
+		s := sightings[i]
+		fmt.Fprintf(&b, "  %s  %-16s %-24s %.3f\n", s.time.Format("15:04:05"), truncate(s.camera, 16), truncate(s.name, 24), s.distance)
+	}
+
+	io.WriteString(w, b.String())
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-1] + "…"
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+	"github.com/shafiqaimanx/go_face_recognition/internal/cli"
+)
+
+// watchEvent is one line of "goface watch --output jsonl"
+type watchEvent struct {
+	Time      time.Time          `json:"time"`
+	Event     string             `json:"event"` // "face" or "error"
+	File      string             `json:"file"`
+	FaceIndex int                `json:"face_index,omitempty"`
+	Rectangle *facerec.Rectangle `json:"rectangle,omitempty"`
+	PersonID  string             `json:"person_id,omitempty"`
+	Name      string             `json:"name,omitempty"`
+	Distance  float64            `json:"distance,omitempty"`
+	Error     string             `json:"error,omitempty"`
+}
+
+// runWatch detects (and optionally identifies) faces in the images of a directory, emitting one event per face
+// With --follow it keeps polling for new images until interrupted
+func runWatch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	output := fs.String("output", "text", "output format: text or jsonl")
+	follow := fs.Bool("follow", false, "keep watching for new images until interrupted")
+	interval := fs.Duration("interval", time.Second, "polling interval with --follow")
+	dbPath := fs.String("db", "", "face database to identify faces against")
+	tolerance := fs.Float64("tolerance", 0.6, "match tolerance for identification")
+	upsample := fs.Int("upsample", 1, "number of times to upsample images for detection")
+	modelDir := fs.String("models", "", "models directory (defaults to the package models directory)")
+	storePath := fs.String("store", "", "append every face to this sighting log, see goface history")
+	snapshots := fs.String("snapshots", "", "save a crop of every face to this directory (requires --store)")
+	camera := fs.String("camera", "", "camera ID recorded with sightings (defaults to the directory name)")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if len(positional) != 1 {
+		return cli.UsageErrorf("usage: goface watch <dir> [--output jsonl] [--follow] [--store sightings.jsonl]")
+	}
+	if *output != "text" && *output != "jsonl" {
+		return cli.UsageErrorf("unknown --output %q (text, jsonl)", *output)
+	}
+	if *snapshots != "" && *storePath == "" {
+		return cli.UsageErrorf("--snapshots requires --store")
+	}
+	dir := positional[0]
+	if *camera == "" {
+		*camera = filepath.Base(filepath.Clean(dir))
+	}
+
+	var store *facerec.SightingStore
+	if *storePath != "" {
+		var err error
+		if store, err = facerec.OpenSightingStore(*storePath); err != nil {
+			return err
+		}
+		defer store.Close()
+	}
+	if *snapshots != "" {
+		if err := os.MkdirAll(*snapshots, 0o755); err != nil {
+			return err
+		}
+	}
+
+	var db *facerec.FaceDB
+	if *dbPath != "" {
+		var err error
+		if db, err = facerec.OpenFaceDB(*dbPath); err != nil {
+			return err
+		}
+	}
+
+	fr, err := newRecognizer(*modelDir, 1)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	enc := json.NewEncoder(os.Stdout)
+	emit := func(ev watchEvent) {
+		if *output == "jsonl" {
+			enc.Encode(ev)
+			return
+		}
+		switch ev.Event {
+		case "error":
+			fmt.Printf("%s: error: %s\n", ev.File, ev.Error)
+		default:
+			r := ev.Rectangle
+			line := fmt.Sprintf("%s: face %d at (top %d, right %d, bottom %d, left %d)", ev.File, ev.FaceIndex, r.Top, r.Right, r.Bottom, r.Left)
+			if ev.Name != "" {
+				line += fmt.Sprintf(" %s (%.3f)", ev.Name, ev.Distance)
+			}
+			fmt.Println(line)
+		}
+	}
+
+	process := func(path string) {
+		img, err := facerec.LoadImageFile(path)
+		if err != nil {
+			emit(watchEvent{Time: time.Now(), Event: "error", File: path, Error: err.Error()})
+			return
+		}
+
+		faces, err := fr.DetectAndEncode(img, *upsample, 1)
+		if err != nil {
+			emit(watchEvent{Time: time.Now(), Event: "error", File: path, Error: err.Error()})
+			return
+		}
+
+		for i, face := range faces {
+			ev := watchEvent{Time: time.Now(), Event: "face", File: path, FaceIndex: i, Rectangle: &face.Rectangle}
+			if db != nil {
+				if matches := db.Search(face.Encoding, *tolerance); len(matches) > 0 {
+					ev.PersonID = matches[0].Person.ID
+					ev.Name = matches[0].Person.Name
+					ev.Distance = matches[0].Distance
+				}
+			}
+			emit(ev)
+
+			if store != nil {
+				if err := recordSighting(store, *snapshots, *camera, *tolerance, path, img, face, ev); err != nil {
+					emit(watchEvent{Time: time.Now(), Event: "error", File: path, Error: err.Error()})
+				}
+			}
+		}
+	}
+
+	poller := newDirPoller(dir)
+	poll := func(wait bool) error {
+		paths, err := poller.poll(wait)
+		for _, path := range paths {
+			process(path)
+		}
+		return err
+	}
+
+	// Images already present are complete, only new ones need the settle check
+	if err := poll(false); err != nil {
+		return err
+	}
+	if !*follow {
+		return nil
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-interrupt:
+			return nil
+		case <-ticker.C:
+			if err := poll(true); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// recordSighting appends a face to the sighting log, saving its crop first when snapshotDir is set
+// Watched files are unrelated stills, so their sightings have no track and are all kept by SightingIndex
+func recordSighting(store *facerec.SightingStore, snapshotDir, camera string, tolerance float64, path string, img *facerec.ImageMatrix, face facerec.Face, ev watchEvent) error {
+	s := facerec.Sighting{
+		Time:      ev.Time,
+		CameraID:  camera,
+		Source:    path,
+		Rectangle: face.Rectangle,
+		PersonID:  ev.PersonID,
+		Name:      ev.Name,
+		Encoding:  face.Encoding,
+	}
+	if ev.PersonID != "" {
+		s.Distance = ev.Distance
+		s.Confidence = facerec.DistanceToConfidence(ev.Distance, tolerance)
+	}
+
+	if snapshotDir != "" {
+		base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		s.Snapshot = filepath.Join(snapshotDir, fmt.Sprintf("%s-%d-%d.jpg", base, ev.FaceIndex, ev.Time.UnixNano()))
+		if err := img.Crop(face.Rectangle).SaveJPEG(s.Snapshot, 0); err != nil {
+			return err
+		}
+	}
+
+	_, err := store.Append(s)
+	return err
+}
+
+// dirPoller lists images added to a directory since the previous poll
+type dirPoller struct {
+	dir     string
+	seen    map[string]bool
+	pending map[string]int64 // size at the previous poll, files are reported once it stops changing
+}
+
+func newDirPoller(dir string) *dirPoller {
+	return &dirPoller{dir: dir, seen: make(map[string]bool), pending: make(map[string]int64)}
+}
+
+// poll returns the new images in name order
+// With wait set, files are only returned once their size is unchanged since the previous poll
+func (p *dirPoller) poll(wait bool) ([]string, error) {
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	var paths []string
+	for _, entry := range entries {
+		path := filepath.Join(p.dir, entry.Name())
+		if entry.IsDir() || p.seen[path] || !cli.IsImageFile(path) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		// Files still being written are picked up on a later poll
+		if wait {
+			if prev, ok := p.pending[path]; !ok || prev != info.Size() {
+				p.pending[path] = info.Size()
+				continue
+			}
+		}
+
+		delete(p.pending, path)
+		p.seen[path] = true
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
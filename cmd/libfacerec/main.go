@@ -0,0 +1,317 @@
+// Command libfacerec builds the package as a C library, so applications in other languages (C#,
+// Rust, Node through FFI) get the gallery, the quality checks and matching, not only raw dlib
+//
+//	go build -buildmode=c-shared -o libfacerec.so ./cmd/libfacerec
+//	go build -buildmode=c-archive -o libfacerec.a ./cmd/libfacerec
+//
+// The API is declared in bindings/gofr.h, which also holds the Python and Node bindings; ship that
+// header rather than the generated libfacerec.h. Every function is prefixed with gofr_ and is safe to
+// call from several threads. Recognizers and galleries are opaque handles released with gofr_close
+// and gofr_gallery_close; arrays and strings returned by the library are released with gofr_free,
+// match arrays with gofr_free_matches. Functions that can fail return -1 or a zero handle and set
+// *err, when err is not NULL, to a message released with gofr_free
+package main
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/../../bindings
+#include <stdlib.h>
+#include "gofr.h"
+*/
+import "C"
+import (
+	"fmt"
+	"runtime/cgo"
+	"unsafe"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+)
+
+// issueBits maps the reasons of QualityReport.Issues to the GOFR_ISSUE_ bits
+var issueBits = map[facerec.RejectReason]C.int{
+	facerec.RejectSmallFace:   C.GOFR_ISSUE_SMALL_FACE,
+	facerec.RejectBlurry:      C.GOFR_ISSUE_BLURRY,
+	facerec.RejectDark:        C.GOFR_ISSUE_DARK,
+	facerec.RejectOverexposed: C.GOFR_ISSUE_OVEREXPOSED,
+	facerec.RejectLowContrast: C.GOFR_ISSUE_LOW_CONTRAST,
+	facerec.RejectExtremePose: C.GOFR_ISSUE_EXTREME_POSE,
+	facerec.RejectOccluded:    C.GOFR_ISSUE_OCCLUDED,
+}
+
+func main() {}
+
+// gofr_api_version returns GOFR_API_VERSION of the header the library was built with, for bindings
+// to check they do not call functions the loaded library lacks
+//
+//export gofr_api_version
+func gofr_api_version() C.int {
+	return C.GOFR_API_VERSION
+}
+
+// setErr stores err in *out for the caller to release with gofr_free
+func setErr(out **C.char, err error) {
+	if out != nil {
+		*out = C.CString(err.Error())
+	}
+}
+
+// goImage copies a C image, the caller may reuse its buffer once the call returns
+func goImage(img C.gofr_image) (*facerec.ImageMatrix, error) {
+	width, height, stride := int(img.width), int(img.height), int(img.stride)
+	if img.pixels == nil || width <= 0 || height <= 0 || stride < width*3 {
+		return nil, fmt.Errorf("invalid image %dx%d with stride %d", width, height, stride)
+	}
+	return &facerec.ImageMatrix{
+		Pixels: C.GoBytes(unsafe.Pointer(img.pixels), C.int(stride*height)),
+		Width:  width,
+		Height: height,
+		Stride: stride,
+	}, nil
+}
+
+func goEncoding(p *C.double) facerec.FaceEncoding {
+	var e facerec.FaceEncoding
+	for i, v := range unsafe.Slice(p, len(e)) {
+		e[i] = float64(v)
+	}
+	return e
+}
+
+func recognizer(h C.gofr_recognizer) (*facerec.FaceRecognizer, error) {
+	if h == 0 {
+		return nil, fmt.Errorf("null recognizer")
+	}
+	return cgo.Handle(h).Value().(*facerec.FaceRecognizer), nil
+}
+
+func gallery(h C.gofr_gallery) (*facerec.FaceDB, error) {
+	if h == 0 {
+		return nil, fmt.Errorf("null gallery")
+	}
+	return cgo.Handle(h).Value().(*facerec.FaceDB), nil
+}
+
+// gofr_open loads the models from model_dir, NULL or empty for the package models directory
+// Models are not downloaded; fetch them first with the goface or facecli tools
+//
+//export gofr_open
+func gofr_open(modelDir *C.char, err **C.char) C.gofr_recognizer {
+	dir := facerec.DefaultModelsDir()
+	if modelDir != nil && C.GoString(modelDir) != "" {
+		dir = C.GoString(modelDir)
+	}
+	fr, e := facerec.NewFaceRecognizer(facerec.Config{ModelPaths: facerec.DefaultModelPaths(dir), NumJitters: 1})
+	if e != nil {
+		setErr(err, e)
+		return 0
+	}
+	return C.gofr_recognizer(cgo.NewHandle(fr))
+}
+
+// gofr_close releases a recognizer
+//
+//export gofr_close
+func gofr_close(rec C.gofr_recognizer) {
+	if rec == 0 {
+		return
+	}
+	h := cgo.Handle(rec)
+	h.Value().(*facerec.FaceRecognizer).Close()
+	h.Delete()
+}
+
+// gofr_detect_encode finds the faces of img with the HOG detector and encodes them
+// It returns the number of faces and stores them in *faces, NULL when there are none
+//
+//export gofr_detect_encode
+func gofr_detect_encode(rec C.gofr_recognizer, img C.gofr_image, upsample, jitters C.int, faces **C.gofr_face, err **C.char) C.int {
+	*faces = nil
+	fr, e := recognizer(rec)
+	if e != nil {
+		setErr(err, e)
+		return -1
+	}
+	im, e := goImage(img)
+	if e != nil {
+		setErr(err, e)
+		return -1
+	}
+	found, e := fr.DetectAndEncode(im, int(upsample), int(jitters))
+	if e != nil {
+		setErr(err, e)
+		return -1
+	}
+	if len(found) == 0 {
+		return 0
+	}
+
+	*faces = (*C.gofr_face)(C.malloc(C.size_t(len(found)) * C.size_t(unsafe.Sizeof(C.gofr_face{}))))
+	out := unsafe.Slice(*faces, len(found))
+	for i, f := range found {
+		out[i].location = C.gofr_rect{top: C.int(f.Rectangle.Top), right: C.int(f.Rectangle.Right), bottom: C.int(f.Rectangle.Bottom), left: C.int(f.Rectangle.Left)}
+		for j, v := range f.Encoding {
+			out[i].encoding[j] = C.double(v)
+		}
+	}
+	return C.int(len(found))
+}
+
+// gofr_assess_quality measures the face at location and checks it against the default thresholds
+//
+//export gofr_assess_quality
+func gofr_assess_quality(rec C.gofr_recognizer, img C.gofr_image, location C.gofr_rect, quality *C.gofr_quality, err **C.char) C.int {
+	fr, e := recognizer(rec)
+	if e != nil {
+		setErr(err, e)
+		return -1
+	}
+	im, e := goImage(img)
+	if e != nil {
+		setErr(err, e)
+		return -1
+	}
+	rect := facerec.Rectangle{Top: int(location.top), Right: int(location.right), Bottom: int(location.bottom), Left: int(location.left)}
+	landmarks, e := fr.FaceLandmarks(im, []facerec.Rectangle{rect})
+	if e != nil {
+		setErr(err, e)
+		return -1
+	}
+	var lm facerec.FaceLandmarks
+	if len(landmarks) == 1 {
+		lm = landmarks[0]
+	}
+
+	report := facerec.AssessQuality(im, rect, lm)
+	*quality = C.gofr_quality{
+		sharpness:          C.double(report.Sharpness),
+		brightness:         C.double(report.Brightness),
+		contrast:           C.double(report.Contrast),
+		face_size:          C.int(report.FaceSize),
+		inter_eye_distance: C.double(report.InterEyeDistance),
+		pose_deviation:     C.double(report.PoseDeviation),
+	}
+	for _, issue := range report.Issues(facerec.DefaultQualityThresholds) {
+		quality.issues |= issueBits[issue]
+	}
+	return 0
+}
+
+// gofr_distance returns the Euclidean distance between two 128-value encodings
+//
+//export gofr_distance
+func gofr_distance(a, b *C.double) C.double {
+	return C.double(facerec.FaceDistance(goEncoding(a), goEncoding(b)))
+}
+
+// gofr_gallery_open loads the gallery saved at path, or creates an empty one saved there
+//
+//export gofr_gallery_open
+func gofr_gallery_open(path *C.char, err **C.char) C.gofr_gallery {
+	db, e := facerec.OpenFaceDB(C.GoString(path))
+	if e != nil {
+		setErr(err, e)
+		return 0
+	}
+	return C.gofr_gallery(cgo.NewHandle(db))
+}
+
+// gofr_gallery_close releases a gallery without saving it
+//
+//export gofr_gallery_close
+func gofr_gallery_close(g C.gofr_gallery) {
+	if g != 0 {
+		cgo.Handle(g).Delete()
+	}
+}
+
+// gofr_gallery_save writes the gallery back to the path it was opened from
+//
+//export gofr_gallery_save
+func gofr_gallery_save(g C.gofr_gallery, err **C.char) C.int {
+	db, e := gallery(g)
+	if e == nil {
+		e = db.Save()
+	}
+	if e != nil {
+		setErr(err, e)
+		return -1
+	}
+	return 0
+}
+
+// gofr_gallery_add adds a person with count encodings of 128 values each and stores the new ID in *id
+//
+//export gofr_gallery_add
+func gofr_gallery_add(g C.gofr_gallery, name *C.char, encodings *C.double, count C.int, id **C.char, err **C.char) C.int {
+	db, e := gallery(g)
+	if e != nil {
+		setErr(err, e)
+		return -1
+	}
+	if count <= 0 || encodings == nil {
+		setErr(err, fmt.Errorf("a person needs at least one encoding"))
+		return -1
+	}
+	values := unsafe.Slice(encodings, int(count)*128)
+	list := make([]facerec.FaceEncoding, count)
+	for i := range list {
+		list[i] = goEncoding(&values[i*128])
+	}
+	personID, e := db.Add(C.GoString(name), list, nil)
+	if e != nil {
+		setErr(err, e)
+		return -1
+	}
+	*id = C.CString(personID)
+	return 0
+}
+
+// gofr_identify stores in *matches up to limit people of the gallery within tolerance of encoding,
+// closest first, and returns their number; a tolerance of 0 uses 0.6
+//
+//export gofr_identify
+func gofr_identify(g C.gofr_gallery, encoding *C.double, tolerance C.double, limit C.int, matches **C.gofr_match, err **C.char) C.int {
+	*matches = nil
+	db, e := gallery(g)
+	if e != nil {
+		setErr(err, e)
+		return -1
+	}
+	if tolerance <= 0 {
+		tolerance = 0.6
+	}
+	found := db.Search(goEncoding(encoding), float64(tolerance))
+	if limit >= 0 && len(found) > int(limit) {
+		found = found[:limit]
+	}
+	if len(found) == 0 {
+		return 0
+	}
+
+	*matches = (*C.gofr_match)(C.malloc(C.size_t(len(found)) * C.size_t(unsafe.Sizeof(C.gofr_match{}))))
+	out := unsafe.Slice(*matches, len(found))
+	for i, m := range found {
+		out[i] = C.gofr_match{id: C.CString(m.Person.ID), name: C.CString(m.Person.Name), distance: C.double(m.Distance)}
+	}
+	return C.int(len(found))
+}
+
+// gofr_free_matches releases the matches returned by gofr_identify
+//
+//export gofr_free_matches
+func gofr_free_matches(matches *C.gofr_match, count C.int) {
+	if matches == nil {
+		return
+	}
+	for _, m := range unsafe.Slice(matches, int(count)) {
+		C.free(unsafe.Pointer(m.id))
+		C.free(unsafe.Pointer(m.name))
+	}
+	C.free(unsafe.Pointer(matches))
+}
+
+// gofr_free releases a string or array returned by the library
+//
+//export gofr_free
+func gofr_free(p unsafe.Pointer) {
+	C.free(p)
+}
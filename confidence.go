@@ -0,0 +1,71 @@
+package gofacerecognition
+
+import (
+	"errors"
+	"math"
+)
+
+// LogisticCalibration maps a face distance to the probability that both faces show the same person
+// No calibration ships with the package, fit one with FitLogisticCalibration on labeled pairs
+//
+//	p(same) = 1 / (1 + exp(Slope * (distance - Midpoint)))
+type LogisticCalibration struct {
+	Midpoint float64 // distance at which p(same) is 0.5
+	Slope    float64 // steepness, larger values give more decisive probabilities
+}
+
+// Probability returns p(same person) for a distance; c must come from FitLogisticCalibration
+func (c LogisticCalibration) Probability(distance float64) float64 {
+	return sigmoid(-c.Slope * (distance - c.Midpoint))
+}
+
+// FitLogisticCalibration fits a calibration by logistic regression on labeled pair distances,
+// genuine holding distances of same-person pairs and impostor those of different-person pairs
+func FitLogisticCalibration(genuine, impostor []float64) (LogisticCalibration, error) {
+	if len(genuine) == 0 || len(impostor) == 0 {
+		return LogisticCalibration{}, errors.New("calibration needs both genuine and impostor distances")
+	}
+
+	// p = sigmoid(a + b*d), fitted with Newton's method; a small ridge term keeps perfectly separable
+	// data from driving the slope to infinity
+	const ridge = 1e-3
+	a, b := 0.0, 0.0
+	for iter := 0; iter < 100; iter++ {
+		var ga, gb, haa, hab, hbb float64
+		visit := func(d, y float64) {
+			p := sigmoid(a + b*d)
+			ga += y - p
+			gb += (y - p) * d
+			w := p * (1 - p)
+			haa += w
+			hab += w * d
+			hbb += w * d * d
+		}
+		for _, d := range genuine {
+			visit(d, 1)
+		}
+		for _, d := range impostor {
+			visit(d, 0)
+		}
+		gb -= ridge * b
+		hbb += ridge
+		haa += 1e-9
+
+		det := haa*hbb - hab*hab
+		if det <= 0 {
+			break
+		}
+		da := (hbb*ga - hab*gb) / det
+		db := (haa*gb - hab*ga) / det
+		a += da
+		b += db
+		if math.Abs(da) < 1e-9 && math.Abs(db) < 1e-9 {
+			break
+		}
+	}
+
+	if b >= 0 || math.IsNaN(a) || math.IsNaN(b) {
+		return LogisticCalibration{}, errors.New("genuine pairs are not closer than impostor pairs, cannot calibrate")
+	}
+	return LogisticCalibration{Midpoint: -a / b, Slope: -b}, nil
+}
@@ -1,9 +1,42 @@
 package gofacerecognition
 
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+)
+
 type Config struct {
 	ModelPaths ModelPaths
-	UseGPU     bool
-	NumJitters int // Number of times to re-sample the face (higher = more accurate but slower)
+	UseGPU     bool       // Run CNN detection and encoding on CUDA (requires building with -tags cuda)
+	GPUDevice  int        // CUDA device index used when UseGPU is set
+	NumJitters int        // Number of times to re-sample the face (higher = more accurate but slower)
+	InputMode  InputMode  // Camera type; InputNIR normalizes infrared frames before detection and encoding
+	NIROptions NIROptions // Preprocessing used when InputMode is InputNIR
+	// MinDetectionScore is the detector confidence a face needs to be reported; 0 is dlib's default,
+	// negative values trade precision for recall and positive values the other way round
+	MinDetectionScore float64
+	// CNNBoxCalibration maps CNN detections onto HOG-equivalent boxes before landmarks and encodings
+	// are computed from them, so switching detectors does not shift match distances; nil keeps the
+	// boxes as the detector returns them; fit one with CalibrateBoxes
+	CNNBoxCalibration *BoxCalibration
+	// MeasureCNNBoxCalibration, when above 0 and CNNBoxCalibration is nil, measures the calibration on
+	// the images the recognizer is given: CNN detections through FaceLocations also run the HOG
+	// detector until this many faces are paired, then the fitted calibration applies to every later
+	// CNN detection; 0 keeps CNN boxes as they are
+	MeasureCNNBoxCalibration int
+	// Preprocessing corrects images before detection in DetectAndEncode, FaceLocations and
+	// VideoProcessor, which report faces in the coordinates of the images they were given; nil leaves
+	// images as given
+	Preprocessing *Preprocessing
+	// Metrics receives the latency and face counts of detection and encoding calls, and the utilization
+	// of pools created with this config; nil disables metrics
+	Metrics Metrics
+	// Logger receives the diagnostics of the recognizer, including every cgo call at debug level;
+	// nil logs nothing
+	Logger *slog.Logger
 }
 
 func NewConfig() (Config, error) {
@@ -17,5 +50,159 @@ func NewConfig() (Config, error) {
 		ModelPaths: DefaultModelPaths(modelDir),
 		UseGPU:     false,
 		NumJitters: 1,
+		InputMode:  InputRGB,
+		NIROptions: DefaultNIROptions(),
 	}, nil
 }
+
+// Validate checks the whole configuration and returns a *ConfigError listing every problem with a
+// suggested fix, instead of NewFaceRecognizer failing on the first one
+// It needs the model files and the GPUs, so run it on the machine that will use the configuration
+func (c Config) Validate() error {
+	p := configProblems{config: "Config"}
+
+	required := []struct{ field, name, path string }{
+		{"ModelPaths.ShapePredictor68", "shape_predictor_68", c.ModelPaths.ShapePredictor68},
+		{"ModelPaths.FaceRecognitionModel", "face_recognition_model", c.ModelPaths.FaceRecognitionModel},
+	}
+	for _, m := range required {
+		p.checkModelFile(m.field, m.name, m.path)
+	}
+
+	switch {
+	case c.UseGPU && !cudaEnabled:
+		p.addErr("UseGPU", &GPUUnavailableError{Reason: "package built without the cuda build tag"},
+			"build with -tags cuda against a CUDA-enabled dlib, or set UseGPU to false")
+	case c.UseGPU:
+		if n := NumGPUs(); n == 0 {
+			p.addErr("UseGPU", &GPUUnavailableError{Reason: "no CUDA device found"},
+				"check the NVIDIA driver and CUDA_VISIBLE_DEVICES, or set UseGPU to false")
+		} else if c.GPUDevice < 0 || c.GPUDevice >= n {
+			p.addErr("GPUDevice", &GPUUnavailableError{Reason: fmt.Sprintf("device %d does not exist (%d available)", c.GPUDevice, n)},
+				fmt.Sprintf("use a device index from 0 to %d", n-1))
+		}
+	}
+
+	if c.NumJitters < 0 {
+		p.add("NumJitters", fmt.Sprintf("%d is negative", c.NumJitters), "use 1 for speed, or up to 100 for slightly more accurate encodings")
+	}
+
+	switch c.InputMode {
+	case "", InputRGB:
+	case InputNIR:
+		p.checkNIROptions(c.NIROptions)
+	default:
+		p.add("InputMode", fmt.Sprintf("unknown input mode %q", c.InputMode), fmt.Sprintf("use %q or %q", InputRGB, InputNIR))
+	}
+
+	if math.IsNaN(c.MinDetectionScore) || math.IsInf(c.MinDetectionScore, 0) {
+		p.add("MinDetectionScore", fmt.Sprintf("%v is not a finite score", c.MinDetectionScore), "use 0 for dlib's default threshold")
+	}
+
+	if c.Preprocessing != nil {
+		c.Preprocessing.validate(&p)
+	}
+
+	if c.MeasureCNNBoxCalibration < 0 {
+		p.add("MeasureCNNBoxCalibration", fmt.Sprintf("%d faces is negative", c.MeasureCNNBoxCalibration), "use 0 to keep CNN boxes as they are, or around 50 faces to measure a calibration")
+	}
+	if cal := c.CNNBoxCalibration; cal != nil {
+		if !(cal.ScaleX > 0) || !(cal.ScaleY > 0) || math.IsInf(cal.ScaleX, 0) || math.IsInf(cal.ScaleY, 0) {
+			p.add("CNNBoxCalibration", fmt.Sprintf("scales %v and %v are not positive", cal.ScaleX, cal.ScaleY), "use 1 to keep the box size, or fit the calibration with CalibrateBoxes")
+		}
+		if math.IsNaN(cal.ShiftX) || math.IsNaN(cal.ShiftY) || math.IsInf(cal.ShiftX, 0) || math.IsInf(cal.ShiftY, 0) {
+			p.add("CNNBoxCalibration", fmt.Sprintf("shifts %v and %v are not finite", cal.ShiftX, cal.ShiftY), "use 0 to keep the box center")
+		}
+	}
+
+	return p.err()
+}
+
+// configProblems collects the problems found by a Validate method
+type configProblems struct {
+	config   string
+	problems []ConfigProblem
+}
+
+func (p *configProblems) add(field, problem, fix string) {
+	p.problems = append(p.problems, ConfigProblem{Field: field, Problem: problem, Fix: fix})
+}
+
+func (p *configProblems) addErr(field string, err error, fix string) {
+	p.problems = append(p.problems, ConfigProblem{Field: field, Problem: err.Error(), Fix: fix, Err: err})
+}
+
+// err returns a *ConfigError for the problems found, or nil
+func (p *configProblems) err() error {
+	if len(p.problems) == 0 {
+		return nil
+	}
+	return &ConfigError{Config: p.config, Problems: p.problems}
+}
+
+// checkModelFile reports a model path that is empty, missing or not a regular file
+func (p *configProblems) checkModelFile(field, name, path string) {
+	const fix = "download the models with EnsureModels or use DefaultModelPaths with the directory holding them"
+	if path == "" {
+		p.add(field, "path is empty", fix)
+		return
+	}
+
+	info, err := os.Stat(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		p.addErr(field, &ModelNotFoundError{ModelName: name, Path: path}, fix)
+	case err != nil:
+		p.addErr(field, err, "check the permissions of the model file and its directory")
+	case info.IsDir():
+		p.add(field, fmt.Sprintf("%s is a directory", path), "point it at the .dat file inside the models directory")
+	}
+}
+
+// checkNIROptions reports settings that withDefaults would silently replace
+func (p *configProblems) checkNIROptions(o NIROptions) {
+	if o.LowPercentile < 0 || o.LowPercentile >= 1 {
+		p.add("NIROptions.LowPercentile", fmt.Sprintf("%v is outside [0, 1)", o.LowPercentile), "use a fraction such as 0.01, or 0 for the default")
+	}
+	if o.HighPercentile < 0 || o.HighPercentile > 1 {
+		p.add("NIROptions.HighPercentile", fmt.Sprintf("%v is outside [0, 1]", o.HighPercentile), "use a fraction such as 0.99, or 0 for the default")
+	} else if o.HighPercentile > 0 && o.HighPercentile <= o.LowPercentile {
+		p.add("NIROptions.HighPercentile", fmt.Sprintf("%v is not above LowPercentile %v", o.HighPercentile, o.LowPercentile), "make HighPercentile larger than LowPercentile")
+	}
+	if o.Gamma < 0 || math.IsNaN(o.Gamma) {
+		p.add("NIROptions.Gamma", fmt.Sprintf("%v is not a positive gamma", o.Gamma), "use 1 for no correction, or 0 for the default")
+	}
+}
+
+// checkTolerance reports a Euclidean match tolerance that matches nothing or everything
+// Encodings have a length close to 1, so no two of them are 2 or more apart
+func (p *configProblems) checkTolerance(field string, tolerance float64) {
+	if tolerance < 0 || math.IsNaN(tolerance) {
+		p.add(field, fmt.Sprintf("%v can never be met", tolerance), "use 0.6, or 0 for the default")
+	} else if tolerance >= 2 {
+		p.add(field, fmt.Sprintf("%v matches every face", tolerance), "use 0.6; values from 0.4 to 0.6 are typical")
+	}
+}
+
+// checkDetection reports detection and encoding settings that cannot work
+func (p *configProblems) checkDetection(model DetectionModel, upsample, jitters int) {
+	if model != "" && model != HOG && model != CNN {
+		p.add("Model", fmt.Sprintf("unknown detection model %q", model), fmt.Sprintf("use %q or %q", HOG, CNN))
+	}
+	if upsample < 0 {
+		p.add("UpsampleTimes", fmt.Sprintf("%d is negative", upsample), "use 0 for large faces, 1 (default) or 2 for small ones")
+	} else if upsample > 4 {
+		// Every upsampling quadruples the pixels to scan
+		p.add("UpsampleTimes", fmt.Sprintf("%d scans %dx the pixels of the frame", upsample, 1<<(2*upsample)), "use at most 2, or crop the region of interest")
+	}
+	if jitters < 0 {
+		p.add("NumJitters", fmt.Sprintf("%d is negative", jitters), "use 1, or 0 for the default")
+	}
+}
+
+// checkNonNegative reports a negative count or duration
+func (p *configProblems) checkNonNegative(field string, v int64, fix string) {
+	if v < 0 {
+		p.add(field, fmt.Sprintf("%d is negative", v), fix)
+	}
+}
@@ -0,0 +1,99 @@
+package gofacerecognition
+
+import "context"
+
+// FaceLocationsCtx is FaceLocations that returns ctx.Err() as soon as ctx is done
+// The native detection cannot be interrupted; it finishes in the background and its result is discarded
+func (fr *FaceRecognizer) FaceLocationsCtx(ctx context.Context, img *ImageMatrix, upsampleTimes int, model DetectionModel) ([]Rectangle, error) {
+	return fr.faceLocationsCtx(ctx, img, upsampleTimes, model, fr.FaceLocations)
+}
+
+// faceLocationsCtx runs detect like FaceLocationsCtx runs FaceLocations, callers that already applied
+// Config.Preprocessing pass fr.faceLocations
+func (fr *FaceRecognizer) faceLocationsCtx(ctx context.Context, img *ImageMatrix, upsampleTimes int, model DetectionModel,
+	detect func(*ImageMatrix, int, DetectionModel) ([]Rectangle, error)) ([]Rectangle, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		rects []Rectangle
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		rects, err := detect(img, upsampleTimes, model)
+		done <- result{rects, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.rects, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// FaceEncodingsCtx is FaceEncodings that encodes one face at a time and stops when ctx is done
+// If faceLocations is nil, faces are detected first with the HOG model
+func (fr *FaceRecognizer) FaceEncodingsCtx(ctx context.Context, img *ImageMatrix, faceLocations []Rectangle, numJitters int, model LandmarkModel) ([]FaceEncoding, error) {
+	if faceLocations == nil {
+		var err error
+		faceLocations, err = fr.FaceLocationsCtx(ctx, img, 1, HOG)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	encodings := make([]FaceEncoding, 0, len(faceLocations))
+	for _, loc := range faceLocations {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		enc, err := fr.FaceEncodings(img, []Rectangle{loc}, numJitters, model)
+		if err != nil {
+			return nil, err
+		}
+		encodings = append(encodings, enc...)
+	}
+
+	return encodings, nil
+}
+
+// DetectAndEncodeCtx is DetectAndEncode that stops between stages and faces when ctx is done
+// Config.Preprocessing is applied first, as in DetectAndEncode
+func (fr *FaceRecognizer) DetectAndEncodeCtx(ctx context.Context, img *ImageMatrix, upsampleTimes int, numJitters int) ([]Face, error) {
+	img, original := fr.preprocessImage(img)
+	locations, err := fr.faceLocationsCtx(ctx, img, upsampleTimes, HOG, fr.faceLocations)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	landmarks, err := fr.FaceLandmarks(img, locations)
+	if err != nil {
+		return nil, err
+	}
+
+	encodings, err := fr.FaceEncodingsCtx(ctx, img, locations, numJitters, LandmarkLarge)
+	if err != nil {
+		return nil, err
+	}
+
+	faces := make([]Face, len(locations))
+	for i := range locations {
+		faces[i] = Face{
+			Rectangle: locations[i],
+			Encoding:  encodings[i],
+		}
+		if i < len(landmarks) {
+			faces[i].Landmarks = landmarks[i]
+		}
+		faces[i] = original(faces[i])
+	}
+
+	return faces, nil
+}
@@ -0,0 +1,382 @@
+package gofacerecognition
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shafiqaimanx/go_face_recognition/security"
+)
+
+// MatcherNode searches one shard of a gallery, locally or on a remote host
+type MatcherNode interface {
+	Name() string
+	// Match returns up to k people within tolerance of each probe, closest first; tolerance <= 0 means unbounded
+	Match(ctx context.Context, probes []FaceEncoding, k int, tolerance float64) ([][]PersonMatch, error)
+}
+
+// LocalMatcher serves a shard from an in-process FaceDB
+type LocalMatcher struct {
+	NodeName string
+	DB       *FaceDB
+}
+
+// Name returns the node name
+func (m *LocalMatcher) Name() string {
+	return m.NodeName
+}
+
+// Match searches the database for each probe
+func (m *LocalMatcher) Match(ctx context.Context, probes []FaceEncoding, k int, tolerance float64) ([][]PersonMatch, error) {
+	return matchDB(ctx, m.DB, probes, k, tolerance)
+}
+
+func matchDB(ctx context.Context, db *FaceDB, probes []FaceEncoding, k int, tolerance float64) ([][]PersonMatch, error) {
+	if tolerance <= 0 {
+		tolerance = math.Inf(1)
+	}
+	results := make([][]PersonMatch, len(probes))
+	for i, probe := range probes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		matches := db.Search(probe, tolerance)
+		if k > 0 && len(matches) > k {
+			matches = matches[:k]
+		}
+		results[i] = matches
+	}
+	return results, nil
+}
+
+// matchRequest is the body of POST /match on a matcher node
+type matchRequest struct {
+	Encodings []FaceEncoding `json:"encodings"`
+	K         int            `json:"k"`
+	Tolerance float64        `json:"tolerance"` // <= 0 means unbounded
+}
+
+// wireMatch is a PersonMatch on the wire, without the person's encodings
+type wireMatch struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Distance float64           `json:"distance"`
+}
+
+// matchResponse is the body of a POST /match response, one list per encoding
+type matchResponse struct {
+	Results [][]wireMatch `json:"results"`
+}
+
+// NewMatcherHandler serves a FaceDB shard to HTTPMatcherNode clients at POST /match
+// Only requests signed with a key of keys are served, see HTTPMatcherNode.Keys; a nil ring rejects all
+func NewMatcherHandler(db *FaceDB, keys *security.KeyRing) http.Handler {
+	mux := http.NewServeMux()
+	// Other methods get 405 with an Allow header from the mux, before authentication
+	mux.Handle("POST /match", requirePeerAuth(keys, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req matchRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64<<20)).Decode(&req); err != nil {
+			WriteHTTPError(w, &APIError{Code: CodeInvalidArgument, Message: err.Error()})
+			return
+		}
+
+		results, err := matchDB(r.Context(), db, req.Encodings, req.K, req.Tolerance)
+		if err != nil {
+			WriteHTTPError(w, err)
+			return
+		}
+
+		resp := matchResponse{Results: make([][]wireMatch, len(results))}
+		for i, matches := range results {
+			resp.Results[i] = make([]wireMatch, len(matches))
+			for j, m := range matches {
+				resp.Results[i][j] = wireMatch{ID: m.Person.ID, Name: m.Person.Name, Metadata: m.Person.Metadata, Distance: m.Distance}
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})))
+	return mux
+}
+
+// HTTPMatcherNode queries a remote shard served by NewMatcherHandler
+type HTTPMatcherNode struct {
+	URL    string       // base URL, /match is appended
+	Client *http.Client // defaults to http.DefaultClient
+	// Keys signs the requests, the node serves only clients holding a key of its ring
+	Keys *security.KeyRing
+}
+
+// Name returns the node URL
+func (n *HTTPMatcherNode) Name() string {
+	return n.URL
+}
+
+// Match sends the probes to the remote node
+func (n *HTTPMatcherNode) Match(ctx context.Context, probes []FaceEncoding, k int, tolerance float64) ([][]PersonMatch, error) {
+	if math.IsInf(tolerance, 1) {
+		tolerance = 0
+	}
+	body, err := json.Marshal(matchRequest{Encodings: probes, K: k, Tolerance: tolerance})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(n.URL, "/")+"/match", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.Keys != nil {
+		if err := signPeerRequest(req, n.Keys, body); err != nil {
+			return nil, err
+		}
+	}
+
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, ReadHTTPError(resp)
+	}
+
+	var mr matchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&mr); err != nil {
+		return nil, fmt.Errorf("%s: %w", n.URL, err)
+	}
+	if len(mr.Results) != len(probes) {
+		return nil, fmt.Errorf("%s: got %d result lists for %d probes", n.URL, len(mr.Results), len(probes))
+	}
+
+	results := make([][]PersonMatch, len(mr.Results))
+	for i, matches := range mr.Results {
+		results[i] = make([]PersonMatch, len(matches))
+		for j, m := range matches {
+			results[i][j] = PersonMatch{Person: Person{ID: m.ID, Name: m.Name, Metadata: m.Metadata}, Distance: m.Distance}
+		}
+	}
+	return results, nil
+}
+
+// Shard is one partition of the gallery, served by interchangeable replicas
+type Shard struct {
+	Name     string
+	Replicas []MatcherNode
+}
+
+// CoordinatorConfig configures a Coordinator
+type CoordinatorConfig struct {
+	Shards  []Shard
+	Timeout time.Duration // per replica attempt (default 2s)
+	Backoff time.Duration // how long a failed replica is skipped while others are available (default 30s)
+	// AllowPartial returns the results of the shards that answered when others failed, together with
+	// a *PartialResultsError; otherwise any failed shard fails the query
+	AllowPartial bool
+}
+
+// Coordinator fans matching out to every shard of a distributed gallery and merges the top results
+// Each shard is queried on one replica, moving on to the next replica when it fails
+// It is safe for concurrent use
+type Coordinator struct {
+	config CoordinatorConfig
+
+	mu        sync.Mutex
+	downUntil map[[2]int]time.Time // {shard, replica} -> end of backoff
+	next      []atomic.Uint32      // round-robin position per shard
+}
+
+// NewCoordinator creates a Coordinator, every shard needs at least one replica
+func NewCoordinator(config CoordinatorConfig) (*Coordinator, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 2 * time.Second
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = 30 * time.Second
+	}
+	return &Coordinator{
+		config:    config,
+		downUntil: make(map[[2]int]time.Time),
+		next:      make([]atomic.Uint32, len(config.Shards)),
+	}, nil
+}
+
+// Match queries every shard and merges the results into the k closest people per probe
+// tolerance <= 0 means unbounded
+func (c *Coordinator) Match(ctx context.Context, probes []FaceEncoding, k int, tolerance float64) ([][]PersonMatch, error) {
+	type shardResult struct {
+		matches [][]PersonMatch
+		err     error
+	}
+	results := make([]shardResult, len(c.config.Shards))
+
+	var wg sync.WaitGroup
+	for i := range c.config.Shards {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i].matches, results[i].err = c.queryShard(ctx, i, probes, k, tolerance)
+		}(i)
+	}
+	wg.Wait()
+
+	merged := make([][]PersonMatch, len(probes))
+	var failed []*ShardUnavailableError
+	for i, r := range results {
+		if r.err != nil {
+			failed = append(failed, &ShardUnavailableError{Shard: c.config.Shards[i].Name, Err: r.err})
+			continue
+		}
+		for p := range merged {
+			merged[p] = append(merged[p], r.matches[p]...)
+		}
+	}
+
+	if len(failed) == len(results) || (len(failed) > 0 && !c.config.AllowPartial) {
+		return nil, &PartialResultsError{Failed: failed}
+	}
+
+	for p := range merged {
+		merged[p] = mergeMatches(merged[p], k)
+	}
+	if len(failed) > 0 {
+		return merged, &PartialResultsError{Failed: failed}
+	}
+	return merged, nil
+}
+
+// Identify detects and encodes the faces of img locally and identifies them across all shards
+// With AllowPartial, faces are returned together with a *PartialResultsError when some shards failed
+func (c *Coordinator) Identify(ctx context.Context, fr *FaceRecognizer, img *ImageMatrix, opts IdentifyOptions) ([]IdentifiedFace, error) {
+	opts = opts.withDefaults()
+	faces, err := fr.detectForIdentify(img, opts)
+	if err != nil || len(faces) == 0 {
+		return faces, err
+	}
+
+	probes := make([]FaceEncoding, len(faces))
+	for i := range faces {
+		probes[i] = faces[i].Encoding
+	}
+
+	results, err := c.Match(ctx, probes, opts.Candidates, 0)
+	if results == nil {
+		return nil, err
+	}
+	for i := range faces {
+		faces[i].setMatches(results[i], opts)
+	}
+	return faces, err
+}
+
+// queryShard tries the replicas of shard i, healthy ones first, until one answers
+func (c *Coordinator) queryShard(ctx context.Context, i int, probes []FaceEncoding, k int, tolerance float64) ([][]PersonMatch, error) {
+	replicas := c.config.Shards[i].Replicas
+	start := int(c.next[i].Add(1)) % len(replicas)
+
+	now := time.Now()
+	var healthy, down []int
+	c.mu.Lock()
+	for n := 0; n < len(replicas); n++ {
+		r := (start + n) % len(replicas)
+		if c.downUntil[[2]int{i, r}].After(now) {
+			down = append(down, r)
+		} else {
+			healthy = append(healthy, r)
+		}
+	}
+	c.mu.Unlock()
+
+	var errs []error
+	for _, r := range append(healthy, down...) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		attempt, cancel := context.WithTimeout(ctx, c.config.Timeout)
+		matches, err := replicas[r].Match(attempt, probes, k, tolerance)
+		cancel()
+		if err == nil && len(matches) != len(probes) {
+			err = fmt.Errorf("got %d result lists for %d probes", len(matches), len(probes))
+		}
+
+		c.mu.Lock()
+		if err != nil {
+			c.downUntil[[2]int{i, r}] = time.Now().Add(c.config.Backoff)
+		} else {
+			delete(c.downUntil, [2]int{i, r})
+		}
+		c.mu.Unlock()
+
+		if err == nil {
+			return matches, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", replicas[r].Name(), err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// mergeMatches sorts matches from several shards, keeps each person once and truncates to k
+func mergeMatches(matches []PersonMatch, k int) []PersonMatch {
+	sort.SliceStable(matches, func(a, b int) bool { return matches[a].Distance < matches[b].Distance })
+
+	seen := make(map[string]bool, len(matches))
+	out := matches[:0]
+	for _, m := range matches {
+		if seen[m.Person.ID] {
+			continue
+		}
+		seen[m.Person.ID] = true
+		out = append(out, m)
+		if k > 0 && len(out) == k {
+			break
+		}
+	}
+	return out
+}
+
+// Validate returns a *ConfigError listing every problem of the configuration
+func (c CoordinatorConfig) Validate() error {
+	p := configProblems{config: "CoordinatorConfig"}
+	if len(c.Shards) == 0 {
+		p.add("Shards", "no shards", "add a Shard for every part of the gallery")
+	}
+	names := make(map[string]bool)
+	for i, s := range c.Shards {
+		field := fmt.Sprintf("Shards[%d]", i)
+		if s.Name != "" && names[s.Name] {
+			p.add(field+".Name", fmt.Sprintf("%q is used by another shard", s.Name), "give every shard its own name, results are reported by it")
+		}
+		names[s.Name] = true
+		if len(s.Replicas) == 0 {
+			p.add(field+".Replicas", fmt.Sprintf("shard %q has no replicas", s.Name), "add a LocalMatcher or HTTPMatcherNode serving the shard")
+		}
+		for j, r := range s.Replicas {
+			if r == nil {
+				p.add(fmt.Sprintf("%s.Replicas[%d]", field, j), "replica is nil", "remove it from the list")
+			}
+		}
+	}
+	p.checkNonNegative("Timeout", int64(c.Timeout), "use 0 for the 2s default")
+	p.checkNonNegative("Backoff", int64(c.Backoff), "use 0 for the 30s default")
+	return p.err()
+}
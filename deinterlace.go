@@ -0,0 +1,135 @@
+package gofacerecognition
+
+// DeinterlaceMode selects how interlaced frames are converted to progressive ones
+type DeinterlaceMode string
+
+const (
+	// DeinterlaceNone leaves frames untouched (default)
+	DeinterlaceNone DeinterlaceMode = ""
+	// DeinterlaceBob keeps the top field and interpolates the bottom field lines from their neighbours
+	// It removes all combing at the cost of half the vertical resolution
+	DeinterlaceBob DeinterlaceMode = "bob"
+	// DeinterlaceWeave keeps both fields and only interpolates pixels that show combing from motion between fields
+	DeinterlaceWeave DeinterlaceMode = "weave"
+)
+
+// defaultCombThreshold is the minimum deviation of a line from both neighbours, in intensity levels, to count as combing
+const defaultCombThreshold = 20
+
+// Deinterlace returns a progressive copy of an interlaced frame
+func Deinterlace(img *ImageMatrix, mode DeinterlaceMode) *ImageMatrix {
+	out := img.clone()
+	if mode == DeinterlaceNone || img.Height < 3 {
+		return out
+	}
+
+	for y := 1; y < img.Height; y += 2 {
+		above := y - 1
+		below := y + 1
+		if below >= img.Height {
+			below = above
+		}
+		for x := 0; x < img.Width; x++ {
+			r0, g0, b0 := img.At(x, above)
+			r1, g1, b1 := img.At(x, y)
+			r2, g2, b2 := img.At(x, below)
+
+			if mode == DeinterlaceWeave && !combed(luma(r0, g0, b0), luma(r1, g1, b1), luma(r2, g2, b2)) {
+				continue
+			}
+			out.Set(x, y, avg2(r0, r2), avg2(g0, g2), avg2(b0, b2))
+		}
+	}
+	return out
+}
+
+// WeaveFields interleaves two half-height fields into one frame, top field lines first
+// Use it with capture cards that deliver each field as a separate image
+// The frame is grayscale when the top field is
+func WeaveFields(top, bottom *ImageMatrix) *ImageMatrix {
+	switch {
+	case top.IsGray() && !bottom.IsGray():
+		bottom = bottom.ToGray()
+	case !top.IsGray() && bottom.IsGray():
+		bottom = bottom.ToRGB()
+	}
+	width := min(top.Width, bottom.Width)
+	lines := min(top.Height, bottom.Height)
+	out := top.newLike(width, lines*2)
+	row := width * out.bytesPerPixel()
+	for y := 0; y < out.Height; y++ {
+		field := top
+		if y%2 == 1 {
+			field = bottom
+		}
+		src := (y / 2) * field.Stride
+		copy(out.Pixels[y*out.Stride:y*out.Stride+row], field.Pixels[src:src+row])
+	}
+	return out
+}
+
+// combed reports whether the middle line sticks out from both neighbours in the same direction
+func combed(above, mid, below byte) bool {
+	a, m, b := int(above), int(mid), int(below)
+	return (m-a > defaultCombThreshold && m-b > defaultCombThreshold) ||
+		(a-m > defaultCombThreshold && b-m > defaultCombThreshold)
+}
+
+func avg2(a, b byte) byte {
+	return byte((int(a) + int(b) + 1) / 2)
+}
+
+// DenoiseConfig configures a TemporalDenoiser
+type DenoiseConfig struct {
+	// Strength is the weight of the previous output in the running average, 0 to 1 (default 0.5)
+	Strength float64
+	// MotionThreshold is the intensity change above which a pixel is treated as moving and left unfiltered (default 24)
+	MotionThreshold int
+}
+
+// TemporalDenoiser smooths sensor and analog noise by averaging each pixel with the previous frames
+// Moving pixels are passed through so faces do not ghost; it is not safe for concurrent use
+type TemporalDenoiser struct {
+	config DenoiseConfig
+	prev   *ImageMatrix
+}
+
+// NewTemporalDenoiser creates a TemporalDenoiser
+func NewTemporalDenoiser(config DenoiseConfig) *TemporalDenoiser {
+	if config.Strength <= 0 || config.Strength >= 1 {
+		config.Strength = 0.5
+	}
+	if config.MotionThreshold <= 0 {
+		config.MotionThreshold = 24
+	}
+	return &TemporalDenoiser{config: config}
+}
+
+// Process returns the denoised version of the next frame in the stream
+// The filter restarts whenever the frame size or kind, grayscale or RGB, changes
+func (d *TemporalDenoiser) Process(img *ImageMatrix) *ImageMatrix {
+	out := img.clone()
+
+	if d.prev == nil || d.prev.Width != img.Width || d.prev.Height != img.Height || d.prev.IsGray() != img.IsGray() {
+		d.prev = out
+		return out
+	}
+
+	s := d.config.Strength
+	for i, cur := range out.Pixels {
+		p := d.prev.Pixels[i]
+		diff := int(cur) - int(p)
+		if diff < -d.config.MotionThreshold || diff > d.config.MotionThreshold {
+			continue
+		}
+		out.Pixels[i] = byte(s*float64(p) + (1-s)*float64(cur) + 0.5)
+	}
+
+	d.prev = out
+	return out
+}
+
+// Reset forgets the previous frames, use it after a scene cut or camera switch
+func (d *TemporalDenoiser) Reset() {
+	d.prev = nil
+}
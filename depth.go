@@ -0,0 +1,218 @@
+package gofacerecognition
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// DepthMap is a depth image aligned pixel-for-pixel with an RGB ImageMatrix
+// Values are in meters; 0 marks pixels without a depth reading
+type DepthMap struct {
+	Data   []float32
+	Width  int
+	Height int
+}
+
+// NewDepthMap creates an empty depth map
+func NewDepthMap(width, height int) *DepthMap {
+	return &DepthMap{
+		Data:   make([]float32, width*height),
+		Width:  width,
+		Height: height,
+	}
+}
+
+// DepthMapFromMillimeters converts the 16-bit millimeter depth frames produced by RealSense and Kinect sensors
+// It fails when data holds fewer than width*height values
+func DepthMapFromMillimeters(data []uint16, width, height int) (*DepthMap, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid depth frame size %dx%d", width, height)
+	}
+	if len(data) < width*height {
+		return nil, fmt.Errorf("depth frame has %d values, %dx%d needs %d", len(data), width, height, width*height)
+	}
+	dm := NewDepthMap(width, height)
+	for i, v := range data[:width*height] {
+		dm.Data[i] = float32(v) / 1000
+	}
+	return dm, nil
+}
+
+// At returns the depth at (x, y) in meters
+func (dm *DepthMap) At(x, y int) float32 {
+	return dm.Data[y*dm.Width+x]
+}
+
+// RGBDFrame pairs a color image with its aligned depth map
+type RGBDFrame struct {
+	Image *ImageMatrix
+	Depth *DepthMap
+	// FocalLength is the horizontal focal length of the color camera in pixels, used for metric sizes
+	FocalLength float64
+}
+
+// FaceDepthStats describes the depth inside a face rectangle
+type FaceDepthStats struct {
+	MedianDepth float64 // meters
+	// Relief is the RMS deviation from the best-fit plane in meters
+	// Real faces have a few centimeters of relief; photos and screens are nearly flat
+	Relief     float64
+	ValidRatio float64 // fraction of pixels with a depth reading
+}
+
+// Default thresholds for depth-based checks
+const (
+	DefaultMinFaceRelief  = 0.008 // meters
+	DefaultMinFaceWidthM  = 0.10  // meters
+	DefaultMaxFaceWidthM  = 0.25  // meters
+	minDepthValidFraction = 0.3
+)
+
+// FaceDepth computes depth statistics inside a face rectangle
+func FaceDepth(depth *DepthMap, rect Rectangle) FaceDepthStats {
+	rect = trimRectToDepth(rect, depth)
+	total := rect.Area()
+	if total == 0 {
+		return FaceDepthStats{}
+	}
+
+	// Least squares fit of z = a*x + b*y + c over the valid pixels
+	var n, sx, sy, sz, sxx, syy, sxy, sxz, syz float64
+	values := make([]float64, 0, total)
+	for y := rect.Top; y < rect.Bottom; y++ {
+		for x := rect.Left; x < rect.Right; x++ {
+			z := float64(depth.At(x, y))
+			if z <= 0 {
+				continue
+			}
+			fx, fy := float64(x), float64(y)
+			n++
+			sx += fx
+			sy += fy
+			sz += z
+			sxx += fx * fx
+			syy += fy * fy
+			sxy += fx * fy
+			sxz += fx * z
+			syz += fy * z
+			values = append(values, z)
+		}
+	}
+
+	stats := FaceDepthStats{ValidRatio: n / float64(total)}
+	if n < 3 {
+		return stats
+	}
+
+	sort.Float64s(values)
+	stats.MedianDepth = values[len(values)/2]
+
+	a, b, c, ok := solve3x3(
+		[3][3]float64{{sxx, sxy, sx}, {sxy, syy, sy}, {sx, sy, n}},
+		[3]float64{sxz, syz, sz},
+	)
+	if !ok {
+		return stats
+	}
+
+	var residual float64
+	for y := rect.Top; y < rect.Bottom; y++ {
+		for x := rect.Left; x < rect.Right; x++ {
+			z := float64(depth.At(x, y))
+			if z <= 0 {
+				continue
+			}
+			d := z - (a*float64(x) + b*float64(y) + c)
+			residual += d * d
+		}
+	}
+	stats.Relief = math.Sqrt(residual / n)
+
+	return stats
+}
+
+// IsFlatSurface reports whether the face region is planar, as with a printed photo or a screen
+// minRelief <= 0 uses DefaultMinFaceRelief; faces without enough depth readings are treated as flat
+func IsFlatSurface(depth *DepthMap, rect Rectangle, minRelief float64) bool {
+	if minRelief <= 0 {
+		minRelief = DefaultMinFaceRelief
+	}
+	stats := FaceDepth(depth, rect)
+	if stats.ValidRatio < minDepthValidFraction {
+		return true
+	}
+	return stats.Relief < minRelief
+}
+
+// PhysicalFaceWidth estimates the real width of a face in meters from its depth and the camera focal length
+// Returns 0 when there is not enough depth data
+func PhysicalFaceWidth(frame RGBDFrame, rect Rectangle) float64 {
+	if frame.Depth == nil || frame.FocalLength <= 0 {
+		return 0
+	}
+	stats := FaceDepth(frame.Depth, rect)
+	if stats.ValidRatio < minDepthValidFraction {
+		return 0
+	}
+	return float64(rect.Width()) * stats.MedianDepth / frame.FocalLength
+}
+
+// FaceSizePlausible reports whether a detection has the physical size of a real face
+// Rejects tiny faces on a screen close to the camera and posters far away
+// minWidth and maxWidth <= 0 use DefaultMinFaceWidthM and DefaultMaxFaceWidthM
+func FaceSizePlausible(frame RGBDFrame, rect Rectangle, minWidth, maxWidth float64) bool {
+	if minWidth <= 0 {
+		minWidth = DefaultMinFaceWidthM
+	}
+	if maxWidth <= 0 {
+		maxWidth = DefaultMaxFaceWidthM
+	}
+	w := PhysicalFaceWidth(frame, rect)
+	return w >= minWidth && w <= maxWidth
+}
+
+// FaceLocationsRGBD runs FaceLocations on the color image of frame and drops detections whose physical
+// size rules out a real face, such as faces on a phone held to the camera or on a poster far behind
+// Without a depth map or focal length every detection is kept
+func (fr *FaceRecognizer) FaceLocationsRGBD(frame RGBDFrame, upsampleTimes int, model DetectionModel) ([]Rectangle, error) {
+	locations, err := fr.FaceLocations(frame.Image, upsampleTimes, model)
+	if err != nil || frame.Depth == nil || frame.FocalLength <= 0 {
+		return locations, err
+	}
+	kept := locations[:0]
+	for _, rect := range locations {
+		if FaceSizePlausible(frame, rect, 0, 0) {
+			kept = append(kept, rect)
+		}
+	}
+	return kept, nil
+}
+
+func trimRectToDepth(rect Rectangle, depth *DepthMap) Rectangle {
+	return trimRectToBounds(rect, depth.Height, depth.Width)
+}
+
+// solve3x3 solves m * x = v with Cramer's rule
+func solve3x3(m [3][3]float64, v [3]float64) (float64, float64, float64, bool) {
+	det := func(a [3][3]float64) float64 {
+		return a[0][0]*(a[1][1]*a[2][2]-a[1][2]*a[2][1]) -
+			a[0][1]*(a[1][0]*a[2][2]-a[1][2]*a[2][0]) +
+			a[0][2]*(a[1][0]*a[2][1]-a[1][1]*a[2][0])
+	}
+
+	d := det(m)
+	if math.Abs(d) < 1e-12 {
+		return 0, 0, 0, false
+	}
+
+	var x [3]float64
+	for col := 0; col < 3; col++ {
+		mc := m
+		for row := 0; row < 3; row++ {
+			mc[row][col] = v[row]
+		}
+		x[col] = det(mc) / d
+	}
+	return x[0], x[1], x[2], true
+}
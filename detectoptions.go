@@ -0,0 +1,82 @@
+package gofacerecognition
+
+import "math"
+
+// DetectionOptions configures FaceLocationsOptions
+type DetectionOptions struct {
+	Model         DetectionModel // detection model (default HOG)
+	UpsampleTimes int            // detection upsampling, chosen from MinFaceSize when 0 (default 1)
+	// MinFaceSize and MaxFaceSize bound the size of the faces reported, in pixels of the longer side
+	// of the rectangle; 0 leaves the bound off
+	// MinFaceSize also guides detection: without an explicit UpsampleTimes, images are upsampled just
+	// enough to find faces that small, or downscaled when only large faces are wanted, which is faster
+	MinFaceSize int
+	MaxFaceSize int
+}
+
+// detectorWindow is the smallest face, in pixels, the detectors find in an image that is not upsampled
+func detectorWindow(model DetectionModel) int {
+	if model == CNN {
+		return 50
+	}
+	return 80
+}
+
+// FaceLocationsOptions is FaceLocationsWithScores with size constraints, see DetectionOptions
+func (fr *FaceRecognizer) FaceLocationsOptions(img *ImageMatrix, opts DetectionOptions) ([]ScoredRectangle, error) {
+	if opts.Model == "" {
+		opts.Model = HOG
+	}
+
+	upsample, scale := opts.UpsampleTimes, 1.0
+	if upsample <= 0 {
+		upsample = 1
+		if opts.MinFaceSize > 0 {
+			upsample, scale = detectionScale(detectorWindow(opts.Model), opts.MinFaceSize)
+		}
+	}
+
+	src := img
+	if scale < 1 {
+		src = img.Resize(max(1, int(float64(img.Width)*scale)), max(1, int(float64(img.Height)*scale)))
+	}
+
+	faces, err := fr.FaceLocationsWithScores(src, upsample, opts.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	sx, sy := float64(img.Width)/float64(src.Width), float64(img.Height)/float64(src.Height)
+	kept := faces[:0]
+	for _, f := range faces {
+		if src != img {
+			f.Rectangle = Rectangle{
+				Top:    int(float64(f.Top) * sy),
+				Right:  min(int(math.Round(float64(f.Right)*sx)), img.Width),
+				Bottom: min(int(math.Round(float64(f.Bottom)*sy)), img.Height),
+				Left:   int(float64(f.Left) * sx),
+			}
+		}
+		size := max(f.Width(), f.Height())
+		if (opts.MinFaceSize > 0 && size < opts.MinFaceSize) || (opts.MaxFaceSize > 0 && size > opts.MaxFaceSize) {
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return kept, nil
+}
+
+// detectionScale returns the upsampling and the downscale factor that make faces of minFace pixels
+// just large enough for a detector finding faces of window pixels
+// Upsampling is at least 1, as in FaceLocations, and doubles the image each time
+func detectionScale(window, minFace int) (upsample int, scale float64) {
+	upsample = 1
+	for upsample < 4 && window>>upsample > minFace {
+		upsample++
+	}
+	// Faces near the window size are found less reliably, so aim a quarter above it
+	if s := 1.25 * float64(window) / float64(minFace<<upsample); s < 1 {
+		return upsample, s
+	}
+	return upsample, 1
+}
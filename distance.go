@@ -1,6 +1,10 @@
 package gofacerecognition
 
-import "math"
+import (
+	"fmt"
+	"math"
+	"sort"
+)
 
 // FaceDistance calculates the Euclidean distance between two face encodings
 // Lower distance means more similar faces
@@ -91,6 +95,39 @@ func FindBestMatch(knownEncodings []FaceEncoding, faceToCheck FaceEncoding, tole
 	return bestIndex, bestDistance
 }
 
+// Match is a known encoding returned by FindTopKMatches
+type Match struct {
+	Index    int // position in the known encodings
+	Distance float64
+}
+
+// FindTopKMatches returns up to k known encodings within tolerance of faceToCheck, closest first
+// Equal distances keep the order of knownEncodings; default tolerance is 0.6
+func FindTopKMatches(knownEncodings []FaceEncoding, faceToCheck FaceEncoding, k int, tolerance float64) ([]Match, error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("k must be positive, got %d", k)
+	}
+
+	if tolerance <= 0 {
+		tolerance = 0.6
+	}
+
+	matches := []Match{}
+	for i, distance := range FaceDistances(knownEncodings, faceToCheck) {
+		if distance <= tolerance {
+			matches = append(matches, Match{Index: i, Distance: distance})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Distance < matches[j].Distance
+	})
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches, nil
+}
+
 // AverageEncoding calculates the average of multiple face encodings
 // Useful for creating a more robust encoding from multiple images of the same person
 func AverageEncoding(encodings []FaceEncoding) FaceEncoding {
@@ -0,0 +1,222 @@
+// Package draw renders detection results onto images for debugging and demos
+//
+// The functions draw onto any image/draw.Image; wrap an ImageMatrix with Matrix to annotate it in place
+package draw
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	stddraw "image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Style controls how annotations look
+type Style struct {
+	Color       color.Color // stroke and label background (default green)
+	TextColor   color.Color // label text (default black)
+	Thickness   int         // rectangle and landmark line width in pixels (default 2)
+	PointRadius int         // radius of landmark dots (default 2)
+}
+
+// DefaultStyle returns green boxes with black labels, readable on most photos
+func DefaultStyle() Style {
+	return Style{
+		Color:       color.RGBA{R: 0, G: 220, B: 0, A: 255},
+		TextColor:   color.Black,
+		Thickness:   2,
+		PointRadius: 2,
+	}
+}
+
+func (s Style) withDefaults() Style {
+	def := DefaultStyle()
+	if s.Color == nil {
+		s.Color = def.Color
+	}
+	if s.TextColor == nil {
+		s.TextColor = def.TextColor
+	}
+	if s.Thickness <= 0 {
+		s.Thickness = def.Thickness
+	}
+	if s.PointRadius <= 0 {
+		s.PointRadius = def.PointRadius
+	}
+	return s
+}
+
+// Landmarks is implemented by facerec.FaceLandmarks and facerec.FaceLandmarksSmall
+type Landmarks interface {
+	Features() map[string][]facerec.Point
+}
+
+// closedFeatures are drawn as closed outlines, the other features as open lines
+var closedFeatures = map[string]bool{
+	"left_eye": true, "right_eye": true, "top_lip": true, "bottom_lip": true,
+}
+
+// DrawRectangles outlines each rectangle
+func DrawRectangles(img stddraw.Image, rects []facerec.Rectangle, style Style) {
+	style = style.withDefaults()
+	for _, r := range rects {
+		t := style.Thickness
+		fill(img, image.Rect(r.Left, r.Top, r.Right, r.Top+t), style.Color)
+		fill(img, image.Rect(r.Left, r.Bottom-t, r.Right, r.Bottom), style.Color)
+		fill(img, image.Rect(r.Left, r.Top, r.Left+t, r.Bottom), style.Color)
+		fill(img, image.Rect(r.Right-t, r.Top, r.Right, r.Bottom), style.Color)
+	}
+}
+
+// DrawLandmarks draws every landmark point and connects the points of each facial feature
+// lm is typically a facerec.FaceLandmarks or facerec.FaceLandmarksSmall; other values are ignored
+func DrawLandmarks(img stddraw.Image, lm interface{}, style Style) {
+	landmarks, ok := lm.(Landmarks)
+	if !ok {
+		return
+	}
+	style = style.withDefaults()
+
+	width := max(1, style.Thickness/2)
+	for name, points := range landmarks.Features() {
+		for i := 1; i < len(points); i++ {
+			line(img, points[i-1], points[i], width, style.Color)
+		}
+		if closedFeatures[name] && len(points) > 2 {
+			line(img, points[len(points)-1], points[0], width, style.Color)
+		}
+		for _, p := range points {
+			dot(img, p, style.PointRadius, style.Color)
+		}
+	}
+}
+
+// DrawLabels writes labels[i] on a filled box just above rects[i], or inside it when there is no room above
+// Empty labels and labels without a rectangle are skipped
+func DrawLabels(img stddraw.Image, rects []facerec.Rectangle, labels []string, style Style) {
+	style = style.withDefaults()
+	face := basicfont.Face7x13
+	metrics := face.Metrics()
+	height := (metrics.Ascent + metrics.Descent).Ceil() + 4
+
+	for i, label := range labels {
+		if i >= len(rects) || label == "" {
+			continue
+		}
+		r := rects[i]
+		width := font.MeasureString(face, label).Ceil() + 4
+
+		top := r.Top - height
+		if top < img.Bounds().Min.Y {
+			top = r.Top
+		}
+		fill(img, image.Rect(r.Left, top, r.Left+width, top+height), style.Color)
+
+		d := font.Drawer{
+			Dst:  img,
+			Src:  image.NewUniform(style.TextColor),
+			Face: face,
+			Dot:  fixed.P(r.Left+2, top+2+metrics.Ascent.Ceil()),
+		}
+		d.DrawString(label)
+	}
+}
+
+// DrawFaces draws the rectangle and landmarks of each face, and its label when labels is long enough
+func DrawFaces(img stddraw.Image, faces []facerec.Face, labels []string, style Style) {
+	rects := make([]facerec.Rectangle, len(faces))
+	for i, f := range faces {
+		rects[i] = f.Rectangle
+		DrawLandmarks(img, f.Landmarks, style)
+	}
+	DrawRectangles(img, rects, style)
+	DrawLabels(img, rects, labels, style)
+}
+
+// Save writes img as a PNG or JPEG depending on the extension of path
+func Save(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		err = png.Encode(f, img)
+	case ".jpg", ".jpeg":
+		err = jpeg.Encode(f, img, &jpeg.Options{Quality: 90})
+	default:
+		err = fmt.Errorf("unsupported image format %q, use .png, .jpg or .jpeg", filepath.Ext(path))
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// fill paints r clipped to the image bounds
+func fill(img stddraw.Image, r image.Rectangle, c color.Color) {
+	stddraw.Draw(img, r.Intersect(img.Bounds()), image.NewUniform(c), image.Point{}, stddraw.Src)
+}
+
+// dot paints a filled disc centered on p
+func dot(img stddraw.Image, p facerec.Point, radius int, c color.Color) {
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			if dx*dx+dy*dy <= radius*radius {
+				set(img, p.X+dx, p.Y+dy, c)
+			}
+		}
+	}
+}
+
+// line draws a segment with Bresenham's algorithm, widened to a square pen of the given width
+func line(img stddraw.Image, a, b facerec.Point, width int, c color.Color) {
+	dx, dy := abs(b.X-a.X), -abs(b.Y-a.Y)
+	sx, sy := 1, 1
+	if a.X > b.X {
+		sx = -1
+	}
+	if a.Y > b.Y {
+		sy = -1
+	}
+
+	half := width / 2
+	x, y, e := a.X, a.Y, dx+dy
+	for {
+		fill(img, image.Rect(x-half, y-half, x-half+width, y-half+width), c)
+		if x == b.X && y == b.Y {
+			return
+		}
+		if e2 := 2 * e; e2 >= dy {
+			e += dy
+			x += sx
+		} else {
+			e += dx
+			y += sy
+		}
+	}
+}
+
+func set(img stddraw.Image, x, y int, c color.Color) {
+	if (image.Point{X: x, Y: y}).In(img.Bounds()) {
+		img.Set(x, y, c)
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,48 @@
+package draw
+
+import (
+	"image"
+	"image/color"
+	stddraw "image/draw"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+)
+
+// matrixImage adapts an ImageMatrix to image/draw.Image, writes go straight to its pixels
+type matrixImage struct {
+	im *facerec.ImageMatrix
+}
+
+// Matrix returns a draw.Image backed by im, so annotations modify the matrix in place
+func Matrix(im *facerec.ImageMatrix) stddraw.Image {
+	return matrixImage{im: im}
+}
+
+func (m matrixImage) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+func (m matrixImage) Bounds() image.Rectangle {
+	return image.Rect(0, 0, m.im.Width, m.im.Height)
+}
+
+func (m matrixImage) At(x, y int) color.Color {
+	if !(image.Point{X: x, Y: y}).In(m.Bounds()) {
+		return color.RGBA{}
+	}
+	r, g, b := m.im.At(x, y)
+	return color.RGBA{R: r, G: g, B: b, A: 255}
+}
+
+// Set blends c over the pixel, since an ImageMatrix has no alpha channel
+func (m matrixImage) Set(x, y int, c color.Color) {
+	if !(image.Point{X: x, Y: y}).In(m.Bounds()) {
+		return
+	}
+	sr, sg, sb, sa := c.RGBA()
+	dr, dg, db := m.im.At(x, y)
+	blend := func(s uint32, d byte) byte {
+		return byte((s + uint32(d)*0x101*(0xffff-sa)/0xffff) >> 8)
+	}
+	m.im.Set(x, y, blend(sr, dr), blend(sg, dg), blend(sb, db))
+}
@@ -0,0 +1,189 @@
+package gofacerecognition
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// DlibModelID identifies encodings produced by dlib's ResNet face recognition model
+const DlibModelID = "dlib_resnet_v1"
+
+// Encoder computes face encodings for faces at known locations
+// Encodings from different ModelIDs are not comparable with each other
+type Encoder interface {
+	ModelID() string
+	Encode(img *ImageMatrix, locations []Rectangle) ([]FaceEncoding, error)
+}
+
+// ModelID returns the identifier of the model producing this recognizer's encodings
+func (fr *FaceRecognizer) ModelID() string {
+	return DlibModelID
+}
+
+// Encode computes encodings with the 68-point landmarks and the configured number of jitters
+func (fr *FaceRecognizer) Encode(img *ImageMatrix, locations []Rectangle) ([]FaceEncoding, error) {
+	return fr.FaceEncodings(img, locations, fr.numJitters, LandmarkLarge)
+}
+
+// MetricEncoder is an Encoder whose encodings are compared with another metric or tolerance than
+// the Euclidean 0.6 of dlib's model
+type MetricEncoder interface {
+	Encoder
+	Metric() DistanceMetric
+	Tolerance() float64 // match threshold under Metric
+}
+
+// FuncEncoder adapts a function to an Encoder, e.g. to run a model of the caller's in an
+// EnsembleEncoder or with ReencodeGallery
+type FuncEncoder struct {
+	Model string // returned by ModelID, must differ from DlibModelID
+	Fn    func(img *ImageMatrix, locations []Rectangle) ([]FaceEncoding, error)
+}
+
+// ModelID returns e.Model
+func (e FuncEncoder) ModelID() string {
+	return e.Model
+}
+
+// Encode calls e.Fn
+func (e FuncEncoder) Encode(img *ImageMatrix, locations []Rectangle) ([]FaceEncoding, error) {
+	return e.Fn(img, locations)
+}
+
+// EncoderBackend creates the Encoder of a model; fr is a loaded recognizer, for backends that reuse
+// it, and modelDir the directory the backend's model files live in
+type EncoderBackend func(fr *FaceRecognizer, modelDir string) (Encoder, error)
+
+var (
+	encoderBackendsMu sync.RWMutex
+	encoderBackends   = map[string]EncoderBackend{
+		DlibModelID: func(fr *FaceRecognizer, modelDir string) (Encoder, error) { return fr, nil },
+	}
+)
+
+// RegisterEncoderBackend makes an encoder available to NewEncoder under name, replacing any backend
+// registered under it before; optional backends register themselves from init in their build-tagged files
+func RegisterEncoderBackend(name string, backend EncoderBackend) {
+	encoderBackendsMu.Lock()
+	defer encoderBackendsMu.Unlock()
+	encoderBackends[name] = backend
+}
+
+// EncoderBackends returns the names of the registered encoder backends, sorted
+func EncoderBackends() []string {
+	encoderBackendsMu.RLock()
+	defer encoderBackendsMu.RUnlock()
+	names := make([]string, 0, len(encoderBackends))
+	for name := range encoderBackends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewEncoder creates the encoder registered under name
+// It returns an *InvalidModelError listing the available backends when name is not registered
+func NewEncoder(name string, fr *FaceRecognizer, modelDir string) (Encoder, error) {
+	encoderBackendsMu.RLock()
+	backend, ok := encoderBackends[name]
+	encoderBackendsMu.RUnlock()
+	if !ok {
+		return nil, &InvalidModelError{Model: name, Valid: EncoderBackends()}
+	}
+	return backend(fr, modelDir)
+}
+
+// reencodeChipSize and reencodeChipPadding are the chips ReencodeGallery caches, those of dlib's encoder
+const (
+	reencodeChipSize    = 150
+	reencodeChipPadding = 0.25
+)
+
+// ReencodeOptions configures ReencodeGallery
+type ReencodeOptions struct {
+	// Chips holds aligned face chips of sources seen before, so their faces are not detected again;
+	// chips of faces found in other sources are added to it. nil detects faces in every source
+	Chips *ChipCache
+	// OnSkip is called for each source that cannot be loaded or holds no face
+	OnSkip func(p Person, source string, err error)
+}
+
+// ReencodeGallery re-encodes the Sources of every person with encoder and stores the results next
+// to the existing encodings under encoder.ModelID(), so both models can be matched during a migration
+// Faces are found with detector, or taken from opts.Chips when the largest face of a source was
+// cached. It returns how many people were re-encoded and how many had no usable source
+func ReencodeGallery(db *FaceDB, detector *FaceRecognizer, encoder Encoder, opts ReencodeOptions) (updated, skipped int, err error) {
+	for _, person := range db.List() {
+		var encodings []FaceEncoding
+		for _, src := range person.Sources {
+			img, err := LoadImageFile(src)
+			var encs []FaceEncoding
+			if err == nil {
+				encs, err = reencodeImage(detector, encoder, opts.Chips, img)
+				if err != nil && !errors.Is(err, ErrNoFace) {
+					return updated, skipped, err
+				}
+				if err != nil {
+					err = fmt.Errorf("%s: %w", src, err)
+				}
+			}
+			if err != nil && opts.OnSkip != nil {
+				opts.OnSkip(person, src, err)
+			}
+			encodings = append(encodings, encs...)
+		}
+
+		if len(encodings) == 0 {
+			skipped++
+			continue
+		}
+		if err := db.SetModelEncodings(person.ID, encoder.ModelID(), encodings); err != nil {
+			return updated, skipped, err
+		}
+		updated++
+	}
+	return updated, skipped, nil
+}
+
+// reencodeImage encodes the largest face of img, or returns ErrNoFace
+func reencodeImage(detector *FaceRecognizer, encoder Encoder, chips *ChipCache, img *ImageMatrix) ([]FaceEncoding, error) {
+	var hash string
+	if chips != nil {
+		hash = ImageHash(img)
+		if faces := chips.Faces(hash); len(faces) > 0 {
+			if chip, ok := chips.Get(hash, faces[0]); ok && chip.Width == reencodeChipSize && chip.Height == reencodeChipSize {
+				return encoder.Encode(chip, []Rectangle{chipFace(reencodeChipSize, reencodeChipPadding)})
+			}
+		}
+	}
+
+	locations, err := detector.FaceLocations(img, 1, HOG)
+	if err != nil {
+		return nil, err
+	}
+	if len(locations) == 0 {
+		return nil, ErrNoFace
+	}
+	largest := LargestFaces(locations, 1)
+
+	if chips != nil {
+		faceChips, err := detector.AlignedFaceChips(img, largest, reencodeChipSize, reencodeChipPadding)
+		if err != nil {
+			return nil, err
+		}
+		if len(faceChips) == 1 {
+			if err := chips.Put(hash, largest[0], faceChips[0]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return encoder.Encode(img, largest)
+}
+
+// chipFace returns the face rectangle inside an aligned chip of size pixels with padding
+func chipFace(size int, padding float64) Rectangle {
+	margin := int(float64(size) * padding / (1 + 2*padding))
+	return Rectangle{Top: margin, Right: size - margin, Bottom: size - margin, Left: margin}
+}
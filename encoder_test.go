@@ -0,0 +1,29 @@
+package gofacerecognition
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestNewEncoderBackends(t *testing.T) {
+	if !slices.Contains(EncoderBackends(), DlibModelID) {
+		t.Fatalf("dlib backend is not registered: %v", EncoderBackends())
+	}
+
+	var invalid *InvalidModelError
+	if _, err := NewEncoder("no-such-model", nil, ""); !errors.As(err, &invalid) {
+		t.Fatalf("unknown backend returned %v, want an *InvalidModelError", err)
+	}
+
+	RegisterEncoderBackend("test-encoder", func(fr *FaceRecognizer, modelDir string) (Encoder, error) {
+		return FuncEncoder{Model: "test-encoder:" + modelDir}, nil
+	})
+	encoder, err := NewEncoder("test-encoder", nil, "/models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := encoder.ModelID(); got != "test-encoder:/models" {
+		t.Errorf("ModelID = %q", got)
+	}
+}
@@ -1,80 +1,162 @@
 package gofacerecognition
 
 import (
-	"bytes"
 	"encoding/binary"
 	"encoding/json"
+	"fmt"
 	"io"
+	"math"
+	"runtime"
+	"slices"
+	"sync"
 )
 
+// encodingSize is the size of one encoding in the binary format, 128 little-endian float64s
+const encodingSize = 128 * 8
+
+// encodingChunk is the number of encodings WriteEncodings and ReadEncodings convert per buffer;
+// chunks are converted on up to GOMAXPROCS goroutines and written or read in order
+const encodingChunk = 1024
+
+// maxPreallocEncodings bounds the encodings ReadEncodings allocates before reading them (64 MiB)
+const maxPreallocEncodings = 64 * 1024
+
 // EncodingToBytes converts a FaceEncoding to a byte slice
 // Uses little-endian binary format for efficient storage
 func EncodingToBytes(encoding FaceEncoding) []byte {
-	buf := new(bytes.Buffer)
-	for _, v := range encoding {
-		binary.Write(buf, binary.LittleEndian, v)
-	}
-	return buf.Bytes()
+	buf := make([]byte, encodingSize)
+	putEncoding(buf, &encoding)
+	return buf
 }
 
 // BytesToEncoding converts a byte slice back to a FaceEncoding
 func BytesToEncoding(data []byte) (FaceEncoding, error) {
 	var encoding FaceEncoding
-	buf := bytes.NewReader(data)
-
-	for i := 0; i < 128; i++ {
-		var v float64
-		if err := binary.Read(buf, binary.LittleEndian, &v); err != nil {
-			return encoding, err
-		}
-		encoding[i] = v
+	switch {
+	case len(data) == 0:
+		return encoding, io.EOF
+	case len(data) < encodingSize:
+		return encoding, io.ErrUnexpectedEOF
 	}
-
+	getEncoding(data, &encoding)
 	return encoding, nil
 }
 
 // WriteEncodings writes multiple face encodings to a writer in binary format
 // Format: [count uint32][encoding1][encoding2]...
 func WriteEncodings(w io.Writer, encodings []FaceEncoding) error {
-	// Write count
-	if err := binary.Write(w, binary.LittleEndian, uint32(len(encodings))); err != nil {
+	var count [4]byte
+	binary.LittleEndian.PutUint32(count[:], uint32(len(encodings)))
+	if _, err := w.Write(count[:]); err != nil {
 		return err
 	}
 
-	// Write each encoding
-	for _, enc := range encodings {
-		for _, v := range enc {
-			if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+	buffers := encodingBuffers(len(encodings))
+	for start := 0; start < len(encodings); start += len(buffers) * encodingChunk {
+		chunks := splitChunks(encodings[start:], len(buffers))
+		parallelChunks(len(chunks), func(i int) {
+			for j := range chunks[i] {
+				putEncoding(buffers[i][j*encodingSize:], &chunks[i][j])
+			}
+		})
+		for i, chunk := range chunks {
+			if _, err := w.Write(buffers[i][:len(chunk)*encodingSize]); err != nil {
 				return err
 			}
 		}
 	}
-
 	return nil
 }
 
 // ReadEncodings reads multiple face encodings from a reader
 func ReadEncodings(r io.Reader) ([]FaceEncoding, error) {
-	// Read count
-	var count uint32
-	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
 		return nil, err
 	}
+	count := int(binary.LittleEndian.Uint32(header[:]))
 
-	encodings := make([]FaceEncoding, count)
-
-	// Read each encoding
-	for i := uint32(0); i < count; i++ {
-		for j := 0; j < 128; j++ {
-			if err := binary.Read(r, binary.LittleEndian, &encodings[i][j]); err != nil {
+	// The count comes from the stream, so beyond maxPreallocEncodings memory for the encodings is only
+	// taken as they arrive
+	encodings := make([]FaceEncoding, 0, min(count, maxPreallocEncodings))
+	buffers := encodingBuffers(count)
+	for start := 0; start < count; start += len(buffers) * encodingChunk {
+		n := min(count-start, len(buffers)*encodingChunk)
+		read := 0
+		for i := 0; read < n; i++ {
+			size := min(n-read, encodingChunk)
+			if _, err := io.ReadFull(r, buffers[i][:size*encodingSize]); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
 				return nil, err
 			}
+			read += size
 		}
-	}
 
+		encodings = slices.Grow(encodings, n)[:start+n]
+		chunks := splitChunks(encodings[start:start+n], len(buffers))
+		parallelChunks(len(chunks), func(i int) {
+			for j := range chunks[i] {
+				getEncoding(buffers[i][j*encodingSize:], &chunks[i][j])
+			}
+		})
+	}
 	return encodings, nil
 }
 
+// encodingBuffers returns one chunk buffer per goroutine converting count encodings
+func encodingBuffers(count int) [][]byte {
+	workers := max(min(runtime.GOMAXPROCS(0), (count+encodingChunk-1)/encodingChunk), 1)
+	buffers := make([][]byte, workers)
+	for i := range buffers {
+		buffers[i] = make([]byte, min(count, encodingChunk)*encodingSize)
+	}
+	return buffers
+}
+
+// splitChunks splits the first up to n*encodingChunk encodings into at most n chunks
+func splitChunks(encodings []FaceEncoding, n int) [][]FaceEncoding {
+	var chunks [][]FaceEncoding
+	for len(encodings) > 0 && len(chunks) < n {
+		size := min(len(encodings), encodingChunk)
+		chunks = append(chunks, encodings[:size])
+		encodings = encodings[size:]
+	}
+	return chunks
+}
+
+// parallelChunks runs convert for each of n chunks, on separate goroutines when there are several
+func parallelChunks(n int, convert func(i int)) {
+	if n == 1 {
+		convert(0)
+		return
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			convert(i)
+		}()
+	}
+	wg.Wait()
+}
+
+func putEncoding(dst []byte, encoding *FaceEncoding) {
+	_ = dst[encodingSize-1]
+	for i, v := range encoding {
+		binary.LittleEndian.PutUint64(dst[i*8:], math.Float64bits(v))
+	}
+}
+
+func getEncoding(src []byte, encoding *FaceEncoding) {
+	_ = src[encodingSize-1]
+	for i := range encoding {
+		encoding[i] = math.Float64frombits(binary.LittleEndian.Uint64(src[i*8:]))
+	}
+}
+
 // EncodingToJSON converts a FaceEncoding to JSON
 func EncodingToJSON(encoding FaceEncoding) ([]byte, error) {
 	return json.Marshal(encoding)
@@ -91,19 +173,121 @@ func JSONToEncoding(data []byte) (FaceEncoding, error) {
 type NamedEncoding struct {
 	Name     string       `json:"name"`
 	Encoding FaceEncoding `json:"encoding"`
+	Model    string       `json:"model,omitempty"` // ID of the model that produced the encoding
 	Metadata interface{}  `json:"metadata,omitempty"`
 }
 
+// ModelID returns the model that produced the encoding; untagged encodings predate tagging and come from dlib
+func (n NamedEncoding) ModelID() string {
+	if n.Model == "" {
+		return DlibModelID
+	}
+	return n.Model
+}
+
 // EncodeNamedEncodings serializes named encodings to JSON
+// Untagged encodings are tagged with DlibModelID
 func EncodeNamedEncodings(encodings []NamedEncoding) ([]byte, error) {
-	return json.MarshalIndent(encodings, "", "  ")
+	tagged := make([]NamedEncoding, len(encodings))
+	for i, enc := range encodings {
+		enc.Model = enc.ModelID()
+		tagged[i] = enc
+	}
+	return json.MarshalIndent(tagged, "", "  ")
 }
 
 // DecodeNamedEncodings deserializes named encodings from JSON
+// Untagged encodings are tagged with DlibModelID
 func DecodeNamedEncodings(data []byte) ([]NamedEncoding, error) {
 	var encodings []NamedEncoding
-	err := json.Unmarshal(data, &encodings)
-	return encodings, err
+	if err := json.Unmarshal(data, &encodings); err != nil {
+		return encodings, err
+	}
+	for i := range encodings {
+		encodings[i].Model = encodings[i].ModelID()
+	}
+	return encodings, nil
+}
+
+// CheckNamedEncodings returns a ModelMismatchError if any encoding was not produced by modelID
+func CheckNamedEncodings(modelID string, encodings []NamedEncoding) error {
+	for _, enc := range encodings {
+		if err := CheckModelCompatibility(modelID, enc.ModelID()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckModelCompatibility returns a ModelMismatchError if encodings from the two models cannot be compared
+// An empty model ID means DlibModelID
+func CheckModelCompatibility(modelA, modelB string) error {
+	if modelA == "" {
+		modelA = DlibModelID
+	}
+	if modelB == "" {
+		modelB = DlibModelID
+	}
+	if modelA != modelB {
+		return &ModelMismatchError{Expected: modelA, Got: modelB}
+	}
+	return nil
+}
+
+// taggedEncodingsMagic starts a binary encoding stream that records the producing model
+var taggedEncodingsMagic = [4]byte{'G', 'F', 'E', '1'}
+
+// WriteTaggedEncodings writes encodings together with the ID of the model that produced them
+// Format: [magic "GFE1"][model length uint16][model ID][count uint32][encoding1][encoding2]...
+func WriteTaggedEncodings(w io.Writer, modelID string, encodings []FaceEncoding) error {
+	if modelID == "" {
+		modelID = DlibModelID
+	}
+	if len(modelID) > 0xFFFF {
+		return fmt.Errorf("model ID too long")
+	}
+
+	if _, err := w.Write(taggedEncodingsMagic[:]); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint16(len(modelID))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, modelID); err != nil {
+		return err
+	}
+	return WriteEncodings(w, encodings)
+}
+
+// ReadTaggedEncodings reads encodings written by WriteTaggedEncodings
+// If expectedModel is not empty, a ModelMismatchError is returned when the stored model differs
+func ReadTaggedEncodings(r io.Reader, expectedModel string) (string, []FaceEncoding, error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return "", nil, err
+	}
+	if magic != taggedEncodingsMagic {
+		return "", nil, fmt.Errorf("not a tagged encodings stream")
+	}
+
+	var n uint16
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return "", nil, err
+	}
+	model := make([]byte, n)
+	if _, err := io.ReadFull(r, model); err != nil {
+		return "", nil, err
+	}
+	modelID := string(model)
+
+	if expectedModel != "" {
+		if err := CheckModelCompatibility(expectedModel, modelID); err != nil {
+			return modelID, nil, err
+		}
+	}
+
+	encodings, err := ReadEncodings(r)
+	return modelID, encodings, err
 }
 
 // NormalizeEncoding normalizes a face encoding to unit length
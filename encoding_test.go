@@ -0,0 +1,96 @@
+package gofacerecognition
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"runtime"
+	"testing"
+)
+
+// testEncodings returns n distinct encodings
+func testEncodings(n int) []FaceEncoding {
+	encodings := make([]FaceEncoding, n)
+	for i := range encodings {
+		for j := range encodings[i] {
+			encodings[i][j] = math.Sin(float64(i*128+j)) / 4
+		}
+	}
+	return encodings
+}
+
+func TestEncodingsRoundTrip(t *testing.T) {
+	// Sizes around the chunk boundaries of the parallel conversion
+	for _, n := range []int{0, 1, encodingChunk - 1, encodingChunk, encodingChunk + 1, 5*encodingChunk + 3} {
+		want := testEncodings(n)
+		var buf bytes.Buffer
+		if err := WriteEncodings(&buf, want); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() != 4+n*encodingSize {
+			t.Errorf("%d encodings: wrote %d bytes, want %d", n, buf.Len(), 4+n*encodingSize)
+		}
+
+		got, err := ReadEncodings(&buf)
+		if err != nil {
+			t.Fatalf("%d encodings: %v", n, err)
+		}
+		if len(got) != n {
+			t.Fatalf("%d encodings: read %d", n, len(got))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("%d encodings: encoding %d differs", n, i)
+			}
+		}
+	}
+}
+
+func TestReadEncodingsUntrustedCount(t *testing.T) {
+	// A header claiming 4 billion encodings followed by two must fail without allocating for the claim
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(math.MaxUint32))
+	for _, e := range testEncodings(2) {
+		buf.Write(EncodingToBytes(e))
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := ReadEncodings(bytes.NewReader(buf.Bytes()))
+	runtime.ReadMemStats(&after)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v, want io.ErrUnexpectedEOF", err)
+	}
+	// Only the conversion buffers, one chunk per goroutine, and the preallocated result may be
+	// allocated up front
+	limit := uint64(runtime.GOMAXPROCS(0)*encodingChunk+maxPreallocEncodings+64) * encodingSize
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > limit {
+		t.Errorf("allocated %d bytes for a truncated stream, want at most %d", allocated, limit)
+	}
+}
+
+func BenchmarkWriteEncodings(b *testing.B) {
+	encodings := testEncodings(10000)
+	b.SetBytes(int64(len(encodings) * encodingSize))
+	for b.Loop() {
+		if err := WriteEncodings(io.Discard, encodings); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadEncodings(b *testing.B) {
+	var buf bytes.Buffer
+	if err := WriteEncodings(&buf, testEncodings(10000)); err != nil {
+		b.Fatal(err)
+	}
+	data := buf.Bytes()
+	b.SetBytes(int64(len(data)))
+	for b.Loop() {
+		if _, err := ReadEncodings(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package gofacerecognition
+
+import (
+	"math"
+	"sort"
+)
+
+// RejectReason is why an Enroller or QualityReport.Issues rejected a capture
+type RejectReason string
+
+const (
+	RejectNoFace      RejectReason = "no_face"
+	RejectAmbiguous   RejectReason = "ambiguous"    // another face almost as large as the largest one
+	RejectSmallFace   RejectReason = "small_face"   // below EnrollerConfig.MinFaceSize
+	RejectBlurry      RejectReason = "blurry"       // below EnrollerConfig.MinSharpness
+	RejectExtremePose RejectReason = "extreme_pose" // beyond EnrollerConfig.MaxYaw or MaxPitch
+	RejectOccluded    RejectReason = "occluded"     // one of EnrollerConfig.RejectOcclusions
+	RejectOutlier     RejectReason = "outlier"      // too far from the other samples, likely another person
+)
+
+// EnrollerConfig configures an Enroller; zero fields take the defaults
+type EnrollerConfig struct {
+	MinFaceSize  int     // smallest accepted face side in pixels (default 80)
+	MinSharpness float64 // smallest accepted Laplacian variance of the face, see EnrollSample.Sharpness (default 25)
+	MaxYaw       float64 // largest accepted yaw in degrees (default 35)
+	MaxPitch     float64 // largest accepted pitch in degrees (default 25)
+	// RejectOcclusions are the occlusions that disqualify a sample (default sunglasses, mask and hand)
+	RejectOcclusions []Occlusion
+	// Occlusions finds the occlusions of a face (default HeuristicOcclusions)
+	Occlusions OcclusionDetector
+	// OutlierDistance drops accepted samples further than this from the most central one, which
+	// keeps a photo of someone else out of the template (default 0.45)
+	OutlierDistance float64
+	MinSamples      int // accepted samples Result needs (default 3)
+	MaxEncodings    int // encodings of the gallery entry, the fused one and one per pose bin (default 6)
+	UpsampleTimes   int // detection upsampling (default 1)
+	NumJitters      int // encoding jitters; enrollment runs once, so a higher count pays off (default 5)
+	Model           DetectionModel
+	PoseBins        PoseBinConfig
+}
+
+func (c EnrollerConfig) withDefaults() EnrollerConfig {
+	if c.MinFaceSize <= 0 {
+		c.MinFaceSize = 80
+	}
+	if c.MinSharpness <= 0 {
+		c.MinSharpness = 25
+	}
+	if c.MaxYaw <= 0 {
+		c.MaxYaw = 35
+	}
+	if c.MaxPitch <= 0 {
+		c.MaxPitch = 25
+	}
+	if c.RejectOcclusions == nil {
+		c.RejectOcclusions = []Occlusion{OcclusionSunglasses, OcclusionMask, OcclusionHand}
+	}
+	if c.Occlusions == nil {
+		c.Occlusions = HeuristicOcclusions
+	}
+	if c.OutlierDistance <= 0 {
+		c.OutlierDistance = 0.45
+	}
+	if c.MinSamples <= 0 {
+		c.MinSamples = 3
+	}
+	if c.MaxEncodings <= 0 {
+		c.MaxEncodings = 6
+	}
+	if c.UpsampleTimes <= 0 {
+		c.UpsampleTimes = 1
+	}
+	if c.NumJitters <= 0 {
+		c.NumJitters = 5
+	}
+	if c.Model == "" {
+		c.Model = HOG
+	}
+	return c
+}
+
+// EnrollSample is one image given to an Enroller and the outcome of its quality checks
+type EnrollSample struct {
+	Index      int // order in which the sample was added
+	Face       Face
+	Pose       HeadPose
+	PoseBin    PoseBin // empty when the pose falls in no bin
+	Sharpness  float64 // BlurScore of the face, higher is sharper
+	Occlusions Occlusions
+	Accepted   bool
+	Reason     RejectReason // set when the sample was rejected
+}
+
+// EnrollmentResult is the gallery entry built from the accepted samples
+type EnrollmentResult struct {
+	// Fused is the mean of the accepted encodings, rescaled to their mean length
+	Fused FaceEncoding
+	// Encodings are Fused followed by the sharpest sample of each captured pose bin, to store with
+	// FaceDB.Add; matching takes the closest one, so faces seen at an angle still match
+	Encodings []FaceEncoding
+	Samples   []EnrollSample
+	Coverage  PoseCoverageReport
+}
+
+// Enroller builds a robust gallery entry from several images of one person: it rejects blurry,
+// small, occluded and extreme-pose samples, drops outliers and fuses the rest, instead of averaging
+// every encoding blindly with AverageEncoding
+// It is not safe for concurrent use
+type Enroller struct {
+	fr      *FaceRecognizer
+	config  EnrollerConfig
+	samples []EnrollSample
+}
+
+// NewEnroller creates an Enroller running fr
+func NewEnroller(fr *FaceRecognizer, config EnrollerConfig) *Enroller {
+	return &Enroller{fr: fr, config: config.withDefaults()}
+}
+
+// Add checks the largest face of img and keeps its encoding when it passes
+// Rejected samples are returned with Accepted false and a Reason; the error is only set when the
+// recognizer fails
+func (e *Enroller) Add(img *ImageMatrix) (EnrollSample, error) {
+	sample := EnrollSample{Index: len(e.samples)}
+	sample, err := e.check(img, sample)
+	if err != nil {
+		return EnrollSample{}, err
+	}
+	e.samples = append(e.samples, sample)
+	return sample, nil
+}
+
+// check runs the quality checks, cheapest first, and encodes the samples that pass
+// The checks run on the image after Config.Preprocessing, the face of the sample is in the
+// coordinates of img
+func (e *Enroller) check(img *ImageMatrix, sample EnrollSample) (EnrollSample, error) {
+	c := e.config
+
+	img, original := e.fr.preprocessImage(img)
+	locations, err := e.fr.faceLocations(img, c.UpsampleTimes, c.Model)
+	if err != nil {
+		return sample, err
+	}
+	if len(locations) == 0 {
+		return e.reject(sample, RejectNoFace), nil
+	}
+	largest := LargestFaces(locations, 2)
+	rect := largest[0]
+	sample.Face = original(Face{Rectangle: rect})
+	if len(largest) > 1 && float64(largest[1].Area()) > 0.5*float64(largest[0].Area()) {
+		return e.reject(sample, RejectAmbiguous), nil
+	}
+
+	// The minimum size refers to the original image, not to a downscaled copy
+	if size := sample.Face.Rectangle; min(size.Width(), size.Height()) < c.MinFaceSize {
+		return e.reject(sample, RejectSmallFace), nil
+	}
+
+	sample.Sharpness = BlurScore(img, rect)
+	if sample.Sharpness < c.MinSharpness {
+		return e.reject(sample, RejectBlurry), nil
+	}
+
+	landmarks, err := e.fr.FaceLandmarks(img, []Rectangle{rect})
+	if err != nil {
+		return sample, err
+	}
+	if len(landmarks) != 1 || len(landmarks[0].Chin) == 0 {
+		return e.reject(sample, RejectNoFace), nil
+	}
+	sample.Face = original(Face{Rectangle: rect, Landmarks: landmarks[0]})
+
+	if sample.Pose, err = EstimateHeadPose(landmarks[0], img.Width, img.Height); err != nil {
+		return e.reject(sample, RejectExtremePose), nil
+	}
+	sample.PoseBin, _ = c.PoseBins.ClassifyPose(sample.Pose)
+	if math.Abs(sample.Pose.Yaw) > c.MaxYaw || math.Abs(sample.Pose.Pitch) > c.MaxPitch {
+		return e.reject(sample, RejectExtremePose), nil
+	}
+
+	if sample.Occlusions, err = c.Occlusions.Occlusions(img, landmarks[0]); err != nil {
+		return sample, err
+	}
+	for _, o := range c.RejectOcclusions {
+		if sample.Occlusions.Has(o) {
+			return e.reject(sample, RejectOccluded), nil
+		}
+	}
+
+	encodings, err := e.fr.FaceEncodings(img, []Rectangle{rect}, c.NumJitters, LandmarkLarge)
+	if err != nil {
+		return sample, err
+	}
+	if len(encodings) != 1 {
+		return e.reject(sample, RejectNoFace), nil
+	}
+	sample.Face.Encoding = encodings[0]
+	sample.Accepted = true
+	return sample, nil
+}
+
+func (e *Enroller) reject(sample EnrollSample, reason RejectReason) EnrollSample {
+	sample.Accepted, sample.Reason = false, reason
+	return sample
+}
+
+// Samples returns every sample added so far, in order
+func (e *Enroller) Samples() []EnrollSample {
+	return append([]EnrollSample(nil), e.samples...)
+}
+
+// Coverage reports the pose bins captured by the accepted samples, to guide users towards the
+// poses still missing
+func (e *Enroller) Coverage() PoseCoverageReport {
+	coverage := NewPoseCoverage(e.config.PoseBins)
+	for _, s := range e.samples {
+		if s.Accepted {
+			coverage.Add(s.Pose)
+		}
+	}
+	return coverage.Report()
+}
+
+// Reset forgets every sample, to enroll another person
+func (e *Enroller) Reset() {
+	e.samples = nil
+}
+
+// Result drops the outliers among the accepted samples and fuses the rest
+// It returns an *InsufficientSamplesError when fewer than MinSamples remain
+func (e *Enroller) Result() (EnrollmentResult, error) {
+	var accepted []int
+	for i, s := range e.samples {
+		if s.Accepted {
+			accepted = append(accepted, i)
+		}
+	}
+
+	// The medoid is the sample with the smallest total distance to the others; unlike the mean, a
+	// photo of someone else cannot pull it away
+	medoid, best := -1, math.Inf(1)
+	for _, i := range accepted {
+		var sum float64
+		for _, j := range accepted {
+			sum += FaceDistance(e.samples[i].Face.Encoding, e.samples[j].Face.Encoding)
+		}
+		if sum < best {
+			medoid, best = i, sum
+		}
+	}
+	var inliers []int
+	for _, i := range accepted {
+		if FaceDistance(e.samples[i].Face.Encoding, e.samples[medoid].Face.Encoding) > e.config.OutlierDistance {
+			e.samples[i] = e.reject(e.samples[i], RejectOutlier)
+			continue
+		}
+		inliers = append(inliers, i)
+	}
+
+	if len(inliers) < e.config.MinSamples {
+		reasons := make(map[RejectReason]int)
+		for _, s := range e.samples {
+			if !s.Accepted {
+				reasons[s.Reason]++
+			}
+		}
+		return EnrollmentResult{}, &InsufficientSamplesError{Accepted: len(inliers), Required: e.config.MinSamples, Reasons: reasons}
+	}
+
+	encodings := make([]FaceEncoding, len(inliers))
+	var length float64
+	for k, i := range inliers {
+		encodings[k] = e.samples[i].Face.Encoding
+		length += encodingLength(encodings[k])
+	}
+	fused := AverageEncoding(encodings)
+	if l := encodingLength(fused); l > 0 {
+		// Averaging shortens the vector, which would shift every distance to the template
+		scale := length / float64(len(inliers)) / l
+		for i := range fused {
+			fused[i] *= scale
+		}
+	}
+
+	result := EnrollmentResult{
+		Fused:     fused,
+		Encodings: []FaceEncoding{fused},
+		Samples:   e.Samples(),
+		Coverage:  e.Coverage(),
+	}
+
+	// One representative per pose bin, the sharpest, in the order of AllPoseBins
+	sort.SliceStable(inliers, func(a, b int) bool {
+		return e.samples[inliers[a]].Sharpness > e.samples[inliers[b]].Sharpness
+	})
+	for _, bin := range AllPoseBins {
+		for _, i := range inliers {
+			if e.samples[i].PoseBin == bin && len(result.Encodings) < e.config.MaxEncodings {
+				result.Encodings = append(result.Encodings, e.samples[i].Face.Encoding)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// Enroll adds the result as a new person of db and returns its ID
+func (e *Enroller) Enroll(db *FaceDB, name string, metadata map[string]string) (string, EnrollmentResult, error) {
+	result, err := e.Result()
+	if err != nil {
+		return "", result, err
+	}
+	id, err := db.Add(name, result.Encodings, metadata)
+	return id, result, err
+}
+
+func encodingLength(e FaceEncoding) float64 {
+	var sum float64
+	for _, v := range e {
+		sum += v * v
+	}
+	return math.Sqrt(sum)
+}
@@ -0,0 +1,184 @@
+package gofacerecognition
+
+import (
+	"fmt"
+	"sort"
+)
+
+// FusionMethod selects how an EnsembleEncoder combines the scores of its members
+type FusionMethod string
+
+const (
+	// FusionWeightedSum averages each member's distance divided by its threshold
+	FusionWeightedSum FusionMethod = "weighted_sum"
+	// FusionRank combines each member's ranking with weighted reciprocal rank fusion
+	FusionRank FusionMethod = "rank"
+)
+
+// rrfK dampens the influence of top ranks in reciprocal rank fusion (the usual value from the literature)
+const rrfK = 60
+
+// EnsembleMember is one encoder in an ensemble
+type EnsembleMember struct {
+	Encoder Encoder
+	Weight  float64 // relative weight (default 1)
+	// Metric compares the member's encodings (default the encoder's MetricEncoder.Metric, or Euclidean)
+	Metric DistanceMetric
+	// Threshold is the member's match distance under Metric, used to bring distances onto a common
+	// scale (default the encoder's MetricEncoder.Tolerance, or Metric.DefaultTolerance)
+	Threshold float64
+}
+
+// EnsembleEncoding holds one encoding per ensemble member, in member order
+type EnsembleEncoding []FaceEncoding
+
+// EnsembleMatch is a fused ranking result
+type EnsembleMatch struct {
+	Index int
+	// Score is the fused distance for FusionWeightedSum (lower is better, <= 1 is a match)
+	// or the fused reciprocal rank score for FusionRank (higher is better)
+	Score     float64
+	Distances []float64 // raw distance from each member
+}
+
+// EnsembleEncoder runs several encoders on the same faces and fuses their scores
+// Useful when the accuracy gain is worth paying for inference on every member, typically the dlib
+// ResNet encoder (FaceRecognizer) with the ONNX encoder of builds with the onnx tag, see NewEncoder;
+// every member keeps its own metric, so cosine-trained models are not compared by Euclidean distance
+type EnsembleEncoder struct {
+	members []EnsembleMember
+	method  FusionMethod
+}
+
+// NewEnsembleEncoder creates an ensemble of at least two members with distinct model IDs
+func NewEnsembleEncoder(method FusionMethod, members ...EnsembleMember) (*EnsembleEncoder, error) {
+	if method != FusionWeightedSum && method != FusionRank {
+		return nil, &InvalidModelError{Model: string(method), Valid: []string{string(FusionWeightedSum), string(FusionRank)}}
+	}
+	if len(members) < 2 {
+		return nil, fmt.Errorf("ensemble needs at least two encoders, got %d", len(members))
+	}
+
+	seen := make(map[string]bool)
+	ms := make([]EnsembleMember, len(members))
+	for i, m := range members {
+		if m.Encoder == nil {
+			return nil, fmt.Errorf("ensemble member %d has no encoder", i)
+		}
+		if seen[m.Encoder.ModelID()] {
+			return nil, fmt.Errorf("ensemble has two encoders for model %s", m.Encoder.ModelID())
+		}
+		seen[m.Encoder.ModelID()] = true
+
+		if m.Weight <= 0 {
+			m.Weight = 1
+		}
+		me, hasMetric := m.Encoder.(MetricEncoder)
+		if m.Metric == "" && hasMetric {
+			m.Metric = me.Metric()
+		}
+		if m.Metric == "" {
+			m.Metric = Euclidean
+		}
+		if err := m.Metric.Validate(); err != nil {
+			return nil, fmt.Errorf("ensemble member %s: %w", m.Encoder.ModelID(), err)
+		}
+		if m.Threshold <= 0 && hasMetric && me.Metric() == m.Metric {
+			m.Threshold = me.Tolerance()
+		}
+		if m.Threshold <= 0 {
+			m.Threshold = m.Metric.DefaultTolerance()
+		}
+		ms[i] = m
+	}
+
+	return &EnsembleEncoder{members: ms, method: method}, nil
+}
+
+// ModelIDs returns the model ID of each member, in member order
+func (e *EnsembleEncoder) ModelIDs() []string {
+	ids := make([]string, len(e.members))
+	for i, m := range e.members {
+		ids[i] = m.Encoder.ModelID()
+	}
+	return ids
+}
+
+// Encode runs every member on the given faces
+func (e *EnsembleEncoder) Encode(img *ImageMatrix, locations []Rectangle) ([]EnsembleEncoding, error) {
+	result := make([]EnsembleEncoding, len(locations))
+	for i := range result {
+		result[i] = make(EnsembleEncoding, len(e.members))
+	}
+
+	for mi, m := range e.members {
+		encodings, err := m.Encoder.Encode(img, locations)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", m.Encoder.ModelID(), err)
+		}
+		if len(encodings) != len(locations) {
+			return nil, fmt.Errorf("%s: returned %d encodings for %d faces", m.Encoder.ModelID(), len(encodings), len(locations))
+		}
+		for i, enc := range encodings {
+			result[i][mi] = enc
+		}
+	}
+
+	return result, nil
+}
+
+// Distance returns the fused weighted-sum distance between two ensemble encodings
+// A value <= 1 means every member agrees on a match on average
+func (e *EnsembleEncoder) Distance(a, b EnsembleEncoding) float64 {
+	var sum, weights float64
+	for i, m := range e.members {
+		sum += m.Weight * m.Metric.Distance(a[i], b[i]) / m.Threshold
+		weights += m.Weight
+	}
+	return sum / weights
+}
+
+// Rank scores a probe against a gallery with the ensemble's fusion method, best match first
+func (e *EnsembleEncoder) Rank(gallery []EnsembleEncoding, probe EnsembleEncoding) []EnsembleMatch {
+	matches := make([]EnsembleMatch, len(gallery))
+	for gi, g := range gallery {
+		matches[gi] = EnsembleMatch{Index: gi, Distances: make([]float64, len(e.members))}
+		for mi, m := range e.members {
+			matches[gi].Distances[mi] = m.Metric.Distance(g[mi], probe[mi])
+		}
+	}
+
+	switch e.method {
+	case FusionRank:
+		order := make([]int, len(gallery))
+		for mi, m := range e.members {
+			for i := range order {
+				order[i] = i
+			}
+			sort.SliceStable(order, func(i, j int) bool {
+				return matches[order[i]].Distances[mi] < matches[order[j]].Distances[mi]
+			})
+			for rank, gi := range order {
+				matches[gi].Score += m.Weight / float64(rrfK+rank+1)
+			}
+		}
+		sort.SliceStable(matches, func(i, j int) bool {
+			return matches[i].Score > matches[j].Score
+		})
+
+	default:
+		for gi := range matches {
+			var sum, weights float64
+			for mi, m := range e.members {
+				sum += m.Weight * matches[gi].Distances[mi] / m.Threshold
+				weights += m.Weight
+			}
+			matches[gi].Score = sum / weights
+		}
+		sort.SliceStable(matches, func(i, j int) bool {
+			return matches[i].Score < matches[j].Score
+		})
+	}
+
+	return matches
+}
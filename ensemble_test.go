@@ -0,0 +1,41 @@
+package gofacerecognition
+
+import (
+	"math"
+	"testing"
+)
+
+// cosineEncoder is a MetricEncoder for tests
+type cosineEncoder struct{ FuncEncoder }
+
+func (cosineEncoder) Metric() DistanceMetric { return Cosine }
+func (cosineEncoder) Tolerance() float64     { return 0.5 }
+
+func TestEnsembleMemberMetrics(t *testing.T) {
+	euclidean := FuncEncoder{Model: "a"}
+	cosine := cosineEncoder{FuncEncoder{Model: "b"}}
+	e, err := NewEnsembleEncoder(FusionWeightedSum, EnsembleMember{Encoder: euclidean}, EnsembleMember{Encoder: cosine})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Same direction, different lengths: far apart for Euclidean, identical for cosine
+	var short, long FaceEncoding
+	short[0], long[0] = 1, 3
+	a := EnsembleEncoding{short, short}
+	b := EnsembleEncoding{short, long}
+
+	// Member a sees identical encodings, member b the same direction, so both distances are 0
+	if d := e.Distance(a, b); d > 1e-9 {
+		t.Errorf("cosine member compared by length, fused distance %v", d)
+	}
+
+	matches := e.Rank([]EnsembleEncoding{b}, a)
+	if got := matches[0].Distances; got[0] != 0 || math.Abs(got[1]) > 1e-9 {
+		t.Errorf("member distances %v, want [0 0]", got)
+	}
+
+	if _, err := NewEnsembleEncoder(FusionWeightedSum, EnsembleMember{Encoder: euclidean}, EnsembleMember{Encoder: FuncEncoder{Model: "c"}, Metric: "hamming"}); err == nil {
+		t.Error("unknown metric accepted")
+	}
+}
@@ -1,6 +1,29 @@
 package gofacerecognition
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sentinel errors for errors.Is, each matches every error of its type, local or decoded from a server
+var (
+	ErrNoFace       error = &NoFaceFoundError{}
+	ErrBusy         error = &BusyError{}
+	ErrUnauthorized error = &UnauthorizedError{}
+)
+
+// IsRetryable reports whether the operation that returned err may succeed when tried again
+// Errors that do not say so through a Retryable method are treated as permanent
+func IsRetryable(err error) bool {
+	var r interface{ Retryable() bool }
+	if errors.As(err, &r) {
+		return r.Retryable()
+	}
+	return false
+}
 
 // ModelNotFoundError: Returned when a required model file is not found
 type ModelNotFoundError struct {
@@ -26,6 +49,32 @@ func (e *ImageLoadError) Unwrap() error {
 	return e.Err
 }
 
+// ImageTooLargeError: Returned when an image declares more pixels than the loader accepts
+type ImageTooLargeError struct {
+	Width     int
+	Height    int
+	MaxPixels int
+}
+
+func (e *ImageTooLargeError) Error() string {
+	return fmt.Sprintf("image of %dx%d pixels exceeds the limit of %d pixels", e.Width, e.Height, e.MaxPixels)
+}
+
+// FrameDecodeError: Returned by a FrameSource when one frame cannot be decoded; the source itself
+// is still usable and Next can be called again
+type FrameDecodeError struct {
+	Source string // file or stream the frame came from
+	Err    error
+}
+
+func (e *FrameDecodeError) Error() string {
+	return fmt.Sprintf("decoding frame of %s: %v", e.Source, e.Err)
+}
+
+func (e *FrameDecodeError) Unwrap() error {
+	return e.Err
+}
+
 // NoFaceFoundError: Returned when no face is found in an image
 type NoFaceFoundError struct{}
 
@@ -33,6 +82,16 @@ func (e *NoFaceFoundError) Error() string {
 	return "no face found in image"
 }
 
+func (e *NoFaceFoundError) Is(target error) bool {
+	_, ok := target.(*NoFaceFoundError)
+	return ok
+}
+
+// Retryable is false, the same image will not show a face on the next attempt
+func (e *NoFaceFoundError) Retryable() bool {
+	return false
+}
+
 // InvalidModelError: Returned when an invalid model type is specified
 type InvalidModelError struct {
 	Model string
@@ -49,3 +108,255 @@ type RecognizerNotInitializedError struct{}
 func (e *RecognizerNotInitializedError) Error() string {
 	return "face recognizer not initialized, call Init() first"
 }
+
+// WorkerCrashedError: Returned when an isolated worker process dies while handling a request
+type WorkerCrashedError struct {
+	State string // exit status of the worker, if known
+	Err   error
+}
+
+func (e *WorkerCrashedError) Error() string {
+	if e.State != "" {
+		return fmt.Sprintf("face recognition worker crashed (%s): %v", e.State, e.Err)
+	}
+	return fmt.Sprintf("face recognition worker crashed: %v", e.Err)
+}
+
+func (e *WorkerCrashedError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable is true, the worker is restarted for the next request
+func (e *WorkerCrashedError) Retryable() bool {
+	return true
+}
+
+// PersonNotFoundError: Returned when a FaceDB has no person with the given ID
+type PersonNotFoundError struct {
+	ID string
+}
+
+func (e *PersonNotFoundError) Error() string {
+	return fmt.Sprintf("person '%s' not found in face database", e.ID)
+}
+
+// NativeError: Returned when the dlib layer fails, including C++ exceptions such as std::bad_alloc
+type NativeError struct {
+	Op      string
+	Message string
+}
+
+func (e *NativeError) Error() string {
+	return fmt.Sprintf("%s failed: %s", e.Op, e.Message)
+}
+
+// GPUUnavailableError: Returned when GPU execution is requested but cannot be used
+type GPUUnavailableError struct {
+	Reason string
+}
+
+func (e *GPUUnavailableError) Error() string {
+	return fmt.Sprintf("GPU unavailable: %s", e.Reason)
+}
+
+// ModelMismatchError: Returned when encodings produced by different models are compared
+type ModelMismatchError struct {
+	Expected string
+	Got      string
+}
+
+func (e *ModelMismatchError) Error() string {
+	return fmt.Sprintf("encoding model mismatch: expected '%s', got '%s'", e.Expected, e.Got)
+}
+
+// ChecksumMismatchError: Returned when a downloaded model does not match its expected SHA-256 digest
+type ChecksumMismatchError struct {
+	Path     string
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("checksum mismatch for '%s': expected %s, got %s", e.Path, e.Expected, e.Actual)
+}
+
+// UnpinnedModelError: Returned when a model has no known SHA-256 digest to check it against
+type UnpinnedModelError struct {
+	Model string
+}
+
+func (e *UnpinnedModelError) Error() string {
+	return fmt.Sprintf("no SHA-256 digest is known for '%s', refusing to use it unverified", e.Model)
+}
+
+// SessionLockedError: Returned when a verification session is locked out after too many failed attempts
+type SessionLockedError struct {
+	Until time.Time
+}
+
+func (e *SessionLockedError) Error() string {
+	return fmt.Sprintf("verification session locked until %s", e.Until.Format(time.RFC3339))
+}
+
+// InvalidLandmarksError: Returned when landmarks are missing points or too degenerate for a computation
+type InvalidLandmarksError struct {
+	Reason string
+}
+
+func (e *InvalidLandmarksError) Error() string {
+	return fmt.Sprintf("invalid landmarks: %s", e.Reason)
+}
+
+// ShardUnavailableError: Returned when no replica of a gallery shard answered a query
+type ShardUnavailableError struct {
+	Shard string
+	Err   error
+}
+
+func (e *ShardUnavailableError) Error() string {
+	return fmt.Sprintf("shard '%s' unavailable: %v", e.Shard, e.Err)
+}
+
+func (e *ShardUnavailableError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ShardUnavailableError) Retryable() bool {
+	return true
+}
+
+// PartialResultsError: Returned when some shards of a distributed query failed
+// Results returned alongside it only cover the shards that answered
+type PartialResultsError struct {
+	Failed []*ShardUnavailableError
+}
+
+func (e *PartialResultsError) Error() string {
+	names := make([]string, len(e.Failed))
+	for i, f := range e.Failed {
+		names[i] = f.Shard
+	}
+	return fmt.Sprintf("%d shard(s) unavailable: %v", len(e.Failed), names)
+}
+
+func (e *PartialResultsError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, f := range e.Failed {
+		errs[i] = f
+	}
+	return errs
+}
+
+// BusyError: Returned when all recognizers are in use and the request was not queued
+type BusyError struct {
+	RetryAfter time.Duration // suggested wait before retrying, 0 if unknown
+}
+
+func (e *BusyError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("face recognition busy, retry after %s", e.RetryAfter)
+	}
+	return "face recognition busy"
+}
+
+func (e *BusyError) Is(target error) bool {
+	_, ok := target.(*BusyError)
+	return ok
+}
+
+func (e *BusyError) Retryable() bool {
+	return true
+}
+
+// UnauthorizedError: Returned when a server rejects the credentials of a request
+type UnauthorizedError struct {
+	Reason string
+}
+
+func (e *UnauthorizedError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("unauthorized: %s", e.Reason)
+	}
+	return "unauthorized"
+}
+
+func (e *UnauthorizedError) Is(target error) bool {
+	_, ok := target.(*UnauthorizedError)
+	return ok
+}
+
+func (e *UnauthorizedError) Retryable() bool {
+	return false
+}
+
+// APIError: Returned by clients for server errors without a more specific type, see ErrorCode
+type APIError struct {
+	Code    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Retryable is true for codes describing a temporary server condition
+func (e *APIError) Retryable() bool {
+	return e.Code == CodeUnavailable || e.Code == CodeBusy
+}
+
+// ConfigError: Returned by the Validate methods of the configuration types, listing every problem found
+type ConfigError struct {
+	Config   string // configuration type, e.g. "Config"
+	Problems []ConfigProblem
+}
+
+// ConfigProblem is one invalid setting of a configuration and how to fix it
+type ConfigProblem struct {
+	Field   string
+	Problem string
+	Fix     string
+	Err     error // underlying error, e.g. a *ModelNotFoundError, or nil
+}
+
+func (e *ConfigError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid %s, %d problem(s):", e.Config, len(e.Problems))
+	for _, p := range e.Problems {
+		fmt.Fprintf(&b, "\n  %s: %s", p.Field, p.Problem)
+		if p.Fix != "" {
+			fmt.Fprintf(&b, " (fix: %s)", p.Fix)
+		}
+	}
+	return b.String()
+}
+
+// Unwrap returns the underlying errors of the problems, so errors.As finds a *ModelNotFoundError
+func (e *ConfigError) Unwrap() []error {
+	var errs []error
+	for _, p := range e.Problems {
+		if p.Err != nil {
+			errs = append(errs, p.Err)
+		}
+	}
+	return errs
+}
+
+// InsufficientSamplesError: Returned by Enroller.Result when too few samples passed the quality checks
+type InsufficientSamplesError struct {
+	Accepted int
+	Required int
+	Reasons  map[RejectReason]int // rejected samples per reason
+}
+
+func (e *InsufficientSamplesError) Error() string {
+	reasons := make([]string, 0, len(e.Reasons))
+	for r, n := range e.Reasons {
+		reasons = append(reasons, fmt.Sprintf("%d %s", n, r))
+	}
+	sort.Strings(reasons)
+	msg := fmt.Sprintf("only %d of the %d required samples passed the quality checks", e.Accepted, e.Required)
+	if len(reasons) > 0 {
+		msg += " (rejected: " + strings.Join(reasons, ", ") + ")"
+	}
+	return msg
+}
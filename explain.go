@@ -0,0 +1,149 @@
+package gofacerecognition
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// DimContribution is the part one dimension of the encodings plays in their distance
+type DimContribution struct {
+	Dim        int     `json:"dim"`
+	Difference float64 `json:"difference"` // a[Dim] - b[Dim]
+	// Share is the fraction of the squared distance due to this dimension; shares of all dimensions sum to 1
+	Share float64 `json:"share"`
+}
+
+// ExplainDistance breaks the Euclidean distance of two encodings down by dimension, largest share
+// first, so investigators can see whether a distance comes from a few dimensions or from all of them
+// Identical encodings give every dimension a share of 0
+func ExplainDistance(a, b FaceEncoding) []DimContribution {
+	contributions := make([]DimContribution, len(a))
+	var sum float64
+	for i := range a {
+		d := a[i] - b[i]
+		contributions[i] = DimContribution{Dim: i, Difference: d}
+		sum += d * d
+	}
+	if sum > 0 {
+		for i := range contributions {
+			d := contributions[i].Difference
+			contributions[i].Share = d * d / sum
+		}
+	}
+
+	sort.SliceStable(contributions, func(i, j int) bool {
+		return contributions[i].Share > contributions[j].Share
+	})
+	return contributions
+}
+
+// saliencyChipSize and saliencyChipPadding match the chips dlib's encoder works on
+const (
+	saliencyChipSize    = 150
+	saliencyChipPadding = 0.25
+)
+
+// SaliencyMap is a coarse map of which regions of a face drive its distance to a reference encoding,
+// found by covering each cell of a grid over the aligned face chip and encoding it again
+type SaliencyMap struct {
+	Chip     *ImageMatrix // The aligned face chip the grid lies on
+	Grid     int          // Cells per side
+	Baseline float64      // Distance of the uncovered chip to the reference
+	// Cells holds, row by row, the change in distance when the cell is covered. Positive cells hold
+	// features the two faces share, covering them moves the faces apart; negative cells hold
+	// features that differ
+	Cells []float64
+}
+
+// At returns the change in distance of the cell in column x and row y
+func (s *SaliencyMap) At(x, y int) float64 {
+	return s.Cells[y*s.Grid+x]
+}
+
+// Overlay returns the chip with positive cells tinted green and negative cells red, in proportion to
+// the largest change in the map
+func (s *SaliencyMap) Overlay() *ImageMatrix {
+	out := s.Chip.Crop(Rectangle{Right: s.Chip.Width, Bottom: s.Chip.Height})
+	var peak float64
+	for _, v := range s.Cells {
+		peak = max(peak, math.Abs(v))
+	}
+	if peak == 0 {
+		return out
+	}
+
+	for y := 0; y < out.Height; y++ {
+		for x := 0; x < out.Width; x++ {
+			v := s.At(x*s.Grid/out.Width, y*s.Grid/out.Height) / peak
+			alpha := 0.6 * math.Abs(v)
+			tint := [3]float64{255, 0, 0}
+			if v > 0 {
+				tint = [3]float64{0, 255, 0}
+			}
+			r, g, b := out.At(x, y)
+			out.Set(x, y,
+				byte(float64(r)*(1-alpha)+tint[0]*alpha),
+				byte(float64(g)*(1-alpha)+tint[1]*alpha),
+				byte(float64(b)*(1-alpha)+tint[2]*alpha))
+		}
+	}
+	return out
+}
+
+// DistanceSaliency maps which regions of the face at location drive its distance to reference
+// Each of the grid x grid cells of the aligned chip is covered with gray in turn and the chip encoded
+// again, so a map costs grid*grid + 1 encodings; grid defaults to 7
+func (fr *FaceRecognizer) DistanceSaliency(img *ImageMatrix, location Rectangle, reference FaceEncoding, grid int) (*SaliencyMap, error) {
+	if grid <= 0 {
+		grid = 7
+	}
+	if grid > saliencyChipSize/4 {
+		return nil, fmt.Errorf("a grid of %d leaves cells too small to cover features, use at most %d", grid, saliencyChipSize/4)
+	}
+
+	chips, err := fr.AlignedFaceChips(img, []Rectangle{location}, saliencyChipSize, saliencyChipPadding)
+	if err != nil {
+		return nil, err
+	}
+	if len(chips) == 0 {
+		return nil, fmt.Errorf("no chip for face at %v", location)
+	}
+	chip := chips[0]
+
+	// The face fills the chip apart from the padding on each side
+	margin := int(saliencyChipSize * saliencyChipPadding / (1 + 2*saliencyChipPadding))
+	face := []Rectangle{{Top: margin, Right: saliencyChipSize - margin, Bottom: saliencyChipSize - margin, Left: margin}}
+	distance := func(im *ImageMatrix) (float64, error) {
+		encodings, err := fr.FaceEncodings(im, face, 1, LandmarkLarge)
+		if err != nil {
+			return 0, err
+		}
+		if len(encodings) == 0 {
+			return 0, fmt.Errorf("chip of face at %v could not be encoded", location)
+		}
+		return FaceDistance(encodings[0], reference), nil
+	}
+
+	baseline, err := distance(chip)
+	if err != nil {
+		return nil, err
+	}
+	s := &SaliencyMap{Chip: chip, Grid: grid, Baseline: baseline, Cells: make([]float64, grid*grid)}
+	for cy := 0; cy < grid; cy++ {
+		for cx := 0; cx < grid; cx++ {
+			covered := chip.Crop(Rectangle{Right: chip.Width, Bottom: chip.Height})
+			for y := cy * chip.Height / grid; y < (cy+1)*chip.Height/grid; y++ {
+				for x := cx * chip.Width / grid; x < (cx+1)*chip.Width/grid; x++ {
+					covered.Set(x, y, 128, 128, 128)
+				}
+			}
+			d, err := distance(covered)
+			if err != nil {
+				return nil, err
+			}
+			s.Cells[cy*grid+cx] = d - baseline
+		}
+	}
+	return s, nil
+}
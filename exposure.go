@@ -0,0 +1,133 @@
+package gofacerecognition
+
+import "math"
+
+// EqualizeHistogram returns a copy of the image with its luma histogram spread over the full range,
+// which brings out faces in dark or washed-out CCTV frames. Colors keep their hue: each pixel is
+// scaled by the ratio of its equalized to its original luma
+func (im *ImageMatrix) EqualizeHistogram() *ImageMatrix {
+	hist, _, n := nirHistogram(im)
+	if n == 0 {
+		return im.mapChannels(identityLUT())
+	}
+
+	// Map the cumulative distribution so the darkest level present stays black
+	var lut [256]byte
+	cdfMin, cum := 0, 0
+	for _, c := range hist {
+		if c > 0 {
+			cdfMin = c
+			break
+		}
+	}
+	for v, c := range hist {
+		cum += c
+		if n > cdfMin {
+			lut[v] = byte(math.Round(float64(max(cum-cdfMin, 0)) / float64(n-cdfMin) * 255))
+		} else {
+			lut[v] = byte(v)
+		}
+	}
+	return im.mapLuma(lut)
+}
+
+// AdjustGamma returns a copy of the image with every channel raised to gamma; values below 1
+// brighten the shadows, where faces in low-light frames hide, values above 1 darken them
+// A gamma that is not positive leaves the image unchanged
+func (im *ImageMatrix) AdjustGamma(gamma float64) *ImageMatrix {
+	if !(gamma > 0) || math.IsInf(gamma, 0) {
+		gamma = 1
+	}
+	var lut [256]byte
+	for v := range lut {
+		lut[v] = byte(math.Round(math.Pow(float64(v)/255, gamma) * 255))
+	}
+	return im.mapChannels(lut)
+}
+
+// AutoGamma returns a copy of the image gamma corrected so its mean luma moves to the middle of
+// the range, brightening underexposed frames and darkening overexposed ones
+func (im *ImageMatrix) AutoGamma() *ImageMatrix {
+	hist, _, n := nirHistogram(im)
+	if n == 0 {
+		return im.mapChannels(identityLUT())
+	}
+	var sum float64
+	for v, c := range hist {
+		sum += float64(v * c)
+	}
+	mean := sum / float64(n) / 255
+	if mean <= 0.01 || mean >= 0.99 {
+		// Nearly black or white frames hold nothing a curve can recover
+		return im.mapChannels(identityLUT())
+	}
+	// Clamped so noise in very dark frames is not amplified into the whole range
+	return im.AdjustGamma(math.Max(0.3, math.Min(3, math.Log(0.5)/math.Log(mean))))
+}
+
+// StretchContrast returns a copy of the image with the luma at the low and high percentiles, e.g.
+// 0.01 and 0.99, stretched to black and white; every channel is stretched the same way
+func (im *ImageMatrix) StretchContrast(lowPercentile, highPercentile float64) *ImageMatrix {
+	hist, _, n := nirHistogram(im)
+	if n == 0 {
+		return im.mapChannels(identityLUT())
+	}
+	lowPercentile = math.Max(0, math.Min(1, lowPercentile))
+	highPercentile = math.Max(lowPercentile, math.Min(1, highPercentile))
+	low := float64(histogramPercentile(hist, n, lowPercentile))
+	high := float64(histogramPercentile(hist, n, highPercentile))
+	if high <= low {
+		high = low + 1
+	}
+
+	var lut [256]byte
+	for v := range lut {
+		t := (float64(v) - low) / (high - low)
+		lut[v] = byte(math.Round(math.Max(0, math.Min(1, t)) * 255))
+	}
+	return im.mapChannels(lut)
+}
+
+func identityLUT() [256]byte {
+	var lut [256]byte
+	for v := range lut {
+		lut[v] = byte(v)
+	}
+	return lut
+}
+
+// mapChannels returns a copy of the image with lut applied to each channel
+func (im *ImageMatrix) mapChannels(lut [256]byte) *ImageMatrix {
+	out := im.newLike(im.Width, im.Height)
+	for y := 0; y < im.Height; y++ {
+		for x := 0; x < im.Width; x++ {
+			r, g, b := im.At(x, y)
+			out.Set(x, y, lut[r], lut[g], lut[b])
+		}
+	}
+	return out
+}
+
+// mapLuma returns a copy of the image with its luma mapped through lut, scaling the channels of
+// each pixel by the same factor
+func (im *ImageMatrix) mapLuma(lut [256]byte) *ImageMatrix {
+	out := im.newLike(im.Width, im.Height)
+	for y := 0; y < im.Height; y++ {
+		for x := 0; x < im.Width; x++ {
+			r, g, b := im.At(x, y)
+			l := luma(r, g, b)
+			if l == 0 {
+				v := lut[0]
+				out.Set(x, y, v, v, v)
+				continue
+			}
+			k := float64(lut[l]) / float64(l)
+			out.Set(x, y, scaleChannel(r, k), scaleChannel(g, k), scaleChannel(b, k))
+		}
+	}
+	return out
+}
+
+func scaleChannel(v byte, k float64) byte {
+	return byte(math.Min(255, math.Round(float64(v)*k)))
+}
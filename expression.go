@@ -0,0 +1,200 @@
+package gofacerecognition
+
+import "math"
+
+// Expression is a facial expression label
+type Expression string
+
+const (
+	ExpressionUnknown   Expression = "unknown" // landmarks are incomplete
+	ExpressionNeutral   Expression = "neutral"
+	ExpressionHappy     Expression = "happy"
+	ExpressionSurprised Expression = "surprised"
+	ExpressionSad       Expression = "sad"
+	ExpressionAngry     Expression = "angry"
+)
+
+// ExpressionFeatures are landmark measurements in a roll-corrected frame, in units of the distance between the eye centers
+type ExpressionFeatures struct {
+	MouthOpen  float64 // gap between the inner lips
+	MouthWidth float64 // distance between the mouth corners
+	CornerLift float64 // height of the mouth corners above the lip center, negative when they droop
+	BrowRaise  float64 // height of the eyebrows above the eyes
+	EyeOpen    float64 // mean eye aspect ratio
+}
+
+// ExpressionResult is the classification of one face
+type ExpressionResult struct {
+	Label      Expression
+	Confidence float64 // score of Label, between 0 and 1
+	Scores     map[Expression]float64
+	Features   ExpressionFeatures
+}
+
+// typicalNeutral is an average neutral face, used until an EmotionClassifier is calibrated
+var typicalNeutral = ExpressionFeatures{
+	MouthOpen:  0.02,
+	MouthWidth: 0.85,
+	CornerLift: 0.0,
+	BrowRaise:  0.35,
+	EyeOpen:    0.28,
+}
+
+// EmotionClassifier classifies expressions from 68-point landmark geometry
+// Features are compared with a neutral baseline; calibrating with neutral frames of the actual person
+// makes it considerably more reliable than the built-in average face
+type EmotionClassifier struct {
+	baseline ExpressionFeatures
+}
+
+// NewEmotionClassifier creates a classifier with an average neutral baseline
+func NewEmotionClassifier() *EmotionClassifier {
+	return &EmotionClassifier{baseline: typicalNeutral}
+}
+
+// Calibrate sets the neutral baseline from landmarks of the person with a relaxed face
+// Incomplete landmarks are ignored; the baseline is unchanged when none are usable
+func (c *EmotionClassifier) Calibrate(neutral []FaceLandmarks) {
+	var sum ExpressionFeatures
+	n := 0
+	for _, lm := range neutral {
+		f, ok := MeasureExpression(lm)
+		if !ok {
+			continue
+		}
+		sum.MouthOpen += f.MouthOpen
+		sum.MouthWidth += f.MouthWidth
+		sum.CornerLift += f.CornerLift
+		sum.BrowRaise += f.BrowRaise
+		sum.EyeOpen += f.EyeOpen
+		n++
+	}
+	if n == 0 {
+		return
+	}
+
+	k := float64(n)
+	c.baseline = ExpressionFeatures{
+		MouthOpen:  sum.MouthOpen / k,
+		MouthWidth: sum.MouthWidth / k,
+		CornerLift: sum.CornerLift / k,
+		BrowRaise:  sum.BrowRaise / k,
+		EyeOpen:    sum.EyeOpen / k,
+	}
+}
+
+// Classify returns the expression of one face
+func (c *EmotionClassifier) Classify(lm FaceLandmarks) ExpressionResult {
+	f, ok := MeasureExpression(lm)
+	if !ok {
+		return ExpressionResult{Label: ExpressionUnknown}
+	}
+
+	b := c.baseline
+	open := unit((f.MouthOpen - b.MouthOpen) / 0.25)
+	wide := unit((f.MouthWidth - b.MouthWidth) / 0.15)
+	lift := (f.CornerLift - b.CornerLift) / 0.04
+	brow := (f.BrowRaise - b.BrowRaise) / 0.08
+	eyes := unit((f.EyeOpen - b.EyeOpen) / 0.08)
+
+	scores := map[Expression]float64{
+		ExpressionHappy:     0.5*wide + 0.5*unit(lift),
+		ExpressionSurprised: 0.45*open + 0.4*unit(brow) + 0.15*eyes,
+		ExpressionSad:       unit(-lift) * (1 - open) * (1 - wide),
+		ExpressionAngry:     unit(-brow*4/3) * (1 - unit(lift)) * (1 - open),
+	}
+
+	strongest := 0.0
+	for _, s := range scores {
+		strongest = math.Max(strongest, s)
+	}
+	scores[ExpressionNeutral] = 1 - strongest
+
+	result := ExpressionResult{Scores: scores, Features: f}
+	for _, label := range []Expression{ExpressionNeutral, ExpressionHappy, ExpressionSurprised, ExpressionSad, ExpressionAngry} {
+		if scores[label] > result.Confidence {
+			result.Label, result.Confidence = label, scores[label]
+		}
+	}
+	return result
+}
+
+// ClassifyAll returns the expression of each face
+func (c *EmotionClassifier) ClassifyAll(landmarks []FaceLandmarks) []ExpressionResult {
+	results := make([]ExpressionResult, len(landmarks))
+	for i, lm := range landmarks {
+		results[i] = c.Classify(lm)
+	}
+	return results
+}
+
+// MeasureExpression computes the expression features of a face, false when the landmarks are incomplete
+func MeasureExpression(lm FaceLandmarks) (ExpressionFeatures, bool) {
+	if len(lm.LeftEye) < 6 || len(lm.RightEye) < 6 || len(lm.LeftEyebrow) < 5 || len(lm.RightEyebrow) < 5 ||
+		len(lm.TopLip) < 12 || len(lm.BottomLip) < 12 {
+		return ExpressionFeatures{}, false
+	}
+
+	// Roll-corrected frame: origin between the eyes, x along the eye line, one unit per eye distance, y pointing down
+	left, right := centroid(lm.LeftEye), centroid(lm.RightEye)
+	iod := math.Hypot(right.x-left.x, right.y-left.y)
+	if iod == 0 {
+		return ExpressionFeatures{}, false
+	}
+	cos, sin := (right.x-left.x)/iod, (right.y-left.y)/iod
+	ox, oy := (left.x+right.x)/2, (left.y+right.y)/2
+	norm := func(p Point) fpoint {
+		dx, dy := float64(p.X)-ox, float64(p.Y)-oy
+		return fpoint{(dx*cos + dy*sin) / iod, (-dx*sin + dy*cos) / iod}
+	}
+
+	cornerL, cornerR := norm(lm.TopLip[0]), norm(lm.TopLip[6])
+	outerTop, outerBottom := norm(lm.TopLip[3]), norm(lm.BottomLip[3])
+	innerTop, innerBottom := norm(lm.TopLip[9]), norm(lm.BottomLip[9])
+
+	var f ExpressionFeatures
+	f.MouthOpen = math.Max(0, innerBottom.y-innerTop.y)
+	f.MouthWidth = math.Hypot(cornerR.x-cornerL.x, cornerR.y-cornerL.y)
+	f.CornerLift = (outerTop.y+outerBottom.y)/2 - (cornerL.y+cornerR.y)/2
+
+	browL, browR := normCentroid(lm.LeftEyebrow, norm), normCentroid(lm.RightEyebrow, norm)
+	eyeL, eyeR := normCentroid(lm.LeftEye, norm), normCentroid(lm.RightEye, norm)
+	f.BrowRaise = ((eyeL.y - browL.y) + (eyeR.y - browR.y)) / 2
+
+	f.EyeOpen = EyeAspectRatio(lm)
+	return f, true
+}
+
+type fpoint struct {
+	x, y float64
+}
+
+func centroid(points []Point) fpoint {
+	var c fpoint
+	for _, p := range points {
+		c.x += float64(p.X)
+		c.y += float64(p.Y)
+	}
+	n := float64(len(points))
+	return fpoint{c.x / n, c.y / n}
+}
+
+func normCentroid(points []Point, norm func(Point) fpoint) fpoint {
+	var c fpoint
+	for _, p := range points {
+		q := norm(p)
+		c.x += q.x
+		c.y += q.y
+	}
+	n := float64(len(points))
+	return fpoint{c.x / n, c.y / n}
+}
+
+func pointDistance(a, b Point) float64 {
+	return math.Hypot(float64(a.X-b.X), float64(a.Y-b.Y))
+}
+
+// unit clamps v to [0, 1]
+func unit(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
@@ -0,0 +1,534 @@
+package gofacerecognition
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Person is a labeled identity stored in a FaceDB
+type Person struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Encodings []FaceEncoding    `json:"encodings"` // produced by DlibModelID
+	// Sources are the image paths the encodings were computed from, used to re-encode with another model
+	Sources []string `json:"sources,omitempty"`
+	// ModelEncodings holds encodings from other models, keyed by model ID, e.g. during a migration
+	ModelEncodings map[string][]FaceEncoding `json:"model_encodings,omitempty"`
+}
+
+// PersonMatch is a search result from a FaceDB
+type PersonMatch struct {
+	Person   Person
+	Distance float64 // distance of the closest encoding of this person
+}
+
+// faceDBFile is the on-disk layout of a FaceDB
+type faceDBFile struct {
+	Version int      `json:"version"`
+	People  []Person `json:"people"`
+	// Replication state, see replication.go
+	NodeID     string                    `json:"node_id,omitempty"`
+	Clock      int64                     `json:"clock,omitempty"`
+	Seq        uint64                    `json:"seq,omitempty"`
+	Versions   map[string]replicaVersion `json:"versions,omitempty"`
+	Tombstones map[string]replicaVersion `json:"tombstones,omitempty"`
+}
+
+const faceDBVersion = 1
+
+// FaceDB stores labeled face encodings and persists them to a single JSON file
+// It is safe for concurrent use
+type FaceDB struct {
+	mu           sync.RWMutex
+	path         string
+	people       map[string]*Person
+	order        []string // insertion order of IDs, keeps listings and saved files stable
+	calibrations CameraCalibrations
+	normalizer   *ScoreNormalizer
+
+	// Replication state, every change stamps the person with a new version
+	nodeID     string
+	clock      int64  // last version timestamp issued or seen
+	seq        uint64 // local change counter, cursors of Changes refer to it
+	versions   map[string]replicaVersion
+	tombstones map[string]replicaVersion
+}
+
+// NewFaceDB creates an empty in-memory database
+// Use SaveTo to persist it
+func NewFaceDB() *FaceDB {
+	// A random node ID never fails to be unique in practice; SetNodeID gives readable ones
+	nodeID, _ := newPersonID()
+	return &FaceDB{
+		people:     make(map[string]*Person),
+		nodeID:     nodeID,
+		versions:   make(map[string]replicaVersion),
+		tombstones: make(map[string]replicaVersion),
+	}
+}
+
+// OpenFaceDB loads a database from path, or creates an empty one if the file does not exist
+// Save writes changes back to the same path
+func OpenFaceDB(path string) (*FaceDB, error) {
+	db := NewFaceDB()
+	db.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	modified := time.Now()
+	if info, err := os.Stat(path); err == nil {
+		modified = info.ModTime()
+	}
+
+	var file faceDBFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse face database %s: %w", path, err)
+	}
+
+	if file.NodeID != "" {
+		db.nodeID = file.NodeID
+	}
+	db.clock, db.seq = file.Clock, file.Seq
+	for id, v := range file.Tombstones {
+		db.tombstones[id] = v
+	}
+
+	for i := range file.People {
+		p := file.People[i]
+		db.people[p.ID] = &p
+		db.order = append(db.order, p.ID)
+
+		// People saved before replication existed are stamped as changed by this node when the file
+		// was last written; the zero version would lose to the absence of the person on every peer
+		v, ok := file.Versions[p.ID]
+		if !ok {
+			db.seq++
+			v = replicaVersion{Time: modified.UnixNano(), Node: db.nodeID, Seq: db.seq}
+			db.clock = max(db.clock, v.Time)
+		}
+		db.versions[p.ID] = v
+	}
+
+	return db, nil
+}
+
+// Add stores a new person and returns the generated ID
+func (db *FaceDB) Add(name string, encodings []FaceEncoding, metadata map[string]string) (string, error) {
+	id, err := newPersonID()
+	if err != nil {
+		return "", err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.people[id] = &Person{
+		ID:        id,
+		Name:      name,
+		Metadata:  copyMetadata(metadata),
+		Encodings: append([]FaceEncoding(nil), encodings...),
+	}
+	db.order = append(db.order, id)
+	db.touch(id)
+	return id, nil
+}
+
+// AddEncoding appends another encoding to an existing person
+func (db *FaceDB) AddEncoding(id string, encoding FaceEncoding) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	p, ok := db.people[id]
+	if !ok {
+		return &PersonNotFoundError{ID: id}
+	}
+	p.Encodings = append(p.Encodings, encoding)
+	db.touch(id)
+	return nil
+}
+
+// Update replaces the name, metadata, and encodings of an existing person
+func (db *FaceDB) Update(person Person) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.people[person.ID]; !ok {
+		return &PersonNotFoundError{ID: person.ID}
+	}
+	c := person.clone()
+	db.people[person.ID] = &c
+	db.touch(person.ID)
+	return nil
+}
+
+// Remove deletes a person from the database
+func (db *FaceDB) Remove(id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.people[id]; !ok {
+		return &PersonNotFoundError{ID: id}
+	}
+	db.remove(id)
+	db.tombstones[id] = db.nextVersion()
+	return nil
+}
+
+// remove deletes a person and its version, the caller records the tombstone
+func (db *FaceDB) remove(id string) {
+	delete(db.people, id)
+	delete(db.versions, id)
+	for i, oid := range db.order {
+		if oid == id {
+			db.order = append(db.order[:i], db.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Get returns a copy of the person with the given ID
+func (db *FaceDB) Get(id string) (Person, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	p, ok := db.people[id]
+	if !ok {
+		return Person{}, false
+	}
+	return p.clone(), true
+}
+
+// FindByName returns all people with the given name
+func (db *FaceDB) FindByName(name string) []Person {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var people []Person
+	for _, id := range db.order {
+		if p := db.people[id]; p.Name == name {
+			people = append(people, p.clone())
+		}
+	}
+	return people
+}
+
+// List returns copies of all people in insertion order
+func (db *FaceDB) List() []Person {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	people := make([]Person, 0, len(db.order))
+	for _, id := range db.order {
+		people = append(people, db.people[id].clone())
+	}
+	return people
+}
+
+// Len returns the number of people in the database
+func (db *FaceDB) Len() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return len(db.people)
+}
+
+// Search returns every person with an encoding within tolerance of probe, closest first
+// Default tolerance is 0.6
+func (db *FaceDB) Search(probe FaceEncoding, tolerance float64) []PersonMatch {
+	return db.SearchModel(DlibModelID, probe, tolerance)
+}
+
+// SetScoreNormalizer sets the cohort normalization used by SearchNormalized
+func (db *FaceDB) SetScoreNormalizer(n *ScoreNormalizer) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.normalizer = n
+}
+
+// SearchNormalized is like Search but compares cohort-normalized scores against threshold
+// PersonMatch.Distance holds the normalized score; threshold 0 uses DefaultNormalizedThreshold
+// Without a normalizer it behaves like Search with the default tolerance
+func (db *FaceDB) SearchNormalized(probe FaceEncoding, threshold float64) []PersonMatch {
+	if threshold == 0 {
+		threshold = DefaultNormalizedThreshold
+	}
+
+	db.mu.RLock()
+	normalizer := db.normalizer
+	db.mu.RUnlock()
+	if normalizer == nil {
+		return db.Search(probe, 0)
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var matches []PersonMatch
+	for _, id := range db.order {
+		p := db.people[id]
+
+		best, found := 0.0, false
+		for _, enc := range p.Encodings {
+			score := normalizer.Normalize(probe, enc, FaceDistance(enc, probe))
+			if !found || score < best {
+				best, found = score, true
+			}
+		}
+
+		if found && best <= threshold {
+			matches = append(matches, PersonMatch{Person: p.clone(), Distance: best})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Distance < matches[j].Distance
+	})
+	return matches
+}
+
+// SetModelEncodings stores encodings produced by another model alongside the existing ones
+func (db *FaceDB) SetModelEncodings(id, modelID string, encodings []FaceEncoding) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	p, ok := db.people[id]
+	if !ok {
+		return &PersonNotFoundError{ID: id}
+	}
+
+	if modelID == DlibModelID {
+		p.Encodings = append([]FaceEncoding(nil), encodings...)
+	} else {
+		if p.ModelEncodings == nil {
+			p.ModelEncodings = make(map[string][]FaceEncoding)
+		}
+		p.ModelEncodings[modelID] = append([]FaceEncoding(nil), encodings...)
+	}
+	db.touch(id)
+	return nil
+}
+
+// Models returns the IDs of every model with encodings in the database
+func (db *FaceDB) Models() []string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	for _, p := range db.people {
+		if len(p.Encodings) > 0 {
+			seen[DlibModelID] = true
+		}
+		for modelID, encs := range p.ModelEncodings {
+			if len(encs) > 0 {
+				seen[modelID] = true
+			}
+		}
+	}
+
+	models := make([]string, 0, len(seen))
+	for modelID := range seen {
+		models = append(models, modelID)
+	}
+	sort.Strings(models)
+	return models
+}
+
+// CheckModel returns a ModelMismatchError if the database holds no encodings produced by modelID,
+// which would make every search with such a probe silently return nothing
+func (db *FaceDB) CheckModel(modelID string) error {
+	models := db.Models()
+	if len(models) == 0 {
+		return nil
+	}
+	for _, m := range models {
+		if m == modelID {
+			return nil
+		}
+	}
+	return &ModelMismatchError{Expected: strings.Join(models, ","), Got: modelID}
+}
+
+// SearchModel is like Search but only compares against encodings produced by modelID
+// Encodings are never compared across models
+func (db *FaceDB) SearchModel(modelID string, probe FaceEncoding, tolerance float64) []PersonMatch {
+	return db.SearchDual(map[string]FaceEncoding{modelID: probe}, tolerance)
+}
+
+// SetCameraCalibrations sets the per-camera corrections used by SearchFromCamera
+func (db *FaceDB) SetCameraCalibrations(cc CameraCalibrations) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.calibrations = cc
+}
+
+// SearchFromCamera is like Search for a probe captured by cameraID
+// The probe and the resulting distances are corrected with the camera's calibration, if one is set
+func (db *FaceDB) SearchFromCamera(cameraID string, probe FaceEncoding, tolerance float64) []PersonMatch {
+	if tolerance <= 0 {
+		tolerance = 0.6
+	}
+
+	db.mu.RLock()
+	cal := db.calibrations[cameraID]
+	db.mu.RUnlock()
+	if cal == nil {
+		return db.Search(probe, tolerance)
+	}
+
+	matches := db.Search(cal.Apply(probe), tolerance+cal.ScoreOffset)
+	kept := matches[:0]
+	for _, m := range matches {
+		m.Distance = cal.AdjustDistance(m.Distance)
+		if m.Distance <= tolerance {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// SearchDual matches one probe per model and keeps each person's closest distance across models
+// This allows matching during a migration, while only part of the gallery has been re-encoded
+func (db *FaceDB) SearchDual(probes map[string]FaceEncoding, tolerance float64) []PersonMatch {
+	if tolerance <= 0 {
+		tolerance = 0.6
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var matches []PersonMatch
+	for _, id := range db.order {
+		p := db.people[id]
+
+		best, found := 0.0, false
+		for modelID, probe := range probes {
+			for _, enc := range p.encodingsFor(modelID) {
+				if d := FaceDistance(enc, probe); !found || d < best {
+					best, found = d, true
+				}
+			}
+		}
+
+		if found && best <= tolerance {
+			matches = append(matches, PersonMatch{Person: p.clone(), Distance: best})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Distance < matches[j].Distance
+	})
+	return matches
+}
+
+// Save writes the database back to the path it was opened from
+func (db *FaceDB) Save() error {
+	db.mu.RLock()
+	path := db.path
+	db.mu.RUnlock()
+
+	if path == "" {
+		return fmt.Errorf("face database has no path, use SaveTo")
+	}
+	return db.SaveTo(path)
+}
+
+// SaveTo writes the database to path atomically and makes it the path used by Save
+func (db *FaceDB) SaveTo(path string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	file := faceDBFile{
+		Version:    faceDBVersion,
+		People:     make([]Person, 0, len(db.order)),
+		NodeID:     db.nodeID,
+		Clock:      db.clock,
+		Seq:        db.seq,
+		Versions:   db.versions,
+		Tombstones: db.tombstones,
+	}
+	for _, id := range db.order {
+		file.People = append(file.People, *db.people[id])
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file in the same directory and rename so a crash never leaves a truncated database
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	db.path = path
+	return nil
+}
+
+// encodingsFor returns the person's encodings produced by modelID
+func (p *Person) encodingsFor(modelID string) []FaceEncoding {
+	if modelID == DlibModelID {
+		return p.Encodings
+	}
+	return p.ModelEncodings[modelID]
+}
+
+func (p *Person) clone() Person {
+	c := *p
+	c.Metadata = copyMetadata(p.Metadata)
+	c.Encodings = append([]FaceEncoding(nil), p.Encodings...)
+	c.Sources = append([]string(nil), p.Sources...)
+	if p.ModelEncodings != nil {
+		c.ModelEncodings = make(map[string][]FaceEncoding, len(p.ModelEncodings))
+		for k, v := range p.ModelEncodings {
+			c.ModelEncodings[k] = append([]FaceEncoding(nil), v...)
+		}
+	}
+	return c
+}
+
+func copyMetadata(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func newPersonID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
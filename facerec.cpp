@@ -1,8 +1,15 @@
+#include <dlib/clustering.h>
 #include <dlib/image_processing.h>
 #include <dlib/image_processing/frontal_face_detector.h>
+#include <dlib/image_transforms.h>
 #include <dlib/matrix.h>
 #include <dlib/dnn.h>
+#include <algorithm>
+#include <cmath>
+#include <cstdlib>
 #include <cstring>
+#include <new>
+#include <stdexcept>
 #include <string>
 #include <vector>
 
@@ -38,6 +45,46 @@ using anet_type = dlib::loss_metric<dlib::fc_no_bias<128, dlib::avg_pool_everyth
     alevel0<alevel1<alevel2<alevel3<alevel4<dlib::max_pool<3, 3, 2, 2,
     dlib::relu<dlib::affine<dlib::con<32, 7, 7, 2, 2, dlib::input_rgb_image_sized<150>>>>>>>>>>>>>;
 
+// CNN face detector network definition (matches mmod_human_face_detector.dat)
+template <long num_filters, typename SUBNET> using con5d = dlib::con<num_filters, 5, 5, 2, 2, SUBNET>;
+template <long num_filters, typename SUBNET> using con5 = dlib::con<num_filters, 5, 5, 1, 1, SUBNET>;
+
+template <typename SUBNET>
+using downsampler = dlib::relu<dlib::affine<con5d<32, dlib::relu<dlib::affine<con5d<32,
+    dlib::relu<dlib::affine<con5d<16, SUBNET>>>>>>>>>;
+template <typename SUBNET>
+using rcon5 = dlib::relu<dlib::affine<con5<45, SUBNET>>>;
+
+using cnn_net_type = dlib::loss_mmod<dlib::con<1, 9, 9, 1, 1, rcon5<rcon5<rcon5<downsampler<
+    dlib::input_rgb_image_pyramid<dlib::pyramid_down<6>>>>>>>>;
+
+// Age and gender networks (match dnn_age_predictor_v1.dat and dnn_gender_classifier_v1.dat from dlib-models)
+// Files with a different architecture fail to deserialize and leave the estimator disabled
+template <int N, typename SUBNET>
+using gres = dlib::relu<residual<block, N, dlib::affine, SUBNET>>;
+template <int N, typename SUBNET>
+using gres_down = dlib::relu<residual_down<block, N, dlib::affine, SUBNET>>;
+
+template <typename SUBNET>
+using glevel1 = gres<512, gres_down<512, SUBNET>>;
+template <typename SUBNET>
+using glevel2 = gres<256, gres_down<256, SUBNET>>;
+template <typename SUBNET>
+using glevel3 = gres<128, gres_down<128, SUBNET>>;
+template <typename SUBNET>
+using glevel4 = gres<64, gres<64, SUBNET>>;
+
+template <typename SUBNET>
+using attribute_trunk = dlib::avg_pool_everything<glevel1<glevel2<glevel3<glevel4<
+    dlib::max_pool<3, 3, 2, 2, dlib::relu<dlib::affine<dlib::con<64, 7, 7, 2, 2, SUBNET>>>>>>>>>;
+
+static const int gender_chip_size = 32;
+static const int age_chip_size = 64;
+static const int age_classes = 81; // ages 0 to 80
+
+using gender_net_type = dlib::loss_multiclass_log<dlib::fc<2, attribute_trunk<dlib::input_rgb_image_sized<gender_chip_size>>>>;
+using age_net_type = dlib::loss_multiclass_log<dlib::fc<age_classes, attribute_trunk<dlib::input_rgb_image_sized<age_chip_size>>>>;
+
 // Internal face recognizer struct
 struct FaceRecognizer {
     std::string error_msg;
@@ -47,22 +94,42 @@ struct FaceRecognizer {
     dlib::shape_predictor shape_predictor_68;
     dlib::shape_predictor shape_predictor_5;
     anet_type face_encoder;
+    cnn_net_type cnn_detector;
+    // Softmax heads over the loaded networks, giving class probabilities instead of labels
+    dlib::softmax<gender_net_type::subnet_type> gender_classifier;
+    dlib::softmax<age_net_type::subnet_type> age_predictor;
 
     bool hog_loaded;
     bool sp68_loaded;
     bool sp5_loaded;
     bool encoder_loaded;
+    bool cnn_loaded;
+    bool gender_loaded;
+    bool age_loaded;
+
+    bool use_gpu;
+    int gpu_device;
+
+    // Applied to CNN detections the way BoxCalibration.Apply maps boxes, see facerec_set_cnn_box_calibration
+    double cnn_scale_x, cnn_scale_y, cnn_shift_x, cnn_shift_y;
 
     FaceRecognizer() : hog_loaded(false), sp68_loaded(false), sp5_loaded(false),
-                       encoder_loaded(false) {}
+                       encoder_loaded(false), cnn_loaded(false), gender_loaded(false),
+                       age_loaded(false), use_gpu(false), gpu_device(0),
+                       cnn_scale_x(1), cnn_scale_y(1), cnn_shift_x(0), cnn_shift_y(0) {}
 };
 
-// Convert Go image to dlib matrix
+// Convert Go image to dlib matrix, grayscale images are replicated to all three channels
 dlib::matrix<dlib::rgb_pixel> image_to_matrix(const image& img) {
     dlib::matrix<dlib::rgb_pixel> mat(img.height, img.width);
 
     for (int y = 0; y < img.height; y++) {
         for (int x = 0; x < img.width; x++) {
+            if (img.channels == 1) {
+                uint8_t v = img.data[y * img.stride + x];
+                mat(y, x) = dlib::rgb_pixel(v, v, v);
+                continue;
+            }
             int idx = y * img.stride + x * 3;
             mat(y, x) = dlib::rgb_pixel(
                 img.data[idx],
@@ -75,13 +142,79 @@ dlib::matrix<dlib::rgb_pixel> image_to_matrix(const image& img) {
     return mat;
 }
 
+// Convert a grayscale Go image to a dlib matrix without widening it to RGB
+dlib::matrix<unsigned char> gray_image_to_matrix(const image& img) {
+    dlib::matrix<unsigned char> mat(img.height, img.width);
+
+    for (int y = 0; y < img.height; y++) {
+        for (int x = 0; x < img.width; x++) {
+            mat(y, x) = img.data[y * img.stride + x];
+        }
+    }
+
+    return mat;
+}
+
+// Copy a message into a malloc'd string that the caller releases with facerec_free_error
+static char* copy_error(const char* msg) {
+    char* err = static_cast<char*>(malloc(strlen(msg) + 1));
+    if (err) {
+        strcpy(err, msg);
+    }
+    return err;
+}
+
+static void set_error(char** err, const char* msg) {
+    if (err) {
+        *err = copy_error(msg);
+    }
+}
+
+static int num_gpus() {
+#ifdef DLIB_USE_CUDA
+    return dlib::cuda::get_num_devices();
+#else
+    return 0;
+#endif
+}
+
+// CUDA device selection is per OS thread and Go may move us between threads,
+// so the recognizer's device is re-selected at the start of every call
+static void select_gpu(FaceRecognizer* rec) {
+#ifdef DLIB_USE_CUDA
+    if (rec->use_gpu) {
+        dlib::cuda::set_device(rec->gpu_device);
+    }
+#else
+    (void)rec;
+#endif
+}
+
 extern "C" {
 
-facerec facerec_init(const char* model_dir) {
-    FaceRecognizer* rec = new FaceRecognizer();
-    rec->model_dir = std::string(model_dir);
+facerec facerec_init(const char* model_dir, const char* cnn_model_path, int use_gpu, int gpu_device) {
+    FaceRecognizer* rec = new (std::nothrow) FaceRecognizer();
+    if (!rec) {
+        return nullptr;
+    }
 
     try {
+        rec->model_dir = std::string(model_dir);
+
+        if (use_gpu) {
+            if (num_gpus() == 0) {
+                rec->error_msg = "GPU requested but no CUDA device is available (is dlib built with CUDA?)";
+                return static_cast<facerec>(rec);
+            }
+            if (gpu_device < 0 || gpu_device >= num_gpus()) {
+                rec->error_msg = "GPU device " + std::to_string(gpu_device) + " does not exist";
+                return static_cast<facerec>(rec);
+            }
+            rec->use_gpu = true;
+            rec->gpu_device = gpu_device;
+            select_gpu(rec);
+        }
+
         // Load HOG detector (built-in, no model file needed)
         rec->hog_detector = dlib::get_frontal_face_detector();
         rec->hog_loaded = true;
@@ -105,13 +238,54 @@ facerec facerec_init(const char* model_dir) {
         dlib::deserialize(encoder_path) >> rec->face_encoder;
         rec->encoder_loaded = true;
 
+        // Load CNN face detector when a path is given
+        if (cnn_model_path && cnn_model_path[0] != '\0') {
+            dlib::deserialize(std::string(cnn_model_path)) >> rec->cnn_detector;
+            rec->cnn_loaded = true;
+        }
+
+        // Age and gender models are optional, see facerec_load_attribute_model
+
     } catch (const std::exception& e) {
         rec->error_msg = e.what();
+    } catch (...) {
+        rec->error_msg = "unknown C++ exception while loading models";
     }
 
     return static_cast<facerec>(rec);
 }
 
+int facerec_num_gpus(void) {
+    try {
+        return num_gpus();
+    } catch (...) {
+        return 0;
+    }
+}
+
+int facerec_set_gpu_device(facerec handle, int device) {
+    if (!handle) return -1;
+
+    FaceRecognizer* rec = static_cast<FaceRecognizer*>(handle);
+    if (device < 0 || device >= facerec_num_gpus()) {
+        return -1;
+    }
+
+    rec->use_gpu = true;
+    rec->gpu_device = device;
+    return 0;
+}
+
+void facerec_set_cnn_box_calibration(facerec handle, double scale_x, double scale_y, double shift_x, double shift_y) {
+    if (!handle) return;
+
+    FaceRecognizer* rec = static_cast<FaceRecognizer*>(handle);
+    rec->cnn_scale_x = scale_x;
+    rec->cnn_scale_y = scale_y;
+    rec->cnn_shift_x = shift_x;
+    rec->cnn_shift_y = shift_y;
+}
+
 void facerec_free(facerec handle) {
     if (handle) {
         FaceRecognizer* rec = static_cast<FaceRecognizer*>(handle);
@@ -120,16 +294,14 @@ void facerec_free(facerec handle) {
 }
 
 const char* facerec_get_error(facerec handle) {
-    if (!handle) return "null handle";
+    if (!handle) return copy_error("out of memory allocating face recognizer");
 
     FaceRecognizer* rec = static_cast<FaceRecognizer*>(handle);
     if (rec->error_msg.empty()) {
         return nullptr;
     }
 
-    char* err = static_cast<char*>(malloc(rec->error_msg.size() + 1));
-    strcpy(err, rec->error_msg.c_str());
-    return err;
+    return copy_error(rec->error_msg.c_str());
 }
 
 void facerec_free_error(const char* err) {
@@ -138,52 +310,177 @@ void facerec_free_error(const char* err) {
     }
 }
 
-rect* facerec_detect(facerec handle, image img, int upsample_times, int use_cnn, int* num_faces) {
+// The CNN detector only takes RGB, grayscale images are widened for it
+static std::vector<dlib::mmod_rect> run_cnn(FaceRecognizer* rec, const dlib::matrix<dlib::rgb_pixel>& mat, double adjust_threshold) {
+    return rec->cnn_detector.process(mat, adjust_threshold);
+}
+
+static std::vector<dlib::mmod_rect> run_cnn(FaceRecognizer* rec, const dlib::matrix<unsigned char>& mat, double adjust_threshold) {
+    dlib::matrix<dlib::rgb_pixel> rgb;
+    dlib::assign_image(rgb, mat);
+    return rec->cnn_detector.process(rgb, adjust_threshold);
+}
+
+// Run the HOG or CNN detector, throwing if the requested detector is not loaded
+// Detections scoring above adjust_threshold are returned with their confidence, 0 is dlib's default
+// HOG works on intensity, so grayscale images are detected on directly
+template <typename pixel_type>
+static std::vector<dlib::rect_detection> detect_faces(FaceRecognizer* rec, const dlib::matrix<pixel_type>& mat, int upsample_times, int use_cnn, double adjust_threshold) {
+    if (use_cnn && !rec->cnn_loaded) {
+        throw std::runtime_error("CNN face detector not loaded");
+    }
+    if (!use_cnn && !rec->hog_loaded) {
+        throw std::runtime_error("HOG face detector not loaded");
+    }
+
+    // Upsample a copy of the image, run the detector, then map boxes back to the original scale
+    dlib::matrix<pixel_type> scaled = mat;
+    dlib::pyramid_down<2> pyr;
+    for (int i = 0; i < upsample_times; i++) {
+        dlib::pyramid_up(scaled, pyr);
+    }
+
+    std::vector<dlib::rect_detection> dets;
+    if (use_cnn) {
+        auto mmod_dets = run_cnn(rec, scaled, adjust_threshold);
+        for (const auto& d : mmod_dets) {
+            dlib::rect_detection det;
+            det.detection_confidence = d.detection_confidence;
+            det.weight_index = 0;
+            det.rect = d.rect;
+            dets.push_back(det);
+        }
+    } else {
+        rec->hog_detector(scaled, dets, adjust_threshold);
+    }
+
+    for (auto& d : dets) {
+        d.rect = pyr.rect_down(d.rect, upsample_times);
+        if (use_cnn) {
+            // The landmark models were trained on HOG boxes, calibrated CNN boxes give them the same framing
+            // Widths are right - left as in BoxCalibration.Apply, not dlib's inclusive width() which is one more
+            double w = d.rect.right() - d.rect.left(), h = d.rect.bottom() - d.rect.top();
+            double cx = (d.rect.left() + d.rect.right()) / 2.0 + rec->cnn_shift_x * w;
+            double cy = (d.rect.top() + d.rect.bottom()) / 2.0 + rec->cnn_shift_y * h;
+            double hw = w * rec->cnn_scale_x / 2, hh = h * rec->cnn_scale_y / 2;
+            d.rect = dlib::rectangle(std::lround(cx - hw), std::lround(cy - hh), std::lround(cx + hw), std::lround(cy + hh));
+        }
+    }
+    return dets;
+}
+
+// Compute the descriptor of one face from its landmarks
+static void encode_shape(FaceRecognizer* rec, const dlib::matrix<dlib::rgb_pixel>& mat, const dlib::full_object_detection& shape, int num_jitters, double* out) {
+    // Extract aligned face chip
+    dlib::matrix<dlib::rgb_pixel> face_chip;
+    dlib::extract_image_chip(mat, dlib::get_face_chip_details(shape, 150, 0.25), face_chip);
+
+    // Compute descriptor, averaged over randomly jittered copies of the chip when asked to, like
+    // dlib's dnn_face_recognition_ex and face_recognition_model_v1 do
+    dlib::matrix<float, 0, 1> face_descriptor;
+    if (num_jitters <= 1) {
+        face_descriptor = rec->face_encoder(face_chip);
+    } else {
+        thread_local dlib::rand rnd;
+        std::vector<dlib::matrix<dlib::rgb_pixel>> crops;
+        crops.reserve(num_jitters);
+        for (int i = 0; i < num_jitters; i++) {
+            crops.push_back(dlib::jitter_image(face_chip, rnd));
+        }
+        face_descriptor = dlib::mean(dlib::mat(rec->face_encoder(crops)));
+    }
+
+    // Copy to output
+    for (int j = 0; j < 128; j++) {
+        out[j] = static_cast<double>(face_descriptor(j));
+    }
+}
+
+scored_rect* facerec_detect_scored(facerec handle, image img, int upsample_times, int use_cnn, double adjust_threshold, int* num_faces, char** err) {
     *num_faces = 0;
-    if (!handle) return nullptr;
+    if (!handle) {
+        set_error(err, "null handle");
+        return nullptr;
+    }
 
     FaceRecognizer* rec = static_cast<FaceRecognizer*>(handle);
+    scored_rect* rects = nullptr;
 
     try {
-        auto mat = image_to_matrix(img);
-        std::vector<dlib::rectangle> dets;
-
-        // Use HOG detector (CNN not supported in this simplified version)
-        if (rec->hog_loaded) {
-            dets = rec->hog_detector(mat, upsample_times);
+        select_gpu(rec);
+        std::vector<dlib::rect_detection> dets;
+        if (img.channels == 1) {
+            dets = detect_faces(rec, gray_image_to_matrix(img), upsample_times, use_cnn, adjust_threshold);
         } else {
-            return nullptr;
+            dets = detect_faces(rec, image_to_matrix(img), upsample_times, use_cnn, adjust_threshold);
         }
 
         if (dets.empty()) {
             return nullptr;
         }
 
-        *num_faces = static_cast<int>(dets.size());
-        rect* rects = static_cast<rect*>(malloc(sizeof(rect) * dets.size()));
+        rects = static_cast<scored_rect*>(malloc(sizeof(scored_rect) * dets.size()));
+        if (!rects) {
+            set_error(err, "out of memory");
+            return nullptr;
+        }
 
         for (size_t i = 0; i < dets.size(); i++) {
-            rects[i].left = dets[i].left();
-            rects[i].top = dets[i].top();
-            rects[i].right = dets[i].right();
-            rects[i].bottom = dets[i].bottom();
+            rects[i].location.left = dets[i].rect.left();
+            rects[i].location.top = dets[i].rect.top();
+            rects[i].location.right = dets[i].rect.right();
+            rects[i].location.bottom = dets[i].rect.bottom();
+            rects[i].score = dets[i].detection_confidence;
         }
 
+        *num_faces = static_cast<int>(dets.size());
         return rects;
 
     } catch (const std::exception& e) {
-        rec->error_msg = e.what();
+        set_error(err, e.what());
+    } catch (...) {
+        set_error(err, "unknown C++ exception in face detection");
+    }
+
+    free(rects);
+    return nullptr;
+}
+
+rect* facerec_detect(facerec handle, image img, int upsample_times, int use_cnn, int* num_faces, char** err) {
+    scored_rect* scored = facerec_detect_scored(handle, img, upsample_times, use_cnn, 0, num_faces, err);
+    if (!scored) {
+        return nullptr;
+    }
+
+    rect* rects = static_cast<rect*>(malloc(sizeof(rect) * *num_faces));
+    if (!rects) {
+        free(scored);
+        *num_faces = 0;
+        set_error(err, "out of memory");
         return nullptr;
     }
+    for (int i = 0; i < *num_faces; i++) {
+        rects[i] = scored[i].location;
+    }
+    free(scored);
+    return rects;
 }
 
-point* facerec_landmarks(facerec handle, image img, rect* faces, int num_faces, int use_small) {
+point* facerec_landmarks(facerec handle, image img, rect* faces, int num_faces, int use_small, char** err) {
     if (!handle || !faces || num_faces <= 0) return nullptr;
 
     FaceRecognizer* rec = static_cast<FaceRecognizer*>(handle);
+    point* landmarks = nullptr;
 
     try {
-        auto mat = image_to_matrix(img);
+        // The shape predictors work on intensity, so grayscale images are not widened to RGB
+        dlib::matrix<dlib::rgb_pixel> mat;
+        dlib::matrix<unsigned char> gray;
+        if (img.channels == 1) {
+            gray = gray_image_to_matrix(img);
+        } else {
+            mat = image_to_matrix(img);
+        }
 
         dlib::shape_predictor* predictor;
         int points_per_face;
@@ -195,10 +492,15 @@ point* facerec_landmarks(facerec handle, image img, rect* faces, int num_faces,
             predictor = &rec->shape_predictor_68;
             points_per_face = 68;
         } else {
+            set_error(err, "shape predictor not loaded");
             return nullptr;
         }
 
-        point* landmarks = static_cast<point*>(malloc(sizeof(point) * num_faces * points_per_face));
+        landmarks = static_cast<point*>(malloc(sizeof(point) * num_faces * points_per_face));
+        if (!landmarks) {
+            set_error(err, "out of memory");
+            return nullptr;
+        }
 
         for (int i = 0; i < num_faces; i++) {
             dlib::rectangle face_rect(
@@ -208,7 +510,7 @@ point* facerec_landmarks(facerec handle, image img, rect* faces, int num_faces,
                 faces[i].bottom
             );
 
-            auto shape = (*predictor)(mat, face_rect);
+            auto shape = img.channels == 1 ? (*predictor)(gray, face_rect) : (*predictor)(mat, face_rect);
 
             for (int j = 0; j < points_per_face; j++) {
                 landmarks[i * points_per_face + j].x = shape.part(j).x();
@@ -219,22 +521,36 @@ point* facerec_landmarks(facerec handle, image img, rect* faces, int num_faces,
         return landmarks;
 
     } catch (const std::exception& e) {
-        rec->error_msg = e.what();
-        return nullptr;
+        set_error(err, e.what());
+    } catch (...) {
+        set_error(err, "unknown C++ exception in landmark detection");
     }
+
+    free(landmarks);
+    return nullptr;
 }
 
-double* facerec_encode(facerec handle, image img, point* landmarks, int num_faces, int points_per_face, int num_jitters) {
+double* facerec_encode(facerec handle, image img, point* landmarks, int num_faces, int points_per_face, int num_jitters, char** err) {
     if (!handle || !landmarks || num_faces <= 0) return nullptr;
 
     FaceRecognizer* rec = static_cast<FaceRecognizer*>(handle);
 
-    if (!rec->encoder_loaded) return nullptr;
+    if (!rec->encoder_loaded) {
+        set_error(err, "face recognition model not loaded");
+        return nullptr;
+    }
+
+    double* encodings = nullptr;
 
     try {
+        select_gpu(rec);
         auto mat = image_to_matrix(img);
 
-        double* encodings = static_cast<double*>(malloc(sizeof(double) * num_faces * 128));
+        encodings = static_cast<double*>(malloc(sizeof(double) * num_faces * 128));
+        if (!encodings) {
+            set_error(err, "out of memory");
+            return nullptr;
+        }
 
         for (int i = 0; i < num_faces; i++) {
             // Build full_object_detection from landmarks
@@ -259,25 +575,312 @@ double* facerec_encode(facerec handle, image img, point* landmarks, int num_face
             dlib::rectangle rect(min_x, min_y, max_x, max_y);
             dlib::full_object_detection shape(rect, parts);
 
-            // Extract aligned face chip
-            dlib::matrix<dlib::rgb_pixel> face_chip;
-            dlib::extract_image_chip(mat, dlib::get_face_chip_details(shape, 150, 0.25), face_chip);
+            encode_shape(rec, mat, shape, num_jitters, &encodings[i * 128]);
+        }
 
-            // Compute descriptor
-            dlib::matrix<float, 0, 1> face_descriptor = rec->face_encoder(face_chip);
+        return encodings;
 
-            // Copy to output
-            for (int j = 0; j < 128; j++) {
-                encodings[i * 128 + j] = static_cast<double>(face_descriptor(j));
+    } catch (const std::exception& e) {
+        set_error(err, e.what());
+    } catch (...) {
+        set_error(err, "unknown C++ exception in face encoding");
+    }
+
+    free(encodings);
+    return nullptr;
+}
+
+face_result* facerec_detect_and_encode(facerec handle, image img, int upsample_times, int use_cnn, double adjust_threshold, int num_jitters, int* num_faces, char** err) {
+    *num_faces = 0;
+    if (!handle) {
+        set_error(err, "null handle");
+        return nullptr;
+    }
+
+    FaceRecognizer* rec = static_cast<FaceRecognizer*>(handle);
+    if (!rec->sp68_loaded) {
+        set_error(err, "shape predictor not loaded");
+        return nullptr;
+    }
+    if (!rec->encoder_loaded) {
+        set_error(err, "face recognition model not loaded");
+        return nullptr;
+    }
+
+    face_result* results = nullptr;
+
+    try {
+        select_gpu(rec);
+        auto mat = image_to_matrix(img);
+        std::vector<dlib::rect_detection> dets = detect_faces(rec, mat, upsample_times, use_cnn, adjust_threshold);
+
+        if (dets.empty()) {
+            return nullptr;
+        }
+
+        results = static_cast<face_result*>(malloc(sizeof(face_result) * dets.size()));
+        if (!results) {
+            set_error(err, "out of memory");
+            return nullptr;
+        }
+
+        for (size_t i = 0; i < dets.size(); i++) {
+            // Trim to the image like the Go side does for facerec_detect results, so landmarks match
+            const dlib::rectangle& det = dets[i].rect;
+            dlib::rectangle face_rect(
+                std::max(det.left(), 0L),
+                std::max(det.top(), 0L),
+                std::min(det.right(), static_cast<long>(img.width)),
+                std::min(det.bottom(), static_cast<long>(img.height))
+            );
+
+            face_result& r = results[i];
+            r.location.left = face_rect.left();
+            r.location.top = face_rect.top();
+            r.location.right = face_rect.right();
+            r.location.bottom = face_rect.bottom();
+
+            auto shape = rec->shape_predictor_68(mat, face_rect);
+            for (int j = 0; j < 68; j++) {
+                r.landmarks[j].x = shape.part(j).x();
+                r.landmarks[j].y = shape.part(j).y();
             }
+
+            encode_shape(rec, mat, shape, num_jitters, r.encoding);
         }
 
-        return encodings;
+        *num_faces = static_cast<int>(dets.size());
+        return results;
 
     } catch (const std::exception& e) {
-        rec->error_msg = e.what();
+        set_error(err, e.what());
+    } catch (...) {
+        set_error(err, "unknown C++ exception in face detection and encoding");
+    }
+
+    free(results);
+    return nullptr;
+}
+
+uint8_t* facerec_face_chips(facerec handle, image img, rect* faces, int num_faces, int size, double padding, char** err) {
+    if (!handle || !faces || num_faces <= 0 || size <= 0) return nullptr;
+
+    FaceRecognizer* rec = static_cast<FaceRecognizer*>(handle);
+    uint8_t* chips = nullptr;
+
+    try {
+        auto mat = image_to_matrix(img);
+
+        // The 5-point model is what dlib's alignment is tuned for; fall back to 68 points
+        dlib::shape_predictor* predictor;
+        if (rec->sp5_loaded) {
+            predictor = &rec->shape_predictor_5;
+        } else if (rec->sp68_loaded) {
+            predictor = &rec->shape_predictor_68;
+        } else {
+            set_error(err, "shape predictor not loaded");
+            return nullptr;
+        }
+
+        size_t chip_bytes = static_cast<size_t>(size) * size * 3;
+        chips = static_cast<uint8_t*>(malloc(chip_bytes * num_faces));
+        if (!chips) {
+            set_error(err, "out of memory");
+            return nullptr;
+        }
+
+        for (int i = 0; i < num_faces; i++) {
+            dlib::rectangle face_rect(
+                faces[i].left,
+                faces[i].top,
+                faces[i].right,
+                faces[i].bottom
+            );
+
+            auto shape = (*predictor)(mat, face_rect);
+
+            dlib::matrix<dlib::rgb_pixel> chip;
+            dlib::extract_image_chip(mat, dlib::get_face_chip_details(shape, size, padding), chip);
+
+            uint8_t* out = chips + chip_bytes * i;
+            for (long y = 0; y < chip.nr(); y++) {
+                for (long x = 0; x < chip.nc(); x++) {
+                    size_t idx = (y * size + x) * 3;
+                    out[idx] = chip(y, x).red;
+                    out[idx + 1] = chip(y, x).green;
+                    out[idx + 2] = chip(y, x).blue;
+                }
+            }
+        }
+
+        return chips;
+
+    } catch (const std::exception& e) {
+        set_error(err, e.what());
+    } catch (...) {
+        set_error(err, "unknown C++ exception in face chip extraction");
+    }
+
+    free(chips);
+    return nullptr;
+}
+
+int facerec_load_attribute_model(facerec handle, int model, const char* path, char** err) {
+    if (!handle || !path) {
+        set_error(err, "null handle or path");
+        return -1;
+    }
+
+    FaceRecognizer* rec = static_cast<FaceRecognizer*>(handle);
+
+    try {
+        select_gpu(rec);
+        if (model == 0) {
+            gender_net_type gender_net;
+            dlib::deserialize(std::string(path)) >> gender_net;
+            rec->gender_classifier.subnet() = gender_net.subnet();
+            rec->gender_loaded = true;
+        } else if (model == 1) {
+            age_net_type age_net;
+            dlib::deserialize(std::string(path)) >> age_net;
+            rec->age_predictor.subnet() = age_net.subnet();
+            rec->age_loaded = true;
+        } else {
+            set_error(err, "unknown attribute model");
+            return -1;
+        }
+        return 0;
+
+    } catch (const std::exception& e) {
+        set_error(err, e.what());
+    } catch (...) {
+        set_error(err, "unknown C++ exception while loading attribute model");
+    }
+    return -1;
+}
+
+int facerec_age_gender_loaded(facerec handle) {
+    if (!handle) return 0;
+    FaceRecognizer* rec = static_cast<FaceRecognizer*>(handle);
+    return (rec->gender_loaded ? 1 : 0) | (rec->age_loaded ? 2 : 0);
+}
+
+double* facerec_age_gender(facerec handle, image img, rect* faces, int num_faces, char** err) {
+    if (!handle || !faces || num_faces <= 0) return nullptr;
+
+    FaceRecognizer* rec = static_cast<FaceRecognizer*>(handle);
+
+    if (!rec->gender_loaded || !rec->age_loaded) {
+        set_error(err, "age and gender models not loaded");
         return nullptr;
     }
+
+    double* results = nullptr;
+
+    try {
+        select_gpu(rec);
+        auto mat = image_to_matrix(img);
+
+        dlib::shape_predictor* predictor;
+        if (rec->sp5_loaded) {
+            predictor = &rec->shape_predictor_5;
+        } else if (rec->sp68_loaded) {
+            predictor = &rec->shape_predictor_68;
+        } else {
+            set_error(err, "shape predictor not loaded");
+            return nullptr;
+        }
+
+        results = static_cast<double*>(malloc(sizeof(double) * num_faces * 3));
+        if (!results) {
+            set_error(err, "out of memory");
+            return nullptr;
+        }
+
+        for (int i = 0; i < num_faces; i++) {
+            dlib::rectangle face_rect(faces[i].left, faces[i].top, faces[i].right, faces[i].bottom);
+            auto shape = (*predictor)(mat, face_rect);
+
+            dlib::matrix<dlib::rgb_pixel> gender_chip;
+            dlib::extract_image_chip(mat, dlib::get_face_chip_details(shape, gender_chip_size), gender_chip);
+            dlib::matrix<float, 1, 2> gender_probs = dlib::mat(rec->gender_classifier(gender_chip));
+
+            dlib::matrix<dlib::rgb_pixel> age_chip;
+            dlib::extract_image_chip(mat, dlib::get_face_chip_details(shape, age_chip_size), age_chip);
+            dlib::matrix<float, 1, age_classes> age_probs = dlib::mat(rec->age_predictor(age_chip));
+
+            // Expected age and spread over the class distribution
+            double mean = 0, sq = 0;
+            for (int a = 0; a < age_classes; a++) {
+                mean += a * age_probs(a);
+                sq += static_cast<double>(a) * a * age_probs(a);
+            }
+
+            results[i * 3] = gender_probs(0); // probability of class 0 (male)
+            results[i * 3 + 1] = mean;
+            results[i * 3 + 2] = std::sqrt(std::max(0.0, sq - mean * mean));
+        }
+
+        return results;
+
+    } catch (const std::exception& e) {
+        set_error(err, e.what());
+    } catch (...) {
+        set_error(err, "unknown C++ exception in age and gender estimation");
+    }
+
+    free(results);
+    return nullptr;
+}
+
+int* facerec_cluster(const double* encodings, int num_encodings, double threshold, int* num_clusters, char** err) {
+    *num_clusters = 0;
+    if (!encodings || num_encodings <= 0) return nullptr;
+
+    int* labels_out = nullptr;
+
+    try {
+        std::vector<dlib::matrix<double, 0, 1>> descriptors(num_encodings);
+        for (int i = 0; i < num_encodings; i++) {
+            descriptors[i].set_size(128);
+            for (int j = 0; j < 128; j++) {
+                descriptors[i](j) = encodings[i * 128 + j];
+            }
+        }
+
+        // Self edges keep encodings without neighbours in the graph as singleton clusters
+        std::vector<dlib::sample_pair> edges;
+        for (int i = 0; i < num_encodings; i++) {
+            for (int j = i; j < num_encodings; j++) {
+                if (dlib::length(descriptors[i] - descriptors[j]) < threshold) {
+                    edges.push_back(dlib::sample_pair(i, j));
+                }
+            }
+        }
+
+        std::vector<unsigned long> labels;
+        unsigned long count = dlib::chinese_whispers(edges, labels);
+
+        labels_out = static_cast<int*>(malloc(sizeof(int) * num_encodings));
+        if (!labels_out) {
+            set_error(err, "out of memory");
+            return nullptr;
+        }
+        for (int i = 0; i < num_encodings; i++) {
+            labels_out[i] = static_cast<int>(labels[i]);
+        }
+
+        *num_clusters = static_cast<int>(count);
+        return labels_out;
+
+    } catch (const std::exception& e) {
+        set_error(err, e.what());
+    } catch (...) {
+        set_error(err, "unknown C++ exception in clustering");
+    }
+
+    free(labels_out);
+    return nullptr;
 }
 
 } // extern "C"
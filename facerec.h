@@ -16,6 +16,7 @@ typedef struct {
     int width;
     int height;
     int stride;
+    int channels; // 3 for RGB, 1 for grayscale
 } image;
 
 // Rectangle structure for face locations
@@ -26,6 +27,12 @@ typedef struct {
     long bottom;
 } rect;
 
+// Detection with the detector's confidence
+typedef struct {
+    rect location;
+    double score;
+} scored_rect;
+
 // Point structure for landmarks
 typedef struct {
     long x;
@@ -33,30 +40,87 @@ typedef struct {
 } point;
 
 // Initialize face recognizer with model directory
-facerec facerec_init(const char* model_dir);
+// cnn_model_path: path to mmod_human_face_detector.dat, or "" to skip loading the CNN detector
+// use_gpu: 1 to run the DNN models on CUDA device gpu_device (requires a CUDA build of dlib)
+facerec facerec_init(const char* model_dir, const char* cnn_model_path, int use_gpu, int gpu_device);
+
+// Number of CUDA devices visible to dlib (0 when built without CUDA)
+int facerec_num_gpus(void);
+
+// Select the CUDA device used by subsequent calls on this recognizer
+// Returns 0 on success, -1 if the device does not exist or CUDA is unavailable
+int facerec_set_gpu_device(facerec rec, int device);
 
 // Free resources
 void facerec_free(facerec rec);
 
+// Map CNN detections onto HOG-equivalent boxes in every later detection call: the box center
+// moves by shift_x and shift_y box widths and heights, then the box scales by scale_x and scale_y;
+// widths and heights are right - left and bottom - top, like Rectangle.Width and Height on the Go side
+// Scales of 1 and shifts of 0 leave the boxes as the detector returns them
+void facerec_set_cnn_box_calibration(facerec rec, double scale_x, double scale_y, double shift_x, double shift_y);
+
 // Get last error message (NULL if no error)
 const char* facerec_get_error(facerec rec);
 
 // Free error string
 void facerec_free_error(const char* err);
 
+// The functions below never let a C++ exception escape. On failure they return NULL
+// and set *err to a message that must be released with facerec_free_error.
+// *err is left untouched on success.
+
 // Detect faces in an image
 // Returns array of rectangles, sets num_faces to count
 // use_cnn: 0 for HOG, 1 for CNN
-rect* facerec_detect(facerec rec, image img, int upsample_times, int use_cnn, int* num_faces);
+rect* facerec_detect(facerec rec, image img, int upsample_times, int use_cnn, int* num_faces, char** err);
+
+// Detect faces with their detector confidence
+// adjust_threshold: minimum score of returned detections, 0 is dlib's default, lower values find more faces
+scored_rect* facerec_detect_scored(facerec rec, image img, int upsample_times, int use_cnn, double adjust_threshold, int* num_faces, char** err);
 
 // Get facial landmarks for detected faces
 // Returns array of points (num_faces * points_per_face)
 // use_small: 0 for 68-point model, 1 for 5-point model
-point* facerec_landmarks(facerec rec, image img, rect* faces, int num_faces, int use_small);
+point* facerec_landmarks(facerec rec, image img, rect* faces, int num_faces, int use_small, char** err);
 
 // Compute face encodings from landmarks
+// num_jitters above 1 averages the encodings of that many randomly jittered copies of each face chip
 // Returns array of doubles (num_faces * 128)
-double* facerec_encode(facerec rec, image img, point* landmarks, int num_faces, int points_per_face, int num_jitters);
+double* facerec_encode(facerec rec, image img, point* landmarks, int num_faces, int points_per_face, int num_jitters, char** err);
+
+// One face found by facerec_detect_and_encode
+typedef struct {
+    rect location;
+    point landmarks[68];
+    double encoding[128];
+} face_result;
+
+// Detect faces, predict their 68-point landmarks and compute encodings in a single call,
+// so landmarks are computed once and the image is converted once
+// Returns array of num_faces results
+// use_cnn: 0 for HOG, 1 for CNN
+// num_jitters: as for facerec_encode
+face_result* facerec_detect_and_encode(facerec rec, image img, int upsample_times, int use_cnn, double adjust_threshold, int num_jitters, int* num_faces, char** err);
+
+// Extract aligned face chips (rotated and scaled so the eyes are level)
+// Returns array of RGB bytes (num_faces * size * size * 3)
+uint8_t* facerec_face_chips(facerec rec, image img, rect* faces, int num_faces, int size, double padding, char** err);
+
+// Load an optional attribute model from path: 0 for the gender classifier, 1 for the age predictor
+// Returns 0 on success, -1 with *err set to the exception message on failure
+int facerec_load_attribute_model(facerec rec, int model, const char* path, char** err);
+
+// Report which optional attribute models were loaded: bit 0 gender classifier, bit 1 age predictor
+int facerec_age_gender_loaded(facerec rec);
+
+// Estimate age and gender for detected faces
+// Returns array of doubles (num_faces * 3): male probability, expected age, age standard deviation
+double* facerec_age_gender(facerec rec, image img, rect* faces, int num_faces, char** err);
+
+// Cluster face encodings (num_encodings * 128 doubles) with chinese whispers
+// Encodings closer than threshold are linked; returns one label per encoding and sets num_clusters
+int* facerec_cluster(const double* encodings, int num_encodings, double threshold, int* num_clusters, char** err);
 
 #ifdef __cplusplus
 }
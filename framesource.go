@@ -0,0 +1,432 @@
+package gofacerecognition
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FrameSource produces frames from a camera, stream or file set
+// Next blocks until a frame is available and returns io.EOF once the source is exhausted; a frame
+// that cannot be decoded is returned as a *FrameDecodeError and the source moves on to the next one
+type FrameSource interface {
+	Next(ctx context.Context) (image.Image, error)
+	Close() error
+}
+
+// Frames pumps src into a channel suitable for VideoProcessor.Run
+// Frames that cannot be decoded are skipped and their *FrameDecodeError sent on errc; any other error
+// is sent last, then both channels are closed, as they are when the source ends or ctx is cancelled.
+// Read errc while reading frames, the pump waits for every error to be received
+func Frames(ctx context.Context, src FrameSource) (<-chan image.Image, <-chan error) {
+	frames := make(chan image.Image)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(frames)
+		defer close(errc)
+		for {
+			frame, err := src.Next(ctx)
+			var decodeErr *FrameDecodeError
+			if errors.As(err, &decodeErr) {
+				select {
+				case errc <- err:
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+					errc <- err
+				}
+				return
+			}
+			select {
+			case frames <- frame:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return frames, errc
+}
+
+// DirectorySource reads the images of a directory in name order
+// With Follow set it keeps polling for images added later instead of returning io.EOF
+type DirectorySource struct {
+	Dir      string
+	Follow   bool
+	Interval time.Duration // polling interval with Follow (default 500ms)
+
+	seen    map[string]bool
+	pending map[string]int64
+	queue   []string
+}
+
+// NewDirectorySource creates a DirectorySource for dir
+func NewDirectorySource(dir string, follow bool) *DirectorySource {
+	return &DirectorySource{Dir: dir, Follow: follow}
+}
+
+// Next returns the next image, images that fail to decode are returned as a *FrameDecodeError
+func (s *DirectorySource) Next(ctx context.Context) (image.Image, error) {
+	if s.seen == nil {
+		s.seen = make(map[string]bool)
+		s.pending = make(map[string]int64)
+		// Images present at start are complete and need no settle check
+		if err := s.scan(false); err != nil {
+			return nil, err
+		}
+	}
+
+	interval := s.Interval
+	if interval <= 0 {
+		interval = 500 * time.Millisecond
+	}
+
+	for len(s.queue) == 0 {
+		if !s.Follow {
+			return nil, io.EOF
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+		if err := s.scan(true); err != nil {
+			return nil, err
+		}
+	}
+
+	path := s.queue[0]
+	s.queue = s.queue[1:]
+	img, err := LoadImageFile(path)
+	if err != nil {
+		return nil, &FrameDecodeError{Source: path, Err: err}
+	}
+	return img.ToGoImage(), nil
+}
+
+// Close is a no-op, it exists to satisfy FrameSource
+func (s *DirectorySource) Close() error {
+	return nil
+}
+
+// scan queues new images; with wait set a file is only queued once its size stopped changing
+func (s *DirectorySource) scan(wait bool) error {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		path := filepath.Join(s.Dir, entry.Name())
+		if entry.IsDir() || s.seen[path] || !isImageFile(path) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if wait {
+			if prev, ok := s.pending[path]; !ok || prev != info.Size() {
+				s.pending[path] = info.Size()
+				continue
+			}
+		}
+		delete(s.pending, path)
+		s.seen[path] = true
+		s.queue = append(s.queue, path)
+	}
+	return nil
+}
+
+// isImageFile reports whether path has an extension LoadImageFile can decode
+func isImageFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".bmp", ".webp":
+		return true
+	}
+	return false
+}
+
+// MJPEGSource reads a multipart/x-mixed-replace MJPEG stream over HTTP, as served by most IP cameras
+type MJPEGSource struct {
+	URL    string
+	Client *http.Client // defaults to http.DefaultClient
+
+	resp   *http.Response
+	reader *multipart.Reader
+}
+
+// NewMJPEGSource creates an MJPEGSource, the connection is opened on the first call to Next
+func NewMJPEGSource(url string) *MJPEGSource {
+	return &MJPEGSource{URL: url}
+}
+
+// Next returns the next frame of the stream
+func (s *MJPEGSource) Next(ctx context.Context) (image.Image, error) {
+	if s.reader == nil {
+		if err := s.connect(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	part, err := s.reader.NextPart()
+	if err != nil {
+		return nil, err
+	}
+	defer part.Close()
+
+	img, err := jpeg.Decode(part)
+	if err != nil {
+		return nil, &FrameDecodeError{Source: s.URL, Err: err}
+	}
+	return img, nil
+}
+
+// Close closes the HTTP connection
+func (s *MJPEGSource) Close() error {
+	if s.resp == nil {
+		return nil
+	}
+	err := s.resp.Body.Close()
+	s.resp, s.reader = nil, nil
+	return err
+}
+
+func (s *MJPEGSource) connect(ctx context.Context) error {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return fmt.Errorf("mjpeg stream %s: %s", s.URL, resp.Status)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		resp.Body.Close()
+		return fmt.Errorf("mjpeg stream %s: unexpected content type %q", s.URL, resp.Header.Get("Content-Type"))
+	}
+
+	// Some cameras repeat the leading dashes in the boundary parameter
+	s.resp = resp
+	s.reader = multipart.NewReader(resp.Body, strings.TrimPrefix(params["boundary"], "--"))
+	return nil
+}
+
+// FFmpegPath is the ffmpeg executable used by RTSPSource and WebcamSource
+var FFmpegPath = "ffmpeg"
+
+// FFmpegSource decodes any input ffmpeg understands and reads it back as a stream of JPEG frames
+// It backs RTSPSource and WebcamSource, which need a real video decoder
+type FFmpegSource struct {
+	InputArgs []string // arguments placed before the output options, including -i
+	FPS       float64  // output frame rate, 0 keeps the source rate
+
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	r      *bufio.Reader
+}
+
+// RTSPSource reads an RTSP stream through ffmpeg, over TCP to avoid corrupted frames on lossy links
+func RTSPSource(url string, fps float64) *FFmpegSource {
+	return &FFmpegSource{
+		InputArgs: []string{"-rtsp_transport", "tcp", "-i", url},
+		FPS:       fps,
+	}
+}
+
+// WebcamSource captures a local camera through ffmpeg
+// device is a V4L2 device such as /dev/video0 on Linux, a device index on macOS (avfoundation)
+// or a camera name on Windows (dshow)
+func WebcamSource(device string, width, height int, fps float64) *FFmpegSource {
+	var args []string
+	switch {
+	case strings.HasPrefix(device, "/dev/"):
+		args = append(args, "-f", "v4l2")
+	case isDeviceIndex(device):
+		args = append(args, "-f", "avfoundation")
+	default:
+		args = append(args, "-f", "dshow")
+		device = "video=" + device
+	}
+	if width > 0 && height > 0 {
+		args = append(args, "-video_size", fmt.Sprintf("%dx%d", width, height))
+	}
+	if fps > 0 {
+		args = append(args, "-framerate", strconv.FormatFloat(fps, 'f', -1, 64))
+	}
+	args = append(args, "-i", device)
+	return &FFmpegSource{InputArgs: args}
+}
+
+func isDeviceIndex(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// Next returns the next decoded frame, starting ffmpeg on the first call
+func (s *FFmpegSource) Next(ctx context.Context) (image.Image, error) {
+	if s.cmd == nil {
+		if err := s.start(); err != nil {
+			return nil, err
+		}
+	}
+
+	type result struct {
+		frame []byte
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		frame, err := readJPEGFrame(s.r)
+		done <- result{frame, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		s.Close()
+		return nil, ctx.Err()
+	case res := <-done:
+		if res.err != nil {
+			return nil, res.err
+		}
+		img, err := jpeg.Decode(bytes.NewReader(res.frame))
+		if err != nil {
+			return nil, &FrameDecodeError{Source: "ffmpeg", Err: err}
+		}
+		return img, nil
+	}
+}
+
+// Close stops ffmpeg
+func (s *FFmpegSource) Close() error {
+	if s.cmd == nil {
+		return nil
+	}
+	s.stdout.Close()
+	if s.cmd.Process != nil {
+		s.cmd.Process.Kill()
+	}
+	s.cmd.Wait()
+	s.cmd = nil
+	return nil
+}
+
+func (s *FFmpegSource) start() error {
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	args = append(args, s.InputArgs...)
+	if s.FPS > 0 {
+		args = append(args, "-vf", "fps="+strconv.FormatFloat(s.FPS, 'f', -1, 64))
+	}
+	args = append(args, "-f", "image2pipe", "-vcodec", "mjpeg", "-q:v", "3", "-")
+
+	cmd := exec.Command(FFmpegPath, args...)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	s.cmd = cmd
+	s.stdout = stdout
+	s.r = bufio.NewReaderSize(stdout, 1<<20)
+	return nil
+}
+
+// readJPEGFrame reads one complete JPEG image from a stream of concatenated JPEGs
+// Marker segments are skipped by their length, so only a real EOI ends the frame
+func readJPEGFrame(r *bufio.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+
+	// Find the SOI marker, skipping any garbage between frames
+	var prev byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if prev == 0xFF && b == 0xD8 {
+			break
+		}
+		prev = b
+	}
+	buf.Write([]byte{0xFF, 0xD8})
+
+	inScan := false
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		buf.WriteByte(b)
+		if b != 0xFF {
+			if !inScan {
+				return nil, errors.New("malformed jpeg stream")
+			}
+			continue
+		}
+
+		marker, err := r.ReadByte()
+		if err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		buf.WriteByte(marker)
+		switch {
+		case marker == 0x00 || marker == 0xFF || (marker >= 0xD0 && marker <= 0xD7):
+			// Stuffed byte, fill byte or restart marker inside entropy-coded data
+			if marker == 0xFF {
+				r.UnreadByte()
+				buf.Truncate(buf.Len() - 1)
+			}
+			continue
+		case marker == 0xD9:
+			return buf.Bytes(), nil
+		}
+
+		var size [2]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		buf.Write(size[:])
+		n := int(size[0])<<8 | int(size[1])
+		if n < 2 {
+			return nil, errors.New("malformed jpeg segment")
+		}
+		if _, err := io.CopyN(&buf, r, int64(n-2)); err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		inScan = marker == 0xDA
+	}
+}
@@ -2,4 +2,8 @@ module github.com/shafiqaimanx/go_face_recognition
 
 go 1.25.6
 
-require golang.org/x/image v0.35.0
+require (
+	github.com/yalue/onnxruntime_go v1.26.0
+	golang.org/x/image v0.35.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,14 @@
+//go:build cuda
+
+package gofacerecognition
+
+/*
+#cgo CXXFLAGS: -DDLIB_USE_CUDA
+#cgo linux LDFLAGS: -lcudart -lcublas -lcudnn -lcurand -lcusolver
+#cgo linux LDFLAGS: -L/usr/local/cuda/lib64
+#cgo windows LDFLAGS: -lcudart -lcublas -lcudnn -lcurand -lcusolver
+*/
+import "C"
+
+// cudaEnabled reports whether the package was built against a CUDA build of dlib
+const cudaEnabled = true
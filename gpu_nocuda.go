@@ -0,0 +1,6 @@
+//go:build !cuda
+
+package gofacerecognition
+
+// cudaEnabled reports whether the package was built against a CUDA build of dlib
+const cudaEnabled = false
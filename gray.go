@@ -0,0 +1,84 @@
+package gofacerecognition
+
+// NewGrayImageMatrix creates a single-channel grayscale ImageMatrix, a third of the size of an RGB one
+// Detection and landmarks run on it without conversion; encoding widens the face to RGB in the C layer
+func NewGrayImageMatrix(width, height int) *ImageMatrix {
+	return &ImageMatrix{
+		Pixels:   make([]byte, height*width),
+		Width:    width,
+		Height:   height,
+		Stride:   width,
+		Channels: 1,
+	}
+}
+
+// IsGray reports whether the image is a single-channel grayscale image
+func (im *ImageMatrix) IsGray() bool {
+	return im.Channels == 1
+}
+
+// ToGray returns a single-channel copy of the image holding the luma of each pixel
+// Use it on frames from IR cameras, whose RGB channels are identical, to cut their memory to a third
+func (im *ImageMatrix) ToGray() *ImageMatrix {
+	out := NewGrayImageMatrix(im.Width, im.Height)
+	if im.Channels == 1 {
+		out.copyRows(im)
+		return out
+	}
+	for y := 0; y < im.Height; y++ {
+		src := im.Pixels[y*im.Stride : y*im.Stride+im.Width*3]
+		dst := out.Pixels[y*out.Stride : y*out.Stride+im.Width]
+		for x := range dst {
+			dst[x] = luma(src[x*3], src[x*3+1], src[x*3+2])
+		}
+	}
+	return out
+}
+
+// ToRGB returns an RGB copy of the image, with the value of grayscale pixels in all three channels
+func (im *ImageMatrix) ToRGB() *ImageMatrix {
+	out := NewImageMatrix(im.Width, im.Height)
+	if im.Channels != 1 {
+		out.copyRows(im)
+		return out
+	}
+	for y := 0; y < im.Height; y++ {
+		src := im.Pixels[y*im.Stride : y*im.Stride+im.Width]
+		dst := out.Pixels[y*out.Stride : y*out.Stride+im.Width*3]
+		for x, v := range src {
+			dst[x*3], dst[x*3+1], dst[x*3+2] = v, v, v
+		}
+	}
+	return out
+}
+
+// bytesPerPixel returns 1 for grayscale images and 3 for RGB ones
+func (im *ImageMatrix) bytesPerPixel() int {
+	if im.Channels == 1 {
+		return 1
+	}
+	return 3
+}
+
+// newLike creates a width x height image of the same kind, grayscale or RGB, as the receiver
+func (im *ImageMatrix) newLike(width, height int) *ImageMatrix {
+	if im.Channels == 1 {
+		return NewGrayImageMatrix(width, height)
+	}
+	return NewImageMatrix(width, height)
+}
+
+// clone returns a copy of the image with a packed stride
+func (im *ImageMatrix) clone() *ImageMatrix {
+	out := im.newLike(im.Width, im.Height)
+	out.copyRows(im)
+	return out
+}
+
+// copyRows copies the rows of src, an image of the same size and kind, into the receiver
+func (im *ImageMatrix) copyRows(src *ImageMatrix) {
+	row := min(im.Width, src.Width) * im.bytesPerPixel()
+	for y := 0; y < min(im.Height, src.Height); y++ {
+		copy(im.Pixels[y*im.Stride:y*im.Stride+row], src.Pixels[y*src.Stride:y*src.Stride+row])
+	}
+}
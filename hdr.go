@@ -0,0 +1,229 @@
+package gofacerecognition
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"slices"
+)
+
+// ToneMapping selects how FloatImageMatrix values, and the samples of 16-bit images, map to 8 bits
+type ToneMapping string
+
+const (
+	// ToneLinear maps 0 to 0 and 1 to 255, rounding; 16-bit images keep their full range
+	ToneLinear ToneMapping = "linear"
+	// ToneStretch maps the lowest value of the image to 0 and the highest to 255, for raw sensor
+	// counts that use only part of the range
+	ToneStretch ToneMapping = "stretch"
+	// TonePercentile is ToneStretch between the 0.5th and 99.5th percentiles, so a few hot or dead
+	// pixels, common in thermal frames, do not flatten the rest of the image
+	TonePercentile ToneMapping = "percentile"
+	// ToneLog compresses the range logarithmically after stretching it, bringing out faces in frames
+	// with a few very bright regions
+	ToneLog ToneMapping = "log"
+)
+
+// ToneLogStrength is how strongly ToneLog compresses bright values, higher lifts shadows more
+const ToneLogStrength = 100
+
+// tonePercentileSamples bounds the values TonePercentile sorts to find the percentiles
+const tonePercentileSamples = 1 << 16
+
+// FloatImageMatrix is an image of float32 values with 1 (gray) or 3 (RGB) channels, for frames of
+// more than 8 bits from scientific and thermal cameras. Values are nominally in [0, 1] but may hold
+// any range, e.g. temperatures, which ToImageMatrix maps to 8 bits for detection
+type FloatImageMatrix struct {
+	Pixels   []float32
+	Width    int
+	Height   int
+	Channels int
+}
+
+// NewFloatImageMatrix creates a zeroed FloatImageMatrix with 1 or 3 channels
+func NewFloatImageMatrix(width, height, channels int) *FloatImageMatrix {
+	return &FloatImageMatrix{
+		Pixels:   make([]float32, width*height*channels),
+		Width:    width,
+		Height:   height,
+		Channels: channels,
+	}
+}
+
+// At returns the value of channel c of the pixel at (x, y)
+func (fm *FloatImageMatrix) At(x, y, c int) float32 {
+	return fm.Pixels[(y*fm.Width+x)*fm.Channels+c]
+}
+
+// Set sets the value of channel c of the pixel at (x, y)
+func (fm *FloatImageMatrix) Set(x, y, c int, v float32) {
+	fm.Pixels[(y*fm.Width+x)*fm.Channels+c] = v
+}
+
+// Range returns the lowest and highest finite values of the image
+func (fm *FloatImageMatrix) Range() (lo, hi float32) {
+	lo, hi = float32(math.Inf(1)), float32(math.Inf(-1))
+	for _, v := range fm.Pixels {
+		if isFinite32(v) {
+			lo, hi = min(lo, v), max(hi, v)
+		}
+	}
+	if lo > hi {
+		return 0, 0
+	}
+	return lo, hi
+}
+
+// ToImageMatrix maps the image to 8-bit RGB with the given tone mapping, empty for ToneLinear
+// Gray images are copied to all three channels; NaN maps to 0
+func (fm *FloatImageMatrix) ToImageMatrix(mapping ToneMapping) (*ImageMatrix, error) {
+	if fm.Channels != 1 && fm.Channels != 3 {
+		return nil, fmt.Errorf("float image has %d channels, want 1 or 3", fm.Channels)
+	}
+	if len(fm.Pixels) < fm.Width*fm.Height*fm.Channels {
+		return nil, fmt.Errorf("float image has %d values, too few for %dx%d with %d channels", len(fm.Pixels), fm.Width, fm.Height, fm.Channels)
+	}
+
+	var lo, hi float32 = 0, 1
+	switch mapping {
+	case "", ToneLinear:
+	case ToneStretch, ToneLog:
+		lo, hi = fm.Range()
+	case TonePercentile:
+		lo, hi = fm.percentiles(0.005, 0.995)
+	default:
+		return nil, fmt.Errorf("unknown tone mapping %q", mapping)
+	}
+	scale := float32(0)
+	if hi > lo {
+		scale = 1 / (hi - lo)
+	}
+	logNorm := float32(1 / math.Log1p(ToneLogStrength))
+
+	out := NewImageMatrix(fm.Width, fm.Height)
+	for y := 0; y < fm.Height; y++ {
+		row := out.Pixels[y*out.Stride : y*out.Stride+fm.Width*3]
+		for x := 0; x < fm.Width; x++ {
+			for c := 0; c < 3; c++ {
+				v := fm.Pixels[(y*fm.Width+x)*fm.Channels+min(c, fm.Channels-1)]
+				t := (v - lo) * scale
+				if mapping == ToneLog && t > 0 {
+					t = float32(math.Log1p(float64(t)*ToneLogStrength)) * logNorm
+				}
+				row[x*3+c] = unitToByte(t)
+			}
+		}
+	}
+	return out, nil
+}
+
+// percentiles returns the values at fractions p and q of the sorted finite values, sampling large images
+func (fm *FloatImageMatrix) percentiles(p, q float64) (float32, float32) {
+	step := max(len(fm.Pixels)/tonePercentileSamples, 1)
+	values := make([]float32, 0, len(fm.Pixels)/step+1)
+	for i := 0; i < len(fm.Pixels); i += step {
+		if v := fm.Pixels[i]; isFinite32(v) {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return 0, 0
+	}
+	slices.Sort(values)
+	at := func(f float64) float32 {
+		return values[min(int(f*float64(len(values))), len(values)-1)]
+	}
+	return at(p), at(q)
+}
+
+// ImageToFloatMatrix converts a Go image to a 3-channel FloatImageMatrix with values in [0, 1],
+// keeping the full precision of 16-bit images
+func ImageToFloatMatrix(img image.Image) *FloatImageMatrix {
+	bounds := img.Bounds()
+	fm := NewFloatImageMatrix(bounds.Dx(), bounds.Dy(), 3)
+
+	switch src := img.(type) {
+	case *image.Gray16:
+		for y := 0; y < fm.Height; y++ {
+			row := src.Pix[y*src.Stride:]
+			for x := 0; x < fm.Width; x++ {
+				v := float32(uint16(row[x*2])<<8|uint16(row[x*2+1])) / 0xffff
+				i := (y*fm.Width + x) * 3
+				fm.Pixels[i], fm.Pixels[i+1], fm.Pixels[i+2] = v, v, v
+			}
+		}
+		return fm
+	}
+
+	for y := 0; y < fm.Height; y++ {
+		for x := 0; x < fm.Width; x++ {
+			r, g, b, _ := img.At(x+bounds.Min.X, y+bounds.Min.Y).RGBA()
+			i := (y*fm.Width + x) * 3
+			fm.Pixels[i], fm.Pixels[i+1], fm.Pixels[i+2] = float32(r)/0xffff, float32(g)/0xffff, float32(b)/0xffff
+		}
+	}
+	return fm
+}
+
+// ImageToMatrixToneMapped converts a Go image to ImageMatrix, mapping the samples of 16-bit images
+// with the given tone mapping. 8-bit images convert as with ImageToMatrix, whatever the mapping
+func ImageToMatrixToneMapped(img image.Image, mapping ToneMapping) (*ImageMatrix, error) {
+	if !isHighBitDepth(img) {
+		return ImageToMatrix(img), nil
+	}
+	return ImageToFloatMatrix(img).ToImageMatrix(mapping)
+}
+
+// LoadImageFileToneMapped is LoadImageFile for 16-bit sources such as 16-bit PNGs, mapping their
+// samples to 8 bits with the given tone mapping instead of ToneLinear
+func LoadImageFileToneMapped(path string, mapping ToneMapping) (*ImageMatrix, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &ImageLoadError{Path: path, Err: err}
+	}
+	var convertErr error
+	img, err := decodeImage(data, path, DefaultMaxImagePixels, func(img image.Image) *ImageMatrix {
+		im, err := ImageToMatrixToneMapped(img, mapping)
+		if err != nil {
+			convertErr = err
+			return NewImageMatrix(0, 0)
+		}
+		return im
+	})
+	if err != nil {
+		return nil, err
+	}
+	if convertErr != nil {
+		return nil, &ImageLoadError{Path: path, Err: convertErr}
+	}
+	return img, nil
+}
+
+// isHighBitDepth reports whether img holds more than 8 bits per sample
+func isHighBitDepth(img image.Image) bool {
+	switch img.(type) {
+	case *image.Gray16, *image.RGBA64, *image.NRGBA64:
+		return true
+	}
+	return false
+}
+
+// highBitToByte rounds a 16-bit sample to 8 bits, where shifting right by 8 would truncate
+func highBitToByte(v uint32) byte {
+	return byte((v*0xff + 0x7fff) / 0xffff)
+}
+
+func unitToByte(t float32) byte {
+	if !(t > 0) {
+		return 0
+	}
+	if t >= 1 {
+		return 255
+	}
+	return byte(t*255 + 0.5)
+}
+
+func isFinite32(v float32) bool {
+	return !math.IsNaN(float64(v)) && !math.IsInf(float64(v), 0)
+}
@@ -0,0 +1,153 @@
+package gofacerecognition
+
+import "math"
+
+// HeadPose is the orientation of a head in degrees relative to facing the camera
+type HeadPose struct {
+	Yaw   float64 // positive when the person turns their head to their left
+	Pitch float64 // positive when the person looks up
+	Roll  float64 // positive when the head tilts towards the person's left shoulder
+}
+
+// headModel holds the canonical 3D positions of the landmarks used by EstimateHeadPose
+// Units are arbitrary (roughly tenths of a millimeter); x points to the image right, y up, z towards the camera
+var headModel = [6][3]float64{
+	{0, 0, 0},          // nose tip (30)
+	{0, -330, -65},     // chin (8)
+	{-225, 170, -135},  // outer corner of the eye on the image left (36)
+	{225, 170, -135},   // outer corner of the eye on the image right (45)
+	{-150, -150, -125}, // mouth corner on the image left (48)
+	{150, -150, -125},  // mouth corner on the image right (54)
+}
+
+// EstimateHeadPose computes yaw, pitch and roll from 68-point landmarks by fitting a canonical 3D face model (POSIT)
+// The camera is assumed to have a focal length equal to the image width and its center in the middle of the image
+func EstimateHeadPose(landmarks FaceLandmarks, imgWidth, imgHeight int) (HeadPose, error) {
+	if len(landmarks.NoseBridge) < 4 || len(landmarks.Chin) < 17 || len(landmarks.LeftEye) < 6 ||
+		len(landmarks.RightEye) < 6 || len(landmarks.TopLip) < 7 {
+		return HeadPose{}, &InvalidLandmarksError{Reason: "head pose needs the 68-point model"}
+	}
+	if imgWidth <= 0 || imgHeight <= 0 {
+		return HeadPose{}, &InvalidLandmarksError{Reason: "image size must be positive"}
+	}
+
+	image := [6]Point{
+		landmarks.NoseBridge[3],
+		landmarks.Chin[8],
+		landmarks.LeftEye[0],
+		landmarks.RightEye[3],
+		landmarks.TopLip[0],
+		landmarks.TopLip[6],
+	}
+
+	// Normalized camera coordinates: x right, y down
+	f := float64(imgWidth)
+	cx, cy := float64(imgWidth)/2, float64(imgHeight)/2
+	var xs, ys [6]float64
+	for n, p := range image {
+		xs[n] = (float64(p.X) - cx) / f
+		ys[n] = (float64(p.Y) - cy) / f
+	}
+
+	// Model points relative to the nose tip, in the camera axis convention (y down, z away from the camera)
+	var a [5][3]float64
+	for n := 1; n < 6; n++ {
+		a[n-1] = [3]float64{
+			headModel[n][0] - headModel[0][0],
+			-(headModel[n][1] - headModel[0][1]),
+			-(headModel[n][2] - headModel[0][2]),
+		}
+	}
+	b, ok := pseudoInverse5x3(a)
+	if !ok {
+		return HeadPose{}, &InvalidLandmarksError{Reason: "degenerate head model"}
+	}
+
+	var r [3][3]float64
+	var eps [5]float64
+	for iter := 0; iter < 20; iter++ {
+		var vx, vy [5]float64
+		for n := 0; n < 5; n++ {
+			vx[n] = xs[n+1]*(1+eps[n]) - xs[0]
+			vy[n] = ys[n+1]*(1+eps[n]) - ys[0]
+		}
+
+		var i, j [3]float64
+		for row := 0; row < 3; row++ {
+			for n := 0; n < 5; n++ {
+				i[row] += b[row][n] * vx[n]
+				j[row] += b[row][n] * vy[n]
+			}
+		}
+
+		si, sj := vecNorm(i), vecNorm(j)
+		if si == 0 || sj == 0 {
+			return HeadPose{}, &InvalidLandmarksError{Reason: "landmarks are degenerate"}
+		}
+		s := (si + sj) / 2
+		i, j = vecScale(i, 1/si), vecScale(j, 1/sj)
+		k := vecCross(i, j)
+		k = vecScale(k, 1/vecNorm(k))
+
+		// Depth of the nose tip is 1/s in normalized units; update the perspective correction
+		converged := true
+		for n := 0; n < 5; n++ {
+			e := (a[n][0]*k[0] + a[n][1]*k[1] + a[n][2]*k[2]) * s
+			if math.Abs(e-eps[n]) > 1e-6 {
+				converged = false
+			}
+			eps[n] = e
+		}
+
+		r = [3][3]float64{i, vecCross(k, i), k}
+		if converged {
+			break
+		}
+	}
+
+	// Column 2 of r is the model z axis in camera coordinates; the face points the opposite way
+	nx, ny, nz := -r[0][2], -r[1][2], -r[2][2]
+	return HeadPose{
+		Yaw:   math.Atan2(nx, -nz) * 180 / math.Pi,
+		Pitch: math.Asin(math.Max(-1, math.Min(1, -ny))) * 180 / math.Pi,
+		Roll:  math.Atan2(r[1][0], r[0][0]) * 180 / math.Pi,
+	}, nil
+}
+
+// pseudoInverse5x3 returns (AᵀA)⁻¹Aᵀ
+func pseudoInverse5x3(a [5][3]float64) ([3][5]float64, bool) {
+	var ata [3][3]float64
+	for r := 0; r < 3; r++ {
+		for c := 0; c < 3; c++ {
+			for n := 0; n < 5; n++ {
+				ata[r][c] += a[n][r] * a[n][c]
+			}
+		}
+	}
+
+	var out [3][5]float64
+	for n := 0; n < 5; n++ {
+		x, y, z, ok := solve3x3(ata, a[n])
+		if !ok {
+			return out, false
+		}
+		out[0][n], out[1][n], out[2][n] = x, y, z
+	}
+	return out, true
+}
+
+func vecNorm(v [3]float64) float64 {
+	return math.Sqrt(v[0]*v[0] + v[1]*v[1] + v[2]*v[2])
+}
+
+func vecScale(v [3]float64, s float64) [3]float64 {
+	return [3]float64{v[0] * s, v[1] * s, v[2] * s}
+}
+
+func vecCross(a, b [3]float64) [3]float64 {
+	return [3]float64{
+		a[1]*b[2] - a[2]*b[1],
+		a[2]*b[0] - a[0]*b[2],
+		a[0]*b[1] - a[1]*b[0],
+	}
+}
@@ -0,0 +1,429 @@
+// Package httpapi serves face detection, encoding, comparison and identification as a JSON HTTP API
+//
+//	POST /detect    faces of an image with their detector scores
+//	POST /encode    faces of an image with their 128-d encodings
+//	POST /compare   distance between the largest faces of two images
+//	POST /identify  faces of an image matched against a face database
+//
+// Images are sent as multipart/form-data files, as a JSON object of base64 strings (data URLs
+// are accepted), or for single-image endpoints as the raw request body. /compare reads the fields
+// "image1" and "image2", the other endpoints "image".
+// The query parameters model, upsample, jitters, tolerance and max_faces override the server
+// defaults within its limits, see facerec.RequestLimits. Errors are JSON objects with an error
+// message and a code, written by facerec.WriteHTTPError
+package httpapi
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+)
+
+// Config configures NewHandler
+type Config struct {
+	Pool   *facerec.RecognizerPool // required
+	DB     *facerec.FaceDB         // /identify is only served when set
+	Limits facerec.RequestLimits
+	// MaxUploadBytes bounds request bodies (default 20 MiB)
+	MaxUploadBytes int64
+	// MaxImagePixels bounds the decoded size of each image, checked before decoding so small
+	// files declaring huge images are rejected (default facerec.DefaultMaxImagePixels)
+	MaxImagePixels int
+	// QueueTimeout is how long a request waits for a free recognizer before failing with a
+	// busy error, so clients back off instead of piling up (default 10s)
+	QueueTimeout time.Duration
+	// SlowLog logs requests taking longer than its threshold with the time spent reading the
+	// images, waiting for a recognizer and running it, and the request options
+	SlowLog *facerec.SlowLog
+}
+
+// Rectangle is a face rectangle in pixels of the image
+type Rectangle struct {
+	Top    int `json:"top"`
+	Right  int `json:"right"`
+	Bottom int `json:"bottom"`
+	Left   int `json:"left"`
+}
+
+// DetectedFace is a face of a /detect response
+type DetectedFace struct {
+	Rectangle Rectangle `json:"rectangle"`
+	Score     float64   `json:"score"`
+}
+
+// DetectResponse is the body of a /detect response
+type DetectResponse struct {
+	Width  int            `json:"width"`
+	Height int            `json:"height"`
+	Faces  []DetectedFace `json:"faces"`
+}
+
+// EncodedFace is a face of an /encode response
+type EncodedFace struct {
+	Rectangle Rectangle            `json:"rectangle"`
+	Encoding  facerec.FaceEncoding `json:"encoding"`
+}
+
+// EncodeResponse is the body of an /encode response
+type EncodeResponse struct {
+	Faces []EncodedFace `json:"faces"`
+}
+
+// CompareResponse is the body of a /compare response
+type CompareResponse struct {
+	Match      bool      `json:"match"`
+	Distance   float64   `json:"distance"`
+	Confidence float64   `json:"confidence"` // facerec.DistanceToConfidence of Distance
+	Tolerance  float64   `json:"tolerance"`
+	Face1      Rectangle `json:"face1"`
+	Face2      Rectangle `json:"face2"`
+}
+
+// Candidate is a person close to an identified face
+type Candidate struct {
+	PersonID string  `json:"person_id"`
+	Name     string  `json:"name"`
+	Distance float64 `json:"distance"`
+}
+
+// IdentifiedFace is a face of an /identify response
+type IdentifiedFace struct {
+	Rectangle  Rectangle   `json:"rectangle"`
+	Known      bool        `json:"known"`
+	PersonID   string      `json:"person_id,omitempty"`
+	Name       string      `json:"name,omitempty"`
+	Distance   *float64    `json:"distance,omitempty"` // absent when the database is empty
+	Confidence float64     `json:"confidence"`
+	Candidates []Candidate `json:"candidates,omitempty"`
+}
+
+// IdentifyResponse is the body of an /identify response
+type IdentifyResponse struct {
+	Faces []IdentifiedFace `json:"faces"`
+}
+
+// handler serves the endpoints of the package
+type handler struct {
+	config Config
+	mux    *http.ServeMux
+}
+
+// NewHandler returns the handler of the API, with the endpoints at the root of its paths
+func NewHandler(config Config) http.Handler {
+	if config.MaxUploadBytes <= 0 {
+		config.MaxUploadBytes = 20 << 20
+	}
+	if config.QueueTimeout <= 0 {
+		config.QueueTimeout = 10 * time.Second
+	}
+	if config.MaxImagePixels <= 0 {
+		config.MaxImagePixels = facerec.DefaultMaxImagePixels
+	}
+
+	h := &handler{config: config, mux: http.NewServeMux()}
+	h.mux.HandleFunc("/detect", h.post(h.detect))
+	h.mux.HandleFunc("/encode", h.post(h.encode))
+	h.mux.HandleFunc("/compare", h.post(h.compare))
+	if config.DB != nil {
+		h.mux.HandleFunc("/identify", h.post(h.identify))
+	}
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// post adapts an endpoint: it accepts POST only, resolves the request options and writes the
+// response or the error as JSON
+func (h *handler) post(fn func(r *http.Request, opts facerec.RequestOptions) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, h.config.MaxUploadBytes)
+		timings := facerec.NewStageTimings(time.Now())
+		r = r.WithContext(facerec.WithStageTimings(r.Context(), timings))
+
+		opts, err := facerec.ParseRequestOptions(r.URL.Query())
+		if err == nil {
+			opts, err = h.config.Limits.Resolve(opts)
+		}
+		var resp any
+		if err == nil {
+			resp, err = fn(r, opts)
+		}
+		if err != nil {
+			facerec.WriteHTTPError(w, err)
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(resp)
+		}
+
+		h.config.SlowLog.Observe("request "+r.URL.Path, timings, struct {
+			facerec.RequestOptions
+			Err error
+		}{opts, err})
+	}
+}
+
+func (h *handler) detect(r *http.Request, opts facerec.RequestOptions) (any, error) {
+	images, err := h.readImages(r, "image")
+	if err != nil {
+		return nil, err
+	}
+	img := images[0]
+
+	var faces []facerec.ScoredRectangle
+	err = h.withRecognizer(r.Context(), func(fr *facerec.FaceRecognizer) error {
+		faces, err = fr.FaceLocationsWithScores(img, opts.UpsampleTimes, opts.Model)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Largest first, as the other endpoints
+	sort.SliceStable(faces, func(i, j int) bool {
+		return faces[i].Area() > faces[j].Area()
+	})
+	resp := DetectResponse{Width: img.Width, Height: img.Height, Faces: []DetectedFace{}}
+	for _, f := range faces[:min(len(faces), opts.MaxFaces)] {
+		resp.Faces = append(resp.Faces, DetectedFace{Rectangle: rectangle(f.Rectangle), Score: f.Score})
+	}
+	return resp, nil
+}
+
+func (h *handler) encode(r *http.Request, opts facerec.RequestOptions) (any, error) {
+	images, err := h.readImages(r, "image")
+	if err != nil {
+		return nil, err
+	}
+
+	var faces []facerec.Face
+	err = h.withRecognizer(r.Context(), func(fr *facerec.FaceRecognizer) error {
+		faces, err = fr.EncodeLargestFaces(images[0], opts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := EncodeResponse{Faces: []EncodedFace{}}
+	for _, f := range faces {
+		resp.Faces = append(resp.Faces, EncodedFace{Rectangle: rectangle(f.Rectangle), Encoding: f.Encoding})
+	}
+	return resp, nil
+}
+
+func (h *handler) compare(r *http.Request, opts facerec.RequestOptions) (any, error) {
+	images, err := h.readImages(r, "image1", "image2")
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the largest face of each image is compared
+	opts.MaxFaces = 1
+	var faces [2]facerec.Face
+	err = h.withRecognizer(r.Context(), func(fr *facerec.FaceRecognizer) error {
+		for i, img := range images {
+			found, err := fr.EncodeLargestFaces(img, opts)
+			if err != nil {
+				return err
+			}
+			if len(found) == 0 {
+				return fmt.Errorf("image%d: %w", i+1, facerec.ErrNoFace)
+			}
+			faces[i] = found[0]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	distance := facerec.FaceDistance(faces[0].Encoding, faces[1].Encoding)
+	return CompareResponse{
+		Match:      distance <= opts.Tolerance,
+		Distance:   distance,
+		Confidence: facerec.DistanceToConfidence(distance, opts.Tolerance),
+		Tolerance:  opts.Tolerance,
+		Face1:      rectangle(faces[0].Rectangle),
+		Face2:      rectangle(faces[1].Rectangle),
+	}, nil
+}
+
+func (h *handler) identify(r *http.Request, opts facerec.RequestOptions) (any, error) {
+	images, err := h.readImages(r, "image")
+	if err != nil {
+		return nil, err
+	}
+
+	var faces []facerec.IdentifiedFace
+	err = h.withRecognizer(r.Context(), func(fr *facerec.FaceRecognizer) error {
+		faces, err = fr.Identify(images[0], h.config.DB, facerec.IdentifyOptions{
+			Tolerance:     opts.Tolerance,
+			UpsampleTimes: opts.UpsampleTimes,
+			NumJitters:    opts.NumJitters,
+			Model:         opts.Model,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(faces, func(i, j int) bool {
+		return faces[i].Rectangle.Area() > faces[j].Rectangle.Area()
+	})
+	resp := IdentifyResponse{Faces: []IdentifiedFace{}}
+	for _, f := range faces[:min(len(faces), opts.MaxFaces)] {
+		face := IdentifiedFace{
+			Rectangle:  rectangle(f.Rectangle),
+			Known:      f.Known,
+			PersonID:   f.PersonID,
+			Name:       f.Name,
+			Confidence: f.Confidence,
+		}
+		if !math.IsInf(f.Distance, 0) {
+			distance := f.Distance
+			face.Distance = &distance
+		}
+		for _, c := range f.Candidates {
+			face.Candidates = append(face.Candidates, Candidate{PersonID: c.Person.ID, Name: c.Person.Name, Distance: c.Distance})
+		}
+		resp.Faces = append(resp.Faces, face)
+	}
+	return resp, nil
+}
+
+// withRecognizer runs fn with a recognizer of the pool, failing with a busy error when none is
+// free within the queue timeout
+func (h *handler) withRecognizer(ctx context.Context, fn func(fr *facerec.FaceRecognizer) error) error {
+	queueCtx, cancel := context.WithTimeout(ctx, h.config.QueueTimeout)
+	defer cancel()
+
+	timings := facerec.StageTimingsFromContext(ctx)
+	start := time.Now()
+	fr, err := h.config.Pool.Acquire(queueCtx)
+	timings.Since("queue", start)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return &facerec.BusyError{RetryAfter: time.Second}
+		}
+		return err
+	}
+	defer h.config.Pool.Release(fr)
+
+	start = time.Now()
+	defer timings.Since("inference", start)
+	return fn(fr)
+}
+
+// readImages decodes the named images of a request, see the package documentation for the formats
+func (h *handler) readImages(r *http.Request, names ...string) ([]*facerec.ImageMatrix, error) {
+	defer facerec.StageTimingsFromContext(r.Context()).Since("read", time.Now())
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var data [][]byte
+	switch mediaType {
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			return nil, invalidArgumentf("bad multipart form: %v", err)
+		}
+		defer r.MultipartForm.RemoveAll()
+		for _, name := range names {
+			f, _, err := r.FormFile(name)
+			if err != nil {
+				return nil, invalidArgumentf("missing %q file field", name)
+			}
+			b, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, b)
+		}
+
+	case "application/json":
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return nil, invalidArgumentf("bad JSON body: %v", err)
+		}
+		for _, name := range names {
+			b, err := decodeBase64Image(body[name])
+			if err != nil {
+				return nil, invalidArgumentf("field %q: %v", name, err)
+			}
+			data = append(data, b)
+		}
+
+	default:
+		if len(names) != 1 {
+			return nil, invalidArgumentf("send the images %v as multipart/form-data or a JSON object", names)
+		}
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, invalidArgumentf("reading body: %v", err)
+		}
+		data = append(data, b)
+	}
+
+	images := make([]*facerec.ImageMatrix, len(data))
+	for i, b := range data {
+		if len(b) == 0 {
+			return nil, invalidArgumentf("image %q is empty", names[i])
+		}
+		img, err := facerec.LoadImageBytesLimit(b, h.config.MaxImagePixels)
+		if err != nil {
+			return nil, err
+		}
+		images[i] = img
+	}
+	return images, nil
+}
+
+// decodeBase64Image decodes standard or URL-safe base64, with or without a data URL prefix
+func decodeBase64Image(s string) ([]byte, error) {
+	if s == "" {
+		return nil, errors.New("missing")
+	}
+	if strings.HasPrefix(s, "data:") {
+		comma := strings.IndexByte(s, ',')
+		if comma < 0 || !strings.HasSuffix(s[:comma], ";base64") {
+			return nil, errors.New("only base64 data URLs are supported")
+		}
+		s = s[comma+1:]
+	}
+	s = strings.TrimRight(s, "=")
+	if b, err := base64.RawStdEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid base64")
+	}
+	return b, nil
+}
+
+func rectangle(r facerec.Rectangle) Rectangle {
+	return Rectangle{Top: r.Top, Right: r.Right, Bottom: r.Bottom, Left: r.Left}
+}
+
+// invalidArgumentf returns an error answered with 400 and the invalid_argument code
+func invalidArgumentf(format string, args ...any) error {
+	return &facerec.APIError{Code: facerec.CodeInvalidArgument, Message: fmt.Sprintf(format, args...)}
+}
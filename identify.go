@@ -0,0 +1,129 @@
+package gofacerecognition
+
+import "math"
+
+// IdentifyOptions configures FaceRecognizer.Identify, zero values select the defaults
+type IdentifyOptions struct {
+	Tolerance     float64        // maximum distance for a match (default 0.6)
+	UpsampleTimes int            // detection upsampling (default 1)
+	NumJitters    int            // encoding jitters (default 1)
+	Model         DetectionModel // detection model (default HOG)
+	CameraID      string         // applies the camera's calibration, see FaceDB.SetCameraCalibrations
+	Candidates    int            // number of closest people reported per face, known or not (default 1)
+}
+
+// IdentifiedFace is a detected face together with the identity it was matched to
+type IdentifiedFace struct {
+	Face
+	Known      bool    // the closest person is within tolerance
+	PersonID   string  // empty when unknown
+	Name       string  // empty when unknown
+	Distance   float64 // distance to the closest person, +Inf when the database is empty
+	Confidence float64 // DistanceToConfidence of Distance, between 0 and 1
+	// Candidates are the closest people, closest first, including ones beyond tolerance
+	Candidates []PersonMatch
+}
+
+// Identify detects every face in img, encodes it and matches it against db in one call
+// Faces are returned whether or not they were recognized; with a nil db every face is unknown
+func (fr *FaceRecognizer) Identify(img *ImageMatrix, db *FaceDB, opts IdentifyOptions) ([]IdentifiedFace, error) {
+	opts = opts.withDefaults()
+	faces, err := fr.detectForIdentify(img, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range faces {
+		var matches []PersonMatch
+		if db != nil {
+			// An unbounded search ranks everyone, so unknown faces still get their nearest candidates
+			matches = db.SearchFromCamera(opts.CameraID, faces[i].Encoding, math.Inf(1))
+		}
+		faces[i].setMatches(matches, opts)
+	}
+
+	return faces, nil
+}
+
+func (opts IdentifyOptions) withDefaults() IdentifyOptions {
+	if opts.Tolerance <= 0 {
+		opts.Tolerance = 0.6
+	}
+	if opts.UpsampleTimes <= 0 {
+		opts.UpsampleTimes = 1
+	}
+	if opts.NumJitters <= 0 {
+		opts.NumJitters = 1
+	}
+	if opts.Model == "" {
+		opts.Model = HOG
+	}
+	if opts.Candidates <= 0 {
+		opts.Candidates = 1
+	}
+	return opts
+}
+
+// detectForIdentify finds, landmarks and encodes the faces of img, leaving them unidentified
+func (fr *FaceRecognizer) detectForIdentify(img *ImageMatrix, opts IdentifyOptions) ([]IdentifiedFace, error) {
+	detected, err := fr.DetectAndEncodeModel(img, opts.UpsampleTimes, opts.NumJitters, opts.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	faces := make([]IdentifiedFace, len(detected))
+	for i, face := range detected {
+		faces[i] = IdentifiedFace{Face: face, Distance: math.Inf(1)}
+	}
+	return faces, nil
+}
+
+// setMatches fills in the identity from matches sorted closest first
+func (f *IdentifiedFace) setMatches(matches []PersonMatch, opts IdentifyOptions) {
+	if len(matches) > opts.Candidates {
+		matches = matches[:opts.Candidates]
+	}
+	f.Candidates = matches
+	if len(matches) > 0 {
+		f.Distance = matches[0].Distance
+		if f.Distance <= opts.Tolerance {
+			f.Known = true
+			f.PersonID = matches[0].Person.ID
+			f.Name = matches[0].Person.Name
+		}
+	}
+	f.Confidence = DistanceToConfidence(f.Distance, opts.Tolerance)
+}
+
+// DistanceToConfidence maps a face distance to a confidence between 0 and 1
+// A distance equal to tolerance maps to 0.5, the curve is steep around it and flattens towards 0 and 1
+func DistanceToConfidence(distance, tolerance float64) float64 {
+	if tolerance <= 0 {
+		tolerance = 0.6
+	}
+	if math.IsInf(distance, 1) || math.IsNaN(distance) {
+		return 0
+	}
+
+	var linear float64
+	if distance > tolerance {
+		linear = (1 - distance) / ((1 - tolerance) * 2)
+	} else {
+		linear = 1 - distance/(tolerance*2)
+	}
+	linear = math.Max(0, math.Min(1, linear))
+
+	if distance > tolerance {
+		return linear
+	}
+	return linear + (1-linear)*math.Pow((linear-0.5)*2, 0.2)
+}
+
+// Validate returns a *ConfigError listing every invalid option
+func (o IdentifyOptions) Validate() error {
+	p := configProblems{config: "IdentifyOptions"}
+	p.checkTolerance("Tolerance", o.Tolerance)
+	p.checkDetection(o.Model, o.UpsampleTimes, o.NumJitters)
+	p.checkNonNegative("Candidates", int64(o.Candidates), "use 1, or 0 for the default")
+	return p.err()
+}
@@ -1,11 +1,14 @@
 package gofacerecognition
 
 import (
+	"bytes"
+	"fmt"
 	"image"
 	"image/color"
 	_ "image/gif"
-	_ "image/jpeg"
-	_ "image/png"
+	"image/jpeg"
+	"image/png"
+	"io"
 	"os"
 
 	_ "golang.org/x/image/bmp"
@@ -20,6 +23,9 @@ type ImageMatrix struct {
 	Height int
 	// Stride is the number of bytes per row
 	Stride int
+	// Channels is 1 for a grayscale image of one byte per pixel, see NewGrayImageMatrix; 0 and 3
+	// mean RGB
+	Channels int
 }
 
 // NewImageMatrix creates an ImageMatrix from width and height
@@ -35,105 +41,283 @@ func NewImageMatrix(width, height int) *ImageMatrix {
 
 // Shape returns the image shape as (height, width, channels)
 func (im *ImageMatrix) Shape() (int, int, int) {
-	return im.Height, im.Width, 3
+	return im.Height, im.Width, im.bytesPerPixel()
 }
 
-// At returns the RGB values at position (x, y)
+// At returns the RGB values at position (x, y); grayscale images return their value in all three
 func (im *ImageMatrix) At(x, y int) (r, g, b byte) {
+	if im.Channels == 1 {
+		v := im.Pixels[y*im.Stride+x]
+		return v, v, v
+	}
 	offset := y*im.Stride + x*3
 	return im.Pixels[offset], im.Pixels[offset+1], im.Pixels[offset+2]
 }
 
-// Set sets the RGB values at position (x, y)
+// Set sets the RGB values at position (x, y); grayscale images store their luma
 func (im *ImageMatrix) Set(x, y int, r, g, b byte) {
+	if im.Channels == 1 {
+		im.Pixels[y*im.Stride+x] = luma(r, g, b)
+		return
+	}
 	offset := y*im.Stride + x*3
 	im.Pixels[offset] = r
 	im.Pixels[offset+1] = g
 	im.Pixels[offset+2] = b
 }
 
+// DefaultMaxImagePixels is the largest image, in pixels, the Load functions decode; a few KB of
+// PNG can declare a 60000x60000 image, so the size is checked before any pixel is allocated
+const DefaultMaxImagePixels = 50_000_000
+
 // LoadImageFile loads an image file and converts it to RGB format
 // Supports: JPEG, PNG, GIF, BMP, WebP
+// The EXIF orientation of JPEG files is applied, so phone photos come out upright
+// Images above DefaultMaxImagePixels are rejected, see LoadImageFileLimit
 func LoadImageFile(path string) (*ImageMatrix, error) {
-	file, err := os.Open(path)
+	return LoadImageFileLimit(path, DefaultMaxImagePixels)
+}
+
+// LoadImageFileLimit is LoadImageFile rejecting images of more than maxPixels pixels
+// (DefaultMaxImagePixels when <= 0) with an *ImageTooLargeError
+func LoadImageFileLimit(path string, maxPixels int) (*ImageMatrix, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, &ImageLoadError{Path: path, Err: err}
 	}
-	defer file.Close()
+	return decodeImage(data, path, maxPixels, ImageToMatrix)
+}
 
-	img, _, err := image.Decode(file)
+// LoadImage decodes an image from r and converts it to RGB format
+// Supports the same formats as LoadImageFile, including EXIF orientation handling and the size limit
+func LoadImage(r io.Reader) (*ImageMatrix, error) {
+	data, err := io.ReadAll(r)
 	if err != nil {
-		return nil, &ImageLoadError{Path: path, Err: err}
+		return nil, &ImageLoadError{Path: "<reader>", Err: err}
 	}
+	return decodeImage(data, "<reader>", DefaultMaxImagePixels, ImageToMatrix)
+}
 
-	return ImageToMatrix(img), nil
+// LoadImageBytes decodes an encoded image held in memory, e.g. an HTTP request body
+// Images above DefaultMaxImagePixels are rejected, see LoadImageBytesLimit
+func LoadImageBytes(b []byte) (*ImageMatrix, error) {
+	return LoadImageBytesLimit(b, DefaultMaxImagePixels)
 }
 
-// LoadImageFileGrayscale loads an image file and converts it to grayscale
+// LoadImageBytesLimit is LoadImageBytes rejecting images of more than maxPixels pixels
+// (DefaultMaxImagePixels when <= 0) with an *ImageTooLargeError
+func LoadImageBytesLimit(b []byte, maxPixels int) (*ImageMatrix, error) {
+	return decodeImage(b, "<bytes>", maxPixels, ImageToMatrix)
+}
+
+// LoadImageFileGrayscale loads an image file and converts it to a single-channel grayscale image
 func LoadImageFileGrayscale(path string) (*ImageMatrix, error) {
-	file, err := os.Open(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &ImageLoadError{Path: path, Err: err}
+	}
+	return decodeImage(data, path, DefaultMaxImagePixels, ImageToGrayscaleMatrix)
+}
+
+// decodeImage decodes data, converts it with convert and turns it upright according to its EXIF orientation
+// The size declared in the header is checked against maxPixels before the image is decoded
+func decodeImage(data []byte, path string, maxPixels int, convert func(image.Image) *ImageMatrix) (*ImageMatrix, error) {
+	if maxPixels <= 0 {
+		maxPixels = DefaultMaxImagePixels
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
 	if err != nil {
 		return nil, &ImageLoadError{Path: path, Err: err}
 	}
-	defer file.Close()
+	if int64(cfg.Width)*int64(cfg.Height) > int64(maxPixels) {
+		return nil, &ImageLoadError{Path: path, Err: &ImageTooLargeError{Width: cfg.Width, Height: cfg.Height, MaxPixels: maxPixels}}
+	}
 
-	img, _, err := image.Decode(file)
+	img, _, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
 		return nil, &ImageLoadError{Path: path, Err: err}
 	}
 
-	return ImageToGrayscaleMatrix(img), nil
+	return convert(img).ApplyOrientation(ExifOrientation(data)), nil
 }
 
 // ImageToMatrix converts a Go image.Image to ImageMatrix (RGB format)
+// 16-bit images are rounded to 8 bits over their full range; see ImageToMatrixToneMapped for images
+// that use only part of it
 func ImageToMatrix(img image.Image) *ImageMatrix {
+	bounds := img.Bounds()
+	matrix := NewImageMatrix(bounds.Dx(), bounds.Dy())
+	imageToMatrixInto(matrix, img)
+	return matrix
+}
+
+// imageToMatrixInto converts img into matrix, an RGB image of the same size
+func imageToMatrixInto(matrix *ImageMatrix, img image.Image) {
 	bounds := img.Bounds()
 	width := bounds.Max.X - bounds.Min.X
 	height := bounds.Max.Y - bounds.Min.Y
 
-	matrix := NewImageMatrix(width, height)
+	// Decoders return these concrete types; reading their buffers directly avoids a color interface call per pixel
+	switch src := img.(type) {
+	case *image.RGBA:
+		rgbaToMatrix(matrix, src.Pix, src.Stride, width, height, false)
+		return
+	case *image.NRGBA:
+		rgbaToMatrix(matrix, src.Pix, src.Stride, width, height, true)
+		return
+	case *image.YCbCr:
+		ycbcrToMatrix(matrix, src)
+		return
+	}
 
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
 			r, g, b, _ := img.At(x+bounds.Min.X, y+bounds.Min.Y).RGBA()
-			// Convert from 16-bit to 8-bit
-			matrix.Set(x, y, byte(r>>8), byte(g>>8), byte(b>>8))
+			matrix.Set(x, y, highBitToByte(r), highBitToByte(g), highBitToByte(b))
 		}
 	}
+}
 
-	return matrix
+// rgbaToMatrix copies 4-byte RGBA rows, premultiplying alpha for non-premultiplied sources like At().RGBA() does
+// Pix of an image starts at its bounds' minimum point, so no offset is needed
+func rgbaToMatrix(matrix *ImageMatrix, pix []byte, stride, width, height int, straightAlpha bool) {
+	for y := 0; y < height; y++ {
+		src := pix[y*stride : y*stride+width*4]
+		dst := matrix.Pixels[y*matrix.Stride : y*matrix.Stride+width*3]
+		for x, d := 0, 0; x < len(src); x, d = x+4, d+3 {
+			r, g, b, a := src[x], src[x+1], src[x+2], src[x+3]
+			if straightAlpha && a != 255 {
+				// Same 16-bit arithmetic as color.NRGBA.RGBA, so both paths agree exactly
+				a16 := uint32(a) * 0x101
+				r = byte(uint32(r) * 0x101 * a16 / 0xffff >> 8)
+				g = byte(uint32(g) * 0x101 * a16 / 0xffff >> 8)
+				b = byte(uint32(b) * 0x101 * a16 / 0xffff >> 8)
+			}
+			dst[d], dst[d+1], dst[d+2] = r, g, b
+		}
+	}
 }
 
-// ImageToGrayscaleMatrix converts a Go image.Image to grayscale ImageMatrix
+// ycbcrToMatrix converts planar YCbCr (as decoded from JPEG) row by row, handling every chroma subsampling
+func ycbcrToMatrix(matrix *ImageMatrix, src *image.YCbCr) {
+	bounds := src.Rect
+	width, height := bounds.Dx(), bounds.Dy()
+
+	for y := 0; y < height; y++ {
+		dst := matrix.Pixels[y*matrix.Stride : y*matrix.Stride+width*3]
+		for x := 0; x < width; x++ {
+			yi := src.YOffset(bounds.Min.X+x, bounds.Min.Y+y)
+			ci := src.COffset(bounds.Min.X+x, bounds.Min.Y+y)
+			r, g, b := color.YCbCrToRGB(src.Y[yi], src.Cb[ci], src.Cr[ci])
+			dst[x*3], dst[x*3+1], dst[x*3+2] = r, g, b
+		}
+	}
+}
+
+// ImageToGrayscaleMatrix converts a Go image.Image to a single-channel grayscale ImageMatrix
 func ImageToGrayscaleMatrix(img image.Image) *ImageMatrix {
 	bounds := img.Bounds()
 	width := bounds.Max.X - bounds.Min.X
 	height := bounds.Max.Y - bounds.Min.Y
 
-	matrix := NewImageMatrix(width, height)
+	matrix := NewGrayImageMatrix(width, height)
+
+	if src, ok := img.(*image.Gray); ok {
+		for y := 0; y < height; y++ {
+			copy(matrix.Pixels[y*matrix.Stride:(y+1)*matrix.Stride], src.Pix[y*src.Stride:])
+		}
+		return matrix
+	}
 
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
 			gray := color.GrayModel.Convert(img.At(x+bounds.Min.X, y+bounds.Min.Y)).(color.Gray)
-			matrix.Set(x, y, gray.Y, gray.Y, gray.Y)
+			matrix.Pixels[y*matrix.Stride+x] = gray.Y
 		}
 	}
 
 	return matrix
 }
 
-// ToGoImage converts ImageMatrix back to image.Image
+// ToGoImage converts ImageMatrix back to image.Image, an *image.Gray for grayscale images
 func (im *ImageMatrix) ToGoImage() image.Image {
+	if im.Channels == 1 {
+		gray := image.NewGray(image.Rect(0, 0, im.Width, im.Height))
+		for y := 0; y < im.Height; y++ {
+			copy(gray.Pix[y*gray.Stride:y*gray.Stride+im.Width], im.Pixels[y*im.Stride:])
+		}
+		return gray
+	}
 	img := image.NewRGBA(image.Rect(0, 0, im.Width, im.Height))
 	for y := 0; y < im.Height; y++ {
+		src := im.Pixels[y*im.Stride : y*im.Stride+im.Width*3]
+		dst := img.Pix[y*img.Stride : y*img.Stride+im.Width*4]
 		for x := 0; x < im.Width; x++ {
-			r, g, b := im.At(x, y)
-			img.Set(x, y, color.RGBA{R: r, G: g, B: b, A: 255})
+			dst[x*4] = src[x*3]
+			dst[x*4+1] = src[x*3+1]
+			dst[x*4+2] = src[x*3+2]
+			dst[x*4+3] = 255
 		}
 	}
 	return img
 }
 
+// ImageFormat is an encoded image file format
+type ImageFormat string
+
+const (
+	FormatJPEG ImageFormat = "jpeg"
+	FormatPNG  ImageFormat = "png"
+)
+
+// DefaultJPEGQuality is used by EncodeTo and when SaveJPEG is given a quality outside 1-100
+const DefaultJPEGQuality = 90
+
+// EncodeTo writes the image to w in the given format, JPEG uses DefaultJPEGQuality
+func (im *ImageMatrix) EncodeTo(w io.Writer, format ImageFormat) error {
+	switch format {
+	case FormatJPEG:
+		return jpeg.Encode(w, im.ToGoImage(), &jpeg.Options{Quality: DefaultJPEGQuality})
+	case FormatPNG:
+		return png.Encode(w, im.ToGoImage())
+	}
+	return fmt.Errorf("unsupported image format %q", format)
+}
+
+// SaveJPEG writes the image to path as a JPEG with the given quality (1-100)
+func (im *ImageMatrix) SaveJPEG(path string, quality int) error {
+	if quality < 1 || quality > 100 {
+		quality = DefaultJPEGQuality
+	}
+	return im.save(path, func(w io.Writer) error {
+		return jpeg.Encode(w, im.ToGoImage(), &jpeg.Options{Quality: quality})
+	})
+}
+
+// SavePNG writes the image to path as a PNG
+func (im *ImageMatrix) SavePNG(path string) error {
+	return im.save(path, func(w io.Writer) error {
+		return im.EncodeTo(w, FormatPNG)
+	})
+}
+
+// save creates path and writes it with encode, the file is removed again if encoding fails
+func (im *ImageMatrix) save(path string, encode func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = encode(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
 // Crop returns a cropped portion of the image based on a Rectangle
 func (im *ImageMatrix) Crop(rect Rectangle) *ImageMatrix {
 	// Clamp values to image bounds
@@ -149,7 +333,7 @@ func (im *ImageMatrix) Crop(rect Rectangle) *ImageMatrix {
 		return NewImageMatrix(0, 0)
 	}
 
-	cropped := NewImageMatrix(width, height)
+	cropped := im.newLike(width, height)
 
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
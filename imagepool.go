@@ -0,0 +1,67 @@
+package gofacerecognition
+
+import (
+	"image"
+	"sync"
+)
+
+// ImagePool recycles ImageMatrix pixel buffers, so video pipelines converting a frame at 30fps do
+// not allocate a new multi-megabyte buffer per frame. Buffers of any size share the pool; one too
+// small for a request is dropped and a new one allocated, so a stream of a fixed size settles on
+// reusing the same few buffers. It is safe for concurrent use
+type ImagePool struct {
+	pool sync.Pool
+}
+
+// NewImagePool creates an empty ImagePool
+func NewImagePool() *ImagePool {
+	return &ImagePool{}
+}
+
+// Get returns a width x height RGB image from the pool; its pixels hold whatever the previous user left
+func (p *ImagePool) Get(width, height int) *ImageMatrix {
+	return p.get(width, height, false)
+}
+
+// GetGray is Get for a single-channel grayscale image
+func (p *ImagePool) GetGray(width, height int) *ImageMatrix {
+	return p.get(width, height, true)
+}
+
+// Put returns an image to the pool; neither the image nor images sharing its pixels, e.g. returned
+// unchanged by ResizeMaxDim, may be used afterwards
+func (p *ImagePool) Put(img *ImageMatrix) {
+	if img == nil || cap(img.Pixels) == 0 {
+		return
+	}
+	p.pool.Put(img)
+}
+
+// FromImage is ImageToMatrix converting into an image from the pool
+func (p *ImagePool) FromImage(img image.Image) *ImageMatrix {
+	bounds := img.Bounds()
+	matrix := p.Get(bounds.Dx(), bounds.Dy())
+	imageToMatrixInto(matrix, img)
+	return matrix
+}
+
+func (p *ImagePool) get(width, height int, gray bool) *ImageMatrix {
+	fresh := NewImageMatrix
+	if gray {
+		fresh = NewGrayImageMatrix
+	}
+	img, ok := p.pool.Get().(*ImageMatrix)
+	if !ok {
+		return fresh(width, height)
+	}
+
+	// Take the geometry of a fresh image without allocating its pixels
+	shape := fresh(0, 0)
+	shape.Width, shape.Height, shape.Stride = width, height, width*shape.bytesPerPixel()
+	if cap(img.Pixels) < shape.Stride*height {
+		return fresh(width, height)
+	}
+	shape.Pixels = img.Pixels[:shape.Stride*height]
+	*img = *shape
+	return img
+}
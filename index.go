@@ -0,0 +1,256 @@
+package gofacerecognition
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// IndexConfig tunes the locality-sensitive hashing used by FaceIndex
+// More tables and probes raise recall at the cost of query time; more bits make buckets smaller
+type IndexConfig struct {
+	Tables int   // number of independent hash tables (default 8)
+	Bits   int   // hyperplanes per table, at most 64 (default 12)
+	Probes int   // extra buckets probed per table by flipping the least certain bits (default 2)
+	Seed   int64 // seed for the random hyperplanes, indexes built with the same seed hash identically
+	// Metric ranks the candidates and defines the tolerance of queries (default Euclidean)
+	// The hash is angular, so recall is highest for Cosine and slightly lower for the other metrics
+	Metric DistanceMetric
+}
+
+// DefaultIndexConfig returns settings that work well for galleries of up to a few million encodings
+func DefaultIndexConfig() IndexConfig {
+	return IndexConfig{
+		Tables: 8,
+		Bits:   12,
+		Probes: 2,
+		Seed:   1,
+	}
+}
+
+// IndexMatch is a single result from a FaceIndex query
+type IndexMatch struct {
+	ID       string
+	Distance float64
+}
+
+type indexEntry struct {
+	id       string
+	encoding FaceEncoding
+	keys     []uint64 // bucket key per table, kept so compaction and saving need no rehashing
+	deleted  bool
+}
+
+// FaceIndex is an approximate nearest-neighbor index over face encodings
+// Candidates are found with random-hyperplane LSH and re-ranked by exact distance
+// It is safe for concurrent use
+type FaceIndex struct {
+	mu      sync.RWMutex
+	config  IndexConfig
+	planes  [][]FaceEncoding // [table][bit]
+	tables  []map[uint64][]int32
+	entries []indexEntry
+	ids     map[string]int32
+	garbage int // deleted entries still occupying slots, reclaimed by Compact
+}
+
+// NewFaceIndex creates an empty index
+// Zero fields in config are replaced with the defaults
+func NewFaceIndex(config IndexConfig) *FaceIndex {
+	def := DefaultIndexConfig()
+	if config.Tables <= 0 {
+		config.Tables = def.Tables
+	}
+	if config.Bits <= 0 || config.Bits > 64 {
+		config.Bits = def.Bits
+	}
+	if config.Probes < 0 {
+		config.Probes = 0
+	}
+	config.Probes = min(config.Probes, config.Bits)
+	if config.Metric == "" {
+		config.Metric = Euclidean
+	}
+
+	rng := rand.New(rand.NewSource(config.Seed))
+	planes := make([][]FaceEncoding, config.Tables)
+	for t := range planes {
+		planes[t] = make([]FaceEncoding, config.Bits)
+		for b := range planes[t] {
+			for i := 0; i < 128; i++ {
+				planes[t][b][i] = rng.NormFloat64()
+			}
+		}
+	}
+
+	tables := make([]map[uint64][]int32, config.Tables)
+	for t := range tables {
+		tables[t] = make(map[uint64][]int32)
+	}
+
+	return &FaceIndex{
+		config: config,
+		planes: planes,
+		tables: tables,
+		ids:    make(map[string]int32),
+	}
+}
+
+// Len returns the number of encodings in the index
+func (ix *FaceIndex) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.ids)
+}
+
+// Insert adds an encoding under id, replacing any encoding already stored under that id
+func (ix *FaceIndex) Insert(id string, encoding FaceEncoding) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if slot, ok := ix.ids[id]; ok {
+		ix.entries[slot].deleted = true
+		ix.garbage++
+	}
+
+	keys := make([]uint64, len(ix.tables))
+	for t := range ix.tables {
+		keys[t], _ = ix.hash(t, encoding)
+	}
+	ix.add(indexEntry{id: id, encoding: encoding, keys: keys})
+}
+
+// add appends an entry with precomputed keys, the caller holds the write lock
+func (ix *FaceIndex) add(entry indexEntry) {
+	slot := int32(len(ix.entries))
+	ix.entries = append(ix.entries, entry)
+	ix.ids[entry.id] = slot
+	for t, key := range entry.keys {
+		ix.tables[t][key] = append(ix.tables[t][key], slot)
+	}
+}
+
+// Delete removes the encoding stored under id
+// Returns false if the id is not in the index
+func (ix *FaceIndex) Delete(id string) bool {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	slot, ok := ix.ids[id]
+	if !ok {
+		return false
+	}
+	ix.entries[slot].deleted = true
+	ix.garbage++
+	delete(ix.ids, id)
+	return true
+}
+
+// Query returns up to k encodings within tolerance of probe, closest first
+// k <= 0 returns every candidate within tolerance; default tolerance is the metric's DefaultTolerance
+func (ix *FaceIndex) Query(probe FaceEncoding, k int, tolerance float64) []IndexMatch {
+	if tolerance <= 0 {
+		tolerance = ix.config.Metric.DefaultTolerance()
+	}
+	distance := ix.config.Metric.Func()
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	seen := make(map[int32]struct{})
+	var matches []IndexMatch
+
+	visit := func(bucket []int32) {
+		for _, slot := range bucket {
+			if _, ok := seen[slot]; ok {
+				continue
+			}
+			seen[slot] = struct{}{}
+
+			entry := &ix.entries[slot]
+			if entry.deleted {
+				continue
+			}
+			if d := distance(entry.encoding, probe); d <= tolerance {
+				matches = append(matches, IndexMatch{ID: entry.id, Distance: d})
+			}
+		}
+	}
+
+	for t := range ix.tables {
+		key, margins := ix.hash(t, probe)
+		visit(ix.tables[t][key])
+
+		// Multi-probe: also look in the buckets across the hyperplanes the probe is closest to
+		for _, bit := range leastCertainBits(margins, ix.config.Probes) {
+			visit(ix.tables[t][key^(1<<uint(bit))])
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Distance < matches[j].Distance
+	})
+	if k > 0 && len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches
+}
+
+// FindBestMatch returns the closest indexed encoding within tolerance
+// Returns false if no candidate is within tolerance
+func (ix *FaceIndex) FindBestMatch(probe FaceEncoding, tolerance float64) (IndexMatch, bool) {
+	matches := ix.Query(probe, 1, tolerance)
+	if len(matches) == 0 {
+		return IndexMatch{}, false
+	}
+	return matches[0], true
+}
+
+// hash returns the bucket key of encoding in table t and the distance to each hyperplane
+func (ix *FaceIndex) hash(t int, encoding FaceEncoding) (uint64, []float64) {
+	var key uint64
+	margins := make([]float64, len(ix.planes[t]))
+	for b, plane := range ix.planes[t] {
+		var dot float64
+		for i := 0; i < 128; i++ {
+			dot += plane[i] * encoding[i]
+		}
+		if dot >= 0 {
+			key |= 1 << uint(b)
+		}
+		margins[b] = math.Abs(dot)
+	}
+	return key, margins
+}
+
+// leastCertainBits returns the n bit positions with the smallest hyperplane margin
+func leastCertainBits(margins []float64, n int) []int {
+	if n == 0 {
+		return nil
+	}
+	bits := make([]int, len(margins))
+	for i := range bits {
+		bits[i] = i
+	}
+	sort.Slice(bits, func(i, j int) bool {
+		return margins[bits[i]] < margins[bits[j]]
+	})
+	return bits[:n]
+}
+
+// Validate returns a *ConfigError listing every setting NewFaceIndex would replace
+func (c IndexConfig) Validate() error {
+	p := configProblems{config: "IndexConfig"}
+	p.checkNonNegative("Tables", int64(c.Tables), "use 8, or 0 for the default")
+	p.checkNonNegative("Bits", int64(c.Bits), "use 12, or 0 for the default")
+	if c.Bits > 64 {
+		p.add("Bits", strconv.Itoa(c.Bits)+" is above the maximum of 64", "use 12 to 16; more bits make buckets too small to find neighbours")
+	}
+	p.checkNonNegative("Probes", int64(c.Probes), "use 2, or 0 to probe only the exact bucket")
+	if err := c.Metric.Validate(); err != nil {
+		p.addErr("Metric", err, "use Euclidean, Cosine or Manhattan")
+	}
+	return p.err()
+}
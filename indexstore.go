@@ -0,0 +1,263 @@
+package gofacerecognition
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// faceIndexMagic starts every saved FaceIndex
+const faceIndexMagic = "GFIX"
+
+const faceIndexVersion = 1
+
+// Garbage returns the number of deleted or replaced entries still held by the index
+func (ix *FaceIndex) Garbage() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.garbage
+}
+
+// Compact drops deleted and replaced entries and rebuilds the buckets without them
+// Queries wait while it runs; the cost is proportional to the number of live entries
+func (ix *FaceIndex) Compact() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if ix.garbage == 0 {
+		return
+	}
+
+	entries := ix.entries
+	ix.entries = make([]indexEntry, 0, len(ix.ids))
+	ix.ids = make(map[string]int32, len(ix.ids))
+	for t := range ix.tables {
+		ix.tables[t] = make(map[uint64][]int32)
+	}
+	for _, e := range entries {
+		if !e.deleted {
+			ix.add(e)
+		}
+	}
+	ix.garbage = 0
+}
+
+// CompactionPolicy decides when AutoCompact compacts an index
+type CompactionPolicy struct {
+	Interval     time.Duration // how often garbage is checked (default 1 minute)
+	GarbageRatio float64       // compact once this fraction of the slots is garbage (default 0.2)
+	MinGarbage   int           // and at least this many entries are garbage (default 1000)
+}
+
+// AutoCompact compacts the index in the background according to policy until ctx is cancelled
+func (ix *FaceIndex) AutoCompact(ctx context.Context, policy CompactionPolicy) {
+	if policy.Interval <= 0 {
+		policy.Interval = time.Minute
+	}
+	if policy.GarbageRatio <= 0 {
+		policy.GarbageRatio = 0.2
+	}
+	if policy.MinGarbage <= 0 {
+		policy.MinGarbage = 1000
+	}
+
+	go func() {
+		ticker := time.NewTicker(policy.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			ix.mu.RLock()
+			garbage, slots := ix.garbage, len(ix.entries)
+			ix.mu.RUnlock()
+			if garbage >= policy.MinGarbage && float64(garbage) >= policy.GarbageRatio*float64(slots) {
+				ix.Compact()
+			}
+		}
+	}()
+}
+
+// Save writes the index to path atomically
+// Bucket keys are stored with the encodings, so loading needs no rehashing
+func (ix *FaceIndex) Save(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if err := ix.Encode(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// Encode writes the live entries of the index in its binary format
+func (ix *FaceIndex) Encode(w io.Writer) error {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	bw := bufio.NewWriterSize(w, 1<<20)
+	le := binary.LittleEndian
+
+	header := []interface{}{
+		[]byte(faceIndexMagic),
+		uint32(faceIndexVersion),
+		int32(ix.config.Tables), int32(ix.config.Bits), int32(ix.config.Probes), ix.config.Seed,
+	}
+	for _, v := range header {
+		if err := binary.Write(bw, le, v); err != nil {
+			return err
+		}
+	}
+	if err := writeString(bw, string(ix.config.Metric)); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, le, uint64(len(ix.ids))); err != nil {
+		return err
+	}
+
+	var buf [8]byte
+	for _, e := range ix.entries {
+		if e.deleted {
+			continue
+		}
+		if err := writeString(bw, e.id); err != nil {
+			return err
+		}
+		for _, v := range e.encoding {
+			le.PutUint64(buf[:], math.Float64bits(v))
+			bw.Write(buf[:])
+		}
+		for _, key := range e.keys {
+			le.PutUint64(buf[:], key)
+			bw.Write(buf[:])
+		}
+	}
+	return bw.Flush()
+}
+
+// LoadFaceIndex reads an index written by Save
+func LoadFaceIndex(path string) (*FaceIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ix, err := DecodeFaceIndex(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load face index %s: %w", path, err)
+	}
+	return ix, nil
+}
+
+// DecodeFaceIndex reads an index in the format written by Encode
+func DecodeFaceIndex(r io.Reader) (*FaceIndex, error) {
+	br := bufio.NewReaderSize(r, 1<<20)
+	le := binary.LittleEndian
+
+	magic := make([]byte, len(faceIndexMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != faceIndexMagic {
+		return nil, errors.New("not a face index file")
+	}
+
+	var version uint32
+	var tables, bits, probes int32
+	var seed int64
+	for _, v := range []interface{}{&version, &tables, &bits, &probes, &seed} {
+		if err := binary.Read(br, le, v); err != nil {
+			return nil, err
+		}
+	}
+	if version != faceIndexVersion {
+		return nil, fmt.Errorf("unsupported face index version %d", version)
+	}
+	metric, err := readString(br)
+	if err != nil {
+		return nil, err
+	}
+
+	config := IndexConfig{Tables: int(tables), Bits: int(bits), Probes: int(probes), Seed: seed, Metric: DistanceMetric(metric)}
+	if err := config.Metric.Validate(); err != nil {
+		return nil, err
+	}
+	// The hyperplanes are regenerated from the seed, so the stored keys stay valid
+	ix := NewFaceIndex(config)
+	if ix.config.Tables != config.Tables || ix.config.Bits != config.Bits {
+		return nil, fmt.Errorf("invalid index layout: %d tables of %d bits", tables, bits)
+	}
+
+	var count uint64
+	if err := binary.Read(br, le, &count); err != nil {
+		return nil, err
+	}
+
+	var buf [8]byte
+	for n := uint64(0); n < count; n++ {
+		id, err := readString(br)
+		if err != nil {
+			return nil, err
+		}
+		e := indexEntry{id: id, keys: make([]uint64, ix.config.Tables)}
+		for i := range e.encoding {
+			if _, err := io.ReadFull(br, buf[:]); err != nil {
+				return nil, err
+			}
+			e.encoding[i] = math.Float64frombits(le.Uint64(buf[:]))
+		}
+		for t := range e.keys {
+			if _, err := io.ReadFull(br, buf[:]); err != nil {
+				return nil, err
+			}
+			e.keys[t] = le.Uint64(buf[:])
+		}
+		ix.add(e)
+	}
+	return ix, nil
+}
+
+func writeString(w io.Writer, s string) error {
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(s))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+func readString(r io.Reader) (string, error) {
+	var n uint32
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return "", err
+	}
+	if n > 1<<20 {
+		return "", fmt.Errorf("string length %d out of range", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,142 @@
+// Package cli holds the command dispatch, flag parsing and exit codes shared by the facecli and
+// goface commands
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+)
+
+// Exit codes of the commands
+const (
+	ExitMatch   = 0  // success, and a match for compare
+	ExitNoMatch = 1  // compare found no match
+	ExitNoFace  = 2  // no face in an input image
+	ExitUsage   = 11 // unknown command, bad or missing flags
+	ExitFailure = 12 // any other failure
+)
+
+// Command is a subcommand of a command-line tool
+type Command struct {
+	Name        string
+	Args        string // positional arguments, for usage and --describe
+	Summary     string
+	Run         func(args []string) error
+	Subcommands []*Command // when set, Run is unused and the first argument selects a subcommand
+}
+
+// ExitStatus is returned by commands whose outcome is a decision rather than an error, like compare
+type ExitStatus int
+
+func (e ExitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// UsageError marks errors caused by how the command was invoked
+type UsageError struct {
+	Msg string
+}
+
+func (e *UsageError) Error() string {
+	return e.Msg
+}
+
+// UsageErrorf returns a *UsageError, which Dispatch exits with ExitUsage
+func UsageErrorf(format string, args ...interface{}) error {
+	return &UsageError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// Dispatch runs the command named by args[0] from list and returns the exit code
+// Errors are printed to stderr; ExitStatus errors are returned as they are, facerec.ErrNoFace
+// exits with ExitNoFace and usage errors with ExitUsage
+func Dispatch(prefix string, list []*Command, args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		Usage(prefix, list)
+		return ExitUsage
+	}
+
+	name := args[0]
+	for _, cmd := range list {
+		if cmd.Name != name {
+			continue
+		}
+		if cmd.Subcommands != nil {
+			return Dispatch(prefix+" "+name, cmd.Subcommands, args[1:])
+		}
+		err := cmd.Run(args[1:])
+		var status ExitStatus
+		var usage *UsageError
+		switch {
+		case err == nil:
+			return 0
+		case errors.As(err, &status):
+			return int(status)
+		case errors.Is(err, facerec.ErrNoFace):
+			fmt.Fprintf(os.Stderr, "%s %s: %v\n", prefix, name, err)
+			return ExitNoFace
+		case errors.As(err, &usage):
+			fmt.Fprintf(os.Stderr, "%s %s: %v\n", prefix, name, err)
+			return ExitUsage
+		default:
+			fmt.Fprintf(os.Stderr, "%s %s: %v\n", prefix, name, err)
+			return ExitFailure
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: unknown command %q\n", prefix, name)
+	Usage(prefix, list)
+	return ExitUsage
+}
+
+// Usage prints the commands of list to stderr, extra lists other invocations of the tool
+func Usage(prefix string, list []*Command, extra ...string) {
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [flags]\n", prefix)
+	for _, e := range extra {
+		fmt.Fprintf(os.Stderr, "       %s\n", e)
+	}
+	fmt.Fprintf(os.Stderr, "\ncommands:\n")
+	for _, cmd := range list {
+		fmt.Fprintf(os.Stderr, "  %-12s %-18s %s\n", cmd.Name, cmd.Args, cmd.Summary)
+		for _, sub := range cmd.Subcommands {
+			fmt.Fprintf(os.Stderr, "    %-10s %-18s %s\n", sub.Name, sub.Args, sub.Summary)
+		}
+	}
+}
+
+// ParseFlags parses flags that may appear before or after positional arguments and returns the positionals
+// fs must use flag.ContinueOnError. The flag package has already printed the problem when it fails,
+// so the error is an ExitStatus: 0 for -h and ExitUsage otherwise, rather than the flag package's 2,
+// which means "no face"
+func ParseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, ExitStatus(0)
+			}
+			return nil, ExitStatus(ExitUsage)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// imageExtensions are the files the commands read from directories
+var imageExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".bmp": true, ".webp": true,
+}
+
+// IsImageFile reports whether path has the extension of an image the commands can load
+func IsImageFile(path string) bool {
+	return imageExtensions[strings.ToLower(filepath.Ext(path))]
+}
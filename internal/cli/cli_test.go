@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	newFlags := func() (*flag.FlagSet, *int) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		return fs, fs.Int("n", 0, "")
+	}
+
+	fs, n := newFlags()
+	positional, err := ParseFlags(fs, []string{"a", "-n", "3", "b"})
+	if err != nil || *n != 3 || len(positional) != 2 || positional[0] != "a" || positional[1] != "b" {
+		t.Fatalf("got %v, n=%d, %v; want [a b], n=3", positional, *n, err)
+	}
+
+	var status ExitStatus
+	fs, _ = newFlags()
+	if _, err := ParseFlags(fs, []string{"-h"}); !errors.As(err, &status) || status != 0 {
+		t.Fatalf("-h: got %v, want ExitStatus(0)", err)
+	}
+	fs, _ = newFlags()
+	if _, err := ParseFlags(fs, []string{"--bogus"}); !errors.As(err, &status) || status != ExitUsage {
+		t.Fatalf("unknown flag: got %v, want ExitStatus(%d)", err, ExitUsage)
+	}
+}
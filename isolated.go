@@ -0,0 +1,415 @@
+package gofacerecognition
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// workerEnv marks a process that was started as an isolated inference worker
+const workerEnv = "GOFACE_WORKER"
+
+// workerResponseFD is the descriptor the worker writes responses to; stdout is left to native code,
+// which prints to it directly and would corrupt the stream
+const workerResponseFD = 3
+
+// defaultWorkerCallTimeout bounds a call when IsolatedConfig.CallTimeout is zero
+const defaultWorkerCallTimeout = 2 * time.Minute
+
+const (
+	opFaceLocations   = "locations"
+	opFaceEncodings   = "encodings"
+	opDetectAndEncode = "detect_and_encode"
+)
+
+func init() {
+	// Face.Landmarks is an interface and must be registered to cross the pipe
+	gob.Register(FaceLandmarks{})
+	gob.Register(FaceLandmarksSmall{})
+}
+
+type workerRequest struct {
+	Op        string
+	Image     *ImageMatrix
+	Locations []Rectangle
+	Upsample  int
+	Jitters   int
+	Detection DetectionModel
+	Landmark  LandmarkModel
+}
+
+type workerResponse struct {
+	Locations []Rectangle
+	Encodings []FaceEncoding
+	Faces     []Face
+	Err       string
+	Code      string // ErrorCode of the error, to rebuild its type in the parent
+}
+
+// isolatedConfig is the part of Config sent to the worker; the logger, metrics and preprocessing
+// steps belong to this process and cannot cross the pipe
+type isolatedConfig struct {
+	ModelPaths               ModelPaths
+	UseGPU                   bool
+	GPUDevice                int
+	NumJitters               int
+	InputMode                InputMode
+	NIROptions               NIROptions
+	MinDetectionScore        float64
+	CNNBoxCalibration        *BoxCalibration
+	MeasureCNNBoxCalibration int
+	Preprocessing            *isolatedPreprocessing
+}
+
+// isolatedPreprocessing is Preprocessing without Steps
+type isolatedPreprocessing struct {
+	MaxDimension  int
+	Equalize      bool
+	Gamma         float64
+	AutoGamma     bool
+	DenoiseRadius int
+}
+
+func newIsolatedConfig(c Config) isolatedConfig {
+	ic := isolatedConfig{
+		ModelPaths:               c.ModelPaths,
+		UseGPU:                   c.UseGPU,
+		GPUDevice:                c.GPUDevice,
+		NumJitters:               c.NumJitters,
+		InputMode:                c.InputMode,
+		NIROptions:               c.NIROptions,
+		MinDetectionScore:        c.MinDetectionScore,
+		CNNBoxCalibration:        c.CNNBoxCalibration,
+		MeasureCNNBoxCalibration: c.MeasureCNNBoxCalibration,
+	}
+	if p := c.Preprocessing; p != nil {
+		ic.Preprocessing = &isolatedPreprocessing{
+			MaxDimension:  p.MaxDimension,
+			Equalize:      p.Equalize,
+			Gamma:         p.Gamma,
+			AutoGamma:     p.AutoGamma,
+			DenoiseRadius: p.DenoiseRadius,
+		}
+	}
+	return ic
+}
+
+// config returns the Config the worker loads its recognizer with
+func (ic isolatedConfig) config() Config {
+	c := Config{
+		ModelPaths:               ic.ModelPaths,
+		UseGPU:                   ic.UseGPU,
+		GPUDevice:                ic.GPUDevice,
+		NumJitters:               ic.NumJitters,
+		InputMode:                ic.InputMode,
+		NIROptions:               ic.NIROptions,
+		MinDetectionScore:        ic.MinDetectionScore,
+		CNNBoxCalibration:        ic.CNNBoxCalibration,
+		MeasureCNNBoxCalibration: ic.MeasureCNNBoxCalibration,
+	}
+	if p := ic.Preprocessing; p != nil {
+		c.Preprocessing = &Preprocessing{
+			MaxDimension:  p.MaxDimension,
+			Equalize:      p.Equalize,
+			Gamma:         p.Gamma,
+			AutoGamma:     p.AutoGamma,
+			DenoiseRadius: p.DenoiseRadius,
+		}
+	}
+	return c
+}
+
+// IsolatedConfig configures an IsolatedRecognizer
+type IsolatedConfig struct {
+	// Config is loaded in the worker; its Logger and Metrics stay in this process, and
+	// Preprocessing.Steps are not run, since functions cannot be sent to another process
+	Config Config
+	// WorkerPath is the executable started as the worker, defaults to the running executable
+	// The worker must call RunWorkerIfRequested early in main
+	WorkerPath string
+	WorkerArgs []string
+	// MaxRestarts limits how many times a crashed worker is restarted (0 = unlimited)
+	MaxRestarts int
+	// CallTimeout is how long a call may take before the worker is killed and restarted, so a hung
+	// worker cannot block every caller (default 2 minutes)
+	CallTimeout time.Duration
+}
+
+// IsolatedRecognizer runs inference in a child process so a crash in dlib only kills the worker
+// Crashed and hung workers are restarted automatically on the next call; errors returned by the
+// worker keep their code, so errors.Is(err, ErrNoFace) and ErrorCode behave as in-process
+type IsolatedRecognizer struct {
+	config    IsolatedConfig
+	mu        sync.Mutex
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	responses *os.File
+	enc       *gob.Encoder
+	dec       *gob.Decoder
+	restarts  int
+	closed    bool
+}
+
+// NewIsolatedRecognizer starts a worker process and loads the models in it
+func NewIsolatedRecognizer(config IsolatedConfig) (*IsolatedRecognizer, error) {
+	if config.WorkerPath == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("failed to locate worker executable: %w", err)
+		}
+		config.WorkerPath = exe
+	}
+	if config.CallTimeout <= 0 {
+		config.CallTimeout = defaultWorkerCallTimeout
+	}
+
+	ir := &IsolatedRecognizer{config: config}
+	if err := ir.start(); err != nil {
+		return nil, err
+	}
+	return ir, nil
+}
+
+// Restarts returns how many times the worker has been restarted after a crash
+func (ir *IsolatedRecognizer) Restarts() int {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	return ir.restarts
+}
+
+// Close stops the worker process
+func (ir *IsolatedRecognizer) Close() {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+
+	ir.closed = true
+	ir.stop()
+}
+
+// FaceLocations detects faces in the worker process
+func (ir *IsolatedRecognizer) FaceLocations(img *ImageMatrix, upsampleTimes int, model DetectionModel) ([]Rectangle, error) {
+	resp, err := ir.call(workerRequest{Op: opFaceLocations, Image: img, Upsample: upsampleTimes, Detection: model})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Locations, nil
+}
+
+// FaceEncodings computes face encodings in the worker process
+func (ir *IsolatedRecognizer) FaceEncodings(img *ImageMatrix, faceLocations []Rectangle, numJitters int, model LandmarkModel) ([]FaceEncoding, error) {
+	// gob cannot tell an empty slice from nil, and nil means "detect faces first"
+	if faceLocations != nil && len(faceLocations) == 0 {
+		return []FaceEncoding{}, nil
+	}
+
+	resp, err := ir.call(workerRequest{Op: opFaceEncodings, Image: img, Locations: faceLocations, Jitters: numJitters, Landmark: model})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Encodings, nil
+}
+
+// DetectAndEncode detects faces and computes encodings in the worker process
+func (ir *IsolatedRecognizer) DetectAndEncode(img *ImageMatrix, upsampleTimes int, numJitters int) ([]Face, error) {
+	resp, err := ir.call(workerRequest{Op: opDetectAndEncode, Image: img, Upsample: upsampleTimes, Jitters: numJitters})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Faces, nil
+}
+
+func (ir *IsolatedRecognizer) call(req workerRequest) (workerResponse, error) {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+
+	if ir.closed {
+		return workerResponse{}, &RecognizerNotInitializedError{}
+	}
+
+	if ir.cmd == nil {
+		if ir.config.MaxRestarts > 0 && ir.restarts >= ir.config.MaxRestarts {
+			return workerResponse{}, &WorkerCrashedError{Err: fmt.Errorf("restart limit of %d reached", ir.config.MaxRestarts)}
+		}
+		ir.restarts++
+		if err := ir.start(); err != nil {
+			return workerResponse{}, err
+		}
+	}
+
+	var resp workerResponse
+	if err := ir.exchange(req, &resp); err != nil {
+		return resp, err
+	}
+	return resp, resp.err()
+}
+
+// exchange sends req and decodes the reply into resp, killing the worker when it takes longer than
+// CallTimeout; failures reap the worker and return a *WorkerCrashedError
+func (ir *IsolatedRecognizer) exchange(req any, resp *workerResponse) error {
+	var timedOut atomic.Bool
+	process := ir.cmd.Process
+	timer := time.AfterFunc(ir.config.CallTimeout, func() {
+		timedOut.Store(true)
+		process.Kill()
+	})
+	defer timer.Stop()
+
+	err := ir.enc.Encode(req)
+	if err == nil {
+		err = ir.dec.Decode(resp)
+	}
+	if err == nil {
+		return nil
+	}
+	if timedOut.Load() {
+		err = fmt.Errorf("no response within %v: %w", ir.config.CallTimeout, err)
+	}
+	return ir.crashed(err)
+}
+
+// err rebuilds the error the worker returned, nil when it succeeded
+func (resp workerResponse) err() error {
+	if resp.Err == "" {
+		return nil
+	}
+	return ErrorFromCode(resp.Code, resp.Err, 0)
+}
+
+// crashed reaps the dead worker so the next call starts a fresh one
+func (ir *IsolatedRecognizer) crashed(err error) error {
+	state := ""
+	if ir.cmd != nil {
+		ir.stop()
+		if ir.cmd.ProcessState != nil {
+			state = ir.cmd.ProcessState.String()
+		}
+		ir.cmd = nil
+	}
+	return &WorkerCrashedError{State: state, Err: err}
+}
+
+func (ir *IsolatedRecognizer) start() error {
+	cmd := exec.Command(ir.config.WorkerPath, ir.config.WorkerArgs...)
+	cmd.Env = append(os.Environ(), workerEnv+"=1")
+	// Anything the worker prints, including native code writing to fd 1, ends up on stderr
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	responses, workerEnd, err := os.Pipe()
+	if err != nil {
+		stdin.Close()
+		return err
+	}
+	cmd.ExtraFiles = []*os.File{workerEnd} // workerResponseFD in the worker
+
+	err = cmd.Start()
+	workerEnd.Close()
+	if err != nil {
+		stdin.Close()
+		responses.Close()
+		return fmt.Errorf("failed to start worker: %w", err)
+	}
+
+	ir.cmd = cmd
+	ir.stdin = stdin
+	ir.responses = responses
+	ir.enc = gob.NewEncoder(stdin)
+	ir.dec = gob.NewDecoder(responses)
+
+	// The first exchange loads the models in the worker
+	var resp workerResponse
+	if err := ir.exchange(newIsolatedConfig(ir.config.Config), &resp); err != nil {
+		return err
+	}
+	if err := resp.err(); err != nil {
+		ir.stop()
+		ir.cmd = nil
+		return err
+	}
+
+	return nil
+}
+
+func (ir *IsolatedRecognizer) stop() {
+	if ir.cmd == nil {
+		return
+	}
+	ir.stdin.Close()
+	if ir.cmd.ProcessState == nil {
+		ir.cmd.Process.Kill()
+		ir.cmd.Wait()
+	}
+	ir.responses.Close()
+}
+
+// RunWorkerIfRequested serves worker requests and exits when the process was started by an IsolatedRecognizer
+// Call it at the top of main in any binary used as a worker; it returns immediately otherwise
+func RunWorkerIfRequested() {
+	if os.Getenv(workerEnv) != "1" {
+		return
+	}
+
+	out := os.NewFile(workerResponseFD, "goface-worker-responses")
+	if err := ServeWorker(os.Stdin, out); err != nil && err != io.EOF {
+		fmt.Fprintf(os.Stderr, "goface worker: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// ServeWorker runs the worker side of the protocol until r is closed
+func ServeWorker(r io.Reader, w io.Writer) error {
+	dec := gob.NewDecoder(r)
+	enc := gob.NewEncoder(w)
+
+	var config isolatedConfig
+	if err := dec.Decode(&config); err != nil {
+		return err
+	}
+
+	fr, err := NewFaceRecognizer(config.config())
+	if err != nil {
+		return enc.Encode(workerResponse{Err: err.Error(), Code: ErrorCode(err)})
+	}
+	defer fr.Close()
+
+	if err := enc.Encode(workerResponse{}); err != nil {
+		return err
+	}
+
+	for {
+		var req workerRequest
+		if err := dec.Decode(&req); err != nil {
+			return err
+		}
+
+		var resp workerResponse
+		var err error
+		switch req.Op {
+		case opFaceLocations:
+			resp.Locations, err = fr.FaceLocations(req.Image, req.Upsample, req.Detection)
+		case opFaceEncodings:
+			resp.Encodings, err = fr.FaceEncodings(req.Image, req.Locations, req.Jitters, req.Landmark)
+		case opDetectAndEncode:
+			resp.Faces, err = fr.DetectAndEncode(req.Image, req.Upsample, req.Jitters)
+		default:
+			err = fmt.Errorf("unknown operation %q", req.Op)
+		}
+		if err != nil {
+			resp.Err, resp.Code = err.Error(), ErrorCode(err)
+		}
+
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+}
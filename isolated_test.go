@@ -0,0 +1,101 @@
+package gofacerecognition
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIsolatedConfigRoundTrip(t *testing.T) {
+	config := Config{
+		ModelPaths:               DefaultModelPaths("/models"),
+		UseGPU:                   true,
+		GPUDevice:                1,
+		NumJitters:               3,
+		InputMode:                InputNIR,
+		NIROptions:               DefaultNIROptions(),
+		MinDetectionScore:        -0.2,
+		CNNBoxCalibration:        &BoxCalibration{ScaleX: 1.2, ScaleY: 1.1, ShiftY: 0.05},
+		MeasureCNNBoxCalibration: 50,
+		Preprocessing: &Preprocessing{
+			MaxDimension:  1280,
+			Equalize:      true,
+			Gamma:         0.7,
+			DenoiseRadius: 1,
+			Steps:         []func(*ImageMatrix) *ImageMatrix{(*ImageMatrix).EqualizeHistogram},
+		},
+		Metrics: NewPrometheusMetrics(nil),
+		Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(newIsolatedConfig(config)); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	var decoded isolatedConfig
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	want := config
+	want.Metrics, want.Logger = nil, nil
+	pre := *config.Preprocessing
+	pre.Steps = nil
+	want.Preprocessing = &pre
+	if got := decoded.config(); !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip changed the config\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestIsolatedConfigZero(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(newIsolatedConfig(Config{})); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	var decoded isolatedConfig
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got := decoded.config(); !reflect.DeepEqual(got, Config{}) {
+		t.Errorf("zero config came back as %+v", got)
+	}
+}
+
+func TestWorkerResponseKeepsErrorType(t *testing.T) {
+	for _, err := range []error{ErrNoFace, &InvalidModelError{Model: "bad"}, &ImageLoadError{Path: "x.jpg", Err: io.ErrUnexpectedEOF}} {
+		resp := workerResponse{Err: err.Error(), Code: ErrorCode(err)}
+		got := resp.err()
+		if ErrorCode(got) != ErrorCode(err) {
+			t.Errorf("%v: code %q, want %q", err, ErrorCode(got), ErrorCode(err))
+		}
+		if errors.Is(err, ErrNoFace) != errors.Is(got, ErrNoFace) {
+			t.Errorf("%v: errors.Is(ErrNoFace) changed across the pipe", err)
+		}
+	}
+	if err := (workerResponse{}).err(); err != nil {
+		t.Errorf("empty response returned %v", err)
+	}
+}
+
+func TestIsolatedRecognizerKillsHungWorker(t *testing.T) {
+	// The worker prints to stdout and never answers; the output must not reach the protocol stream
+	// and the call must give up after CallTimeout
+	start := time.Now()
+	_, err := NewIsolatedRecognizer(IsolatedConfig{
+		WorkerPath:  "/bin/sh",
+		WorkerArgs:  []string{"-c", "echo garbage; exec sleep 60"},
+		CallTimeout: 200 * time.Millisecond,
+	})
+	var crashed *WorkerCrashedError
+	if !errors.As(err, &crashed) {
+		t.Fatalf("got %v, want a *WorkerCrashedError", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("hung worker blocked for %v", elapsed)
+	}
+}
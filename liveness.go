@@ -0,0 +1,302 @@
+package gofacerecognition
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// LivenessBackend scores how likely a face is a live person rather than a photo, screen or mask
+// Scores are between 0 (spoof) and 1 (live)
+type LivenessBackend interface {
+	Score(img *ImageMatrix, face Rectangle) (float64, error)
+}
+
+// LivenessFunc adapts a function to a LivenessBackend, e.g. to plug in an ONNX anti-spoofing model
+type LivenessFunc func(img *ImageMatrix, face Rectangle) (float64, error)
+
+// Score calls f
+func (f LivenessFunc) Score(img *ImageMatrix, face Rectangle) (float64, error) {
+	return f(img, face)
+}
+
+// DefaultLivenessThreshold is the score at or above which a face is considered live
+const DefaultLivenessThreshold = 0.5
+
+// Liveness runs presentation attack detection with a pluggable backend
+type Liveness struct {
+	backend   LivenessBackend
+	threshold float64
+}
+
+// NewLiveness creates a Liveness check with backend, which is required: the package ships no trained
+// anti-spoofing model, train a TextureLiveness with TrainTextureLiveness or plug in one of your own
+// threshold <= 0 uses DefaultLivenessThreshold
+func NewLiveness(backend LivenessBackend, threshold float64) (*Liveness, error) {
+	if backend == nil {
+		return nil, fmt.Errorf("liveness needs a backend, e.g. a TextureLiveness with a trained model")
+	}
+	if threshold <= 0 {
+		threshold = DefaultLivenessThreshold
+	}
+	return &Liveness{backend: backend, threshold: threshold}, nil
+}
+
+// IsLive returns the liveness score of a face; compare it with Threshold or use Check
+func (l *Liveness) IsLive(img *ImageMatrix, faceLocation Rectangle) (score float64, err error) {
+	if faceLocation.Area() == 0 {
+		return 0, &NoFaceFoundError{}
+	}
+	return l.backend.Score(img, faceLocation)
+}
+
+// Check reports whether the face is live together with its score
+func (l *Liveness) Check(img *ImageMatrix, faceLocation Rectangle) (bool, float64, error) {
+	score, err := l.IsLive(img, faceLocation)
+	if err != nil {
+		return false, 0, err
+	}
+	return score >= l.threshold, score, nil
+}
+
+// CheckRGBD is Check for a depth camera: faces on a flat surface or of implausible physical size,
+// see IsFlatSurface and FaceSizePlausible, are rejected with a score of 0 before the backend runs on
+// the color image. The size check is skipped when the frame has no FocalLength
+func (l *Liveness) CheckRGBD(frame RGBDFrame, faceLocation Rectangle) (bool, float64, error) {
+	if frame.Depth == nil {
+		return false, 0, fmt.Errorf("RGBD liveness: frame has no depth map")
+	}
+	if frame.Depth.Width != frame.Image.Width || frame.Depth.Height != frame.Image.Height {
+		return false, 0, fmt.Errorf("RGBD liveness: %dx%d depth map is not aligned with the %dx%d image",
+			frame.Depth.Width, frame.Depth.Height, frame.Image.Width, frame.Image.Height)
+	}
+	if faceLocation.Area() == 0 {
+		return false, 0, &NoFaceFoundError{}
+	}
+	if IsFlatSurface(frame.Depth, faceLocation, 0) {
+		return false, 0, nil
+	}
+	if frame.FocalLength > 0 && !FaceSizePlausible(frame, faceLocation, 0, 0) {
+		return false, 0, nil
+	}
+	return l.Check(frame.Image, faceLocation)
+}
+
+// Threshold returns the score at or above which a face is considered live
+func (l *Liveness) Threshold() float64 {
+	return l.threshold
+}
+
+// textureSize is the side of the gray face crop texture features are computed on
+const textureSize = 64
+
+// numTextureFeatures is 59 uniform LBP bins, sharpness and saturation
+const numTextureFeatures = 61
+
+// LinearModel is a logistic regression over texture features
+type LinearModel struct {
+	Weights []float64 `json:"weights"`
+	Bias    float64   `json:"bias"`
+}
+
+// LoadLinearModel reads a model saved with Save
+func LoadLinearModel(path string) (*LinearModel, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m LinearModel
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("decoding liveness model %s: %w", path, err)
+	}
+	if len(m.Weights) != numTextureFeatures {
+		return nil, fmt.Errorf("liveness model %s has %d weights, expected %d", path, len(m.Weights), numTextureFeatures)
+	}
+	return &m, nil
+}
+
+// Save writes the model as JSON
+func (m *LinearModel) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (m *LinearModel) predict(features []float64) float64 {
+	z := m.Bias
+	for i, w := range m.Weights {
+		z += w * features[i]
+	}
+	return sigmoid(z)
+}
+
+// TextureLiveness is a texture-based backend using local binary patterns, sharpness and color saturation
+// Recaptured photos and screens lose fine skin texture and color range; a model trained with
+// TrainTextureLiveness on samples from the target camera learns to tell them apart
+// Scoring without a Model is an error, an untrained check would pass attacks it was never tested on
+type TextureLiveness struct {
+	Model *LinearModel
+}
+
+// Score implements LivenessBackend
+func (t *TextureLiveness) Score(img *ImageMatrix, face Rectangle) (float64, error) {
+	if t.Model == nil {
+		return 0, fmt.Errorf("texture liveness has no model, train one with TrainTextureLiveness")
+	}
+	return t.Model.predict(textureFeatures(img, face)), nil
+}
+
+// LivenessSample is a labeled face for TrainTextureLiveness
+type LivenessSample struct {
+	Image *ImageMatrix
+	Face  Rectangle
+	Live  bool
+}
+
+// TrainTextureLiveness fits a LinearModel on live and spoof samples with gradient descent
+// Use samples from the deployment camera and the attacks to defend against (prints, phones, monitors)
+func TrainTextureLiveness(samples []LivenessSample, epochs int) (*LinearModel, error) {
+	var live, spoof int
+	for _, s := range samples {
+		if s.Live {
+			live++
+		} else {
+			spoof++
+		}
+	}
+	if live == 0 || spoof == 0 {
+		return nil, fmt.Errorf("training liveness model: need both live and spoof samples, got %d live and %d spoof", live, spoof)
+	}
+	if epochs <= 0 {
+		epochs = 500
+	}
+
+	features := make([][]float64, len(samples))
+	for i, s := range samples {
+		features[i] = textureFeatures(s.Image, s.Face)
+	}
+
+	const learningRate = 0.5
+	const l2 = 1e-3
+	m := &LinearModel{Weights: make([]float64, numTextureFeatures)}
+	grad := make([]float64, numTextureFeatures)
+	n := float64(len(samples))
+
+	for epoch := 0; epoch < epochs; epoch++ {
+		for i := range grad {
+			grad[i] = l2 * m.Weights[i]
+		}
+		var gradBias float64
+		for i, f := range features {
+			target := 0.0
+			if samples[i].Live {
+				target = 1
+			}
+			diff := m.predict(f) - target
+			for j, v := range f {
+				grad[j] += diff * v / n
+			}
+			gradBias += diff / n
+		}
+		for j := range m.Weights {
+			m.Weights[j] -= learningRate * grad[j]
+		}
+		m.Bias -= learningRate * gradBias
+	}
+
+	return m, nil
+}
+
+// textureFeatures returns the normalized uniform LBP histogram followed by sharpness and saturation
+func textureFeatures(img *ImageMatrix, face Rectangle) []float64 {
+	gray, saturation := grayFaceCrop(img, face, textureSize)
+	features := make([]float64, numTextureFeatures)
+
+	var lapSum, lapSq float64
+	count := 0
+	for y := 1; y < textureSize-1; y++ {
+		for x := 1; x < textureSize-1; x++ {
+			c := gray[y*textureSize+x]
+			code := 0
+			for bit, o := range lbpOffsets {
+				if gray[(y+o[1])*textureSize+x+o[0]] >= c {
+					code |= 1 << bit
+				}
+			}
+			features[uniformLBP[code]]++
+
+			lap := 4*float64(c) - float64(gray[(y-1)*textureSize+x]) - float64(gray[(y+1)*textureSize+x]) -
+				float64(gray[y*textureSize+x-1]) - float64(gray[y*textureSize+x+1])
+			lapSum += lap
+			lapSq += lap * lap
+			count++
+		}
+	}
+
+	for i := 0; i < 59; i++ {
+		features[i] /= float64(count)
+	}
+	mean := lapSum / float64(count)
+	variance := lapSq/float64(count) - mean*mean
+	// log scale keeps the feature in a similar range as the histogram bins
+	features[59] = math.Log1p(math.Max(0, variance)) / 10
+	features[60] = saturation
+	return features
+}
+
+// grayFaceCrop samples the face region into a size x size gray image and returns its mean saturation
+func grayFaceCrop(img *ImageMatrix, face Rectangle, size int) ([]byte, float64) {
+	face = trimRectToBounds(face, img.Height, img.Width)
+	out := make([]byte, size*size)
+	if face.Area() == 0 {
+		return out, 0
+	}
+
+	var satSum float64
+	sx := float64(face.Width()) / float64(size)
+	sy := float64(face.Height()) / float64(size)
+	for y := 0; y < size; y++ {
+		py := face.Top + int(float64(y)*sy)
+		for x := 0; x < size; x++ {
+			px := face.Left + int(float64(x)*sx)
+			r, g, b := img.At(px, py)
+			out[y*size+x] = luma(r, g, b)
+			hi, lo := max(r, g, b), min(r, g, b)
+			if hi > 0 {
+				satSum += float64(hi-lo) / float64(hi)
+			}
+		}
+	}
+	return out, satSum / float64(size*size)
+}
+
+// lbpOffsets are the 8 neighbours in clockwise order starting at the top left
+var lbpOffsets = [8][2]int{{-1, -1}, {0, -1}, {1, -1}, {1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}}
+
+// uniformLBP maps each 8-bit LBP code to one of 58 uniform patterns (at most two 0/1 transitions) or bin 58
+var uniformLBP = func() [256]int {
+	var table [256]int
+	next := 0
+	for code := 0; code < 256; code++ {
+		transitions := 0
+		for bit := 0; bit < 8; bit++ {
+			if (code>>bit)&1 != (code>>((bit+1)%8))&1 {
+				transitions++
+			}
+		}
+		if transitions <= 2 {
+			table[code] = next
+			next++
+		} else {
+			table[code] = 58
+		}
+	}
+	return table
+}()
+
+func sigmoid(z float64) float64 {
+	return 1 / (1 + math.Exp(-z))
+}
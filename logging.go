@@ -0,0 +1,12 @@
+package gofacerecognition
+
+import "log/slog"
+
+// orDiscard returns logger, or a logger dropping every record when it is nil, so the package is
+// silent unless a logger is configured
+func orDiscard(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return logger
+}
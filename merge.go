@@ -0,0 +1,349 @@
+package gofacerecognition
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// NameConflict selects what MergeGalleries does with a person of the second gallery whose name a
+// person of the first gallery already has
+type NameConflict string
+
+const (
+	// NameMergeIfSimilar merges the two when their closest encodings are within MergePolicy.Tolerance
+	// and otherwise keeps both, reporting a ConflictSameName for review (default)
+	NameMergeIfSimilar NameConflict = "merge_if_similar"
+	// NameMerge always merges people of the same name, for galleries whose names are unique keys
+	NameMerge NameConflict = "merge"
+	// NameKeepBoth never merges; the pair is reported as a ConflictSameName
+	NameKeepBoth NameConflict = "keep_both"
+	// NamePreferFirst keeps the person of the first gallery and drops the second
+	NamePreferFirst NameConflict = "prefer_first"
+)
+
+// MetadataConflict selects which value a merged person keeps for a metadata key both people set differently
+type MetadataConflict string
+
+const (
+	// MetadataPreferFirst keeps the value of the first gallery (default)
+	MetadataPreferFirst MetadataConflict = "prefer_first"
+	// MetadataPreferSecond keeps the value of the second gallery
+	MetadataPreferSecond MetadataConflict = "prefer_second"
+	// MetadataJoin keeps both values joined with "; "
+	MetadataJoin MetadataConflict = "join"
+)
+
+// MergePolicy configures MergeGalleries
+type MergePolicy struct {
+	Names    NameConflict
+	Metadata MetadataConflict
+	// Tolerance is the distance within which two people of the same name are the same person under
+	// NameMergeIfSimilar (default 0.6)
+	Tolerance float64
+	// DuplicateTolerance is the distance within which people of different names from the two
+	// galleries are reported as a ConflictNearDuplicate (default 0.4, stricter than matching so the
+	// review list holds likely duplicates rather than lookalikes)
+	DuplicateTolerance float64
+	// FoldNames compares names ignoring case and surrounding space, so "Ana Silva" and "ana silva " conflict
+	FoldNames bool
+}
+
+func (p MergePolicy) withDefaults() MergePolicy {
+	if p.Names == "" {
+		p.Names = NameMergeIfSimilar
+	}
+	if p.Metadata == "" {
+		p.Metadata = MetadataPreferFirst
+	}
+	if p.Tolerance <= 0 {
+		p.Tolerance = 0.6
+	}
+	if p.DuplicateTolerance <= 0 {
+		p.DuplicateTolerance = 0.4
+	}
+	return p
+}
+
+// Validate reports settings MergeGalleries cannot use
+func (p MergePolicy) Validate() error {
+	problems := configProblems{config: "MergePolicy"}
+	switch p.Names {
+	case "", NameMergeIfSimilar, NameMerge, NameKeepBoth, NamePreferFirst:
+	default:
+		problems.add("Names", fmt.Sprintf("unknown name conflict policy %q", p.Names), "use merge_if_similar, merge, keep_both or prefer_first")
+	}
+	switch p.Metadata {
+	case "", MetadataPreferFirst, MetadataPreferSecond, MetadataJoin:
+	default:
+		problems.add("Metadata", fmt.Sprintf("unknown metadata conflict policy %q", p.Metadata), "use prefer_first, prefer_second or join")
+	}
+	problems.checkTolerance("Tolerance", p.Tolerance)
+	problems.checkTolerance("DuplicateTolerance", p.DuplicateTolerance)
+	return problems.err()
+}
+
+// MergeConflictKind is the kind of a MergeConflict
+type MergeConflictKind string
+
+const (
+	// ConflictSameName is a pair of people with the same name that were kept apart
+	ConflictSameName MergeConflictKind = "same_name"
+	// ConflictNearDuplicate is a pair of people with different names whose faces are within DuplicateTolerance
+	ConflictNearDuplicate MergeConflictKind = "near_duplicate"
+	// ConflictMetadata is a metadata key the merged people set to different values
+	ConflictMetadata MergeConflictKind = "metadata"
+)
+
+// MergeConflict is a decision MergeGalleries made that a person should review
+type MergeConflict struct {
+	Kind MergeConflictKind `json:"kind"`
+	// IDs are the people involved in the merged gallery, one for ConflictMetadata
+	IDs   []string `json:"ids"`
+	Names []string `json:"names"`
+	// Distance between the closest encodings of the pair, -1 when either has none and for ConflictMetadata
+	Distance float64  `json:"distance"`
+	Key      string   `json:"key,omitempty"`    // ConflictMetadata: the metadata key
+	Values   []string `json:"values,omitempty"` // ConflictMetadata: the first and second gallery's values
+}
+
+// MergeReport describes the result of MergeGalleries
+type MergeReport struct {
+	Merged  int // people of the second gallery merged into a person of the first
+	Added   int // people of the second gallery added as new people
+	Dropped int // people of the second gallery dropped by NamePreferFirst
+	// FirstIDs and SecondIDs map the IDs of each gallery to the IDs in the merged one; people of the
+	// first gallery keep theirs, people of the second get new IDs when theirs are taken
+	FirstIDs  map[string]string
+	SecondIDs map[string]string
+	Conflicts []MergeConflict
+}
+
+// MergeGalleries consolidates two galleries, e.g. from different sites, into a new in-memory one
+// People of the second gallery are merged into people of the first with the same name according to
+// policy.Names; merged people get the encodings, sources and model encodings of both, exact duplicate
+// encodings once, and metadata resolved by policy.Metadata. People of different names whose faces
+// are within policy.DuplicateTolerance are kept apart and reported for review; that search goes
+// through a FaceIndex, so on very large galleries a few such pairs may go unreported
+// Neither gallery is changed; save the result with SaveTo
+func MergeGalleries(first, second *FaceDB, policy MergePolicy) (*FaceDB, MergeReport, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, MergeReport{}, err
+	}
+	policy = policy.withDefaults()
+	nameKey := func(name string) string {
+		if policy.FoldNames {
+			return strings.ToLower(strings.TrimSpace(name))
+		}
+		return name
+	}
+
+	out := NewFaceDB()
+	report := MergeReport{FirstIDs: make(map[string]string), SecondIDs: make(map[string]string)}
+	byName := make(map[string][]string)
+	fromFirst := make(map[string]bool)
+	put := func(p Person) {
+		out.people[p.ID] = &p
+		out.order = append(out.order, p.ID)
+		out.touch(p.ID)
+	}
+
+	for _, p := range first.List() {
+		put(p)
+		report.FirstIDs[p.ID] = p.ID
+		fromFirst[p.ID] = true
+		byName[nameKey(p.Name)] = append(byName[nameKey(p.Name)], p.ID)
+	}
+
+	var added []string
+	for _, p := range second.List() {
+		secondID := p.ID
+		target, distance := "", math.Inf(1)
+		for _, id := range byName[nameKey(p.Name)] {
+			if !fromFirst[id] {
+				continue
+			}
+			d := closestDistance(out.people[id].Encodings, p.Encodings)
+			if target == "" || d < distance {
+				target, distance = id, d
+			}
+		}
+
+		if target != "" {
+			switch {
+			case policy.Names == NamePreferFirst:
+				report.SecondIDs[secondID] = target
+				report.Dropped++
+				continue
+			case policy.Names == NameMerge || (policy.Names == NameMergeIfSimilar && distance <= policy.Tolerance):
+				report.Conflicts = append(report.Conflicts, mergePeople(out.people[target], p, policy.Metadata)...)
+				out.touch(target)
+				report.SecondIDs[secondID] = target
+				report.Merged++
+				continue
+			}
+		}
+
+		id := p.ID
+		if _, taken := out.people[id]; taken || id == "" {
+			var err error
+			if id, err = newPersonID(); err != nil {
+				return nil, MergeReport{}, err
+			}
+		}
+		if target != "" {
+			report.Conflicts = append(report.Conflicts, MergeConflict{
+				Kind:     ConflictSameName,
+				IDs:      []string{target, id},
+				Names:    []string{out.people[target].Name, p.Name},
+				Distance: knownDistance(distance),
+			})
+		}
+		p.ID = id
+		put(p)
+		report.SecondIDs[secondID] = id
+		report.Added++
+		added = append(added, id)
+	}
+
+	report.Conflicts = append(report.Conflicts, nearDuplicates(out, fromFirst, added, policy, nameKey)...)
+	return out, report, nil
+}
+
+// mergePeople merges p into target and returns the metadata keys the two set differently
+func mergePeople(target *Person, p Person, metadata MetadataConflict) []MergeConflict {
+	target.Encodings = appendNewEncodings(target.Encodings, p.Encodings)
+	for _, s := range p.Sources {
+		if !containsString(target.Sources, s) {
+			target.Sources = append(target.Sources, s)
+		}
+	}
+	for model, encodings := range p.ModelEncodings {
+		if target.ModelEncodings == nil {
+			target.ModelEncodings = make(map[string][]FaceEncoding)
+		}
+		target.ModelEncodings[model] = appendNewEncodings(target.ModelEncodings[model], encodings)
+	}
+
+	var conflicts []MergeConflict
+	keys := make([]string, 0, len(p.Metadata))
+	for k := range p.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := p.Metadata[k]
+		old, ok := target.Metadata[k]
+		if target.Metadata == nil {
+			target.Metadata = make(map[string]string)
+		}
+		switch {
+		case !ok:
+			target.Metadata[k] = v
+			continue
+		case old == v:
+			continue
+		case metadata == MetadataPreferSecond:
+			target.Metadata[k] = v
+		case metadata == MetadataJoin:
+			target.Metadata[k] = old + "; " + v
+		}
+		conflicts = append(conflicts, MergeConflict{
+			Kind:     ConflictMetadata,
+			IDs:      []string{target.ID},
+			Names:    []string{target.Name},
+			Distance: -1,
+			Key:      k,
+			Values:   []string{old, v},
+		})
+	}
+	return conflicts
+}
+
+// nearDuplicates reports pairs of people of different names, one from each gallery, whose faces are
+// within policy.DuplicateTolerance
+func nearDuplicates(db *FaceDB, fromFirst map[string]bool, added []string, policy MergePolicy, nameKey func(string) string) []MergeConflict {
+	ix := NewFaceIndex(DefaultIndexConfig())
+	for id := range fromFirst {
+		for i, e := range db.people[id].Encodings {
+			ix.Insert(fmt.Sprintf("%s/%d", id, i), e)
+		}
+	}
+
+	var conflicts []MergeConflict
+	for _, id := range added {
+		p := db.people[id]
+		closest := make(map[string]float64)
+		for _, e := range p.Encodings {
+			for _, m := range ix.Query(e, 0, policy.DuplicateTolerance) {
+				other := m.ID[:strings.LastIndexByte(m.ID, '/')]
+				if d, ok := closest[other]; !ok || m.Distance < d {
+					closest[other] = m.Distance
+				}
+			}
+		}
+
+		others := make([]string, 0, len(closest))
+		for other := range closest {
+			if nameKey(db.people[other].Name) != nameKey(p.Name) {
+				others = append(others, other)
+			}
+		}
+		sort.Slice(others, func(i, j int) bool { return closest[others[i]] < closest[others[j]] })
+		for _, other := range others {
+			conflicts = append(conflicts, MergeConflict{
+				Kind:     ConflictNearDuplicate,
+				IDs:      []string{other, id},
+				Names:    []string{db.people[other].Name, p.Name},
+				Distance: closest[other],
+			})
+		}
+	}
+	return conflicts
+}
+
+// closestDistance returns the smallest distance between encodings of the two lists, +Inf if either is empty
+func closestDistance(a, b []FaceEncoding) float64 {
+	best := math.Inf(1)
+	for _, x := range a {
+		for _, y := range b {
+			best = min(best, FaceDistance(x, y))
+		}
+	}
+	return best
+}
+
+// knownDistance returns -1 for the +Inf of closestDistance, which JSON cannot encode
+func knownDistance(d float64) float64 {
+	if math.IsInf(d, 1) {
+		return -1
+	}
+	return d
+}
+
+// appendNewEncodings appends the encodings of add that dst does not already hold
+func appendNewEncodings(dst, add []FaceEncoding) []FaceEncoding {
+	for _, e := range add {
+		dup := false
+		for _, d := range dst {
+			if d == e {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			dst = append(dst, e)
+		}
+	}
+	return dst
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
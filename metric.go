@@ -0,0 +1,125 @@
+package gofacerecognition
+
+import (
+	"fmt"
+	"math"
+)
+
+// DistanceMetric selects how two encodings are compared; every metric returns smaller values for more similar faces
+type DistanceMetric string
+
+const (
+	// Euclidean is the L2 distance, the metric dlib's model was trained for (default)
+	Euclidean DistanceMetric = "euclidean"
+	// Cosine is 1 - CosineSimilarity, between 0 and 2; it ignores the encoding length, which suits normalized
+	// encodings and models trained with angular losses
+	Cosine DistanceMetric = "cosine"
+	// Manhattan is the L1 distance
+	Manhattan DistanceMetric = "manhattan"
+)
+
+// CosineSimilarity returns the cosine of the angle between two encodings, 1 for identical directions
+// Zero encodings have a similarity of 0
+func CosineSimilarity(encoding1, encoding2 FaceEncoding) float64 {
+	var dot, n1, n2 float64
+	for i := 0; i < 128; i++ {
+		dot += encoding1[i] * encoding2[i]
+		n1 += encoding1[i] * encoding1[i]
+		n2 += encoding2[i] * encoding2[i]
+	}
+	if n1 == 0 || n2 == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(n1*n2)
+}
+
+// CosineDistance returns 1 - CosineSimilarity
+func CosineDistance(encoding1, encoding2 FaceEncoding) float64 {
+	return 1 - CosineSimilarity(encoding1, encoding2)
+}
+
+// ManhattanDistance returns the sum of absolute differences between two encodings
+func ManhattanDistance(encoding1, encoding2 FaceEncoding) float64 {
+	var sum float64
+	for i := 0; i < 128; i++ {
+		sum += math.Abs(encoding1[i] - encoding2[i])
+	}
+	return sum
+}
+
+// Distance compares two encodings with the metric, an empty metric is Euclidean
+func (m DistanceMetric) Distance(encoding1, encoding2 FaceEncoding) float64 {
+	return m.Func()(encoding1, encoding2)
+}
+
+// Func returns the metric as a DistanceFunc, e.g. for KMeansConfig.Distance
+func (m DistanceMetric) Func() DistanceFunc {
+	switch m {
+	case Cosine:
+		return CosineDistance
+	case Manhattan:
+		return ManhattanDistance
+	}
+	return FaceDistance
+}
+
+// DefaultTolerance returns the metric's equivalent of the 0.6 Euclidean tolerance for dlib encodings
+// dlib encodings have a length close to 1, where a Euclidean distance of 0.6 corresponds to a cosine distance
+// of about 0.18 and, for evenly spread differences, a Manhattan distance of about 5.4
+func (m DistanceMetric) DefaultTolerance() float64 {
+	switch m {
+	case Cosine:
+		return 0.18
+	case Manhattan:
+		return 5.4
+	}
+	return 0.6
+}
+
+// Validate returns an error for unknown metrics
+func (m DistanceMetric) Validate() error {
+	switch m {
+	case "", Euclidean, Cosine, Manhattan:
+		return nil
+	}
+	return fmt.Errorf("unknown distance metric %q, valid options are: %v", m, []DistanceMetric{Euclidean, Cosine, Manhattan})
+}
+
+// FaceDistancesMetric is FaceDistances with a chosen metric
+func FaceDistancesMetric(encodings []FaceEncoding, faceToCompare FaceEncoding, metric DistanceMetric) []float64 {
+	distance := metric.Func()
+	distances := make([]float64, len(encodings))
+	for i, encoding := range encodings {
+		distances[i] = distance(encoding, faceToCompare)
+	}
+	return distances
+}
+
+// CompareFacesMetric is CompareFaces with a chosen metric; tolerance <= 0 uses the metric's DefaultTolerance
+func CompareFacesMetric(knownEncodings []FaceEncoding, faceToCheck FaceEncoding, tolerance float64, metric DistanceMetric) []bool {
+	if tolerance <= 0 {
+		tolerance = metric.DefaultTolerance()
+	}
+
+	distances := FaceDistancesMetric(knownEncodings, faceToCheck, metric)
+	matches := make([]bool, len(distances))
+	for i, distance := range distances {
+		matches[i] = distance <= tolerance
+	}
+	return matches
+}
+
+// FindBestMatchMetric is FindBestMatch with a chosen metric; tolerance <= 0 uses the metric's DefaultTolerance
+func FindBestMatchMetric(knownEncodings []FaceEncoding, faceToCheck FaceEncoding, tolerance float64, metric DistanceMetric) (int, float64) {
+	if tolerance <= 0 {
+		tolerance = metric.DefaultTolerance()
+	}
+
+	bestIndex, bestDistance := -1, 0.0
+	for i, distance := range FaceDistancesMetric(knownEncodings, faceToCheck, metric) {
+		if distance <= tolerance && (bestIndex == -1 || distance < bestDistance) {
+			bestIndex, bestDistance = i, distance
+		}
+	}
+	return bestIndex, bestDistance
+}
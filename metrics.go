@@ -0,0 +1,213 @@
+package gofacerecognition
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics receives measurements from recognizers and pools, set with Config.Metrics, so deployments
+// can monitor throughput and latency without wrapping every call
+// Implementations are called from every goroutine using a recognizer and must be safe for concurrent use
+type Metrics interface {
+	// ObserveDetection is called after every detection with the number of faces found
+	ObserveDetection(model DetectionModel, faces int, elapsed time.Duration, err error)
+	// ObserveEncoding is called after every encoding call with the number of faces encoded
+	ObserveEncoding(faces int, elapsed time.Duration, err error)
+	// SetPoolUtilization is called by RecognizerPool whenever a recognizer is acquired or released
+	SetPoolUtilization(inUse, size int)
+}
+
+// StageMetrics is implemented by Metrics that also want the duration of every stage of a
+// VideoProcessor frame, such as "detect", "match" or "plugin:<name>:decide", see StageTimings
+type StageMetrics interface {
+	ObserveStage(stage string, elapsed time.Duration)
+}
+
+// noMetrics is the Metrics of recognizers configured without any
+type noMetrics struct{}
+
+func (noMetrics) ObserveDetection(DetectionModel, int, time.Duration, error) {}
+func (noMetrics) ObserveEncoding(int, time.Duration, error)                  {}
+func (noMetrics) SetPoolUtilization(int, int)                                {}
+
+// DefaultLatencyBuckets are the upper bounds in seconds of the latency histograms of PrometheusMetrics
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// PrometheusMetrics collects Metrics and serves them in the Prometheus text exposition format, so a
+// scraper can read them from a /metrics endpoint without pulling the Prometheus client into the build
+// Several pools reporting to the same PrometheusMetrics overwrite each other's utilization
+type PrometheusMetrics struct {
+	mu         sync.Mutex
+	buckets    []float64
+	detections map[DetectionModel]*stageMetrics
+	encoding   stageMetrics
+	stages     map[string]*stageMetrics
+	inUse      int
+	size       int
+}
+
+// stageMetrics are the counters and latency histogram of one stage
+type stageMetrics struct {
+	calls, faces, errors uint64
+	counts               []uint64 // per bucket, not cumulative
+	sum                  float64
+}
+
+func (s *stageMetrics) observe(buckets []float64, faces int, elapsed time.Duration, err error) {
+	if s.counts == nil {
+		s.counts = make([]uint64, len(buckets)+1)
+	}
+	seconds := elapsed.Seconds()
+	s.counts[sort.SearchFloat64s(buckets, seconds)]++
+	s.sum += seconds
+	s.calls++
+	s.faces += uint64(faces)
+	if err != nil {
+		s.errors++
+	}
+}
+
+// NewPrometheusMetrics creates an empty collector; nil buckets use DefaultLatencyBuckets
+func NewPrometheusMetrics(buckets []float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &PrometheusMetrics{
+		buckets:    buckets,
+		detections: make(map[DetectionModel]*stageMetrics),
+		stages:     make(map[string]*stageMetrics),
+	}
+}
+
+// ObserveDetection implements Metrics
+func (m *PrometheusMetrics) ObserveDetection(model DetectionModel, faces int, elapsed time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.detections[model]
+	if s == nil {
+		s = &stageMetrics{}
+		m.detections[model] = s
+	}
+	s.observe(m.buckets, faces, elapsed, err)
+}
+
+// ObserveEncoding implements Metrics
+func (m *PrometheusMetrics) ObserveEncoding(faces int, elapsed time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.encoding.observe(m.buckets, faces, elapsed, err)
+}
+
+// ObserveStage implements StageMetrics
+func (m *PrometheusMetrics) ObserveStage(stage string, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.stages[stage]
+	if s == nil {
+		s = &stageMetrics{}
+		m.stages[stage] = s
+	}
+	s.observe(m.buckets, 0, elapsed, nil)
+}
+
+// SetPoolUtilization implements Metrics
+func (m *PrometheusMetrics) SetPoolUtilization(inUse, size int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inUse, m.size = inUse, size
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	var b strings.Builder
+
+	models := make([]string, 0, len(m.detections))
+	for model := range m.detections {
+		models = append(models, string(model))
+	}
+	sort.Strings(models)
+
+	writeHeader(&b, "facerec_detections_total", "counter", "Detection calls")
+	for _, model := range models {
+		fmt.Fprintf(&b, "facerec_detections_total{model=%q} %d\n", model, m.detections[DetectionModel(model)].calls)
+	}
+	writeHeader(&b, "facerec_detection_errors_total", "counter", "Detection calls that failed")
+	for _, model := range models {
+		fmt.Fprintf(&b, "facerec_detection_errors_total{model=%q} %d\n", model, m.detections[DetectionModel(model)].errors)
+	}
+	writeHeader(&b, "facerec_faces_detected_total", "counter", "Faces found by detection")
+	for _, model := range models {
+		fmt.Fprintf(&b, "facerec_faces_detected_total{model=%q} %d\n", model, m.detections[DetectionModel(model)].faces)
+	}
+	writeHeader(&b, "facerec_detection_duration_seconds", "histogram", "Latency of detection calls")
+	for _, model := range models {
+		m.writeHistogram(&b, "facerec_detection_duration_seconds", fmt.Sprintf("model=%q,", model), m.detections[DetectionModel(model)])
+	}
+
+	writeHeader(&b, "facerec_encodings_total", "counter", "Encoding calls")
+	fmt.Fprintf(&b, "facerec_encodings_total %d\n", m.encoding.calls)
+	writeHeader(&b, "facerec_encoding_errors_total", "counter", "Encoding calls that failed")
+	fmt.Fprintf(&b, "facerec_encoding_errors_total %d\n", m.encoding.errors)
+	writeHeader(&b, "facerec_faces_encoded_total", "counter", "Faces encoded")
+	fmt.Fprintf(&b, "facerec_faces_encoded_total %d\n", m.encoding.faces)
+	writeHeader(&b, "facerec_encoding_duration_seconds", "histogram", "Latency of encoding calls")
+	m.writeHistogram(&b, "facerec_encoding_duration_seconds", "", &m.encoding)
+
+	stages := make([]string, 0, len(m.stages))
+	for stage := range m.stages {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	writeHeader(&b, "facerec_stage_duration_seconds", "histogram", "Latency of the stages of video frames")
+	for _, stage := range stages {
+		m.writeHistogram(&b, "facerec_stage_duration_seconds", fmt.Sprintf("stage=%q,", stage), m.stages[stage])
+	}
+
+	writeHeader(&b, "facerec_pool_in_use", "gauge", "Recognizers of the pool currently acquired")
+	fmt.Fprintf(&b, "facerec_pool_in_use %d\n", m.inUse)
+	writeHeader(&b, "facerec_pool_size", "gauge", "Recognizers in the pool")
+	fmt.Fprintf(&b, "facerec_pool_size %d\n", m.size)
+	m.mu.Unlock()
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP serves the metrics to a Prometheus scraper
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+func writeHeader(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeHistogram writes the cumulative buckets, sum and count of a stage; labels ends with a comma when set
+func (m *PrometheusMetrics) writeHistogram(b *strings.Builder, name, labels string, s *stageMetrics) {
+	var cumulative uint64
+	for i, le := range m.buckets {
+		if s.counts != nil {
+			cumulative += s.counts[i]
+		}
+		fmt.Fprintf(b, "%s_bucket{%sle=\"%g\"} %d\n", name, labels, le, cumulative)
+	}
+	fmt.Fprintf(b, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, s.calls)
+
+	labels = strings.TrimSuffix(labels, ",")
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(b, "%s_sum%s %g\n", name, labels, s.sum)
+	fmt.Fprintf(b, "%s_count%s %d\n", name, labels, s.calls)
+}
@@ -1,12 +1,17 @@
 package gofacerecognition
 
 import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 )
 
 const (
@@ -15,24 +20,37 @@ const (
 	ShapePredictor68URL = GitHubReleasesBase + "shape_predictor_68_face_landmarks.dat"
 	ShapePredictor5URL  = GitHubReleasesBase + "shape_predictor_5_face_landmarks.dat"
 	FaceRecognitionURL  = GitHubReleasesBase + "dlib_face_recognition_resnet_model_v1.dat"
+	CNNFaceDetectorURL  = GitHubReleasesBase + "mmod_human_face_detector.dat"
+	GenderClassifierURL = GitHubReleasesBase + "dnn_gender_classifier_v1.dat"
+	AgePredictorURL     = GitHubReleasesBase + "dnn_age_predictor_v1.dat"
 )
 
 const (
 	ShapePredictor68File = "shape_predictor_68_face_landmarks.dat"
 	ShapePredictor5File  = "shape_predictor_5_face_landmarks.dat"
 	FaceRecognitionFile  = "dlib_face_recognition_resnet_model_v1.dat"
+	CNNFaceDetectorFile  = "mmod_human_face_detector.dat"
+	GenderClassifierFile = "dnn_gender_classifier_v1.dat"
+	AgePredictorFile     = "dnn_age_predictor_v1.dat"
 )
 
 type ModelInfo struct {
 	Name     string
 	URL      string
 	Required bool
+	SHA256   string // pinned hex digest of the release asset; EnsureModels refuses a model without one
 }
 
+// AllModels are the models of the release with the digests their downloads are checked against
+// Until a digest is pinned here, the model is only usable with DownloadOptions.Checksums; print the
+// digests of verified copies with "facecli models checksums"
 var AllModels = []ModelInfo{
 	{Name: ShapePredictor68File, URL: ShapePredictor68URL, Required: true},
 	{Name: ShapePredictor5File, URL: ShapePredictor5URL, Required: true},
 	{Name: FaceRecognitionFile, URL: FaceRecognitionURL, Required: true},
+	{Name: CNNFaceDetectorFile, URL: CNNFaceDetectorURL, Required: false},
+	{Name: GenderClassifierFile, URL: GenderClassifierURL, Required: false},
+	{Name: AgePredictorFile, URL: AgePredictorURL, Required: false},
 }
 
 // DefaultModelsDir: Returns the default directory for storing models
@@ -47,8 +65,12 @@ func DefaultModelsDir() string {
 	return filepath.Join(home, ".go_face_recognition", "models")
 }
 
+// ModelsExist: Reports whether every required model is present in dir
 func ModelsExist(dir string) bool {
 	for _, model := range AllModels {
+		if !model.Required {
+			continue
+		}
 		path := filepath.Join(dir, model.Name)
 		if _, err := os.Stat(path); os.IsNotExist(err) {
 			return false
@@ -63,59 +85,268 @@ func ModelExists(dir, modelName string) bool {
 	return err == nil
 }
 
+// ProgressFunc receives download progress for a model file
+// total is -1 while the size is unknown; the last call of a successful download has downloaded == total
+type ProgressFunc func(name string, downloaded, total int64)
+
+// DownloadOptions configures how models are fetched
+type DownloadOptions struct {
+	// Client performs the requests, set it to use a proxy, custom TLS config or auth headers (default http.DefaultClient,
+	// which honors HTTP_PROXY and HTTPS_PROXY)
+	Client *http.Client
+	// Progress is called as data arrives, nil disables progress reporting
+	Progress ProgressFunc
+	// Logger receives downloads started, corrupt files replaced and optional models that could not
+	// be fetched; nil logs nothing
+	Logger *slog.Logger
+	// Checksums are digests by file name that replace the pinned ModelInfo.SHA256, for mirrors serving
+	// other builds of the models; see ParseModelChecksums
+	Checksums map[string]string
+}
+
+// digest returns the digest a model is verified against, "" when none is known
+func (opts DownloadOptions) digest(model ModelInfo) string {
+	if d, ok := opts.Checksums[model.Name]; ok {
+		return d
+	}
+	return model.SHA256
+}
+
+// DefaultDownloadOptions: Returns the options used by EnsureModels and DownloadModel, which print nothing
+// Use TerminalProgress or LogProgress as Progress to report downloads
+func DefaultDownloadOptions() DownloadOptions {
+	return DownloadOptions{
+		Client: http.DefaultClient,
+	}
+}
+
+// LogProgress: Returns a ProgressFunc logging every finished download to logger at info level
+func LogProgress(logger *slog.Logger) ProgressFunc {
+	return func(name string, downloaded, total int64) {
+		if total >= 0 && downloaded == total {
+			logger.Info("model downloaded", "model", name, "bytes", total)
+		}
+	}
+}
+
+// TerminalProgress: Prints download progress to stderr, updating a single line when stderr is a terminal
+// Meant for command-line tools, set it as DownloadOptions.Progress; stdout is left to the output of the tool
+func TerminalProgress(name string, downloaded, total int64) {
+	if total >= 0 && downloaded == total {
+		if isTerminal() {
+			fmt.Fprint(os.Stderr, "\n")
+		}
+		fmt.Fprintf(os.Stderr, "Downloaded %s (%.2f MB)\n", name, float64(total)/(1024*1024))
+		return
+	}
+	if isTerminal() {
+		if total > 0 {
+			fmt.Fprintf(os.Stderr, "\r  %s: %.1f%%", name, float64(downloaded)/float64(total)*100)
+		} else {
+			fmt.Fprintf(os.Stderr, "\r  %s: %.2f MB", name, float64(downloaded)/(1024*1024))
+		}
+	}
+}
+
+// EnsureModels: Downloads every missing model into dir and checks every model against its digest
 func EnsureModels(dir string) error {
+	return EnsureModelsWithOptions(dir, DefaultDownloadOptions())
+}
+
+// EnsureModelsWithOptions: Downloads every missing model into dir with the given client and progress callback
+// Every model, present or downloaded, is checked against its SHA-256 digest; corrupt files are
+// downloaded again. A required model without a known digest, or that still fails the check, is an
+// error; optional ones are skipped and reported to the logger
+func EnsureModelsWithOptions(dir string, opts DownloadOptions) error {
+	logger := orDiscard(opts.Logger)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("failed to create models directory: %w", err)
 	}
 
 	for _, model := range AllModels {
-		if !ModelExists(dir, model.Name) {
-			fmt.Printf("Downloading %s...\n", model.Name)
-			if err := DownloadModel(model.URL, filepath.Join(dir, model.Name)); err != nil {
-				if model.Required {
-					return fmt.Errorf("failed to download %s: %w", model.Name, err)
-				}
-				continue
+		if err := ensureModel(dir, model, opts); err != nil {
+			if model.Required {
+				return fmt.Errorf("failed to ensure %s: %w", model.Name, err)
 			}
+			logger.Warn("skipping optional model", "model", model.Name, "err", err)
 		}
 	}
 	return nil
 }
 
-func DownloadModel(url, destpath string) error {
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+// ensureModel verifies the model in dir, downloading it when it is missing or corrupt
+func ensureModel(dir string, model ModelInfo, opts DownloadOptions) error {
+	digest := opts.digest(model)
+	if digest == "" {
+		return &UnpinnedModelError{Model: model.Name}
+	}
+
+	path := filepath.Join(dir, model.Name)
+	if ModelExists(dir, model.Name) {
+		err := VerifyModel(path, digest)
+		if err == nil {
 			return nil
-		},
+		}
+		orDiscard(opts.Logger).Warn("replacing corrupt model", "model", model.Name, "err", err)
+		if err := os.Remove(path); err != nil {
+			return err
+		}
 	}
 
-	resp, err := client.Get(url)
+	orDiscard(opts.Logger).Info("downloading model", "model", model.Name, "url", model.URL)
+	return DownloadModelWithOptions(model.URL, path, digest, opts)
+}
+
+// ParseModelChecksums: Reads a manifest in the format of sha256sum output, one "<hex digest>  <file name>"
+// line per model, and returns the digests by file name, e.g. for DownloadOptions.Checksums
+func ParseModelChecksums(r io.Reader) (map[string]string, error) {
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		digest, name, ok := strings.Cut(text, " ")
+		name = strings.TrimPrefix(strings.TrimSpace(name), "*") // binary mode marker
+		if b, err := hex.DecodeString(digest); !ok || err != nil || len(b) != sha256.Size || name == "" {
+			return nil, fmt.Errorf("checksum manifest line %d: expected a SHA-256 digest and a file name", line)
+		}
+		sums[name] = strings.ToLower(digest)
+	}
+	return sums, scanner.Err()
+}
+
+// DownloadModel: Downloads a model file without checksum verification
+func DownloadModel(url, destpath string) error {
+	return DownloadModelWithChecksum(url, destpath, "")
+}
+
+// DownloadModelWithChecksum: Downloads a model file, resuming a previous partial download if one exists
+// The data is written to destpath + ".part" and only renamed to destpath once it matches checksum (if given)
+func DownloadModelWithChecksum(url, destpath, checksum string) error {
+	return DownloadModelWithOptions(url, destpath, checksum, DefaultDownloadOptions())
+}
+
+// DownloadModelWithOptions: DownloadModelWithChecksum with a caller supplied HTTP client and progress callback
+func DownloadModelWithOptions(url, destpath, checksum string, opts DownloadOptions) error {
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	name := filepath.Base(destpath)
+	partPath := destpath + ".part"
+
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+		orDiscard(opts.Logger).Debug("resuming model download", "model", name, "offset", offset)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("HTTP request failed: %w", err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("HTTP request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is already complete
+		resp.Body.Close()
+		return finishDownload(partPath, destpath, checksum)
+	case resp.StatusCode == http.StatusOK:
+		// Server ignored the range request, start over
+		offset = 0
+		flags |= os.O_TRUNC
+	default:
 		return fmt.Errorf("HTTP status %d: %s", resp.StatusCode, resp.Status)
 	}
 
-	destFile, err := os.Create(destpath)
+	destFile, err := os.OpenFile(partPath, flags, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
 	}
-	defer destFile.Close()
 
-	written, err := copyWithProgress(destFile, resp.Body, resp.ContentLength)
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = resp.ContentLength + offset
+	}
+
+	progress := func(downloaded int64) {
+		// Completion is reported once the file has been verified and moved into place
+		if opts.Progress != nil && downloaded != total {
+			opts.Progress(name, downloaded, total)
+		}
+	}
+	progress(offset)
+
+	written, err := copyWithProgress(destFile, resp.Body, offset, progress)
+	destFile.Close()
 	if err != nil {
-		os.Remove(destpath)
+		// Keep the partial file so the next attempt can resume
 		return fmt.Errorf("download failed: %w", err)
 	}
 
-	fmt.Printf("\nDownloaded %.2f MB\n", float64(written)/(1024*1024))
+	if err := finishDownload(partPath, destpath, checksum); err != nil {
+		return err
+	}
+	if opts.Progress != nil {
+		opts.Progress(name, offset+written, offset+written)
+	}
+	return nil
+}
+
+// VerifyModel: Checks that the file at path has the expected SHA-256 hex digest
+func VerifyModel(path, expected string) error {
+	actual, err := ModelDigest(path)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(actual, expected) {
+		return &ChecksumMismatchError{Path: path, Expected: expected, Actual: actual}
+	}
 	return nil
 }
 
-func copyWithProgress(dst io.Writer, src io.Reader, total int64) (int64, error) {
+// ModelDigest: Returns the SHA-256 hex digest of the file at path, as pinned in ModelInfo.SHA256
+func ModelDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func finishDownload(partPath, destpath, checksum string) error {
+	if checksum != "" {
+		if err := VerifyModel(partPath, checksum); err != nil {
+			// A corrupt partial file can never be resumed into a valid one
+			os.Remove(partPath)
+			return err
+		}
+	}
+	return os.Rename(partPath, destpath)
+}
+
+// copyWithProgress copies src to dst, calling progress with the byte count so far starting at offset
+func copyWithProgress(dst io.Writer, src io.Reader, offset int64, progress func(int64)) (int64, error) {
 	var written int64
 	buf := make([]byte, 32*1024) // 32KB buffer
 
@@ -137,11 +368,7 @@ func copyWithProgress(dst io.Writer, src io.Reader, total int64) (int64, error)
 				return written, io.ErrShortWrite
 			}
 
-			// Print progress (only on terminals)
-			if total > 0 && isTerminal() {
-				pct := float64(written) / float64(total) * 100
-				fmt.Printf("\r  Progress: %.1f%%", pct)
-			}
+			progress(offset + written)
 		}
 		if er != nil {
 			if er != io.EOF {
@@ -158,7 +385,7 @@ func isTerminal() bool {
 	if runtime.GOOS == "windows" {
 		return true
 	}
-	fi, err := os.Stdout.Stat()
+	fi, err := os.Stderr.Stat()
 	if err != nil {
 		return false
 	}
@@ -0,0 +1,81 @@
+package gofacerecognition
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseModelChecksums(t *testing.T) {
+	digest := strings.Repeat("ab", 32)
+	manifest := "# release v1\n" + digest + "  " + ShapePredictor5File + "\n" + strings.ToUpper(digest) + " *" + FaceRecognitionFile + "\n\n"
+
+	sums, err := ParseModelChecksums(strings.NewReader(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sums) != 2 || sums[ShapePredictor5File] != digest || sums[FaceRecognitionFile] != digest {
+		t.Fatalf("got %v", sums)
+	}
+
+	for _, bad := range []string{"abcd  " + ShapePredictor5File, digest, "zz" + digest[2:] + "  x.dat"} {
+		if _, err := ParseModelChecksums(strings.NewReader(bad)); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestEnsureModelsVerifiesDigests(t *testing.T) {
+	content := []byte("model weights")
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	saved := AllModels
+	defer func() { AllModels = saved }()
+	AllModels = []ModelInfo{{Name: "a.dat", URL: server.URL + "/a.dat", Required: true, SHA256: digest}}
+
+	dir := t.TempDir()
+	if err := EnsureModels(dir); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+
+	// A corrupt file already on disk is replaced even though nothing is missing
+	path := filepath.Join(dir, "a.dat")
+	if err := os.WriteFile(path, []byte("corrupt"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnsureModels(dir); err != nil {
+		t.Fatalf("repair: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != string(content) {
+		t.Fatalf("corrupt model was kept: %q", data)
+	}
+
+	var mismatch *ChecksumMismatchError
+	err := EnsureModelsWithOptions(t.TempDir(), DownloadOptions{Checksums: map[string]string{"a.dat": strings.Repeat("00", 32)}})
+	if !errors.As(err, &mismatch) {
+		t.Errorf("wrong digest: got %v, want a *ChecksumMismatchError", err)
+	}
+
+	var unpinned *UnpinnedModelError
+	AllModels[0].SHA256 = ""
+	if err := EnsureModels(dir); !errors.As(err, &unpinned) {
+		t.Errorf("missing digest: got %v, want an *UnpinnedModelError", err)
+	}
+
+	// Optional models are skipped instead
+	AllModels[0].Required = false
+	if err := EnsureModels(t.TempDir()); err != nil {
+		t.Errorf("optional model without a digest: %v", err)
+	}
+}
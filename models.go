@@ -10,6 +10,8 @@ type ModelPaths struct {
 	ShapePredictor5      string // shape_predictor_5_face_landmarks.dat
 	FaceRecognitionModel string // dlib_face_recognition_resnet_model_v1.dat
 	CNNFaceDetector      string // mmod_human_face_detector.dat
+	GenderClassifier     string // dnn_gender_classifier_v1.dat (optional)
+	AgePredictor         string // dnn_age_predictor_v1.dat (optional)
 }
 
 func DefaultModelPaths(modeldir string) ModelPaths {
@@ -18,6 +20,8 @@ func DefaultModelPaths(modeldir string) ModelPaths {
 		ShapePredictor5:      filepath.Join(modeldir, "shape_predictor_5_face_landmarks.dat"),
 		FaceRecognitionModel: filepath.Join(modeldir, "dlib_face_recognition_resnet_model_v1.dat"),
 		CNNFaceDetector:      filepath.Join(modeldir, "mmod_human_face_detector.dat"),
+		GenderClassifier:     filepath.Join(modeldir, "dnn_gender_classifier_v1.dat"),
+		AgePredictor:         filepath.Join(modeldir, "dnn_age_predictor_v1.dat"),
 	}
 }
 
@@ -0,0 +1,142 @@
+package gofacerecognition
+
+import "math"
+
+// InputMode describes what kind of camera produced the images given to a FaceRecognizer
+type InputMode string
+
+const (
+	// InputRGB is a regular color camera (default)
+	InputRGB InputMode = "rgb"
+	// InputNIR is a near-infrared camera, frames are normalized with PreprocessNIR before detection
+	InputNIR InputMode = "nir"
+)
+
+// NIROptions tunes PreprocessNIR
+type NIROptions struct {
+	LowPercentile  float64 // intensity mapped to black (default 0.01)
+	HighPercentile float64 // intensity mapped to white (default 0.99)
+	Gamma          float64 // applied after stretching, < 1 brightens (default 0.8)
+}
+
+// DefaultNIROptions returns settings that suit typical IR door and night-vision cameras
+func DefaultNIROptions() NIROptions {
+	return NIROptions{
+		LowPercentile:  0.01,
+		HighPercentile: 0.99,
+		Gamma:          0.8,
+	}
+}
+
+// NIRReport describes an IR frame and gives guidance about its usability
+type NIRReport struct {
+	LikelyNIR    bool // the channels are nearly identical, as with IR sensors
+	LowContrast  bool // the useful intensity range is narrow, detection is unreliable
+	Overexposed  bool // many pixels are clipped, often from the IR illuminator being too close
+	Underexposed bool // the frame is mostly dark, the IR illuminator may be off or too weak
+	Low          byte // intensity at LowPercentile
+	High         byte // intensity at HighPercentile
+}
+
+// AnalyzeNIR inspects a frame without modifying it
+func AnalyzeNIR(img *ImageMatrix, opts NIROptions) NIRReport {
+	opts = opts.withDefaults()
+	hist, diff, n := nirHistogram(img)
+
+	report := NIRReport{}
+	if n == 0 {
+		return report
+	}
+
+	report.LikelyNIR = diff/float64(n) < 3
+	report.Low = histogramPercentile(hist, n, opts.LowPercentile)
+	report.High = histogramPercentile(hist, n, opts.HighPercentile)
+	report.LowContrast = int(report.High)-int(report.Low) < 40
+
+	var clipped, dark int
+	for v := 250; v < 256; v++ {
+		clipped += hist[v]
+	}
+	for v := 0; v < 20; v++ {
+		dark += hist[v]
+	}
+	report.Overexposed = float64(clipped)/float64(n) > 0.05
+	report.Underexposed = float64(dark)/float64(n) > 0.6
+
+	return report
+}
+
+// PreprocessNIR converts an IR frame to a contrast-stretched single-channel gray image for detection
+// The intensity range between the configured percentiles is stretched to the full range and gamma corrected
+func PreprocessNIR(img *ImageMatrix, opts NIROptions) (*ImageMatrix, NIRReport) {
+	opts = opts.withDefaults()
+	report := AnalyzeNIR(img, opts)
+
+	low, high := float64(report.Low), float64(report.High)
+	if high <= low {
+		high = low + 1
+	}
+
+	var lut [256]byte
+	for v := 0; v < 256; v++ {
+		t := (float64(v) - low) / (high - low)
+		t = math.Max(0, math.Min(1, t))
+		lut[v] = byte(math.Round(math.Pow(t, opts.Gamma) * 255))
+	}
+
+	out := NewGrayImageMatrix(img.Width, img.Height)
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			r, g, b := img.At(x, y)
+			v := lut[luma(r, g, b)]
+			out.Set(x, y, v, v, v)
+		}
+	}
+
+	return out, report
+}
+
+func (o NIROptions) withDefaults() NIROptions {
+	def := DefaultNIROptions()
+	if o.LowPercentile <= 0 || o.LowPercentile >= 1 {
+		o.LowPercentile = def.LowPercentile
+	}
+	if o.HighPercentile <= o.LowPercentile || o.HighPercentile > 1 {
+		o.HighPercentile = def.HighPercentile
+	}
+	if o.Gamma <= 0 {
+		o.Gamma = def.Gamma
+	}
+	return o
+}
+
+// nirHistogram returns the luma histogram, the summed channel spread, and the pixel count
+func nirHistogram(img *ImageMatrix) ([256]int, float64, int) {
+	var hist [256]int
+	var diff float64
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			r, g, b := img.At(x, y)
+			hist[luma(r, g, b)]++
+			diff += float64(max(r, g, b) - min(r, g, b))
+		}
+	}
+	return hist, diff, img.Width * img.Height
+}
+
+func histogramPercentile(hist [256]int, n int, p float64) byte {
+	target := int(p * float64(n))
+	cum := 0
+	for v, c := range hist {
+		cum += c
+		if cum > target {
+			return byte(v)
+		}
+	}
+	return 255
+}
+
+// luma returns the ITU-R BT.601 luminance of an RGB pixel
+func luma(r, g, b byte) byte {
+	return byte((299*int(r) + 587*int(g) + 114*int(b) + 500) / 1000)
+}
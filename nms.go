@@ -0,0 +1,134 @@
+package gofacerecognition
+
+import "sort"
+
+// NMS performs greedy non-maximum suppression: detections are visited from the highest score down
+// and each is kept unless it overlaps an already kept one by more than iouThreshold (default 0.5)
+// The result is sorted by descending score
+func NMS(rects []ScoredRectangle, iouThreshold float64) []ScoredRectangle {
+	if iouThreshold <= 0 {
+		iouThreshold = 0.5
+	}
+
+	sorted := append([]ScoredRectangle(nil), rects...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Score > sorted[j].Score
+	})
+
+	kept := make([]ScoredRectangle, 0, len(sorted))
+	for _, r := range sorted {
+		suppressed := false
+		for _, k := range kept {
+			if r.IoU(k.Rectangle) > iouThreshold {
+				suppressed = true
+				break
+			}
+		}
+		if !suppressed {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// MergeOverlapping groups detections that overlap by more than threshold (default 0.5) and replaces
+// each group with one rectangle scored with the group's best score
+// Overlap is measured against the smaller rectangle, so a face cut off at a tile border merges with
+// the full detection from a neighbouring tile even though their IoU is low. The merged rectangle is
+// the area-weighted mean of the group's largest rectangle and those similar to it (IoU >= 0.5), so
+// boxes of the same face from several scales are averaged while fragments do not shrink the result
+// The result is sorted by descending score
+func MergeOverlapping(rects []ScoredRectangle, threshold float64) []ScoredRectangle {
+	if threshold <= 0 {
+		threshold = 0.5
+	}
+
+	// Union-find over every overlapping pair, so chains of overlaps form one group
+	parent := make([]int, len(rects))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range rects {
+		for j := i + 1; j < len(rects); j++ {
+			if overlapOfSmaller(rects[i].Rectangle, rects[j].Rectangle) > threshold {
+				parent[find(i)] = find(j)
+			}
+		}
+	}
+
+	groups := make(map[int][]ScoredRectangle)
+	var roots []int
+	for i, r := range rects {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], r)
+	}
+
+	merged := make([]ScoredRectangle, 0, len(roots))
+	for _, root := range roots {
+		merged = append(merged, mergeGroup(groups[root]))
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Score > merged[j].Score
+	})
+	return merged
+}
+
+// mergeGroup averages the largest rectangle of a group with the ones similar to it, weighted by area,
+// and keeps the best score of the group
+func mergeGroup(group []ScoredRectangle) ScoredRectangle {
+	if len(group) == 1 {
+		return group[0]
+	}
+
+	largest := group[0].Rectangle
+	for _, r := range group[1:] {
+		if r.Area() > largest.Area() {
+			largest = r.Rectangle
+		}
+	}
+
+	var top, right, bottom, left, total float64
+	best := group[0].Score
+	for _, r := range group {
+		best = max(best, r.Score)
+		if r.IoU(largest) < 0.5 {
+			continue
+		}
+		w := float64(max(r.Area(), 1))
+		top += w * float64(r.Top)
+		right += w * float64(r.Right)
+		bottom += w * float64(r.Bottom)
+		left += w * float64(r.Left)
+		total += w
+	}
+
+	return ScoredRectangle{
+		Rectangle: Rectangle{
+			Top:    int(top/total + 0.5),
+			Right:  int(right/total + 0.5),
+			Bottom: int(bottom/total + 0.5),
+			Left:   int(left/total + 0.5),
+		},
+		Score: best,
+	}
+}
+
+// overlapOfSmaller returns the intersection area as a fraction of the smaller rectangle's area
+func overlapOfSmaller(a, b Rectangle) float64 {
+	inter := a.Intersect(b).Area()
+	if inter == 0 {
+		return 0
+	}
+	return float64(inter) / float64(min(a.Area(), b.Area()))
+}
@@ -0,0 +1,141 @@
+package gofacerecognition
+
+import "math"
+
+// NormalizedPoint is a point in fractions of the image width and height
+type NormalizedPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Normalize converts the point to fractions of an image of the given size
+func (p Point) Normalize(width, height int) NormalizedPoint {
+	if width <= 0 || height <= 0 {
+		return NormalizedPoint{}
+	}
+	return NormalizedPoint{X: float64(p.X) / float64(width), Y: float64(p.Y) / float64(height)}
+}
+
+// Denormalize converts the point to pixels of an image of the given size
+func (n NormalizedPoint) Denormalize(width, height int) Point {
+	return Point{X: int(math.Round(n.X * float64(width))), Y: int(math.Round(n.Y * float64(height)))}
+}
+
+// Features returns the landmarks keyed by feature name, as in face_recognition's face_landmarks
+func (fl FaceLandmarks) Features() map[string][]Point {
+	return map[string][]Point{
+		"chin":          fl.Chin,
+		"left_eyebrow":  fl.LeftEyebrow,
+		"right_eyebrow": fl.RightEyebrow,
+		"nose_bridge":   fl.NoseBridge,
+		"nose_tip":      fl.NoseTip,
+		"left_eye":      fl.LeftEye,
+		"right_eye":     fl.RightEye,
+		"top_lip":       fl.TopLip,
+		"bottom_lip":    fl.BottomLip,
+	}
+}
+
+// Features returns the landmarks keyed by feature name, as in face_recognition's face_landmarks
+func (fl FaceLandmarksSmall) Features() map[string][]Point {
+	return map[string][]Point{
+		"nose_tip":  fl.NoseTip,
+		"left_eye":  fl.LeftEye,
+		"right_eye": fl.RightEye,
+	}
+}
+
+// NormalizedFace is a Face with coordinates in fractions of the image size
+type NormalizedFace struct {
+	Rectangle NormalizedRect               `json:"rectangle"`
+	Landmarks map[string][]NormalizedPoint `json:"landmarks,omitempty"`
+	Encoding  FaceEncoding                 `json:"encoding"`
+}
+
+// NormalizedResult holds faces in normalized coordinates together with the size of the image they were found in
+type NormalizedResult struct {
+	ImageWidth  int              `json:"image_width"`
+	ImageHeight int              `json:"image_height"`
+	Faces       []NormalizedFace `json:"faces"`
+}
+
+// NormalizeFaces converts faces found in an image of the given size to normalized coordinates
+func NormalizeFaces(faces []Face, width, height int) NormalizedResult {
+	result := NormalizedResult{ImageWidth: width, ImageHeight: height, Faces: make([]NormalizedFace, len(faces))}
+	for i, f := range faces {
+		nf := NormalizedFace{
+			Rectangle: f.Rectangle.Normalize(width, height),
+			Encoding:  f.Encoding,
+		}
+
+		var features map[string][]Point
+		switch lm := f.Landmarks.(type) {
+		case FaceLandmarks:
+			features = lm.Features()
+		case FaceLandmarksSmall:
+			features = lm.Features()
+		}
+		if features != nil {
+			nf.Landmarks = make(map[string][]NormalizedPoint, len(features))
+			for name, points := range features {
+				np := make([]NormalizedPoint, len(points))
+				for j, p := range points {
+					np[j] = p.Normalize(width, height)
+				}
+				nf.Landmarks[name] = np
+			}
+		}
+
+		result.Faces[i] = nf
+	}
+	return result
+}
+
+// FaceLocationsNormalized is FaceLocations with the rectangles in normalized coordinates
+func (fr *FaceRecognizer) FaceLocationsNormalized(img *ImageMatrix, upsampleTimes int, model DetectionModel) (NormalizedResult, error) {
+	locations, err := fr.FaceLocations(img, upsampleTimes, model)
+	if err != nil {
+		return NormalizedResult{}, err
+	}
+
+	faces := make([]Face, len(locations))
+	for i, loc := range locations {
+		faces[i].Rectangle = loc
+	}
+	return NormalizeFaces(faces, img.Width, img.Height), nil
+}
+
+// FaceLandmarksNormalized is FaceLandmarks with the rectangles and landmarks in normalized coordinates
+// If faceLocations is nil, faces are detected first with the HOG model
+func (fr *FaceRecognizer) FaceLandmarksNormalized(img *ImageMatrix, faceLocations []Rectangle) (NormalizedResult, error) {
+	if faceLocations == nil {
+		var err error
+		faceLocations, err = fr.FaceLocations(img, 1, HOG)
+		if err != nil {
+			return NormalizedResult{}, err
+		}
+	}
+
+	landmarks, err := fr.FaceLandmarks(img, faceLocations)
+	if err != nil {
+		return NormalizedResult{}, err
+	}
+
+	faces := make([]Face, len(faceLocations))
+	for i, loc := range faceLocations {
+		faces[i].Rectangle = loc
+		if i < len(landmarks) {
+			faces[i].Landmarks = landmarks[i]
+		}
+	}
+	return NormalizeFaces(faces, img.Width, img.Height), nil
+}
+
+// DetectAndEncodeNormalized is DetectAndEncode with coordinates in normalized form
+func (fr *FaceRecognizer) DetectAndEncodeNormalized(img *ImageMatrix, upsampleTimes int, numJitters int) (NormalizedResult, error) {
+	faces, err := fr.DetectAndEncode(img, upsampleTimes, numJitters)
+	if err != nil {
+		return NormalizedResult{}, err
+	}
+	return NormalizeFaces(faces, img.Width, img.Height), nil
+}
@@ -0,0 +1,229 @@
+package gofacerecognition
+
+import "math"
+
+// Occlusion is something covering part of a face
+type Occlusion string
+
+const (
+	OcclusionGlasses    Occlusion = "glasses"    // clear glasses, the eyes stay visible
+	OcclusionSunglasses Occlusion = "sunglasses" // dark lenses hiding the eyes
+	OcclusionHand       Occlusion = "hand"
+	OcclusionMask       Occlusion = "mask" // a mask over the mouth and nose
+)
+
+// Occlusions lists the occlusions found on a face, empty for an unoccluded face
+type Occlusions []Occlusion
+
+// Has reports whether the occlusion was found
+func (o Occlusions) Has(kind Occlusion) bool {
+	for _, k := range o {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// occlusionSlack is how much each occlusion raises the match tolerance in AdjustTolerance
+// Occluded faces lose part of their features, so a genuine match ends up further away
+var occlusionSlack = map[Occlusion]float64{
+	OcclusionGlasses:    0.02,
+	OcclusionSunglasses: 0.05,
+	OcclusionHand:       0.04,
+	OcclusionMask:       0.06,
+}
+
+// AdjustTolerance returns the tolerance to match an occluded face with, loosened for each occlusion
+// Loosening trades false rejects for false accepts; callers with high security needs should reject
+// occluded faces instead
+func (o Occlusions) AdjustTolerance(tolerance float64) float64 {
+	for _, k := range o {
+		tolerance += occlusionSlack[k]
+	}
+	return tolerance
+}
+
+// OcclusionDetector finds occlusions on a face, e.g. with a dedicated classification model
+type OcclusionDetector interface {
+	Occlusions(img *ImageMatrix, landmarks FaceLandmarks) (Occlusions, error)
+}
+
+// OcclusionFunc adapts a function to an OcclusionDetector
+type OcclusionFunc func(img *ImageMatrix, landmarks FaceLandmarks) (Occlusions, error)
+
+// Occlusions calls f
+func (f OcclusionFunc) Occlusions(img *ImageMatrix, landmarks FaceLandmarks) (Occlusions, error) {
+	return f(img, landmarks)
+}
+
+// HeuristicOcclusions is the OcclusionDetector of DetectOcclusions
+var HeuristicOcclusions OcclusionDetector = OcclusionFunc(DetectOcclusions)
+
+// Thresholds of the occlusion heuristics; luma ratios and edge strengths are relative to the
+// forehead, so they hold across lighting and skin tones
+const (
+	sunglassesLumaRatio = 0.5  // eye regions darker than this share of the forehead
+	sunglassesMaxStd    = 25   // and this uniform, since visible eyes mix sclera, iris and lashes
+	glassesEdgeRatio    = 2.5  // horizontal edges on the nose bridge compared with the forehead
+	glassesMinEdge      = 6    // absolute bridge edge strength, so a smooth forehead does not make any bridge edge count
+	maskChromaDistance  = 0.04 // normalized red-green distance from the forehead color
+	maskMinLumaRatio    = 0.55
+	maskMaxLumaRatio    = 1.7
+	handTextureRatio    = 3    // texture of one cheek compared with the other
+	handChromaDistance  = 0.05 // the textured cheek must still look like skin
+)
+
+// DetectOcclusions looks for glasses, sunglasses, a mask or a hand with heuristics on the regions
+// around the 68-point landmarks, comparing each with the forehead as the skin reference
+// The heuristics assume an upright face and miss subtle cases: thin frameless glasses, masks of skin
+// color, or a hand covering the forehead. Beards and strong side light can be taken for a mask or hand
+func DetectOcclusions(img *ImageMatrix, landmarks FaceLandmarks) (Occlusions, error) {
+	if len(landmarks.Chin) < 17 || len(landmarks.LeftEyebrow) < 5 || len(landmarks.RightEyebrow) < 5 ||
+		len(landmarks.NoseBridge) < 4 || len(landmarks.NoseTip) < 5 || len(landmarks.LeftEye) < 6 ||
+		len(landmarks.RightEye) < 6 || len(landmarks.TopLip) < 12 || len(landmarks.BottomLip) < 12 {
+		return nil, &InvalidLandmarksError{Reason: "occlusion detection needs the 68-point model"}
+	}
+
+	eyeL, eyeR := centroid(landmarks.LeftEye), centroid(landmarks.RightEye)
+	d := math.Hypot(eyeR.x-eyeL.x, eyeR.y-eyeL.y)
+	if d < 8 {
+		return nil, &InvalidLandmarksError{Reason: "face too small for occlusion detection"}
+	}
+
+	browTop := math.Min(boundsOf(landmarks.LeftEyebrow).top, boundsOf(landmarks.RightEyebrow).top)
+	forehead := measureRegion(img, eyeL.x, browTop-0.4*d, eyeR.x, browTop-0.1*d)
+	if forehead.n == 0 || forehead.luma < 1 {
+		// Without a skin reference the comparisons mean nothing
+		return Occlusions{}, nil
+	}
+
+	var found Occlusions
+
+	// Sunglasses: both eyes dark and flat compared with the forehead
+	sunglasses := true
+	for _, eye := range [][]Point{landmarks.LeftEye, landmarks.RightEye} {
+		b := boundsOf(eye)
+		padY := math.Max(b.bottom-b.top, 0.12*d)
+		s := measureRegion(img, b.left-0.15*d, b.top-padY, b.right+0.15*d, b.bottom+padY)
+		if s.n == 0 || s.luma/forehead.luma >= sunglassesLumaRatio || s.std >= sunglassesMaxStd {
+			sunglasses = false
+		}
+	}
+
+	// Glasses: the frame bridge makes horizontal edges on the otherwise smooth top of the nose
+	inner := (landmarks.LeftEye[3].X + landmarks.RightEye[0].X) / 2
+	bridgeTop := float64(landmarks.NoseBridge[0].Y)
+	bridge := measureRegion(img, float64(inner)-0.15*d, bridgeTop-0.15*d, float64(inner)+0.15*d, float64(landmarks.NoseBridge[1].Y))
+	glasses := bridge.n > 0 && bridge.edgeY >= glassesMinEdge && bridge.edgeY >= glassesEdgeRatio*forehead.edgeY
+
+	switch {
+	case sunglasses:
+		found = append(found, OcclusionSunglasses)
+	case glasses:
+		found = append(found, OcclusionGlasses)
+	}
+
+	// Mask: the chin and both cheeks at mouth level differ from the forehead in color or brightness
+	mouthL, mouthR := landmarks.TopLip[0], landmarks.TopLip[6]
+	mouthY := float64(mouthL.Y+mouthR.Y) / 2
+	lipBottom := boundsOf(landmarks.BottomLip).bottom
+	chinY := float64(landmarks.Chin[8].Y)
+	chin := measureRegion(img, float64(mouthL.X), lipBottom+0.05*d, float64(mouthR.X), chinY-0.05*d)
+	cheekL := measureRegion(img, float64(landmarks.Chin[3].X)+0.1*d, mouthY-0.3*d, float64(mouthL.X)-0.05*d, mouthY)
+	cheekR := measureRegion(img, float64(mouthR.X)+0.05*d, mouthY-0.3*d, float64(landmarks.Chin[13].X)-0.1*d, mouthY)
+
+	unlike := func(s regionStats) bool {
+		ratio := s.luma / forehead.luma
+		return s.n > 0 && (s.chromaDistance(forehead) > maskChromaDistance || ratio < maskMinLumaRatio || ratio > maskMaxLumaRatio)
+	}
+	mask := unlike(chin) && unlike(cheekL) && unlike(cheekR)
+	if mask {
+		found = append(found, OcclusionMask)
+	}
+
+	// Hand: one cheek much more textured than the other, with finger edges, while still skin colored
+	if !mask && cheekL.n > 0 && cheekR.n > 0 {
+		busy, calm := cheekL, cheekR
+		if busy.texture() < calm.texture() {
+			busy, calm = calm, busy
+		}
+		if busy.texture() > handTextureRatio*math.Max(calm.texture(), 1) && busy.chromaDistance(forehead) <= handChromaDistance {
+			found = append(found, OcclusionHand)
+		}
+	}
+
+	if found == nil {
+		found = Occlusions{}
+	}
+	return found, nil
+}
+
+// regionStats are the brightness, color and edge statistics of an image region
+type regionStats struct {
+	n            int
+	luma, std    float64
+	r, g         float64 // normalized chromaticity, r/(r+g+b) and g/(r+g+b)
+	edgeX, edgeY float64 // mean absolute luma gradient across columns (vertical edges) and rows (horizontal edges)
+}
+
+func (s regionStats) chromaDistance(o regionStats) float64 {
+	return math.Hypot(s.r-o.r, s.g-o.g)
+}
+
+func (s regionStats) texture() float64 {
+	return s.edgeX + s.edgeY
+}
+
+// measureRegion computes the statistics of the pixels in [left, right) x [top, bottom), clipped to the image
+func measureRegion(img *ImageMatrix, left, top, right, bottom float64) regionStats {
+	x0, y0 := max(int(math.Floor(left)), 1), max(int(math.Floor(top)), 1)
+	x1, y1 := min(int(math.Ceil(right)), img.Width-1), min(int(math.Ceil(bottom)), img.Height-1)
+
+	var s regionStats
+	var sum, sq, rs, gs, ex, ey float64
+	lumaAt := func(x, y int) float64 {
+		return float64(luma(img.At(x, y)))
+	}
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			r, g, b := img.At(x, y)
+			l := float64(luma(r, g, b))
+			sum += l
+			sq += l * l
+			if total := float64(r) + float64(g) + float64(b); total > 0 {
+				rs += float64(r) / total
+				gs += float64(g) / total
+			} else {
+				rs, gs = rs+1.0/3, gs+1.0/3
+			}
+			ex += math.Abs(lumaAt(x+1, y)-lumaAt(x-1, y)) / 2
+			ey += math.Abs(lumaAt(x, y+1)-lumaAt(x, y-1)) / 2
+			s.n++
+		}
+	}
+	if s.n == 0 {
+		return s
+	}
+
+	n := float64(s.n)
+	s.luma = sum / n
+	s.std = math.Sqrt(math.Max(0, sq/n-s.luma*s.luma))
+	s.r, s.g = rs/n, gs/n
+	s.edgeX, s.edgeY = ex/n, ey/n
+	return s
+}
+
+// pointBounds is the bounding box of landmark points
+type pointBounds struct {
+	left, top, right, bottom float64
+}
+
+func boundsOf(points []Point) pointBounds {
+	b := pointBounds{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, p := range points {
+		b.left, b.right = math.Min(b.left, float64(p.X)), math.Max(b.right, float64(p.X))
+		b.top, b.bottom = math.Min(b.top, float64(p.Y)), math.Max(b.bottom, float64(p.Y))
+	}
+	return b
+}
@@ -0,0 +1,209 @@
+//go:build onnx
+
+package gofacerecognition
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// ONNXArcFaceBackend is the name NewEncoder knows the ONNX encoder by in builds with the onnx tag
+const ONNXArcFaceBackend = "onnx-arcface"
+
+// DefaultONNXEncoderModel is the model file the onnx-arcface backend loads from the models directory:
+// SFace from the OpenCV model zoo, which takes ArcFace-aligned chips and returns 128-d encodings
+const DefaultONNXEncoderModel = "face_recognition_sface_2021dec.onnx"
+
+// onnxRuntimeLibraryEnv names the onnxruntime shared library when it is not on the loader path
+const onnxRuntimeLibraryEnv = "ONNXRUNTIME_LIB"
+
+// sfaceCosineThreshold is the cosine similarity above which OpenCV's face_detect sample treats two
+// SFace encodings as the same person
+const sfaceCosineThreshold = 0.363
+
+func init() {
+	RegisterEncoderBackend(ONNXArcFaceBackend, func(fr *FaceRecognizer, modelDir string) (Encoder, error) {
+		return NewONNXEncoder(fr, ONNXEncoderConfig{ModelPath: filepath.Join(modelDir, DefaultONNXEncoderModel)})
+	})
+}
+
+// ONNXEncoderConfig configures an ONNXEncoder; zero fields take the defaults
+type ONNXEncoderConfig struct {
+	ModelPath string
+	// ModelID identifies the encodings, e.g. in FaceDB.SetModelEncodings (default "onnx_" and the
+	// model file name without extension)
+	ModelID string
+	// LibraryPath is the onnxruntime shared library (default $ONNXRUNTIME_LIB, or the loader's search path)
+	LibraryPath string
+	// Tolerance is the cosine distance below which faces match (default 1 - 0.363, OpenCV's SFace threshold)
+	Tolerance float64
+}
+
+// ONNXEncoder runs an ArcFace-style ONNX model: faces are aligned with ArcFaceChip on the 68-point
+// landmarks of a FaceRecognizer and the model must return 128 values per face, which are normalized
+// to unit length. Encodings are compared with cosine distance
+// It is safe for concurrent use, calls run one at a time
+type ONNXEncoder struct {
+	fr        *FaceRecognizer
+	modelID   string
+	tolerance float64
+
+	mu      sync.Mutex
+	session *ort.AdvancedSession
+	input   *ort.Tensor[float32]
+	output  *ort.Tensor[float32]
+}
+
+var onnxInitMu sync.Mutex
+
+// NewONNXEncoder loads the model; fr finds the landmarks the chips are aligned on
+func NewONNXEncoder(fr *FaceRecognizer, config ONNXEncoderConfig) (*ONNXEncoder, error) {
+	if fr == nil {
+		return nil, &RecognizerNotInitializedError{}
+	}
+	if _, err := os.Stat(config.ModelPath); err != nil {
+		return nil, &ModelNotFoundError{ModelName: filepath.Base(config.ModelPath), Path: config.ModelPath}
+	}
+	if config.ModelID == "" {
+		config.ModelID = "onnx_" + strings.TrimSuffix(filepath.Base(config.ModelPath), filepath.Ext(config.ModelPath))
+	}
+	if config.Tolerance <= 0 {
+		config.Tolerance = 1 - sfaceCosineThreshold
+	}
+	if config.LibraryPath == "" {
+		config.LibraryPath = os.Getenv(onnxRuntimeLibraryEnv)
+	}
+
+	onnxInitMu.Lock()
+	if !ort.IsInitialized() {
+		if config.LibraryPath != "" {
+			ort.SetSharedLibraryPath(config.LibraryPath)
+		}
+		if err := ort.InitializeEnvironment(); err != nil {
+			onnxInitMu.Unlock()
+			return nil, fmt.Errorf("failed to load onnxruntime: %w", err)
+		}
+	}
+	onnxInitMu.Unlock()
+
+	inputs, outputs, err := ort.GetInputOutputInfo(config.ModelPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", config.ModelPath, err)
+	}
+	if len(inputs) != 1 || len(outputs) != 1 {
+		return nil, fmt.Errorf("%s: want one input and one output, got %d and %d", config.ModelPath, len(inputs), len(outputs))
+	}
+	if dims := outputs[0].Dimensions; len(dims) == 0 || dims[len(dims)-1] != int64(len(FaceEncoding{})) {
+		return nil, fmt.Errorf("%s: output shape %v does not end in %d values", config.ModelPath, dims, len(FaceEncoding{}))
+	}
+
+	input, err := ort.NewEmptyTensor[float32](ort.NewShape(1, 3, ArcFaceChipSize, ArcFaceChipSize))
+	if err != nil {
+		return nil, err
+	}
+	output, err := ort.NewEmptyTensor[float32](ort.NewShape(1, int64(len(FaceEncoding{}))))
+	if err != nil {
+		input.Destroy()
+		return nil, err
+	}
+	session, err := ort.NewAdvancedSession(config.ModelPath,
+		[]string{inputs[0].Name}, []string{outputs[0].Name},
+		[]ort.Value{input}, []ort.Value{output}, nil)
+	if err != nil {
+		input.Destroy()
+		output.Destroy()
+		return nil, fmt.Errorf("%s: %w", config.ModelPath, err)
+	}
+
+	return &ONNXEncoder{
+		fr:        fr,
+		modelID:   config.ModelID,
+		tolerance: config.Tolerance,
+		session:   session,
+		input:     input,
+		output:    output,
+	}, nil
+}
+
+// ModelID implements Encoder
+func (e *ONNXEncoder) ModelID() string {
+	return e.modelID
+}
+
+// Metric implements MetricEncoder
+func (e *ONNXEncoder) Metric() DistanceMetric {
+	return Cosine
+}
+
+// Tolerance implements MetricEncoder
+func (e *ONNXEncoder) Tolerance() float64 {
+	return e.tolerance
+}
+
+// Encode implements Encoder
+func (e *ONNXEncoder) Encode(img *ImageMatrix, locations []Rectangle) ([]FaceEncoding, error) {
+	landmarks, err := e.fr.FaceLandmarks(img, locations)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.session == nil {
+		return nil, &RecognizerNotInitializedError{}
+	}
+
+	encodings := make([]FaceEncoding, len(landmarks))
+	for i, l := range landmarks {
+		if len(l.Chin) == 0 {
+			return nil, &InvalidLandmarksError{Reason: fmt.Sprintf("no landmarks for face %d", i)}
+		}
+		chip := ArcFaceChip(img, l)
+
+		// NCHW, RGB, raw 0-255 values as the model was exported
+		data := e.input.GetData()
+		plane := ArcFaceChipSize * ArcFaceChipSize
+		for y := 0; y < ArcFaceChipSize; y++ {
+			for x := 0; x < ArcFaceChipSize; x++ {
+				r, g, b := chip.At(x, y)
+				j := y*ArcFaceChipSize + x
+				data[j], data[plane+j], data[2*plane+j] = float32(r), float32(g), float32(b)
+			}
+		}
+		if err := e.session.Run(); err != nil {
+			return nil, &NativeError{Op: "onnx_encode", Message: err.Error()}
+		}
+
+		var norm float64
+		for j, v := range e.output.GetData() {
+			encodings[i][j] = float64(v)
+			norm += float64(v) * float64(v)
+		}
+		if norm = math.Sqrt(norm); norm > 0 {
+			for j := range encodings[i] {
+				encodings[i][j] /= norm
+			}
+		}
+	}
+	return encodings, nil
+}
+
+// Close releases the session, the recognizer stays open
+func (e *ONNXEncoder) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.session == nil {
+		return nil
+	}
+	err := e.session.Destroy()
+	e.input.Destroy()
+	e.output.Destroy()
+	e.session = nil
+	return err
+}
@@ -0,0 +1,146 @@
+package gofacerecognition
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// OpenSetPoint is one operating point of an open-set identification evaluation
+type OpenSetPoint struct {
+	FAR       float64 // target false alarm rate: fraction of non-mated probes accepted as someone
+	Threshold float64 // distance threshold that achieves FAR on the non-mated probes
+	DIR       float64 // detection and identification rate: mated probes identified correctly within Threshold
+}
+
+// OpenSetReport summarizes an open-set identification evaluation
+type OpenSetReport struct {
+	MatedProbes    int
+	NonMatedProbes int
+	Rank1          float64 // closed-set rank-1 accuracy over the mated probes, ignoring thresholds
+	Points         []OpenSetPoint
+}
+
+// EvaluateOpenSet measures DIR@FAR for probes against a gallery
+// A probe is mated when its Name appears in the gallery; every other probe is an impostor that should be rejected
+// fars lists the false alarm rates to report, e.g. 0.001, 0.01 and 0.1
+func EvaluateOpenSet(gallery, probes []NamedEncoding, fars []float64) OpenSetReport {
+	enrolled := make(map[string]bool, len(gallery))
+	for _, g := range gallery {
+		enrolled[g.Name] = true
+	}
+
+	var report OpenSetReport
+	var matedCorrect []float64 // top-1 distance of mated probes whose top-1 identity is correct
+	var nonMated []float64     // top-1 distance of non-mated probes
+
+	for _, probe := range probes {
+		name, dist := closestIdentity(gallery, probe.Encoding)
+		if enrolled[probe.Name] {
+			report.MatedProbes++
+			if name == probe.Name {
+				matedCorrect = append(matedCorrect, dist)
+			}
+		} else {
+			report.NonMatedProbes++
+			nonMated = append(nonMated, dist)
+		}
+	}
+
+	if report.MatedProbes > 0 {
+		report.Rank1 = float64(len(matedCorrect)) / float64(report.MatedProbes)
+	}
+
+	sort.Float64s(nonMated)
+	for _, far := range fars {
+		point := OpenSetPoint{FAR: far, Threshold: thresholdAtFAR(nonMated, far)}
+		if report.MatedProbes > 0 {
+			hits := 0
+			for _, d := range matedCorrect {
+				if d <= point.Threshold {
+					hits++
+				}
+			}
+			point.DIR = float64(hits) / float64(report.MatedProbes)
+		}
+		report.Points = append(report.Points, point)
+	}
+
+	return report
+}
+
+// UnknownRejector decides whether the closest gallery match of a probe is a known person or a stranger
+// Its threshold is calibrated on impostors so that a chosen fraction of strangers is wrongly accepted
+type UnknownRejector struct {
+	Threshold float64 // distances above this are unknown
+	TargetFAR float64
+	Impostors int // number of impostor probes used for calibration
+}
+
+// CalibrateUnknownRejector picks the threshold at which targetFAR of the impostors would match someone in the gallery
+// Impostors must be held out: people who are not enrolled and were not used to tune anything else
+func CalibrateUnknownRejector(gallery []FaceEncoding, impostors []FaceEncoding, targetFAR float64) (*UnknownRejector, error) {
+	if len(gallery) == 0 {
+		return nil, fmt.Errorf("calibrating unknown rejector: empty gallery")
+	}
+	if len(impostors) == 0 {
+		return nil, fmt.Errorf("calibrating unknown rejector: no impostor encodings")
+	}
+	if targetFAR <= 0 || targetFAR >= 1 {
+		return nil, fmt.Errorf("calibrating unknown rejector: target FAR must be between 0 and 1, got %v", targetFAR)
+	}
+
+	scores := make([]float64, len(impostors))
+	for i, imp := range impostors {
+		scores[i] = math.Inf(1)
+		for _, d := range FaceDistances(gallery, imp) {
+			scores[i] = math.Min(scores[i], d)
+		}
+	}
+	sort.Float64s(scores)
+
+	return &UnknownRejector{
+		Threshold: thresholdAtFAR(scores, targetFAR),
+		TargetFAR: targetFAR,
+		Impostors: len(impostors),
+	}, nil
+}
+
+// IsUnknown reports whether a probe whose closest gallery distance is distance should be treated as a stranger
+func (r *UnknownRejector) IsUnknown(distance float64) bool {
+	return distance > r.Threshold
+}
+
+// Search looks a probe up in a FaceDB using the calibrated threshold as tolerance
+// An empty result means the probe is unknown
+func (r *UnknownRejector) Search(db *FaceDB, probe FaceEncoding) []PersonMatch {
+	return db.Search(probe, r.Threshold)
+}
+
+// closestIdentity returns the gallery identity with the smallest distance to probe
+func closestIdentity(gallery []NamedEncoding, probe FaceEncoding) (string, float64) {
+	name, best := "", math.Inf(1)
+	for _, g := range gallery {
+		if d := FaceDistance(g.Encoding, probe); d < best {
+			name, best = g.Name, d
+		}
+	}
+	return name, best
+}
+
+// thresholdAtFAR returns the largest threshold that accepts at most far of the sorted impostor scores
+func thresholdAtFAR(sorted []float64, far float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	accepted := int(math.Floor(far * float64(len(sorted))))
+	if accepted <= 0 {
+		// Just below the closest impostor
+		return math.Nextafter(sorted[0], math.Inf(-1))
+	}
+	if accepted >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	// Halfway between the last accepted and the first rejected impostor
+	return (sorted[accepted-1] + sorted[accepted]) / 2
+}
@@ -0,0 +1,233 @@
+package gofacerecognition
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// EXIF orientation values, see ExifOrientation
+const (
+	OrientationNormal     = 1
+	OrientationFlipH      = 2
+	OrientationRotate180  = 3
+	OrientationFlipV      = 4
+	OrientationTranspose  = 5
+	OrientationRotate90   = 6 // stored rotated, needs a 90 degree clockwise turn to display upright
+	OrientationTransverse = 7
+	OrientationRotate270  = 8
+)
+
+// ExifOrientation returns the EXIF orientation tag of an encoded JPEG, or OrientationNormal when it has none
+// Phone cameras store pixels in sensor order and rely on this tag, so detection misses faces unless it is applied
+func ExifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return OrientationNormal
+	}
+
+	// Walk the JPEG markers up to the image data looking for the APP1 Exif segment
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return OrientationNormal
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			pos++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			return OrientationNormal
+		}
+		size := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if size < 2 || pos+2+size > len(data) {
+			return OrientationNormal
+		}
+		segment := data[pos+4 : pos+2+size]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+		pos += 2 + size
+	}
+	return OrientationNormal
+}
+
+// tiffOrientation reads tag 0x0112 from the first IFD of a TIFF structure
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return OrientationNormal
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return OrientationNormal
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return OrientationNormal
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return OrientationNormal
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) != 0x0112 {
+			continue
+		}
+		if order.Uint16(tiff[entry+2:]) != 3 { // SHORT
+			break
+		}
+		o := int(order.Uint16(tiff[entry+8:]))
+		if o < OrientationNormal || o > OrientationRotate270 {
+			break
+		}
+		return o
+	}
+	return OrientationNormal
+}
+
+// ApplyOrientation returns the image turned upright according to an EXIF orientation value
+// Unknown values and OrientationNormal return the receiver unchanged
+func (im *ImageMatrix) ApplyOrientation(orientation int) *ImageMatrix {
+	switch orientation {
+	case OrientationFlipH:
+		return im.FlipHorizontal()
+	case OrientationRotate180:
+		return im.Rotate180()
+	case OrientationFlipV:
+		return im.FlipVertical()
+	case OrientationTranspose:
+		return im.Rotate90().FlipHorizontal()
+	case OrientationRotate90:
+		return im.Rotate90()
+	case OrientationTransverse:
+		return im.Rotate90().FlipVertical()
+	case OrientationRotate270:
+		return im.Rotate270()
+	}
+	return im
+}
+
+// Rotate90 returns a copy of the image rotated 90 degrees clockwise
+func (im *ImageMatrix) Rotate90() *ImageMatrix {
+	return im.remap(im.Height, im.Width, func(x, y int) (int, int) {
+		return y, im.Height - 1 - x
+	})
+}
+
+// Rotate180 returns a copy of the image rotated 180 degrees
+func (im *ImageMatrix) Rotate180() *ImageMatrix {
+	return im.remap(im.Width, im.Height, func(x, y int) (int, int) {
+		return im.Width - 1 - x, im.Height - 1 - y
+	})
+}
+
+// Rotate270 returns a copy of the image rotated 270 degrees clockwise (90 degrees counterclockwise)
+func (im *ImageMatrix) Rotate270() *ImageMatrix {
+	return im.remap(im.Height, im.Width, func(x, y int) (int, int) {
+		return im.Width - 1 - y, x
+	})
+}
+
+// FlipHorizontal returns a mirrored copy of the image
+func (im *ImageMatrix) FlipHorizontal() *ImageMatrix {
+	return im.remap(im.Width, im.Height, func(x, y int) (int, int) {
+		return im.Width - 1 - x, y
+	})
+}
+
+// FlipVertical returns an upside-down copy of the image
+func (im *ImageMatrix) FlipVertical() *ImageMatrix {
+	return im.remap(im.Width, im.Height, func(x, y int) (int, int) {
+		return x, im.Height - 1 - y
+	})
+}
+
+// RotateByAngle returns a copy of the image rotated clockwise by degrees around its center
+// The canvas grows to fit the rotated image and uncovered areas are black; multiples of 90 degrees are exact
+func (im *ImageMatrix) RotateByAngle(degrees float64) *ImageMatrix {
+	d := math.Mod(degrees, 360)
+	if d < 0 {
+		d += 360
+	}
+	switch d {
+	case 0:
+		return im.remap(im.Width, im.Height, func(x, y int) (int, int) { return x, y })
+	case 90:
+		return im.Rotate90()
+	case 180:
+		return im.Rotate180()
+	case 270:
+		return im.Rotate270()
+	}
+
+	rad := d * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+	w, h := float64(im.Width), float64(im.Height)
+	outW := int(math.Ceil(math.Abs(w*cos) + math.Abs(h*sin)))
+	outH := int(math.Ceil(math.Abs(w*sin) + math.Abs(h*cos)))
+	out := im.newLike(outW, outH)
+
+	cx, cy := w/2, h/2
+	ocx, ocy := float64(outW)/2, float64(outH)/2
+	for y := 0; y < outH; y++ {
+		for x := 0; x < outW; x++ {
+			// Inverse rotation of the destination pixel center gives the source position
+			dx, dy := float64(x)+0.5-ocx, float64(y)+0.5-ocy
+			sx := dx*cos + dy*sin + cx - 0.5
+			sy := -dx*sin + dy*cos + cy - 0.5
+			if sx < -0.5 || sy < -0.5 || sx > w-0.5 || sy > h-0.5 {
+				continue
+			}
+			r, g, b := im.bilinear(sx, sy)
+			out.Set(x, y, r, g, b)
+		}
+	}
+	return out
+}
+
+// remap builds a width x height image whose pixel (x, y) is taken from src(x, y) of the receiver
+func (im *ImageMatrix) remap(width, height int, src func(x, y int) (int, int)) *ImageMatrix {
+	out := im.newLike(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b := im.At(src(x, y))
+			out.Set(x, y, r, g, b)
+		}
+	}
+	return out
+}
+
+// bilinear samples the image at a fractional position, clamping to the edges
+func (im *ImageMatrix) bilinear(fx, fy float64) (byte, byte, byte) {
+	fx = math.Max(0, math.Min(fx, float64(im.Width-1)))
+	fy = math.Max(0, math.Min(fy, float64(im.Height-1)))
+	x0, y0 := int(fx), int(fy)
+	x1, y1 := min(x0+1, im.Width-1), min(y0+1, im.Height-1)
+	wx, wy := fx-float64(x0), fy-float64(y0)
+
+	bpp := im.bytesPerPixel()
+	var px [3]byte
+	for c := 0; c < bpp; c++ {
+		p00 := float64(im.Pixels[y0*im.Stride+x0*bpp+c])
+		p10 := float64(im.Pixels[y0*im.Stride+x1*bpp+c])
+		p01 := float64(im.Pixels[y1*im.Stride+x0*bpp+c])
+		p11 := float64(im.Pixels[y1*im.Stride+x1*bpp+c])
+		top := p00 + (p10-p00)*wx
+		bottom := p01 + (p11-p01)*wx
+		px[c] = byte(top + (bottom-top)*wy + 0.5)
+	}
+	if bpp == 1 {
+		return px[0], px[0], px[0]
+	}
+	return px[0], px[1], px[2]
+}
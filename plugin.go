@@ -0,0 +1,337 @@
+package gofacerecognition
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"plugin"
+	"sync"
+	"time"
+)
+
+// Plugin extends a pipeline without forking the package
+// A plugin implements one or more of EventSink, FrameTransform and DecisionHook
+type Plugin interface {
+	Name() string
+}
+
+// FaceEvent is a face seen by a pipeline, as passed to DecisionHook and EventSink plugins
+type FaceEvent struct {
+	Time       time.Time    `json:"time"`
+	CameraID   string       `json:"camera_id,omitempty"`
+	FrameIndex int          `json:"frame_index"`
+	FaceIndex  int          `json:"face_index"`
+	TrackID    string       `json:"track_id,omitempty"` // set when VideoConfig.Tracking is
+	Rectangle  Rectangle    `json:"rectangle"`
+	PersonID   string       `json:"person_id,omitempty"` // empty when the face is unknown
+	Name       string       `json:"name,omitempty"`
+	Distance   float64      `json:"distance,omitempty"`
+	Encoding   FaceEncoding `json:"encoding"`
+	// Quality is the QualityReport.Score of the face against DefaultQualityThresholds, without the
+	// pose and occlusion checks, which need landmarks the pipeline does not compute
+	Quality  float64 `json:"quality"`
+	Decision string  `json:"decision,omitempty"` // set by decision hooks, e.g. "allow" or "alert"
+}
+
+// EventSink receives every face that passed the decision hooks, e.g. to forward it to a queue or an alarm
+type EventSink interface {
+	Plugin
+	HandleEvent(ev FaceEvent) error
+}
+
+// FrameTransform preprocesses frames before detection
+type FrameTransform interface {
+	Plugin
+	TransformFrame(img *ImageMatrix) (*ImageMatrix, error)
+}
+
+// DecisionHook can rewrite an event, e.g. to apply site-specific access rules, or drop it by returning false
+type DecisionHook interface {
+	Plugin
+	Decide(ev *FaceEvent) (bool, error)
+}
+
+// GoPluginSymbol is the symbol LoadPlugin looks up in Go plugins built with -buildmode=plugin
+// It must be a func() (gofacerecognition.Plugin, error)
+const GoPluginSymbol = "NewPlugin"
+
+// LoadPlugin loads a plugin from path
+// Files ending in .so are opened as Go plugins and must export GoPluginSymbol; they have to be built
+// with the same Go version and package versions as the host. Anything else is started as a subprocess
+// plugin, which may be written in any language, see ProcessPlugin
+func LoadPlugin(path string, args ...string) (Plugin, error) {
+	if filepath.Ext(path) != ".so" {
+		return StartProcessPlugin(path, args...)
+	}
+
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open plugin %s: %w", path, err)
+	}
+	sym, err := p.Lookup(GoPluginSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", path, err)
+	}
+	newPlugin, ok := sym.(func() (Plugin, error))
+	if !ok {
+		return nil, fmt.Errorf("plugin %s: %s has type %T, want func() (gofacerecognition.Plugin, error)", path, GoPluginSymbol, sym)
+	}
+	return newPlugin()
+}
+
+// Flusher is implemented by plugins that buffer output, Flush makes everything handled so far durable
+type Flusher interface {
+	Flush() error
+}
+
+// FlushPlugins flushes every plugin that implements Flusher
+func FlushPlugins(plugins []Plugin) error {
+	var errs []error
+	for _, p := range plugins {
+		if f, ok := p.(Flusher); ok {
+			if err := f.Flush(); err != nil {
+				errs = append(errs, fmt.Errorf("plugin %s: %w", p.Name(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ClosePlugins closes every plugin that implements io.Closer
+func ClosePlugins(plugins []Plugin) error {
+	var errs []error
+	for _, p := range plugins {
+		if c, ok := p.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("plugin %s: %w", p.Name(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// applyTransforms runs the FrameTransform plugins in order, recording each as a stage of timings
+func applyTransforms(plugins []Plugin, img *ImageMatrix, timings *StageTimings) (*ImageMatrix, error) {
+	for _, p := range plugins {
+		t, ok := p.(FrameTransform)
+		if !ok {
+			continue
+		}
+		start := time.Now()
+		out, err := t.TransformFrame(img)
+		timings.Since(pluginStage(p, pluginOpTransform), start)
+		if err != nil {
+			return img, fmt.Errorf("plugin %s: %w", p.Name(), err)
+		}
+		if out != nil {
+			img = out
+		}
+	}
+	return img, nil
+}
+
+// dispatchEvent runs the decision hooks on ev and hands it to the sinks unless a hook dropped it
+// It reports whether the event was kept; sink errors do not drop the event. Every hook and sink call
+// is recorded as a stage of timings
+func dispatchEvent(plugins []Plugin, ev *FaceEvent, timings *StageTimings) (bool, error) {
+	for _, p := range plugins {
+		h, ok := p.(DecisionHook)
+		if !ok {
+			continue
+		}
+		start := time.Now()
+		keep, err := h.Decide(ev)
+		timings.Since(pluginStage(p, pluginOpDecide), start)
+		if err != nil {
+			return true, fmt.Errorf("plugin %s: %w", p.Name(), err)
+		}
+		if !keep {
+			return false, nil
+		}
+	}
+
+	var errs []error
+	for _, p := range plugins {
+		if s, ok := p.(EventSink); ok {
+			start := time.Now()
+			err := s.HandleEvent(*ev)
+			timings.Since(pluginStage(p, pluginOpEvent), start)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("plugin %s: %w", p.Name(), err))
+			}
+		}
+	}
+	return true, errors.Join(errs...)
+}
+
+// pluginStage names the stage of a plugin call in StageTimings, e.g. "plugin:blur:transform"
+func pluginStage(p Plugin, op string) string {
+	return "plugin:" + p.Name() + ":" + op
+}
+
+// Subprocess plugin operations
+const (
+	pluginOpHello     = "hello"
+	pluginOpTransform = "transform"
+	pluginOpDecide    = "decide"
+	pluginOpEvent     = "event"
+)
+
+// pluginMessage is one line of the subprocess plugin protocol, in either direction
+type pluginMessage struct {
+	Op           string       `json:"op,omitempty"`
+	Name         string       `json:"name,omitempty"`
+	Capabilities []string     `json:"capabilities,omitempty"`
+	Image        *ImageMatrix `json:"image,omitempty"`
+	Event        *FaceEvent   `json:"event,omitempty"`
+	Keep         *bool        `json:"keep,omitempty"`
+	Error        string       `json:"error,omitempty"`
+}
+
+// ProcessPlugin is a plugin running as a child process that exchanges JSON lines over stdin and stdout
+//
+// The host first sends {"op":"hello"}; the plugin answers with its name and the capabilities it
+// implements, any of "transform", "decide" and "event". Afterwards the host sends one request per line
+// and waits for one response line:
+//
+//	{"op":"transform","image":{...}}  ->  {"image":{...}}  (Pixels are base64 RGB rows, Stride bytes apart)
+//	{"op":"decide","event":{...}}     ->  {"keep":true,"event":{...}}  (event may be omitted when unchanged)
+//	{"op":"event","event":{...}}      ->  {}
+//
+// A response with a non-empty "error" fails the request. Closing stdin asks the plugin to exit
+type ProcessPlugin struct {
+	name         string
+	capabilities map[string]bool
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	enc    *json.Encoder
+	dec    *json.Decoder
+	closed bool
+}
+
+// StartProcessPlugin starts a subprocess plugin and performs the handshake
+func StartProcessPlugin(path string, args ...string) (*ProcessPlugin, error) {
+	cmd := exec.Command(path, args...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin %s: %w", path, err)
+	}
+
+	pp := &ProcessPlugin{
+		name:         filepath.Base(path),
+		capabilities: make(map[string]bool),
+		cmd:          cmd,
+		stdin:        stdin,
+		enc:          json.NewEncoder(stdin),
+		dec:          json.NewDecoder(bufio.NewReader(stdout)),
+	}
+
+	resp, err := pp.call(pluginMessage{Op: pluginOpHello})
+	if err != nil {
+		pp.Close()
+		return nil, fmt.Errorf("plugin %s handshake: %w", path, err)
+	}
+	if resp.Name != "" {
+		pp.name = resp.Name
+	}
+	for _, c := range resp.Capabilities {
+		pp.capabilities[c] = true
+	}
+	return pp, nil
+}
+
+// Name returns the name announced by the plugin, or its file name
+func (pp *ProcessPlugin) Name() string {
+	return pp.name
+}
+
+// TransformFrame sends the frame to the plugin, frames pass unchanged when it has no "transform" capability
+func (pp *ProcessPlugin) TransformFrame(img *ImageMatrix) (*ImageMatrix, error) {
+	if !pp.capabilities[pluginOpTransform] {
+		return img, nil
+	}
+	resp, err := pp.call(pluginMessage{Op: pluginOpTransform, Image: img})
+	if err != nil {
+		return img, err
+	}
+	if resp.Image == nil {
+		return img, nil
+	}
+	if resp.Image.Stride < resp.Image.Width*resp.Image.bytesPerPixel() || len(resp.Image.Pixels) < resp.Image.Height*resp.Image.Stride {
+		return img, fmt.Errorf("returned a malformed %dx%d image", resp.Image.Width, resp.Image.Height)
+	}
+	return resp.Image, nil
+}
+
+// Decide asks the plugin whether to keep ev, events are kept when it has no "decide" capability
+func (pp *ProcessPlugin) Decide(ev *FaceEvent) (bool, error) {
+	if !pp.capabilities[pluginOpDecide] {
+		return true, nil
+	}
+	resp, err := pp.call(pluginMessage{Op: pluginOpDecide, Event: ev})
+	if err != nil {
+		return true, err
+	}
+	if resp.Event != nil {
+		*ev = *resp.Event
+	}
+	return resp.Keep == nil || *resp.Keep, nil
+}
+
+// HandleEvent forwards ev to the plugin when it has the "event" capability
+func (pp *ProcessPlugin) HandleEvent(ev FaceEvent) error {
+	if !pp.capabilities[pluginOpEvent] {
+		return nil
+	}
+	_, err := pp.call(pluginMessage{Op: pluginOpEvent, Event: &ev})
+	return err
+}
+
+// Close closes the plugin's stdin and waits for it to exit
+func (pp *ProcessPlugin) Close() error {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+
+	if pp.closed {
+		return nil
+	}
+	pp.closed = true
+	pp.stdin.Close()
+	return pp.cmd.Wait()
+}
+
+func (pp *ProcessPlugin) call(req pluginMessage) (pluginMessage, error) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+
+	var resp pluginMessage
+	if pp.closed {
+		return resp, errors.New("plugin closed")
+	}
+	if err := pp.enc.Encode(req); err != nil {
+		return resp, err
+	}
+	if err := pp.dec.Decode(&resp); err != nil {
+		return resp, err
+	}
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
@@ -0,0 +1,174 @@
+package gofacerecognition
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// RecognizerPool manages several FaceRecognizer instances so calls can run in parallel
+// Each recognizer loads its own copy of the models
+type RecognizerPool struct {
+	recognizers []*FaceRecognizer
+	free        chan *FaceRecognizer
+	done        chan struct{} // closed by Close and Shutdown, wakes callers waiting in Acquire
+	metrics     Metrics
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewRecognizerPool creates size recognizers from config (default runtime.NumCPU())
+func NewRecognizerPool(config Config, size int) (*RecognizerPool, error) {
+	if size <= 0 {
+		size = runtime.NumCPU()
+	}
+
+	pool := &RecognizerPool{
+		recognizers: make([]*FaceRecognizer, 0, size),
+		free:        make(chan *FaceRecognizer, size),
+		done:        make(chan struct{}),
+		metrics:     config.Metrics,
+	}
+	if pool.metrics == nil {
+		pool.metrics = noMetrics{}
+	}
+
+	for i := 0; i < size; i++ {
+		fr, err := NewFaceRecognizer(config)
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+		pool.recognizers = append(pool.recognizers, fr)
+		pool.free <- fr
+	}
+
+	pool.metrics.SetPoolUtilization(0, size)
+	return pool, nil
+}
+
+// Size returns the number of recognizers in the pool
+func (p *RecognizerPool) Size() int {
+	return len(p.recognizers)
+}
+
+// InUse returns the number of recognizers currently acquired
+func (p *RecognizerPool) InUse() int {
+	return len(p.recognizers) - len(p.free)
+}
+
+// Acquire waits for a free recognizer; it must be returned with Release
+func (p *RecognizerPool) Acquire(ctx context.Context) (*FaceRecognizer, error) {
+	p.mu.RLock()
+	closed := p.closed
+	p.mu.RUnlock()
+	if closed {
+		return nil, &RecognizerNotInitializedError{}
+	}
+
+	select {
+	case fr := <-p.free:
+		return p.checkOut(fr)
+	case <-p.done:
+		return nil, &RecognizerNotInitializedError{}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// TryAcquire is Acquire without waiting, it returns a *BusyError when every recognizer is in use
+func (p *RecognizerPool) TryAcquire() (*FaceRecognizer, error) {
+	p.mu.RLock()
+	closed := p.closed
+	p.mu.RUnlock()
+	if closed {
+		return nil, &RecognizerNotInitializedError{}
+	}
+
+	select {
+	case fr := <-p.free:
+		return p.checkOut(fr)
+	default:
+		return nil, &BusyError{}
+	}
+}
+
+// checkOut hands out a recognizer taken from the free list, unless the pool was closed meanwhile
+func (p *RecognizerPool) checkOut(fr *FaceRecognizer) (*FaceRecognizer, error) {
+	p.mu.RLock()
+	closed := p.closed
+	p.mu.RUnlock()
+	if closed {
+		p.free <- fr
+		return nil, &RecognizerNotInitializedError{}
+	}
+	p.metrics.SetPoolUtilization(p.InUse(), p.Size())
+	return fr, nil
+}
+
+// Release returns a recognizer obtained from Acquire
+func (p *RecognizerPool) Release(fr *FaceRecognizer) {
+	p.free <- fr
+	p.metrics.SetPoolUtilization(p.InUse(), p.Size())
+}
+
+// WithRecognizer runs fn with a recognizer from the pool and releases it afterwards
+func (p *RecognizerPool) WithRecognizer(ctx context.Context, fn func(fr *FaceRecognizer) error) error {
+	fr, err := p.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.Release(fr)
+
+	return fn(fr)
+}
+
+// Close releases every recognizer; recognizers still acquired are closed too and fail further calls
+// Use Shutdown to let them finish their work first
+func (p *RecognizerPool) Close() {
+	if !p.stopIntake() {
+		return
+	}
+	for _, fr := range p.recognizers {
+		fr.Close()
+	}
+}
+
+// Shutdown stops handing out recognizers, waits until the acquired ones are released and closes all of them
+// Recognizers still acquired when ctx is done are closed anyway, which waits for the call they are
+// running to return, and ctx.Err() is returned
+func (p *RecognizerPool) Shutdown(ctx context.Context) error {
+	if !p.stopIntake() {
+		return nil
+	}
+
+	var err error
+	for returned := 0; returned < len(p.recognizers) && err == nil; {
+		select {
+		case fr := <-p.free:
+			fr.Close()
+			returned++
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	for _, fr := range p.recognizers {
+		fr.Close()
+	}
+	return err
+}
+
+// stopIntake marks the pool closed, it returns false if it already was
+func (p *RecognizerPool) stopIntake() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return false
+	}
+	p.closed = true
+	close(p.done)
+	return true
+}
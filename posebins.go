@@ -0,0 +1,140 @@
+package gofacerecognition
+
+import "math"
+
+// PoseBin is a range of head poses that enrollment should capture at least once
+// Galleries holding several poses match faces seen at an angle much better than frontal-only ones
+type PoseBin string
+
+const (
+	PoseFrontal PoseBin = "frontal"
+	PoseLeft    PoseBin = "left"  // head turned to the person's left
+	PoseRight   PoseBin = "right" // head turned to the person's right
+	PoseUp      PoseBin = "up"
+	PoseDown    PoseBin = "down"
+)
+
+// AllPoseBins lists every pose bin
+var AllPoseBins = []PoseBin{PoseFrontal, PoseLeft, PoseRight, PoseUp, PoseDown}
+
+// poseInstructions tell users how to fill each bin
+var poseInstructions = map[PoseBin]string{
+	PoseFrontal: "look straight at the camera",
+	PoseLeft:    "turn your head to your left",
+	PoseRight:   "turn your head to your right",
+	PoseUp:      "tilt your head up",
+	PoseDown:    "tilt your head down",
+}
+
+// PoseBinConfig holds the angles separating the pose bins, in degrees
+type PoseBinConfig struct {
+	FrontalLimit   float64 // largest yaw and pitch of a frontal pose (default 10)
+	YawThreshold   float64 // yaw needed for the left and right bins (default 20)
+	PitchThreshold float64 // pitch needed for the up and down bins (default 15)
+	// MaxAngle is the largest yaw or pitch accepted; beyond it the landmarks, and so the encodings,
+	// are unreliable (default 45)
+	MaxAngle float64
+}
+
+func (c PoseBinConfig) withDefaults() PoseBinConfig {
+	if c.FrontalLimit <= 0 {
+		c.FrontalLimit = 10
+	}
+	if c.YawThreshold <= 0 {
+		c.YawThreshold = 20
+	}
+	if c.PitchThreshold <= 0 {
+		c.PitchThreshold = 15
+	}
+	if c.MaxAngle <= 0 {
+		c.MaxAngle = 45
+	}
+	return c
+}
+
+// ClassifyPose returns the bin of a head pose, false for poses between bins or beyond MaxAngle
+// A pose turned both sideways and up or down goes to the axis where it is furthest past its threshold
+func (c PoseBinConfig) ClassifyPose(pose HeadPose) (PoseBin, bool) {
+	c = c.withDefaults()
+	yaw, pitch := math.Abs(pose.Yaw), math.Abs(pose.Pitch)
+
+	switch {
+	case math.IsNaN(pose.Yaw) || math.IsNaN(pose.Pitch) || yaw > c.MaxAngle || pitch > c.MaxAngle:
+		return "", false
+	case yaw <= c.FrontalLimit && pitch <= c.FrontalLimit:
+		return PoseFrontal, true
+	case yaw >= c.YawThreshold && yaw/c.YawThreshold >= pitch/c.PitchThreshold:
+		if pose.Yaw > 0 {
+			return PoseLeft, true
+		}
+		return PoseRight, true
+	case pitch >= c.PitchThreshold:
+		if pose.Pitch > 0 {
+			return PoseUp, true
+		}
+		return PoseDown, true
+	}
+	return "", false
+}
+
+// PoseCoverage tracks which pose bins of a person have been captured during enrollment
+// It is not safe for concurrent use
+type PoseCoverage struct {
+	config PoseBinConfig
+	counts map[PoseBin]int
+}
+
+// PoseCoverageReport lists the captured and missing pose bins, in the order of AllPoseBins
+type PoseCoverageReport struct {
+	Counts   map[PoseBin]int `json:"counts"`
+	Captured []PoseBin       `json:"captured"`
+	Missing  []PoseBin       `json:"missing"`
+	// Hint asks for the first missing pose, empty once every bin is captured
+	Hint string `json:"hint,omitempty"`
+}
+
+// NewPoseCoverage creates an empty coverage with the given bin angles
+func NewPoseCoverage(config PoseBinConfig) *PoseCoverage {
+	return &PoseCoverage{config: config.withDefaults(), counts: make(map[PoseBin]int)}
+}
+
+// Add records a captured pose and returns its bin, false when it falls in no bin
+func (c *PoseCoverage) Add(pose HeadPose) (PoseBin, bool) {
+	bin, ok := c.config.ClassifyPose(pose)
+	if ok {
+		c.counts[bin]++
+	}
+	return bin, ok
+}
+
+// Count returns the number of poses captured in a bin
+func (c *PoseCoverage) Count(bin PoseBin) int {
+	return c.counts[bin]
+}
+
+// Complete reports whether every bin has been captured
+func (c *PoseCoverage) Complete() bool {
+	for _, bin := range AllPoseBins {
+		if c.counts[bin] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Report returns the captured and missing bins
+func (c *PoseCoverage) Report() PoseCoverageReport {
+	report := PoseCoverageReport{Counts: make(map[PoseBin]int), Captured: []PoseBin{}, Missing: []PoseBin{}}
+	for _, bin := range AllPoseBins {
+		report.Counts[bin] = c.counts[bin]
+		if c.counts[bin] > 0 {
+			report.Captured = append(report.Captured, bin)
+		} else {
+			report.Missing = append(report.Missing, bin)
+		}
+	}
+	if len(report.Missing) > 0 {
+		report.Hint = poseInstructions[report.Missing[0]]
+	}
+	return report
+}
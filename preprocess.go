@@ -0,0 +1,146 @@
+package gofacerecognition
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Preprocessing is a chain of image corrections run before detection, set with Config.Preprocessing
+// so deployment-specific tuning, e.g. for dark CCTV footage, lives in the configuration instead of
+// in every caller. The steps run in the order of the fields; zero fields are skipped
+type Preprocessing struct {
+	// MaxDimension scales images down so their longer side is at most this many pixels; faces found
+	// are mapped back to the coordinates of the original image
+	MaxDimension  int
+	Equalize      bool    // EqualizeHistogram
+	Gamma         float64 // AdjustGamma with this gamma, values below 1 brighten
+	AutoGamma     bool    // AutoGamma, instead of Gamma
+	DenoiseRadius int     // MedianFilter with this radius, 1 removes most sensor noise
+	// Steps run last, in order; they must return an image of the size they were given
+	Steps []func(*ImageMatrix) *ImageMatrix
+}
+
+// Apply runs the chain on img and returns the result with the factor to multiply coordinates on the
+// result with to get coordinates on img
+func (p *Preprocessing) Apply(img *ImageMatrix) (*ImageMatrix, float64) {
+	scale := 1.0
+	if p == nil {
+		return img, scale
+	}
+
+	if p.MaxDimension > 0 {
+		scaled := img.ResizeMaxDim(p.MaxDimension)
+		scale = float64(img.Width) / float64(scaled.Width)
+		img = scaled
+	}
+	if p.Equalize {
+		img = img.EqualizeHistogram()
+	}
+	switch {
+	case p.AutoGamma:
+		img = img.AutoGamma()
+	case p.Gamma > 0 && p.Gamma != 1:
+		img = img.AdjustGamma(p.Gamma)
+	}
+	if p.DenoiseRadius > 0 {
+		img = img.MedianFilter(p.DenoiseRadius)
+	}
+	for _, step := range p.Steps {
+		img = step(img)
+	}
+	return img, scale
+}
+
+// validate reports settings Apply would skip or that would make detection pointlessly slow
+func (p *Preprocessing) validate(problems *configProblems) {
+	problems.checkNonNegative("Preprocessing.MaxDimension", int64(p.MaxDimension), "use 0 to keep the image size")
+	if p.MaxDimension > 0 && p.MaxDimension < 160 {
+		problems.add("Preprocessing.MaxDimension", fmt.Sprintf("%d leaves faces too small to detect", p.MaxDimension), "use 640 or more")
+	}
+	if p.Gamma < 0 {
+		problems.add("Preprocessing.Gamma", fmt.Sprintf("%v is not a positive gamma", p.Gamma), "use 0.5 to 0.8 to brighten dark footage, or 0 to skip")
+	}
+	if p.DenoiseRadius < 0 || p.DenoiseRadius > 3 {
+		problems.add("Preprocessing.DenoiseRadius", fmt.Sprintf("%d is outside 0 to 3", p.DenoiseRadius), "use 1, larger radii blur facial features")
+	}
+	for i, step := range p.Steps {
+		if step == nil {
+			problems.add("Preprocessing.Steps", fmt.Sprintf("step %d is nil", i), "remove it from the list")
+		}
+	}
+}
+
+// MedianFilter returns a copy of the image with each channel replaced by the median of the
+// (2*radius+1)^2 neighbourhood, removing salt-and-pepper and sensor noise while keeping edges
+func (im *ImageMatrix) MedianFilter(radius int) *ImageMatrix {
+	if radius <= 0 {
+		return im.mapChannels(identityLUT())
+	}
+
+	out := im.newLike(im.Width, im.Height)
+	window := make([][]byte, 3)
+	for c := range window {
+		window[c] = make([]byte, 0, (2*radius+1)*(2*radius+1))
+	}
+	for y := 0; y < im.Height; y++ {
+		for x := 0; x < im.Width; x++ {
+			for c := range window {
+				window[c] = window[c][:0]
+			}
+			for dy := -radius; dy <= radius; dy++ {
+				sy := min(max(y+dy, 0), im.Height-1)
+				for dx := -radius; dx <= radius; dx++ {
+					sx := min(max(x+dx, 0), im.Width-1)
+					r, g, b := im.At(sx, sy)
+					window[0] = append(window[0], r)
+					window[1] = append(window[1], g)
+					window[2] = append(window[2], b)
+				}
+			}
+			var m [3]byte
+			for c := range window {
+				slices.Sort(window[c])
+				m[c] = window[c][len(window[c])/2]
+			}
+			out.Set(x, y, m[0], m[1], m[2])
+		}
+	}
+	return out
+}
+
+// preprocessImage runs Config.Preprocessing on img for the detect-and-encode paths and returns the
+// result with the function mapping a face found on it back to the coordinates of img
+func (fr *FaceRecognizer) preprocessImage(img *ImageMatrix) (*ImageMatrix, func(Face) Face) {
+	width, height := img.Width, img.Height
+	pre, scale := fr.preprocess.Apply(img)
+	return pre, func(f Face) Face {
+		return scaleFace(f, scale, width, height)
+	}
+}
+
+// scaleFace maps a face found on a preprocessed image back to the original of width x height
+func scaleFace(f Face, scale float64, width, height int) Face {
+	if scale == 1 {
+		return f
+	}
+	r := f.Rectangle
+	f.Rectangle = Rectangle{
+		Top:    int(float64(r.Top) * scale),
+		Right:  min(int(float64(r.Right)*scale), width),
+		Bottom: min(int(float64(r.Bottom)*scale), height),
+		Left:   int(float64(r.Left) * scale),
+	}
+	l, ok := f.Landmarks.(FaceLandmarks)
+	if !ok {
+		return f
+	}
+	for _, points := range []*[]Point{&l.Chin, &l.LeftEyebrow, &l.RightEyebrow, &l.NoseBridge, &l.NoseTip, &l.LeftEye, &l.RightEye, &l.TopLip, &l.BottomLip} {
+		scaled := make([]Point, len(*points))
+		for i, p := range *points {
+			scaled[i] = Point{X: int(float64(p.X) * scale), Y: int(float64(p.Y) * scale)}
+		}
+		*points = scaled
+	}
+	f.Landmarks = l
+	return f
+}
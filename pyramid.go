@@ -0,0 +1,66 @@
+package gofacerecognition
+
+// PyramidLevel is one level of an image pyramid
+type PyramidLevel struct {
+	Image *ImageMatrix
+	// Scale is the size of this level relative to the original image (1, 0.5, 0.25, ...)
+	Scale float64
+}
+
+// ToOriginal maps a rectangle found in this level back to original image coordinates
+func (l PyramidLevel) ToOriginal(rect Rectangle) Rectangle {
+	return Rectangle{
+		Top:    int(float64(rect.Top) / l.Scale),
+		Right:  int(float64(rect.Right) / l.Scale),
+		Bottom: int(float64(rect.Bottom) / l.Scale),
+		Left:   int(float64(rect.Left) / l.Scale),
+	}
+}
+
+// BuildPyramid returns the image followed by successively halved copies, levels entries in total
+// Level 0 is the original image; building stops early once a level would be smaller than 1 pixel
+func BuildPyramid(img *ImageMatrix, levels int) []PyramidLevel {
+	if levels < 1 {
+		levels = 1
+	}
+
+	pyramid := make([]PyramidLevel, 0, levels)
+	pyramid = append(pyramid, PyramidLevel{Image: img, Scale: 1})
+
+	for len(pyramid) < levels {
+		prev := pyramid[len(pyramid)-1]
+		if prev.Image.Width < 2 || prev.Image.Height < 2 {
+			break
+		}
+		pyramid = append(pyramid, PyramidLevel{
+			Image: halveImage(prev.Image),
+			Scale: prev.Scale / 2,
+		})
+	}
+
+	return pyramid
+}
+
+// halveImage downscales by two using a 2x2 box filter
+func halveImage(im *ImageMatrix) *ImageMatrix {
+	width, height := im.Width/2, im.Height/2
+	out := im.newLike(width, height)
+	bpp := im.bytesPerPixel()
+
+	for y := 0; y < height; y++ {
+		row0 := (2 * y) * im.Stride
+		row1 := row0 + im.Stride
+		for x := 0; x < width; x++ {
+			i0 := row0 + 2*x*bpp
+			i1 := row1 + 2*x*bpp
+			o := y*out.Stride + x*bpp
+			for c := 0; c < bpp; c++ {
+				sum := int(im.Pixels[i0+c]) + int(im.Pixels[i0+bpp+c]) +
+					int(im.Pixels[i1+c]) + int(im.Pixels[i1+bpp+c])
+				out.Pixels[o+c] = byte((sum + 2) / 4)
+			}
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,162 @@
+package gofacerecognition
+
+import "math"
+
+const (
+	RejectDark        RejectReason = "dark"         // below QualityThresholds.MinBrightness
+	RejectOverexposed RejectReason = "overexposed"  // above QualityThresholds.MaxBrightness
+	RejectLowContrast RejectReason = "low_contrast" // below QualityThresholds.MinContrast
+)
+
+// QualityReport measures how well a face capture suits encoding, see AssessQuality
+type QualityReport struct {
+	// Sharpness is the BlurScore of the face, higher is sharper
+	Sharpness  float64 `json:"sharpness"`
+	Brightness float64 `json:"brightness"` // mean luma of the face, 0 to 255
+	Contrast   float64 `json:"contrast"`   // standard deviation of the luma of the face
+	FaceSize   int     `json:"face_size"`  // shorter side of the face inside the image, in pixels
+	// InterEyeDistance is the distance between the eye centers in pixels, 0 without eye landmarks
+	InterEyeDistance float64 `json:"inter_eye_distance"`
+	// Pose and PoseDeviation are only set when PoseEstimated, which needs the 68-point landmarks
+	Pose          HeadPose `json:"pose"`
+	PoseDeviation float64  `json:"pose_deviation"` // angle between the face and the camera axis in degrees
+	PoseEstimated bool     `json:"pose_estimated"`
+	// Occlusions are found with DetectOcclusions, empty without the 68-point landmarks
+	Occlusions Occlusions `json:"occlusions"`
+}
+
+// QualityThresholds are the limits QualityReport.Issues checks; zero fields are not checked
+type QualityThresholds struct {
+	MinSharpness        float64
+	MinBrightness       float64
+	MaxBrightness       float64
+	MinContrast         float64
+	MinFaceSize         int
+	MinInterEyeDistance float64
+	MaxPoseDeviation    float64
+	RejectOcclusions    []Occlusion
+}
+
+// DefaultQualityThresholds reject captures that encode noticeably worse than a frontal, well lit face
+var DefaultQualityThresholds = QualityThresholds{
+	MinSharpness:        25,
+	MinBrightness:       50,
+	MaxBrightness:       210,
+	MinContrast:         20,
+	MinFaceSize:         80,
+	MinInterEyeDistance: 28,
+	MaxPoseDeviation:    35,
+	RejectOcclusions:    []Occlusion{OcclusionSunglasses, OcclusionMask, OcclusionHand},
+}
+
+// AssessQuality measures the face at location, to reject blurry, dark or turned captures before
+// encoding them. landmarks may be empty; the pose, eye distance and occlusions then stay unset
+func AssessQuality(img *ImageMatrix, location Rectangle, landmarks FaceLandmarks) QualityReport {
+	var report QualityReport
+
+	face := trimRectToBounds(location, img.Height, img.Width)
+	report.FaceSize = max(0, min(face.Width(), face.Height()))
+	if face.Area() > 0 {
+		gray, _ := grayFaceCrop(img, face, textureSize)
+		report.Sharpness = laplacianVariance(gray, textureSize)
+
+		var sum, sq float64
+		for _, v := range gray {
+			sum += float64(v)
+			sq += float64(v) * float64(v)
+		}
+		n := float64(len(gray))
+		report.Brightness = sum / n
+		report.Contrast = math.Sqrt(math.Max(0, sq/n-report.Brightness*report.Brightness))
+	}
+
+	if len(landmarks.LeftEye) > 0 && len(landmarks.RightEye) > 0 {
+		l, r := centroid(landmarks.LeftEye), centroid(landmarks.RightEye)
+		report.InterEyeDistance = math.Hypot(r.x-l.x, r.y-l.y)
+	}
+	if pose, err := EstimateHeadPose(landmarks, img.Width, img.Height); err == nil {
+		report.Pose, report.PoseEstimated = pose, true
+		report.PoseDeviation = math.Hypot(pose.Yaw, pose.Pitch)
+	}
+	if occlusions, err := DetectOcclusions(img, landmarks); err == nil {
+		report.Occlusions = occlusions
+	}
+	return report
+}
+
+// Score condenses the report into a number from 0 to 1, where 1 meets every threshold of t: the mean,
+// over the thresholds set and measured, of how close the capture comes to each. A rejected occlusion
+// counts as 0
+func (r QualityReport) Score(t QualityThresholds) float64 {
+	var sum float64
+	n := 0
+	add := func(v float64) {
+		sum += math.Max(0, math.Min(1, v))
+		n++
+	}
+
+	if t.MinSharpness > 0 {
+		add(r.Sharpness / t.MinSharpness)
+	}
+	if t.MinFaceSize > 0 {
+		add(float64(r.FaceSize) / float64(t.MinFaceSize))
+	}
+	if t.MinInterEyeDistance > 0 && r.InterEyeDistance > 0 {
+		add(r.InterEyeDistance / t.MinInterEyeDistance)
+	}
+	if t.MinBrightness > 0 {
+		add(r.Brightness / t.MinBrightness)
+	}
+	if t.MaxBrightness > 0 && t.MaxBrightness < 255 {
+		add((255 - r.Brightness) / (255 - t.MaxBrightness))
+	}
+	if t.MinContrast > 0 {
+		add(r.Contrast / t.MinContrast)
+	}
+	if t.MaxPoseDeviation > 0 && r.PoseEstimated {
+		add(t.MaxPoseDeviation / math.Max(r.PoseDeviation, 1e-9))
+	}
+	for _, o := range t.RejectOcclusions {
+		if r.Occlusions.Has(o) {
+			add(0)
+			break
+		}
+	}
+
+	if n == 0 {
+		return 1
+	}
+	return sum / float64(n)
+}
+
+// Issues returns the reasons the capture fails t, empty when it passes
+// The pose and occlusion limits are skipped when the report could not measure them
+func (r QualityReport) Issues(t QualityThresholds) []RejectReason {
+	var issues []RejectReason
+	if t.MinFaceSize > 0 && r.FaceSize < t.MinFaceSize ||
+		t.MinInterEyeDistance > 0 && r.InterEyeDistance > 0 && r.InterEyeDistance < t.MinInterEyeDistance {
+		issues = append(issues, RejectSmallFace)
+	}
+	if t.MinSharpness > 0 && r.Sharpness < t.MinSharpness {
+		issues = append(issues, RejectBlurry)
+	}
+	if t.MinBrightness > 0 && r.Brightness < t.MinBrightness {
+		issues = append(issues, RejectDark)
+	}
+	if t.MaxBrightness > 0 && r.Brightness > t.MaxBrightness {
+		issues = append(issues, RejectOverexposed)
+	}
+	if t.MinContrast > 0 && r.Contrast < t.MinContrast {
+		issues = append(issues, RejectLowContrast)
+	}
+	if t.MaxPoseDeviation > 0 && r.PoseEstimated && r.PoseDeviation > t.MaxPoseDeviation {
+		issues = append(issues, RejectExtremePose)
+	}
+	for _, o := range t.RejectOcclusions {
+		if r.Occlusions.Has(o) {
+			issues = append(issues, RejectOccluded)
+			break
+		}
+	}
+	return issues
+}
@@ -13,8 +13,16 @@ package gofacerecognition
 */
 import "C"
 import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
 	"path/filepath"
+	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
@@ -23,17 +31,40 @@ type FaceRecognizer struct {
 	rec         C.facerec
 	modelPaths  ModelPaths
 	initialized bool
+	cnnLoaded   bool
+	ageGender   int   // bitmask of loaded attribute models, see facerec_age_gender_loaded
+	genderErr   error // why the gender classifier is not loaded
+	ageErr      error // why the age predictor is not loaded
+	numJitters  int
+	inputMode   InputMode
+	nirOptions  NIROptions
+	minScore    float64
+	preprocess  *Preprocessing
+	cnnBoxCal   *BoxCalibration // applied to CNN detections, nil when none is
+	boxMeasure  *boxMeasurement // measures cnnBoxCal for Config.MeasureCNNBoxCalibration
+	metrics     Metrics
+	logger      *slog.Logger
 	mu          sync.RWMutex
 }
 
 // NewFaceRecognizer creates a new FaceRecognizer with the given configuration
 func NewFaceRecognizer(config Config) (*FaceRecognizer, error) {
-	if err := config.ModelPaths.ValidateRequired(); err != nil {
+	if err := config.Validate(); err != nil {
 		return nil, err
 	}
 
 	fr := &FaceRecognizer{
 		modelPaths: config.ModelPaths,
+		numJitters: max(config.NumJitters, 1),
+		inputMode:  config.InputMode,
+		nirOptions: config.NIROptions,
+		minScore:   config.MinDetectionScore,
+		preprocess: config.Preprocessing,
+		metrics:    config.Metrics,
+		logger:     orDiscard(config.Logger),
+	}
+	if fr.metrics == nil {
+		fr.metrics = noMetrics{}
 	}
 
 	// Get model directory
@@ -47,11 +78,28 @@ func NewFaceRecognizer(config Config) (*FaceRecognizer, error) {
 	cModelDir := C.CString(modelDir)
 	defer C.free(unsafe.Pointer(cModelDir))
 
-	fr.rec = C.facerec_init(cModelDir)
+	// The CNN detector is optional; an empty path tells the C side to skip it
+	cnnPath := ""
+	if config.ModelPaths.CNNFaceDetector != "" {
+		if _, err := os.Stat(config.ModelPaths.CNNFaceDetector); err == nil {
+			cnnPath = config.ModelPaths.CNNFaceDetector
+		}
+	}
+	cCNNPath := C.CString(cnnPath)
+	defer C.free(unsafe.Pointer(cCNNPath))
+
+	useGPU := 0
+	if config.UseGPU {
+		useGPU = 1
+	}
+
+	fr.rec = C.facerec_init(cModelDir, cCNNPath, C.int(useGPU), C.int(config.GPUDevice))
 
 	errStr := C.facerec_get_error(fr.rec)
 	if errStr != nil {
 		defer C.facerec_free_error(errStr)
+		C.facerec_free(fr.rec)
+		fr.logger.Error("failed to load models", "dir", modelDir, "err", C.GoString(errStr))
 		return nil, &ModelNotFoundError{
 			ModelName: "dlib models",
 			Path:      C.GoString(errStr),
@@ -59,9 +107,42 @@ func NewFaceRecognizer(config Config) (*FaceRecognizer, error) {
 	}
 
 	fr.initialized = true
+	fr.cnnLoaded = cnnPath != ""
+	if cal := config.CNNBoxCalibration; cal != nil {
+		fr.setCNNBoxCalibration(*cal)
+	} else if config.MeasureCNNBoxCalibration > 0 && fr.cnnLoaded {
+		fr.boxMeasure = &boxMeasurement{want: config.MeasureCNNBoxCalibration}
+	}
+	fr.genderErr = fr.loadAttributeModel(0, "gender_classifier", config.ModelPaths.GenderClassifier)
+	fr.ageErr = fr.loadAttributeModel(1, "age_predictor", config.ModelPaths.AgePredictor)
+	fr.ageGender = int(C.facerec_age_gender_loaded(fr.rec))
+	fr.logger.Debug("recognizer initialized", "models", modelDir, "cnn", fr.cnnLoaded, "gpu", config.UseGPU,
+		"gpu_device", config.GPUDevice, "age_model", fr.ageGender&2 != 0, "gender_model", fr.ageGender&1 != 0)
 	return fr, nil
 }
 
+// loadAttributeModel loads an optional age or gender model and returns why it is unavailable
+// Missing files are expected; files that exist but fail to load are logged with the dlib message
+func (fr *FaceRecognizer) loadAttributeModel(model int, name, path string) error {
+	if path == "" {
+		return &ModelNotFoundError{ModelName: name, Path: path}
+	}
+	if _, err := os.Stat(path); err != nil {
+		return &ModelNotFoundError{ModelName: name, Path: path}
+	}
+
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	var cErr *C.char
+	if C.facerec_load_attribute_model(fr.rec, C.int(model), cPath, &cErr) != 0 {
+		err := fmt.Errorf("loading %s from %s: %w", name, path, nativeError("facerec_load_attribute_model", cErr))
+		fr.logger.Warn("failed to load optional model", "model", name, "path", path, "err", err)
+		return err
+	}
+	return nil
+}
+
 // Close releases resources held by the FaceRecognizer
 func (fr *FaceRecognizer) Close() {
 	fr.mu.Lock()
@@ -73,8 +154,88 @@ func (fr *FaceRecognizer) Close() {
 	}
 }
 
+// SetGPUDevice moves subsequent CNN detection and encoding calls to another CUDA device
+func (fr *FaceRecognizer) SetGPUDevice(id int) error {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	if !fr.initialized {
+		return &RecognizerNotInitializedError{}
+	}
+	if !cudaEnabled {
+		return &GPUUnavailableError{Reason: "package built without the cuda build tag"}
+	}
+	if C.facerec_set_gpu_device(fr.rec, C.int(id)) != 0 {
+		return &GPUUnavailableError{Reason: fmt.Sprintf("device %d does not exist (%d available)", id, NumGPUs())}
+	}
+	return nil
+}
+
+// NumGPUs returns the number of CUDA devices usable by dlib, 0 when built without CUDA
+func NumGPUs() int {
+	return int(C.facerec_num_gpus())
+}
+
 // FaceLocations detects faces in an image and returns their bounding boxes
+// Config.Preprocessing is applied first; rectangles are in the coordinates of img
 func (fr *FaceRecognizer) FaceLocations(img *ImageMatrix, upsampleTimes int, model DetectionModel) ([]Rectangle, error) {
+	scored, err := fr.FaceLocationsWithScores(img, upsampleTimes, model)
+	if err != nil {
+		return nil, err
+	}
+	return scoredRects(scored), nil
+}
+
+// scoredRects drops the scores of detections
+func scoredRects(scored []ScoredRectangle) []Rectangle {
+	rects := make([]Rectangle, len(scored))
+	for i, r := range scored {
+		rects[i] = r.Rectangle
+	}
+	return rects
+}
+
+// FaceLocationsWithScores is FaceLocations with the detector confidence of every face
+// Only faces scoring above Config.MinDetectionScore are returned
+// Config.Preprocessing is applied first; rectangles are in the coordinates of img
+func (fr *FaceRecognizer) FaceLocationsWithScores(img *ImageMatrix, upsampleTimes int, model DetectionModel) ([]ScoredRectangle, error) {
+	pre, original := fr.preprocessImage(img)
+	found, err := fr.faceLocationsWithScores(pre, upsampleTimes, model)
+	if err != nil {
+		return nil, err
+	}
+	for i := range found {
+		found[i].Rectangle = original(Face{Rectangle: found[i].Rectangle}).Rectangle
+	}
+	return found, nil
+}
+
+// faceLocations is FaceLocations on an image Config.Preprocessing has already been applied to
+func (fr *FaceRecognizer) faceLocations(img *ImageMatrix, upsampleTimes int, model DetectionModel) ([]Rectangle, error) {
+	scored, err := fr.faceLocationsWithScores(img, upsampleTimes, model)
+	if err != nil {
+		return nil, err
+	}
+	return scoredRects(scored), nil
+}
+
+// faceLocationsWithScores is FaceLocationsWithScores on an image Config.Preprocessing has already
+// been applied to
+func (fr *FaceRecognizer) faceLocationsWithScores(img *ImageMatrix, upsampleTimes int, model DetectionModel) (found []ScoredRectangle, err error) {
+	start := time.Now()
+	defer func() { fr.metrics.ObserveDetection(model, len(found), time.Since(start), err) }()
+
+	found, err = fr.detectScored(img, upsampleTimes, model)
+	if err == nil && model == CNN && fr.boxMeasure != nil && fr.boxMeasure.pending() {
+		fr.measureCNNBoxes(img, upsampleTimes, found)
+	}
+	return found, err
+}
+
+// detectScored runs one detector over img, see FaceLocationsWithScores
+func (fr *FaceRecognizer) detectScored(img *ImageMatrix, upsampleTimes int, model DetectionModel) (_ []ScoredRectangle, err error) {
+	defer fr.nativeCall("facerec_detect", time.Now(), &err)
+
 	fr.mu.RLock()
 	defer fr.mu.RUnlock()
 
@@ -86,9 +247,16 @@ func (fr *FaceRecognizer) FaceLocations(img *ImageMatrix, upsampleTimes int, mod
 		upsampleTimes = 1
 	}
 
+	if model == CNN && !fr.cnnLoaded {
+		return nil, &ModelNotFoundError{
+			ModelName: "cnn_face_detector",
+			Path:      fr.modelPaths.CNNFaceDetector,
+		}
+	}
+
 	// Convert image to C format
-	cImg := imageMatrixToC(img)
-	defer C.free(unsafe.Pointer(cImg.data))
+	cImg, release := fr.imageToC(img)
+	defer release()
 
 	useCNN := 0
 	if model == CNN {
@@ -97,34 +265,77 @@ func (fr *FaceRecognizer) FaceLocations(img *ImageMatrix, upsampleTimes int, mod
 
 	// Call C function
 	var numFaces C.int
-	cRects := C.facerec_detect(fr.rec, cImg, C.int(upsampleTimes), C.int(useCNN), &numFaces)
+	var cErr *C.char
+	cRects := C.facerec_detect_scored(fr.rec, cImg, C.int(upsampleTimes), C.int(useCNN), C.double(fr.minScore), &numFaces, &cErr)
+	if err := nativeError("facerec_detect", cErr); err != nil {
+		return nil, err
+	}
 
 	if numFaces == 0 {
-		return []Rectangle{}, nil
+		return []ScoredRectangle{}, nil
 	}
+	nativeAllocs.Add(1)
 
-	defer C.free(unsafe.Pointer(cRects))
+	defer freeC(unsafe.Pointer(cRects))
 
 	// Convert results
-	rects := make([]Rectangle, int(numFaces))
-	cRectsSlice := (*[1 << 28]C.rect)(unsafe.Pointer(cRects))[:numFaces:numFaces]
-
-	for i, r := range cRectsSlice {
-		rects[i] = Rectangle{
-			Top:    int(r.top),
-			Right:  int(r.right),
-			Bottom: int(r.bottom),
-			Left:   int(r.left),
+	rects := make([]ScoredRectangle, int(numFaces))
+	for i, r := range unsafe.Slice(cRects, int(numFaces)) {
+		rect := Rectangle{
+			Top:    int(r.location.top),
+			Right:  int(r.location.right),
+			Bottom: int(r.location.bottom),
+			Left:   int(r.location.left),
 		}
 		// Trim to image bounds
-		rects[i] = trimRectToBounds(rects[i], img.Height, img.Width)
+		rects[i] = ScoredRectangle{Rectangle: trimRectToBounds(rect, img.Height, img.Width), Score: float64(r.score)}
 	}
 
 	return rects, nil
 }
 
+// measureCNNBoxes pairs the CNN detections of img with HOG detections of the same image for
+// Config.MeasureCNNBoxCalibration, and applies the calibration once enough faces are paired
+func (fr *FaceRecognizer) measureCNNBoxes(img *ImageMatrix, upsampleTimes int, cnn []ScoredRectangle) {
+	hog, err := fr.detectScored(img, upsampleTimes, HOG)
+	if err != nil {
+		fr.logger.Warn("HOG detection for the CNN box calibration failed", "err", err)
+		return
+	}
+	cal := fr.boxMeasure.add(scoredRects(cnn), scoredRects(hog))
+	if cal == nil {
+		return
+	}
+
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	fr.setCNNBoxCalibration(*cal)
+	fr.logger.Info("measured CNN box calibration", "faces", fr.boxMeasure.want, "scale_x", cal.ScaleX,
+		"scale_y", cal.ScaleY, "shift_x", cal.ShiftX, "shift_y", cal.ShiftY)
+}
+
+// CNNBoxCalibration returns the calibration applied to CNN detections: Config.CNNBoxCalibration, or
+// the one measured for Config.MeasureCNNBoxCalibration once it is complete, which can be saved into
+// Config.CNNBoxCalibration for later runs; false while none applies
+func (fr *FaceRecognizer) CNNBoxCalibration() (BoxCalibration, bool) {
+	fr.mu.RLock()
+	defer fr.mu.RUnlock()
+	if fr.cnnBoxCal == nil {
+		return BoxCalibration{}, false
+	}
+	return *fr.cnnBoxCal, true
+}
+
+// setCNNBoxCalibration hands cal to the C layer, fr.mu must be held for writing
+func (fr *FaceRecognizer) setCNNBoxCalibration(cal BoxCalibration) {
+	C.facerec_set_cnn_box_calibration(fr.rec, C.double(cal.ScaleX), C.double(cal.ScaleY), C.double(cal.ShiftX), C.double(cal.ShiftY))
+	fr.cnnBoxCal = &cal
+}
+
 // FaceLandmarksDetect detects facial landmarks for faces in an image
-func (fr *FaceRecognizer) FaceLandmarksDetect(img *ImageMatrix, faceLocations []Rectangle, model LandmarkModel) ([]RawLandmarks, error) {
+func (fr *FaceRecognizer) FaceLandmarksDetect(img *ImageMatrix, faceLocations []Rectangle, model LandmarkModel) (_ []RawLandmarks, err error) {
+	defer fr.nativeCall("facerec_landmarks", time.Now(), &err)
+
 	fr.mu.RLock()
 	defer fr.mu.RUnlock()
 
@@ -135,7 +346,6 @@ func (fr *FaceRecognizer) FaceLandmarksDetect(img *ImageMatrix, faceLocations []
 	// If no face locations provided, detect them first
 	if faceLocations == nil {
 		fr.mu.RUnlock()
-		var err error
 		faceLocations, err = fr.FaceLocations(img, 1, HOG)
 		fr.mu.RLock()
 		if err != nil {
@@ -148,8 +358,8 @@ func (fr *FaceRecognizer) FaceLandmarksDetect(img *ImageMatrix, faceLocations []
 	}
 
 	// Convert image to C format
-	cImg := imageMatrixToC(img)
-	defer C.free(unsafe.Pointer(cImg.data))
+	cImg, release := fr.imageToC(img)
+	defer release()
 
 	// Convert face locations
 	cRects := make([]C.rect, len(faceLocations))
@@ -173,22 +383,28 @@ func (fr *FaceRecognizer) FaceLandmarksDetect(img *ImageMatrix, faceLocations []
 	}
 
 	// Call C function
+	var cErr *C.char
 	cLandmarks := C.facerec_landmarks(
 		fr.rec,
 		cImg,
 		&cRects[0],
 		C.int(len(faceLocations)),
 		C.int(useSmall),
+		&cErr,
 	)
+	if err := nativeError("facerec_landmarks", cErr); err != nil {
+		return nil, err
+	}
 
 	if cLandmarks == nil {
 		return []RawLandmarks{}, nil
 	}
-	defer C.free(unsafe.Pointer(cLandmarks))
+	nativeAllocs.Add(1)
+	defer freeC(unsafe.Pointer(cLandmarks))
 
 	// Convert results
 	landmarks := make([]RawLandmarks, len(faceLocations))
-	cLandmarksSlice := (*[1 << 28]C.point)(unsafe.Pointer(cLandmarks))[:len(faceLocations)*numPoints : len(faceLocations)*numPoints]
+	cLandmarksSlice := (*[1 << 28]C.point)(unsafe.Pointer(cLandmarks))[: len(faceLocations)*numPoints : len(faceLocations)*numPoints]
 
 	for i := 0; i < len(faceLocations); i++ {
 		landmarks[i].Points = make([]Point, numPoints)
@@ -216,22 +432,28 @@ func (fr *FaceRecognizer) FaceLandmarks(img *ImageMatrix, faceLocations []Rectan
 		if len(r.Points) < 68 {
 			continue
 		}
-		landmarks[i] = FaceLandmarks{
-			Chin:         r.Points[0:17],
-			LeftEyebrow:  r.Points[17:22],
-			RightEyebrow: r.Points[22:27],
-			NoseBridge:   r.Points[27:31],
-			NoseTip:      r.Points[31:36],
-			LeftEye:      r.Points[36:42],
-			RightEye:     r.Points[42:48],
-			TopLip:       append(r.Points[48:55], r.Points[64], r.Points[63], r.Points[62], r.Points[61], r.Points[60]),
-			BottomLip:    append(append(r.Points[54:60], r.Points[48]), r.Points[60], r.Points[67], r.Points[66], r.Points[65], r.Points[64]),
-		}
+		landmarks[i] = structureLandmarks(r.Points)
 	}
 
 	return landmarks, nil
 }
 
+// structureLandmarks groups the 68 points of the large model by facial feature
+func structureLandmarks(points []Point) FaceLandmarks {
+	// The lip slices use full slice expressions so append copies instead of overwriting the shared points
+	return FaceLandmarks{
+		Chin:         points[0:17],
+		LeftEyebrow:  points[17:22],
+		RightEyebrow: points[22:27],
+		NoseBridge:   points[27:31],
+		NoseTip:      points[31:36],
+		LeftEye:      points[36:42],
+		RightEye:     points[42:48],
+		TopLip:       append(points[48:55:55], points[64], points[63], points[62], points[61], points[60]),
+		BottomLip:    append(points[54:60:60], points[48], points[60], points[67], points[66], points[65], points[64]),
+	}
+}
+
 // FaceLandmarksSmallModel returns structured facial landmarks for the "small" model
 func (fr *FaceRecognizer) FaceLandmarksSmallModel(img *ImageMatrix, faceLocations []Rectangle) ([]FaceLandmarksSmall, error) {
 	raw, err := fr.FaceLandmarksDetect(img, faceLocations, LandmarkSmall)
@@ -255,7 +477,11 @@ func (fr *FaceRecognizer) FaceLandmarksSmallModel(img *ImageMatrix, faceLocation
 }
 
 // FaceEncodings computes 128-dimensional face encodings for faces in an image
-func (fr *FaceRecognizer) FaceEncodings(img *ImageMatrix, faceLocations []Rectangle, numJitters int, model LandmarkModel) ([]FaceEncoding, error) {
+func (fr *FaceRecognizer) FaceEncodings(img *ImageMatrix, faceLocations []Rectangle, numJitters int, model LandmarkModel) (encoded []FaceEncoding, err error) {
+	start := time.Now()
+	defer func() { fr.metrics.ObserveEncoding(len(encoded), time.Since(start), err) }()
+	defer fr.nativeCall("facerec_encode", time.Now(), &err)
+
 	fr.mu.RLock()
 	defer fr.mu.RUnlock()
 
@@ -280,8 +506,8 @@ func (fr *FaceRecognizer) FaceEncodings(img *ImageMatrix, faceLocations []Rectan
 	}
 
 	// Convert image to C format
-	cImg := imageMatrixToC(img)
-	defer C.free(unsafe.Pointer(cImg.data))
+	cImg, release := fr.imageToC(img)
+	defer release()
 
 	numPoints := 68
 	if model == LandmarkSmall {
@@ -300,6 +526,7 @@ func (fr *FaceRecognizer) FaceEncodings(img *ImageMatrix, faceLocations []Rectan
 	}
 
 	// Call C function
+	var cErr *C.char
 	cEncodings := C.facerec_encode(
 		fr.rec,
 		cImg,
@@ -307,16 +534,21 @@ func (fr *FaceRecognizer) FaceEncodings(img *ImageMatrix, faceLocations []Rectan
 		C.int(len(raw)),
 		C.int(numPoints),
 		C.int(numJitters),
+		&cErr,
 	)
+	if err := nativeError("facerec_encode", cErr); err != nil {
+		return nil, err
+	}
 
 	if cEncodings == nil {
 		return []FaceEncoding{}, nil
 	}
-	defer C.free(unsafe.Pointer(cEncodings))
+	nativeAllocs.Add(1)
+	defer freeC(unsafe.Pointer(cEncodings))
 
 	// Convert results
 	encodings := make([]FaceEncoding, len(raw))
-	cEncodingsSlice := (*[1 << 28]C.double)(unsafe.Pointer(cEncodings))[:len(raw)*128 : len(raw)*128]
+	cEncodingsSlice := (*[1 << 28]C.double)(unsafe.Pointer(cEncodings))[: len(raw)*128 : len(raw)*128]
 
 	for i := 0; i < len(raw); i++ {
 		for j := 0; j < 128; j++ {
@@ -327,37 +559,265 @@ func (fr *FaceRecognizer) FaceEncodings(img *ImageMatrix, faceLocations []Rectan
 	return encodings, nil
 }
 
-// DetectAndEncode detects faces and computes encodings in one call
-func (fr *FaceRecognizer) DetectAndEncode(img *ImageMatrix, upsampleTimes int, numJitters int) ([]Face, error) {
-	locations, err := fr.FaceLocations(img, upsampleTimes, HOG)
-	if err != nil {
+// AlignedFaceChips returns size x size crops of each face, rotated so the eyes are level and scaled
+// to a canonical position, as used by the encoder. padding is the margin around the face as a
+// fraction of the face size (dlib's encoder uses 150 and 0.25)
+func (fr *FaceRecognizer) AlignedFaceChips(img *ImageMatrix, faceLocations []Rectangle, size int, padding float64) (_ []*ImageMatrix, err error) {
+	defer fr.nativeCall("facerec_face_chips", time.Now(), &err)
+
+	fr.mu.RLock()
+	defer fr.mu.RUnlock()
+
+	if !fr.initialized {
+		return nil, &RecognizerNotInitializedError{}
+	}
+
+	if size <= 0 {
+		size = 150
+	}
+	if padding < 0 {
+		padding = 0.25
+	}
+
+	if len(faceLocations) == 0 {
+		return []*ImageMatrix{}, nil
+	}
+
+	cImg, release := fr.imageToC(img)
+	defer release()
+
+	cRects := make([]C.rect, len(faceLocations))
+	for i, r := range faceLocations {
+		cRects[i] = C.rect{
+			left:   C.long(r.Left),
+			top:    C.long(r.Top),
+			right:  C.long(r.Right),
+			bottom: C.long(r.Bottom),
+		}
+	}
+
+	var cErr *C.char
+	cChips := C.facerec_face_chips(
+		fr.rec,
+		cImg,
+		&cRects[0],
+		C.int(len(faceLocations)),
+		C.int(size),
+		C.double(padding),
+		&cErr,
+	)
+	if err := nativeError("facerec_face_chips", cErr); err != nil {
 		return nil, err
 	}
+	if cChips == nil {
+		return []*ImageMatrix{}, nil
+	}
+	nativeAllocs.Add(1)
+	defer freeC(unsafe.Pointer(cChips))
 
-	landmarks, err := fr.FaceLandmarks(img, locations)
-	if err != nil {
+	chipBytes := size * size * 3
+	data := unsafe.Slice((*byte)(unsafe.Pointer(cChips)), chipBytes*len(faceLocations))
+
+	chips := make([]*ImageMatrix, len(faceLocations))
+	for i := range chips {
+		chips[i] = NewImageMatrix(size, size)
+		copy(chips[i].Pixels, data[i*chipBytes:(i+1)*chipBytes])
+	}
+
+	return chips, nil
+}
+
+// EstimateAgeGender estimates the age and gender of each face
+// Requires the optional ModelPaths.GenderClassifier and ModelPaths.AgePredictor models; when one is
+// missing or failed to load, the error says which and why
+func (fr *FaceRecognizer) EstimateAgeGender(img *ImageMatrix, faceLocations []Rectangle) (_ []AgeGender, err error) {
+	defer fr.nativeCall("facerec_age_gender", time.Now(), &err)
+
+	fr.mu.RLock()
+	defer fr.mu.RUnlock()
+
+	if !fr.initialized {
+		return nil, &RecognizerNotInitializedError{}
+	}
+	if fr.ageGender&1 == 0 {
+		return nil, fr.genderErr
+	}
+	if fr.ageGender&2 == 0 {
+		return nil, fr.ageErr
+	}
+
+	if len(faceLocations) == 0 {
+		return []AgeGender{}, nil
+	}
+
+	cImg, release := fr.imageToC(img)
+	defer release()
+
+	cRects := make([]C.rect, len(faceLocations))
+	for i, r := range faceLocations {
+		cRects[i] = C.rect{
+			left:   C.long(r.Left),
+			top:    C.long(r.Top),
+			right:  C.long(r.Right),
+			bottom: C.long(r.Bottom),
+		}
+	}
+
+	var cErr *C.char
+	cResults := C.facerec_age_gender(fr.rec, cImg, &cRects[0], C.int(len(faceLocations)), &cErr)
+	if err := nativeError("facerec_age_gender", cErr); err != nil {
 		return nil, err
 	}
+	if cResults == nil {
+		return []AgeGender{}, nil
+	}
+	nativeAllocs.Add(1)
+	defer freeC(unsafe.Pointer(cResults))
 
-	encodings, err := fr.FaceEncodings(img, locations, numJitters, LandmarkLarge)
-	if err != nil {
+	data := unsafe.Slice((*float64)(unsafe.Pointer(cResults)), len(faceLocations)*3)
+
+	results := make([]AgeGender, len(faceLocations))
+	for i := range results {
+		male, age, spread := data[i*3], data[i*3+1], data[i*3+2]
+
+		results[i] = AgeGender{
+			Age:              age,
+			AgeMin:           max(0, int(math.Floor(age-spread))),
+			AgeMax:           int(math.Ceil(age + spread)),
+			Gender:           GenderMale,
+			GenderConfidence: male,
+		}
+		if male < 0.5 {
+			results[i].Gender = GenderFemale
+			results[i].GenderConfidence = 1 - male
+		}
+	}
+
+	return results, nil
+}
+
+// DetectAndEncode detects faces and computes encodings in one call
+func (fr *FaceRecognizer) DetectAndEncode(img *ImageMatrix, upsampleTimes int, numJitters int) ([]Face, error) {
+	return fr.DetectAndEncodeModel(img, upsampleTimes, numJitters, HOG)
+}
+
+// DetectAndEncodeModel is DetectAndEncode with a choice of detector
+// Detection, 68-point landmarks and encoding run in a single cgo call, so each face's landmarks
+// are predicted once and the image crosses into C once. Metrics see the call as both a detection
+// and an encoding, each with the full duration
+// Config.Preprocessing is applied first; rectangles and landmarks are in the coordinates of img
+func (fr *FaceRecognizer) DetectAndEncodeModel(img *ImageMatrix, upsampleTimes int, numJitters int, model DetectionModel) (found []Face, err error) {
+	start := time.Now()
+	defer func() {
+		elapsed := time.Since(start)
+		fr.metrics.ObserveDetection(model, len(found), elapsed, err)
+		fr.metrics.ObserveEncoding(len(found), elapsed, err)
+	}()
+	defer fr.nativeCall("facerec_detect_and_encode", time.Now(), &err)
+
+	fr.mu.RLock()
+	defer fr.mu.RUnlock()
+
+	if !fr.initialized {
+		return nil, &RecognizerNotInitializedError{}
+	}
+
+	if upsampleTimes < 1 {
+		upsampleTimes = 1
+	}
+	if numJitters < 1 {
+		numJitters = 1
+	}
+
+	if model == CNN && !fr.cnnLoaded {
+		return nil, &ModelNotFoundError{
+			ModelName: "cnn_face_detector",
+			Path:      fr.modelPaths.CNNFaceDetector,
+		}
+	}
+
+	img, original := fr.preprocessImage(img)
+	cImg, release := fr.imageToC(img)
+	defer release()
+
+	useCNN := 0
+	if model == CNN {
+		useCNN = 1
+	}
+
+	var numFaces C.int
+	var cErr *C.char
+	cResults := C.facerec_detect_and_encode(fr.rec, cImg, C.int(upsampleTimes), C.int(useCNN), C.double(fr.minScore), C.int(numJitters), &numFaces, &cErr)
+	if err := nativeError("facerec_detect_and_encode", cErr); err != nil {
 		return nil, err
 	}
 
-	faces := make([]Face, len(locations))
-	for i := range locations {
-		faces[i] = Face{
-			Rectangle: locations[i],
-			Encoding:  encodings[i],
+	if numFaces == 0 {
+		return []Face{}, nil
+	}
+	nativeAllocs.Add(1)
+	defer freeC(unsafe.Pointer(cResults))
+
+	faces := make([]Face, int(numFaces))
+	for i, r := range unsafe.Slice(cResults, int(numFaces)) {
+		faces[i].Rectangle = Rectangle{
+			Top:    int(r.location.top),
+			Right:  int(r.location.right),
+			Bottom: int(r.location.bottom),
+			Left:   int(r.location.left),
+		}
+
+		points := make([]Point, len(r.landmarks))
+		for j, p := range r.landmarks {
+			points[j] = Point{X: int(p.x), Y: int(p.y)}
 		}
-		if i < len(landmarks) {
-			faces[i].Landmarks = landmarks[i]
+		faces[i].Landmarks = structureLandmarks(points)
+
+		for j, v := range r.encoding {
+			faces[i].Encoding[j] = float64(v)
 		}
+		faces[i] = original(faces[i])
 	}
 
 	return faces, nil
 }
 
+// ClusterEncodings groups encodings by identity with dlib's chinese whispers algorithm
+// Encodings closer than threshold (default 0.5) are linked; the result holds one cluster label per encoding
+func ClusterEncodings(encodings []FaceEncoding, threshold float64) (_ []int, err error) {
+	defer recoverNative("facerec_cluster", &err)
+
+	if threshold <= 0 {
+		threshold = 0.5
+	}
+	if len(encodings) == 0 {
+		return []int{}, nil
+	}
+
+	var numClusters C.int
+	var cErr *C.char
+	cLabels := C.facerec_cluster(
+		(*C.double)(unsafe.Pointer(&encodings[0][0])),
+		C.int(len(encodings)),
+		C.double(threshold),
+		&numClusters,
+		&cErr,
+	)
+	if err := nativeError("facerec_cluster", cErr); err != nil {
+		return nil, err
+	}
+	nativeAllocs.Add(1)
+	defer freeC(unsafe.Pointer(cLabels))
+
+	cLabelsSlice := unsafe.Slice((*C.int)(unsafe.Pointer(cLabels)), len(encodings))
+	labels := make([]int, len(encodings))
+	for i, l := range cLabelsSlice {
+		labels[i] = int(l)
+	}
+
+	return labels, nil
+}
+
 // Helper functions
 
 func trimRectToBounds(rect Rectangle, height, width int) Rectangle {
@@ -369,13 +829,77 @@ func trimRectToBounds(rect Rectangle, height, width int) Rectangle {
 	}
 }
 
-// C helper types and conversions (these match facerec.h)
-func imageMatrixToC(img *ImageMatrix) C.image {
-	cData := C.CBytes(img.Pixels)
-	return C.image{
-		data:   (*C.uint8_t)(cData),
-		width:  C.int(img.Width),
-		height: C.int(img.Height),
-		stride: C.int(img.Stride),
+// nativeAllocs and nativeFrees count C buffers crossing the cgo boundary
+var (
+	nativeAllocs atomic.Int64
+	nativeFrees  atomic.Int64
+)
+
+// NativeAllocStats reports how many C buffers have been allocated and freed by the package
+// A difference that keeps growing over time indicates a leak in the cgo layer
+func NativeAllocStats() (allocs, frees int64) {
+	return nativeAllocs.Load(), nativeFrees.Load()
+}
+
+// nativeError converts an error string returned by the C layer into a Go error and frees it
+func nativeError(op string, cErr *C.char) error {
+	if cErr == nil {
+		return nil
 	}
+	defer C.facerec_free_error(cErr)
+	return &NativeError{Op: op, Message: C.GoString(cErr)}
+}
+
+// recoverNative turns a panic while handling C results into an error instead of crashing the process
+func recoverNative(op string, err *error) {
+	if r := recover(); r != nil {
+		*err = &NativeError{Op: op, Message: fmt.Sprint(r)}
+	}
+}
+
+// nativeCall is recoverNative for recognizer methods, which also logs the call at debug level with
+// its duration and the C buffers still allocated, and recovered panics at error level
+func (fr *FaceRecognizer) nativeCall(op string, start time.Time, err *error) {
+	if r := recover(); r != nil {
+		*err = &NativeError{Op: op, Message: fmt.Sprint(r)}
+		fr.logger.Error("native call panicked", "op", op, "panic", r)
+	}
+	if fr.logger.Enabled(context.Background(), slog.LevelDebug) {
+		allocs, frees := NativeAllocStats()
+		fr.logger.Debug("native call", "op", op, "elapsed", time.Since(start), "err", *err, "native_buffers", allocs-frees)
+	}
+}
+
+func freeC(p unsafe.Pointer) {
+	C.free(p)
+	nativeFrees.Add(1)
+}
+
+// imageToC converts an image for the C layer, applying the preprocessing of the configured input mode
+// Call release once the C call returns
+func (fr *FaceRecognizer) imageToC(img *ImageMatrix) (cImg C.image, release func()) {
+	if fr.inputMode == InputNIR {
+		img, _ = PreprocessNIR(img, fr.nirOptions)
+	}
+	return imageMatrixToC(img)
+}
+
+// C helper types and conversions (these match facerec.h)
+// imageMatrixToC hands the C layer the Go pixel buffer itself, pinned until release is called, rather
+// than a C copy of it; the C layer only reads the pixels during the call and keeps no pointer to them
+func imageMatrixToC(img *ImageMatrix) (cImg C.image, release func()) {
+	cImg = C.image{
+		width:    C.int(img.Width),
+		height:   C.int(img.Height),
+		stride:   C.int(img.Stride),
+		channels: C.int(img.bytesPerPixel()),
+	}
+	if len(img.Pixels) == 0 {
+		return cImg, func() {}
+	}
+
+	var pinner runtime.Pinner
+	pinner.Pin(&img.Pixels[0])
+	cImg.data = (*C.uint8_t)(unsafe.Pointer(&img.Pixels[0]))
+	return cImg, pinner.Unpin
 }
@@ -0,0 +1,91 @@
+package gofacerecognition
+
+import (
+	"image"
+	"math"
+)
+
+// Rectangle conventions differ between libraries:
+//
+//	this package    Rectangle{Top, Right, Bottom, Left}
+//	face_recognition css tuple (top, right, bottom, left)
+//	dlib            rectangle(left, top, right, bottom)
+//	OpenCV          Rect(x, y, width, height)
+//	image           image.Rect(x0, y0, x1, y1)
+//	normalized      fractions of the image width and height
+//
+// All of them describe the same pixels; only the field order and units change
+
+// CSS returns the rectangle as a face_recognition css tuple (top, right, bottom, left)
+func (r Rectangle) CSS() [4]int {
+	return [4]int{r.Top, r.Right, r.Bottom, r.Left}
+}
+
+// RectangleFromCSS converts a face_recognition css tuple (top, right, bottom, left)
+func RectangleFromCSS(css [4]int) Rectangle {
+	return Rectangle{Top: css[0], Right: css[1], Bottom: css[2], Left: css[3]}
+}
+
+// Dlib returns the rectangle in dlib's order (left, top, right, bottom)
+func (r Rectangle) Dlib() [4]int {
+	return [4]int{r.Left, r.Top, r.Right, r.Bottom}
+}
+
+// RectangleFromDlib converts a rectangle in dlib's order (left, top, right, bottom)
+func RectangleFromDlib(left, top, right, bottom int) Rectangle {
+	return Rectangle{Top: top, Right: right, Bottom: bottom, Left: left}
+}
+
+// XYWH returns the rectangle in OpenCV's (x, y, width, height) form
+func (r Rectangle) XYWH() (x, y, w, h int) {
+	return r.Left, r.Top, r.Width(), r.Height()
+}
+
+// RectangleFromXYWH converts an OpenCV style (x, y, width, height) rectangle
+func RectangleFromXYWH(x, y, w, h int) Rectangle {
+	return Rectangle{Top: y, Right: x + w, Bottom: y + h, Left: x}
+}
+
+// ImageRect returns the rectangle as an image.Rectangle
+func (r Rectangle) ImageRect() image.Rectangle {
+	return image.Rect(r.Left, r.Top, r.Right, r.Bottom)
+}
+
+// RectangleFromImageRect converts an image.Rectangle
+func RectangleFromImageRect(ir image.Rectangle) Rectangle {
+	return Rectangle{Top: ir.Min.Y, Right: ir.Max.X, Bottom: ir.Max.Y, Left: ir.Min.X}
+}
+
+// NormalizedRect is a rectangle in fractions of the image size, in the same order as Rectangle
+// It stays valid when the image is resized, e.g. for thumbnails or UI overlays
+type NormalizedRect struct {
+	Top    float64 `json:"top"`
+	Right  float64 `json:"right"`
+	Bottom float64 `json:"bottom"`
+	Left   float64 `json:"left"`
+}
+
+// Normalize converts the rectangle to fractions of an image of the given size
+func (r Rectangle) Normalize(width, height int) NormalizedRect {
+	if width <= 0 || height <= 0 {
+		return NormalizedRect{}
+	}
+	w, h := float64(width), float64(height)
+	return NormalizedRect{
+		Top:    float64(r.Top) / h,
+		Right:  float64(r.Right) / w,
+		Bottom: float64(r.Bottom) / h,
+		Left:   float64(r.Left) / w,
+	}
+}
+
+// Denormalize converts the rectangle to pixels of an image of the given size
+func (n NormalizedRect) Denormalize(width, height int) Rectangle {
+	w, h := float64(width), float64(height)
+	return Rectangle{
+		Top:    int(math.Round(n.Top * h)),
+		Right:  int(math.Round(n.Right * w)),
+		Bottom: int(math.Round(n.Bottom * h)),
+		Left:   int(math.Round(n.Left * w)),
+	}
+}
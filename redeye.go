@@ -0,0 +1,96 @@
+package gofacerecognition
+
+// Red-eye pixels are clearly redder than they are green or blue and not too dark to be sure of it
+const (
+	redEyeRatio    = 1.8  // minimum red / mean(green, blue)
+	redEyeMinRed   = 50   // minimum red value
+	redEyeMinShare = 0.04 // red pixels needed in the eye polygon to treat it as red-eye
+)
+
+// FixRedEye returns a copy of the image with red-eye removed from both eyes of the face, and the
+// number of eyes that were corrected
+// Only pixels inside the eye landmark polygons are considered, so red skin or clothing is left alone.
+// An eye is corrected when enough of it is red; its red pixels then take the mean of their green
+// and blue values, faded in with the strength of the red so the pupil keeps a natural edge
+// Grayscale images have no red to remove and come back unchanged
+func FixRedEye(img *ImageMatrix, landmarks FaceLandmarks) (*ImageMatrix, int) {
+	out := img.clone()
+	if out.IsGray() {
+		return out, 0
+	}
+
+	fixed := 0
+	for _, eye := range [][]Point{landmarks.LeftEye, landmarks.RightEye} {
+		if len(eye) >= 3 && fixRedEyeRegion(out, eye) {
+			fixed++
+		}
+	}
+	return out, fixed
+}
+
+// fixRedEyeRegion corrects the red pixels inside the eye polygon when they make up a red pupil
+func fixRedEyeRegion(img *ImageMatrix, eye []Point) bool {
+	left, top, right, bottom := eye[0].X, eye[0].Y, eye[0].X, eye[0].Y
+	for _, p := range eye[1:] {
+		left, right = min(left, p.X), max(right, p.X)
+		top, bottom = min(top, p.Y), max(bottom, p.Y)
+	}
+	left, top = max(left, 0), max(top, 0)
+	right, bottom = min(right, img.Width-1), min(bottom, img.Height-1)
+
+	type redPixel struct {
+		x, y     int
+		strength float64
+	}
+	var red []redPixel
+	inside := 0
+	for y := top; y <= bottom; y++ {
+		for x := left; x <= right; x++ {
+			if !pointInPolygon(float64(x)+0.5, float64(y)+0.5, eye) {
+				continue
+			}
+			inside++
+			if s := redness(img.At(x, y)); s > 0 {
+				red = append(red, redPixel{x, y, s})
+			}
+		}
+	}
+	if inside == 0 || float64(len(red)) < redEyeMinShare*float64(inside) {
+		return false
+	}
+
+	for _, p := range red {
+		r, g, b := img.At(p.x, p.y)
+		neutral := (float64(g) + float64(b)) / 2
+		img.Set(p.x, p.y, byte(float64(r)+(neutral-float64(r))*p.strength+0.5), g, b)
+	}
+	return true
+}
+
+// redness returns how strongly a pixel looks like red-eye, from 0 (not at all) to 1
+func redness(r, g, b byte) float64 {
+	if r < redEyeMinRed {
+		return 0
+	}
+	ratio := float64(r) / max((float64(g)+float64(b))/2, 1)
+	if ratio < redEyeRatio {
+		return 0
+	}
+	// Fade in over the range above the threshold so the edge of the correction is soft
+	return min((ratio-redEyeRatio)/redEyeRatio+0.5, 1)
+}
+
+// pointInPolygon reports whether (x, y) lies inside the polygon, by counting edge crossings of a ray
+func pointInPolygon(x, y float64, polygon []Point) bool {
+	inside := false
+	j := len(polygon) - 1
+	for i := range polygon {
+		xi, yi := float64(polygon[i].X), float64(polygon[i].Y)
+		xj, yj := float64(polygon[j].X), float64(polygon[j].Y)
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+		j = i
+	}
+	return inside
+}
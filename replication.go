@@ -0,0 +1,374 @@
+package gofacerecognition
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shafiqaimanx/go_face_recognition/security"
+)
+
+// FaceDB replication is last-writer-wins per person: every change stamps the person with a version
+// (timestamp, node ID), and replicas keep whichever version is newest. Removals leave tombstones so
+// a deleted person is not brought back by a replica that has not seen the removal yet.
+// Timestamps come from a hybrid clock that never goes backwards and jumps past every version seen
+// from other nodes, so a change made after receiving another always wins over it despite clock skew.
+
+// replicaVersion orders the changes of one person across nodes
+type replicaVersion struct {
+	Time int64  `json:"time"`
+	Node string `json:"node"`
+	Seq  uint64 `json:"seq"` // local change counter when the version was stored, not compared
+}
+
+// newer reports whether v wins over o
+func (v replicaVersion) newer(o replicaVersion) bool {
+	if v.Time != o.Time {
+		return v.Time > o.Time
+	}
+	return v.Node > o.Node
+}
+
+// Change is the latest state of one person as shipped between replicas
+type Change struct {
+	PersonID string  `json:"person_id"`
+	Time     int64   `json:"time"` // version timestamp in unix nanoseconds
+	Node     string  `json:"node"` // node that made the change, breaks timestamp ties
+	Deleted  bool    `json:"deleted,omitempty"`
+	Person   *Person `json:"person,omitempty"` // nil for deletions
+}
+
+// NodeID returns the replica ID stamped on local changes
+func (db *FaceDB) NodeID() string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.nodeID
+}
+
+// SetNodeID sets the replica ID stamped on local changes, it is persisted by Save
+// Every node of a deployment needs a distinct ID, so set one when databases are copied between hosts
+func (db *FaceDB) SetNodeID(id string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.nodeID = id
+}
+
+// Changes returns up to limit changes stored locally after cursor since, in order, and the cursor
+// to pass next time; limit <= 0 returns all of them
+// Only the latest state of each person is kept, so a person changed several times appears once
+func (db *FaceDB) Changes(since uint64, limit int) ([]Change, uint64) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var changes []Change
+	seqs := make(map[string]uint64)
+	for id, v := range db.versions {
+		if v.Seq > since {
+			p := db.people[id].clone()
+			changes = append(changes, Change{PersonID: id, Time: v.Time, Node: v.Node, Person: &p})
+			seqs[id] = v.Seq
+		}
+	}
+	for id, v := range db.tombstones {
+		if v.Seq > since {
+			changes = append(changes, Change{PersonID: id, Time: v.Time, Node: v.Node, Deleted: true})
+			seqs[id] = v.Seq
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return seqs[changes[i].PersonID] < seqs[changes[j].PersonID] })
+	if limit > 0 && len(changes) > limit {
+		changes = changes[:limit]
+		return changes, seqs[changes[limit-1].PersonID]
+	}
+	return changes, db.seq
+}
+
+// Apply merges changes from another replica, keeping the newest version of every person
+// It returns how many changes were newer than the local state and applied
+func (db *FaceDB) Apply(changes []Change) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	applied := 0
+	for _, c := range changes {
+		if c.PersonID == "" || (!c.Deleted && (c.Person == nil || c.Person.ID != c.PersonID)) {
+			return applied, fmt.Errorf("invalid change for person '%s'", c.PersonID)
+		}
+
+		incoming := replicaVersion{Time: c.Time, Node: c.Node}
+		current, ok := db.versions[c.PersonID]
+		if !ok {
+			current = db.tombstones[c.PersonID]
+		}
+		if c.Time > db.clock {
+			db.clock = c.Time
+		}
+		if !incoming.newer(current) {
+			continue
+		}
+
+		db.seq++
+		incoming.Seq = db.seq
+		if c.Deleted {
+			db.remove(c.PersonID)
+			db.tombstones[c.PersonID] = incoming
+		} else {
+			if _, exists := db.people[c.PersonID]; !exists {
+				db.order = append(db.order, c.PersonID)
+			}
+			p := c.Person.clone()
+			db.people[c.PersonID] = &p
+			db.versions[c.PersonID] = incoming
+			delete(db.tombstones, c.PersonID)
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+// PruneTombstones forgets removals older than before and returns how many were dropped
+// A replica that has not synced since then can bring pruned people back, so keep a generous margin
+func (db *FaceDB) PruneTombstones(before time.Time) int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	pruned := 0
+	for id, v := range db.tombstones {
+		if v.Time < before.UnixNano() {
+			delete(db.tombstones, id)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// touch stamps a locally changed person with a new version, the caller holds the write lock
+func (db *FaceDB) touch(id string) {
+	db.versions[id] = db.nextVersion()
+	delete(db.tombstones, id)
+}
+
+// nextVersion advances the hybrid clock and the change counter
+func (db *FaceDB) nextVersion() replicaVersion {
+	now := time.Now().UnixNano()
+	if now <= db.clock {
+		now = db.clock + 1
+	}
+	db.clock = now
+	db.seq++
+	return replicaVersion{Time: now, Node: db.nodeID, Seq: db.seq}
+}
+
+// replicationBatch bounds the changes returned by one GET /replicate
+const replicationBatch = 500
+
+// replicationResponse is the body of a GET /replicate response
+type replicationResponse struct {
+	Node    string   `json:"node"`
+	Next    uint64   `json:"next"` // cursor for the following request
+	More    bool     `json:"more,omitempty"`
+	Changes []Change `json:"changes"`
+}
+
+// NewReplicationHandler serves the changes of db to peer Replicators at GET /replicate?since=N
+// Only requests signed with a key of keys are served, see ReplicatorConfig.Keys; a nil ring rejects all
+func NewReplicationHandler(db *FaceDB, keys *security.KeyRing) http.Handler {
+	mux := http.NewServeMux()
+	// Other methods get 405 with an Allow header from the mux, before authentication
+	mux.Handle("GET /replicate", requirePeerAuth(keys, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var since uint64
+		if s := r.URL.Query().Get("since"); s != "" {
+			var err error
+			if since, err = strconv.ParseUint(s, 10, 64); err != nil {
+				WriteHTTPError(w, &APIError{Code: CodeInvalidArgument, Message: "invalid since"})
+				return
+			}
+		}
+
+		changes, next := db.Changes(since, replicationBatch)
+		resp := replicationResponse{Node: db.NodeID(), Next: next, More: len(changes) == replicationBatch, Changes: changes}
+		if resp.Changes == nil {
+			resp.Changes = []Change{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})))
+	return mux
+}
+
+// ReplicatorConfig configures a Replicator
+type ReplicatorConfig struct {
+	Peers    []string      // base URLs of peers serving NewReplicationHandler, /replicate is appended
+	Interval time.Duration // time between sync rounds in Run (default 5s)
+	Client   *http.Client  // defaults to http.DefaultClient
+	// Keys signs the requests to peers, which serve only nodes holding a key of their own ring
+	Keys *security.KeyRing
+	// Save writes the database to its path after changes from a peer were applied
+	Save bool
+	// OnError is called with failed syncs in Run, which keeps going
+	OnError func(peer string, err error)
+}
+
+// Replicator keeps a FaceDB in sync with its peers by pulling their changes
+// Changes a node applies get a new local position in its log, so they propagate on to nodes that
+// only pull from it, and the peers of a deployment do not need to form a full mesh
+type Replicator struct {
+	db     *FaceDB
+	config ReplicatorConfig
+
+	mu      sync.Mutex
+	cursors map[string]peerCursor
+}
+
+// peerCursor is how far a peer's change log has been read
+type peerCursor struct {
+	node string
+	next uint64
+}
+
+// NewReplicator creates a Replicator for db
+func NewReplicator(db *FaceDB, config ReplicatorConfig) *Replicator {
+	if config.Interval <= 0 {
+		config.Interval = 5 * time.Second
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	return &Replicator{db: db, config: config, cursors: make(map[string]peerCursor)}
+}
+
+// Sync pulls the pending changes of every peer once and returns how many were applied
+func (r *Replicator) Sync(ctx context.Context) (int, error) {
+	total := 0
+	var errs []error
+	for _, peer := range r.config.Peers {
+		n, err := r.syncPeer(ctx, peer)
+		total += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", peer, err))
+		}
+	}
+
+	if total > 0 && r.config.Save {
+		if err := r.db.Save(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return total, errors.Join(errs...)
+}
+
+// Run syncs every Interval until ctx is done
+func (r *Replicator) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Sync(ctx); err != nil && ctx.Err() == nil && r.config.OnError != nil {
+			r.config.OnError(strings.Join(r.config.Peers, ","), err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Replicator) syncPeer(ctx context.Context, peer string) (int, error) {
+	r.mu.Lock()
+	cursor := r.cursors[peer]
+	r.mu.Unlock()
+
+	applied := 0
+	for {
+		resp, err := r.fetch(ctx, peer, cursor.next)
+		if err != nil {
+			return applied, err
+		}
+
+		// A peer that was replaced or lost its database restarts its log, read it from the start
+		if resp.Node != cursor.node || resp.Next < cursor.next {
+			if cursor.next != 0 {
+				cursor = peerCursor{node: resp.Node}
+				continue
+			}
+			cursor.node = resp.Node
+		}
+
+		n, err := r.db.Apply(resp.Changes)
+		applied += n
+		if err != nil {
+			return applied, err
+		}
+
+		cursor.next = resp.Next
+		r.mu.Lock()
+		r.cursors[peer] = cursor
+		r.mu.Unlock()
+
+		if !resp.More {
+			return applied, nil
+		}
+	}
+}
+
+func (r *Replicator) fetch(ctx context.Context, peer string, since uint64) (*replicationResponse, error) {
+	u := strings.TrimSuffix(peer, "/") + "/replicate?since=" + url.QueryEscape(strconv.FormatUint(since, 10))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if r.config.Keys != nil {
+		if err := signPeerRequest(req, r.config.Keys, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := r.config.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, ReadHTTPError(resp)
+	}
+
+	var rr replicationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rr); err != nil {
+		return nil, err
+	}
+	return &rr, nil
+}
+
+// Validate returns a *ConfigError listing every problem of the configuration
+func (c ReplicatorConfig) Validate() error {
+	p := configProblems{config: "ReplicatorConfig"}
+	seen := make(map[string]bool)
+	for i, peer := range c.Peers {
+		field := fmt.Sprintf("Peers[%d]", i)
+		u, err := url.Parse(peer)
+		switch {
+		case err != nil:
+			p.addErr(field, err, "use the base URL of the peer, such as http://10.0.0.2:8080")
+		case u.Scheme != "http" && u.Scheme != "https" || u.Host == "":
+			p.add(field, fmt.Sprintf("%q is not an http(s) URL", peer), "use the base URL of the peer, such as http://10.0.0.2:8080")
+		case seen[strings.TrimRight(peer, "/")]:
+			p.add(field, fmt.Sprintf("%q is listed twice", peer), "remove the duplicate")
+		}
+		seen[strings.TrimRight(peer, "/")] = true
+	}
+	if len(c.Peers) > 0 && c.Keys == nil {
+		p.add("Keys", "no key ring to sign requests with", "share a key ring with the peers, they reject unsigned requests")
+	}
+	p.checkNonNegative("Interval", int64(c.Interval), "use 0 for the 5s default")
+	return p.err()
+}
@@ -0,0 +1,188 @@
+package gofacerecognition
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// RequestOptions are the detection and matching settings a client may choose per call of a server,
+// so one deployment serves both fast previews and high-accuracy clients
+// Zero fields select the server's defaults
+type RequestOptions struct {
+	Model         DetectionModel
+	UpsampleTimes int
+	NumJitters    int
+	Tolerance     float64
+	MaxFaces      int // faces detected per image, the largest ones are kept
+}
+
+// RequestLimits are the defaults and bounds a server applies to RequestOptions
+type RequestLimits struct {
+	Defaults     RequestOptions   // zero fields default to HOG, 1 upsample, 1 jitter, tolerance 0.6 and 1 face
+	Models       []DetectionModel // models clients may pick (default the default model only)
+	MaxUpsample  int              // default 2
+	MaxJitters   int              // default 10
+	MaxTolerance float64          // default 1
+	MaxFaces     int              // default 10
+}
+
+// withDefaults fills the zero fields of the limits
+func (l RequestLimits) withDefaults() RequestLimits {
+	if l.Defaults.Model == "" {
+		l.Defaults.Model = HOG
+	}
+	if l.Defaults.UpsampleTimes <= 0 {
+		l.Defaults.UpsampleTimes = 1
+	}
+	if l.Defaults.NumJitters <= 0 {
+		l.Defaults.NumJitters = 1
+	}
+	if l.Defaults.Tolerance <= 0 {
+		l.Defaults.Tolerance = 0.6
+	}
+	if l.Defaults.MaxFaces <= 0 {
+		l.Defaults.MaxFaces = 1
+	}
+	if len(l.Models) == 0 {
+		l.Models = []DetectionModel{l.Defaults.Model}
+	}
+	if l.MaxUpsample <= 0 {
+		l.MaxUpsample = 2
+	}
+	if l.MaxJitters <= 0 {
+		l.MaxJitters = 10
+	}
+	if l.MaxTolerance <= 0 {
+		l.MaxTolerance = 1
+	}
+	if l.MaxFaces <= 0 {
+		l.MaxFaces = 10
+	}
+	return l
+}
+
+// Resolve returns the options to use for a call: zero fields of o take the defaults, and settings
+// beyond the limits are rejected with an *APIError of code CodeInvalidArgument rather than clamped,
+// so clients learn their request was not served as asked
+func (l RequestLimits) Resolve(o RequestOptions) (RequestOptions, error) {
+	l = l.withDefaults()
+
+	if o.Model == "" {
+		o.Model = l.Defaults.Model
+	}
+	allowed := false
+	valid := make([]string, len(l.Models))
+	for i, m := range l.Models {
+		allowed = allowed || m == o.Model
+		valid[i] = string(m)
+	}
+	if !allowed {
+		return RequestOptions{}, &InvalidModelError{Model: string(o.Model), Valid: valid}
+	}
+
+	var err error
+	resolveInt := func(name string, v *int, def, limit int) {
+		switch {
+		case err != nil:
+		case *v < 0:
+			err = invalidArgumentf("%s must not be negative", name)
+		case *v == 0:
+			*v = def
+		case *v > limit:
+			err = invalidArgumentf("%s %d is above the server limit of %d", name, *v, limit)
+		}
+	}
+	resolveInt("upsample", &o.UpsampleTimes, l.Defaults.UpsampleTimes, l.MaxUpsample)
+	resolveInt("jitters", &o.NumJitters, l.Defaults.NumJitters, l.MaxJitters)
+	resolveInt("max_faces", &o.MaxFaces, l.Defaults.MaxFaces, l.MaxFaces)
+	if err != nil {
+		return RequestOptions{}, err
+	}
+
+	switch {
+	case o.Tolerance < 0 || math.IsNaN(o.Tolerance):
+		return RequestOptions{}, invalidArgumentf("tolerance must not be negative")
+	case o.Tolerance == 0:
+		o.Tolerance = l.Defaults.Tolerance
+	case o.Tolerance > l.MaxTolerance:
+		return RequestOptions{}, invalidArgumentf("tolerance %v is above the server limit of %v", o.Tolerance, l.MaxTolerance)
+	}
+	return o, nil
+}
+
+// ParseRequestOptions reads RequestOptions from the query parameters model, upsample, jitters,
+// tolerance and max_faces; absent parameters are left zero
+func ParseRequestOptions(query url.Values) (RequestOptions, error) {
+	var o RequestOptions
+	o.Model = DetectionModel(query.Get("model"))
+
+	var err error
+	parseInt := func(name string, v *int) {
+		if s := query.Get(name); s != "" && err == nil {
+			if *v, err = strconv.Atoi(s); err != nil {
+				err = invalidArgumentf("bad %s %q", name, s)
+			}
+		}
+	}
+	parseInt("upsample", &o.UpsampleTimes)
+	parseInt("jitters", &o.NumJitters)
+	parseInt("max_faces", &o.MaxFaces)
+	if err != nil {
+		return RequestOptions{}, err
+	}
+
+	if s := query.Get("tolerance"); s != "" {
+		if o.Tolerance, err = strconv.ParseFloat(s, 64); err != nil {
+			return RequestOptions{}, invalidArgumentf("bad tolerance %q", s)
+		}
+	}
+	return o, nil
+}
+
+// invalidArgumentf returns an *APIError of code CodeInvalidArgument
+func invalidArgumentf(format string, args ...any) error {
+	return &APIError{Code: CodeInvalidArgument, Message: fmt.Sprintf(format, args...)}
+}
+
+// LargestFaces returns the n largest rectangles, largest first
+func LargestFaces(locations []Rectangle, n int) []Rectangle {
+	sorted := append([]Rectangle(nil), locations...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Area() > sorted[j].Area()
+	})
+	return sorted[:max(0, min(n, len(sorted)))]
+}
+
+// EncodeLargestFaces detects the faces of img with the settings of a request and encodes the
+// opts.MaxFaces largest, largest first; faces beyond them are not encoded, which saves most of the time
+// An image without faces returns none and no error
+// Config.Preprocessing is applied first; rectangles are in the coordinates of img
+func (fr *FaceRecognizer) EncodeLargestFaces(img *ImageMatrix, opts RequestOptions) ([]Face, error) {
+	img, original := fr.preprocessImage(img)
+	locations, err := fr.faceLocations(img, max(opts.UpsampleTimes, 1), opts.Model)
+	if err != nil {
+		return nil, err
+	}
+	locations = LargestFaces(locations, max(opts.MaxFaces, 1))
+	if len(locations) == 0 {
+		return nil, nil
+	}
+
+	encodings, err := fr.FaceEncodings(img, locations, max(opts.NumJitters, 1), LandmarkLarge)
+	if err != nil {
+		return nil, err
+	}
+	if len(encodings) != len(locations) {
+		return nil, errors.New("no encoding computed")
+	}
+
+	faces := make([]Face, len(locations))
+	for i := range faces {
+		faces[i] = original(Face{Rectangle: locations[i], Encoding: encodings[i]})
+	}
+	return faces, nil
+}
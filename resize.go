@@ -0,0 +1,76 @@
+package gofacerecognition
+
+import "math"
+
+// Resize returns a copy of the image scaled to width x height with bilinear interpolation
+// When one dimension is <= 0 it is derived from the other, keeping the aspect ratio
+func (im *ImageMatrix) Resize(width, height int) *ImageMatrix {
+	if im.Width == 0 || im.Height == 0 {
+		return NewImageMatrix(0, 0)
+	}
+	switch {
+	case width <= 0 && height <= 0:
+		return NewImageMatrix(0, 0)
+	case width <= 0:
+		width = max(1, int(math.Round(float64(im.Width)*float64(height)/float64(im.Height))))
+	case height <= 0:
+		height = max(1, int(math.Round(float64(im.Height)*float64(width)/float64(im.Width))))
+	}
+
+	out := im.newLike(width, height)
+	bpp := im.bytesPerPixel()
+	sx := float64(im.Width) / float64(width)
+	sy := float64(im.Height) / float64(height)
+
+	// Source columns and weights are the same for every row, so compute them once
+	x0s := make([]int, width)
+	x1s := make([]int, width)
+	wxs := make([]float64, width)
+	for x := 0; x < width; x++ {
+		x0s[x], x1s[x], wxs[x] = resizeTap(x, sx, im.Width)
+	}
+
+	for y := 0; y < height; y++ {
+		y0, y1, wy := resizeTap(y, sy, im.Height)
+		row0 := im.Pixels[y0*im.Stride:]
+		row1 := im.Pixels[y1*im.Stride:]
+		dst := out.Pixels[y*out.Stride:]
+		for x := 0; x < width; x++ {
+			o0, o1, wx := x0s[x]*bpp, x1s[x]*bpp, wxs[x]
+			for c := 0; c < bpp; c++ {
+				top := float64(row0[o0+c]) + (float64(row0[o1+c])-float64(row0[o0+c]))*wx
+				bottom := float64(row1[o0+c]) + (float64(row1[o1+c])-float64(row1[o0+c]))*wx
+				dst[x*bpp+c] = byte(top + (bottom-top)*wy + 0.5)
+			}
+		}
+	}
+
+	return out
+}
+
+// ResizeMaxDim scales the image down so that its longer side is at most maxDim pixels, keeping the aspect ratio
+// Images that already fit, and maxDim <= 0, return the receiver unchanged
+// Face locations found on the result map back to the original by multiplying with im.Width / result.Width
+func (im *ImageMatrix) ResizeMaxDim(maxDim int) *ImageMatrix {
+	if maxDim <= 0 || (im.Width <= maxDim && im.Height <= maxDim) {
+		return im
+	}
+	if im.Width >= im.Height {
+		return im.Resize(maxDim, 0)
+	}
+	return im.Resize(0, maxDim)
+}
+
+// resizeTap maps destination index i to the two neighbouring source indices and the weight of the second
+// Pixel centers are aligned, so the image does not shift when scaled
+func resizeTap(i int, scale float64, size int) (int, int, float64) {
+	pos := (float64(i)+0.5)*scale - 0.5
+	if pos <= 0 {
+		return 0, 0, 0
+	}
+	i0 := int(pos)
+	if i0 >= size-1 {
+		return size - 1, size - 1, 0
+	}
+	return i0, i0 + 1, pos - float64(i0)
+}
@@ -0,0 +1,606 @@
+// Package rules evaluates small boolean expressions over face events, so alerting and access
+// decisions can live in configuration instead of code
+//
+// Expressions look like
+//
+//	match.distance < 0.45 && face.width > 80 && hour(now) < 20
+//
+// and support numbers, 'single' or "double" quoted strings, true, false, nil, dotted variable names,
+// the operators || && ! == != < <= > >= + - * / % and parentheses, and the functions listed in Functions
+//
+// Missing variables evaluate to nil. Ordering comparisons with nil are false and arithmetic on nil
+// gives nil, so a condition on match.distance simply does not hold for an unknown face
+package rules
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Env holds the variables of an expression, nested maps are reached with dots (match.distance)
+type Env map[string]interface{}
+
+// Func is a function callable from expressions
+type Func func(args ...interface{}) (interface{}, error)
+
+// Functions are available to every expression, add entries to extend the language
+var Functions = map[string]Func{
+	"hour":    timeFunc(func(t time.Time) float64 { return float64(t.Hour()) }),
+	"minute":  timeFunc(func(t time.Time) float64 { return float64(t.Minute()) }),
+	"weekday": timeFunc(func(t time.Time) float64 { return float64(t.Weekday()) }), // 0 is Sunday
+	"abs":     numberFunc(math.Abs),
+	"min":     func(args ...interface{}) (interface{}, error) { return reduceNumbers("min", args, math.Min) },
+	"max":     func(args ...interface{}) (interface{}, error) { return reduceNumbers("max", args, math.Max) },
+	"len": func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("len takes 1 argument")
+		}
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("len: want string, got %s", typeName(args[0]))
+		}
+		return float64(len(s)), nil
+	},
+	"lower": stringFunc(strings.ToLower),
+	"upper": stringFunc(strings.ToUpper),
+	"contains": func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("contains takes 2 arguments")
+		}
+		s, ok1 := args[0].(string)
+		sub, ok2 := args[1].(string)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("contains: want strings")
+		}
+		return strings.Contains(s, sub), nil
+	},
+}
+
+// Program is a compiled expression, safe for concurrent use
+type Program struct {
+	src  string
+	root node
+}
+
+// Compile parses an expression
+func Compile(src string) (*Program, error) {
+	p := &parser{src: src}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+	return &Program{src: src, root: root}, nil
+}
+
+// MustCompile is Compile that panics on error, for expressions fixed at build time
+func MustCompile(src string) *Program {
+	p, err := Compile(src)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the source of the expression
+func (p *Program) String() string {
+	return p.src
+}
+
+// Eval evaluates the expression, results are float64, string, bool, time.Time or nil
+func (p *Program) Eval(env Env) (interface{}, error) {
+	return p.root.eval(env)
+}
+
+// EvalBool evaluates an expression that must produce a bool
+func (p *Program) EvalBool(env Env) (bool, error) {
+	v, err := p.root.eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %q: result is %s, want bool", p.src, typeName(v))
+	}
+	return b, nil
+}
+
+// Tokens
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+	num  float64
+}
+
+type parser struct {
+	src    string
+	tokens []token
+	pos    int
+}
+
+func (p *parser) errorf(tok token, format string, args ...interface{}) error {
+	return fmt.Errorf("expression %q at offset %d: %s", p.src, tok.pos, fmt.Sprintf(format, args...))
+}
+
+// twoCharOps must be matched before their one character prefixes
+var twoCharOps = []string{"||", "&&", "==", "!=", "<=", ">="}
+
+func (p *parser) tokenize() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9' || (c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9'):
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.' || s[j] == '_' ||
+				s[j] == 'e' || s[j] == 'E' || ((s[j] == '+' || s[j] == '-') && (s[j-1] == 'e' || s[j-1] == 'E'))) {
+				j++
+			}
+			n, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return p.errorf(token{pos: i}, "bad number %q", s[i:j])
+			}
+			p.tokens = append(p.tokens, token{kind: tokNumber, text: s[i:j], pos: i, num: n})
+			i = j
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return p.errorf(token{pos: i}, "unterminated string")
+			}
+			p.tokens = append(p.tokens, token{kind: tokString, text: b.String(), pos: i})
+			i = j + 1
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(s) && (s[j] == '_' || s[j] == '.' || s[j] >= 'a' && s[j] <= 'z' || s[j] >= 'A' && s[j] <= 'Z' || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			p.tokens = append(p.tokens, token{kind: tokIdent, text: s[i:j], pos: i})
+			i = j
+		default:
+			op := ""
+			for _, two := range twoCharOps {
+				if strings.HasPrefix(s[i:], two) {
+					op = two
+					break
+				}
+			}
+			if op == "" && strings.ContainsRune("!<>+-*/%(),", rune(c)) {
+				op = string(c)
+			}
+			if op == "" {
+				return p.errorf(token{pos: i}, "unexpected character %q", c)
+			}
+			p.tokens = append(p.tokens, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	p.tokens = append(p.tokens, token{kind: tokEOF, pos: len(s)})
+	return nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// Parsing, by precedence climbing
+
+var precedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3,
+	"<": 4, "<=": 4, ">": 4, ">=": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+func (p *parser) parseExpr(minPrec int) (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		prec, ok := precedence[tok.text]
+		if tok.kind != tokOp || !ok || prec <= minPrec {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseExpr(prec)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: tok.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	tok := p.peek()
+	if tok.kind == tokOp && (tok.text == "!" || tok.text == "-") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: tok.text, operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		return literal{tok.num}, nil
+	case tokString:
+		return literal{tok.text}, nil
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return literal{true}, nil
+		case "false":
+			return literal{false}, nil
+		case "nil", "null":
+			return literal{nil}, nil
+		}
+		if p.peek().text != "(" {
+			return variable(strings.Split(tok.text, ".")), nil
+		}
+		fn, ok := Functions[tok.text]
+		if !ok {
+			return nil, p.errorf(tok, "unknown function %q", tok.text)
+		}
+		p.next()
+		call := &callNode{name: tok.text, fn: fn}
+		if p.peek().text == ")" {
+			p.next()
+			return call, nil
+		}
+		for {
+			arg, err := p.parseExpr(0)
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			sep := p.next()
+			if sep.text == ")" {
+				return call, nil
+			}
+			if sep.text != "," {
+				return nil, p.errorf(sep, "expected , or ) in call to %s", tok.text)
+			}
+		}
+	case tokOp:
+		if tok.text == "(" {
+			inner, err := p.parseExpr(0)
+			if err != nil {
+				return nil, err
+			}
+			if closing := p.next(); closing.text != ")" {
+				return nil, p.errorf(closing, "expected )")
+			}
+			return inner, nil
+		}
+	case tokEOF:
+		return nil, p.errorf(tok, "unexpected end of expression")
+	}
+	return nil, p.errorf(tok, "unexpected %q", tok.text)
+}
+
+// Evaluation
+
+type node interface {
+	eval(env Env) (interface{}, error)
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (l literal) eval(Env) (interface{}, error) {
+	return l.value, nil
+}
+
+// variable is a dotted name, missing variables evaluate to nil
+type variable []string
+
+func (v variable) eval(env Env) (interface{}, error) {
+	var cur interface{} = map[string]interface{}(env)
+	for _, part := range v {
+		switch m := cur.(type) {
+		case map[string]interface{}:
+			cur = m[part]
+		case Env:
+			cur = m[part]
+		default:
+			return nil, nil
+		}
+	}
+	return normalize(cur), nil
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+func (u *unaryNode) eval(env Env) (interface{}, error) {
+	v, err := u.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if u.op == "!" {
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("! applied to %s", typeName(v))
+		}
+		return !b, nil
+	}
+	n, ok := v.(float64)
+	if !ok {
+		return nil, fmt.Errorf("- applied to %s", typeName(v))
+	}
+	return -n, nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (b *binaryNode) eval(env Env) (interface{}, error) {
+	l, err := b.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// && and || short-circuit, so guards like `match.name != nil && ...` work
+	if b.op == "&&" || b.op == "||" {
+		lb, ok := l.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s applied to %s", b.op, typeName(l))
+		}
+		if (b.op == "&&" && !lb) || (b.op == "||" && lb) {
+			return lb, nil
+		}
+		r, err := b.right.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		rb, ok := r.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s applied to %s", b.op, typeName(r))
+		}
+		return rb, nil
+	}
+
+	r, err := b.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch b.op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	}
+
+	if l == nil || r == nil {
+		switch b.op {
+		case "<", "<=", ">", ">=":
+			return false, nil
+		}
+		return nil, nil
+	}
+
+	if ls, ok := l.(string); ok {
+		rs, ok := r.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s between string and %s", b.op, typeName(r))
+		}
+		switch b.op {
+		case "+":
+			return ls + rs, nil
+		case "<":
+			return ls < rs, nil
+		case "<=":
+			return ls <= rs, nil
+		case ">":
+			return ls > rs, nil
+		case ">=":
+			return ls >= rs, nil
+		}
+		return nil, fmt.Errorf("%s is not defined for strings", b.op)
+	}
+
+	ln, ok1 := l.(float64)
+	rn, ok2 := r.(float64)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("%s between %s and %s", b.op, typeName(l), typeName(r))
+	}
+	switch b.op {
+	case "+":
+		return ln + rn, nil
+	case "-":
+		return ln - rn, nil
+	case "*":
+		return ln * rn, nil
+	case "/":
+		return ln / rn, nil
+	case "%":
+		return math.Mod(ln, rn), nil
+	case "<":
+		return ln < rn, nil
+	case "<=":
+		return ln <= rn, nil
+	case ">":
+		return ln > rn, nil
+	case ">=":
+		return ln >= rn, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", b.op)
+}
+
+type callNode struct {
+	name string
+	fn   Func
+	args []node
+}
+
+func (c *callNode) eval(env Env) (interface{}, error) {
+	args := make([]interface{}, len(c.args))
+	for i, arg := range c.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	v, err := c.fn(args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", c.name, err)
+	}
+	return normalize(v), nil
+}
+
+// normalize converts Go numbers to float64, the only numeric type of the language
+func normalize(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case uint:
+		return float64(n)
+	case uint32:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	case float32:
+		return float64(n)
+	case time.Duration:
+		return n.Seconds()
+	}
+	return v
+}
+
+func equal(a, b interface{}) bool {
+	if ta, ok := a.(time.Time); ok {
+		tb, ok := b.(time.Time)
+		return ok && ta.Equal(tb)
+	}
+	return a == b
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case time.Time:
+		return "time"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func timeFunc(f func(time.Time) float64) Func {
+	return func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("takes 1 argument")
+		}
+		t, ok := args[0].(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("want time, got %s", typeName(args[0]))
+		}
+		return f(t), nil
+	}
+}
+
+func numberFunc(f func(float64) float64) Func {
+	return func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("takes 1 argument")
+		}
+		n, ok := args[0].(float64)
+		if !ok {
+			return nil, fmt.Errorf("want number, got %s", typeName(args[0]))
+		}
+		return f(n), nil
+	}
+}
+
+func stringFunc(f func(string) string) Func {
+	return func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("takes 1 argument")
+		}
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("want string, got %s", typeName(args[0]))
+		}
+		return f(s), nil
+	}
+}
+
+func reduceNumbers(name string, args []interface{}, f func(a, b float64) float64) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%s needs at least 1 argument", name)
+	}
+	var acc float64
+	for i, arg := range args {
+		n, ok := arg.(float64)
+		if !ok {
+			return nil, fmt.Errorf("want number, got %s", typeName(arg))
+		}
+		if i == 0 {
+			acc = n
+		} else {
+			acc = f(acc, n)
+		}
+	}
+	return acc, nil
+}
@@ -0,0 +1,168 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	facerec "github.com/shafiqaimanx/go_face_recognition"
+	"gopkg.in/yaml.v3"
+)
+
+// Rule is one entry of a RuleSet, the struct tags allow loading it from JSON or YAML
+type Rule struct {
+	Name     string `json:"name" yaml:"name"`
+	When     string `json:"when" yaml:"when"`         // expression that must evaluate to a bool
+	Decision string `json:"decision" yaml:"decision"` // stored in FaceEvent.Decision, e.g. "allow", "deny", "alert"
+	Drop     bool   `json:"drop,omitempty" yaml:"drop,omitempty"`
+}
+
+// RuleSet is an ordered list of rules; the first rule whose condition holds decides an event
+type RuleSet struct {
+	Rules   []Rule `json:"rules" yaml:"rules"`
+	Default string `json:"default,omitempty" yaml:"default,omitempty"` // decision when no rule matches
+}
+
+// LoadRuleSet reads a RuleSet from a YAML file (.yaml or .yml) or a JSON file (any other extension)
+//
+//	default: allow
+//	rules:
+//	  - name: after-hours
+//	    when: match.distance < 0.45 && face.quality > 0.7 && hour(now) >= 20
+//	    decision: alert
+func LoadRuleSet(path string) (RuleSet, error) {
+	var rs RuleSet
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rs, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &rs)
+	default:
+		err = json.Unmarshal(data, &rs)
+	}
+	if err != nil {
+		return rs, fmt.Errorf("failed to parse rules %s: %w", path, err)
+	}
+	return rs, nil
+}
+
+type compiledRule struct {
+	Rule
+	program *Program
+}
+
+// Hook is a facerec.DecisionHook driven by a RuleSet
+//
+// Expressions see these variables:
+//
+//	now                                   time of the frame
+//	camera, frame                         camera ID and frame index
+//	match.known                           whether the face was identified
+//	match.person_id, match.name           identity, nil when unknown
+//	match.distance                        distance to the matched person, nil when unknown
+//	face.index, face.left, face.top, face.width, face.height
+//	face.quality                          facerec.FaceEvent.Quality, 0 to 1
+//
+// plus anything added by Vars
+type Hook struct {
+	name    string
+	rules   []compiledRule
+	def     string
+	onMatch func(rule Rule, ev facerec.FaceEvent)
+
+	// Vars adds variables computed per event; nested maps are merged
+	Vars func(ev *facerec.FaceEvent) Env
+}
+
+// NewHook compiles every rule of rs, name identifies the hook in errors
+func NewHook(name string, rs RuleSet) (*Hook, error) {
+	h := &Hook{name: name, def: rs.Default}
+	for i, r := range rs.Rules {
+		p, err := Compile(r.When)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %w", i, r.Name, err)
+		}
+		h.rules = append(h.rules, compiledRule{Rule: r, program: p})
+	}
+	return h, nil
+}
+
+// OnMatch registers a callback run whenever a rule decides an event, e.g. to raise alerts
+func (h *Hook) OnMatch(fn func(rule Rule, ev facerec.FaceEvent)) {
+	h.onMatch = fn
+}
+
+// Name implements facerec.Plugin
+func (h *Hook) Name() string {
+	return h.name
+}
+
+// Decide implements facerec.DecisionHook
+func (h *Hook) Decide(ev *facerec.FaceEvent) (bool, error) {
+	env := EventEnv(ev)
+	if h.Vars != nil {
+		merge(env, h.Vars(ev))
+	}
+
+	for _, r := range h.rules {
+		ok, err := r.program.EvalBool(env)
+		if err != nil {
+			return true, fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+		if !ok {
+			continue
+		}
+		ev.Decision = r.Decision
+		if h.onMatch != nil {
+			h.onMatch(r.Rule, *ev)
+		}
+		return !r.Drop, nil
+	}
+
+	ev.Decision = h.def
+	return true, nil
+}
+
+// EventEnv returns the variables describing ev, see Hook
+func EventEnv(ev *facerec.FaceEvent) Env {
+	match := map[string]interface{}{"known": ev.PersonID != ""}
+	if ev.PersonID != "" {
+		match["person_id"] = ev.PersonID
+		match["name"] = ev.Name
+		match["distance"] = ev.Distance
+	}
+
+	return Env{
+		"now":    ev.Time,
+		"camera": ev.CameraID,
+		"frame":  ev.FrameIndex,
+		"match":  match,
+		"face": map[string]interface{}{
+			"index":   ev.FaceIndex,
+			"left":    ev.Rectangle.Left,
+			"top":     ev.Rectangle.Top,
+			"width":   ev.Rectangle.Width(),
+			"height":  ev.Rectangle.Height(),
+			"quality": ev.Quality,
+		},
+	}
+}
+
+// merge copies src into dst, merging nested maps instead of replacing them
+func merge(dst Env, src Env) {
+	for k, v := range src {
+		sub, ok1 := v.(map[string]interface{})
+		existing, ok2 := dst[k].(map[string]interface{})
+		if ok1 && ok2 {
+			for sk, sv := range sub {
+				existing[sk] = sv
+			}
+			continue
+		}
+		dst[k] = v
+	}
+}
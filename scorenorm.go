@@ -0,0 +1,114 @@
+package gofacerecognition
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// ScoreNormalization selects how raw distances are normalized against a cohort
+type ScoreNormalization string
+
+const (
+	// ZNorm normalizes with the distances of each gallery encoding to the cohort
+	// The statistics are computed once per gallery encoding and cached
+	ZNorm ScoreNormalization = "z_norm"
+	// TNorm normalizes with the distances of each probe to the cohort, compensating for probe quality
+	TNorm ScoreNormalization = "t_norm"
+)
+
+// DefaultNormalizedThreshold is the normalized score at or below which SearchNormalized reports a match
+// A score of -3 means the pair is three standard deviations closer than the typical impostor
+const DefaultNormalizedThreshold = -3.0
+
+// ScoreNormalizer turns raw distances into normalized scores using a cohort of background encodings
+// The cohort should hold encodings of people who are not in the gallery, captured in conditions similar to the probes
+// It is safe for concurrent use
+type ScoreNormalizer struct {
+	method ScoreNormalization
+	cohort []FaceEncoding
+	topN   int // when > 0, only the closest cohort distances are used (adaptive normalization)
+
+	mu    sync.Mutex
+	cache map[FaceEncoding]cohortStats
+}
+
+type cohortStats struct {
+	mean, std float64
+}
+
+// NewScoreNormalizer creates a ScoreNormalizer
+// topN > 0 only uses the topN closest cohort encodings, which works better when the cohort is large and varied
+func NewScoreNormalizer(method ScoreNormalization, cohort []FaceEncoding, topN int) *ScoreNormalizer {
+	if topN < 0 || topN > len(cohort) {
+		topN = 0
+	}
+	return &ScoreNormalizer{
+		method: method,
+		cohort: append([]FaceEncoding(nil), cohort...),
+		topN:   topN,
+		cache:  make(map[FaceEncoding]cohortStats),
+	}
+}
+
+// Method returns the normalization method
+func (n *ScoreNormalizer) Method() ScoreNormalization {
+	return n.method
+}
+
+// Normalize converts the distance between probe and a gallery encoding into a normalized score
+// Lower is more similar, as with raw distances
+func (n *ScoreNormalizer) Normalize(probe, gallery FaceEncoding, distance float64) float64 {
+	var stats cohortStats
+	switch n.method {
+	case ZNorm:
+		stats = n.cachedStats(gallery)
+	case TNorm:
+		stats = n.stats(probe)
+	default:
+		return distance
+	}
+	return (distance - stats.mean) / stats.std
+}
+
+// cachedStats returns the cohort statistics of a gallery encoding, computing them on first use
+func (n *ScoreNormalizer) cachedStats(enc FaceEncoding) cohortStats {
+	n.mu.Lock()
+	stats, ok := n.cache[enc]
+	n.mu.Unlock()
+	if ok {
+		return stats
+	}
+
+	stats = n.stats(enc)
+	n.mu.Lock()
+	n.cache[enc] = stats
+	n.mu.Unlock()
+	return stats
+}
+
+// stats returns the mean and standard deviation of the distances from enc to the cohort
+func (n *ScoreNormalizer) stats(enc FaceEncoding) cohortStats {
+	if len(n.cohort) == 0 {
+		return cohortStats{mean: 0, std: 1}
+	}
+
+	dists := FaceDistances(n.cohort, enc)
+	if n.topN > 0 {
+		sort.Float64s(dists)
+		dists = dists[:n.topN]
+	}
+
+	var sum, sumSq float64
+	for _, d := range dists {
+		sum += d
+		sumSq += d * d
+	}
+	mean := sum / float64(len(dists))
+	std := math.Sqrt(math.Max(0, sumSq/float64(len(dists))-mean*mean))
+	// Guard against a degenerate cohort
+	if std < 1e-6 {
+		std = 1e-6
+	}
+	return cohortStats{mean: mean, std: std}
+}
@@ -0,0 +1,201 @@
+package security
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeySize is the length in bytes of generated keys
+const KeySize = 32
+
+// Key is a secret identified by an ID, so signatures can name the key that made them
+type Key struct {
+	ID      string    `json:"id"`
+	Secret  []byte    `json:"secret"` // base64 in JSON
+	Created time.Time `json:"created"`
+}
+
+// GenerateKey creates a new random key
+func GenerateKey() (Key, error) {
+	id, err := NewID()
+	if err != nil {
+		return Key{}, err
+	}
+	secret, err := RandomBytes(KeySize)
+	if err != nil {
+		return Key{}, err
+	}
+	return Key{ID: id[:8], Secret: secret, Created: time.Now().UTC()}, nil
+}
+
+// ParseSecret decodes a secret written as "hex:<digits>" or "base64:<standard base64>"
+// The prefix is required because many strings are valid in both encodings and decode to different bytes
+func ParseSecret(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	var b []byte
+	var err error
+	switch {
+	case strings.HasPrefix(s, "hex:"):
+		b, err = hex.DecodeString(strings.TrimPrefix(s, "hex:"))
+	case strings.HasPrefix(s, "base64:"):
+		b, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(s, "base64:"))
+	default:
+		return nil, fmt.Errorf(`secret must start with "hex:" or "base64:"`)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decoding secret: %w", err)
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("secret is empty")
+	}
+	return b, nil
+}
+
+// KeyFromEnv loads a key whose secret is stored in an environment variable in the format of ParseSecret
+// The variable name is used as the key ID
+func KeyFromEnv(name string) (Key, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return Key{}, fmt.Errorf("environment variable %s is not set", name)
+	}
+	secret, err := ParseSecret(value)
+	if err != nil {
+		return Key{}, fmt.Errorf("environment variable %s: %w", name, err)
+	}
+	return Key{ID: name, Secret: secret}, nil
+}
+
+// KeyRing holds the keys that are still accepted for verification and the current one used for signing
+// Rotating adds a new current key while older keys keep verifying existing signatures until removed
+// It is safe for concurrent use
+type KeyRing struct {
+	mu      sync.RWMutex
+	keys    map[string]Key
+	current string
+}
+
+// keyRingFile is the on-disk layout of a KeyRing
+type keyRingFile struct {
+	Current string `json:"current"`
+	Keys    []Key  `json:"keys"`
+}
+
+// NewKeyRing creates a key ring; the last key given becomes the current one
+func NewKeyRing(keys ...Key) *KeyRing {
+	kr := &KeyRing{keys: make(map[string]Key)}
+	for _, k := range keys {
+		kr.Add(k)
+	}
+	return kr
+}
+
+// Add adds a key and makes it current
+func (kr *KeyRing) Add(key Key) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	kr.keys[key.ID] = key
+	kr.current = key.ID
+}
+
+// Rotate generates a new current key and returns it
+func (kr *KeyRing) Rotate() (Key, error) {
+	key, err := GenerateKey()
+	if err != nil {
+		return Key{}, err
+	}
+	kr.Add(key)
+	return key, nil
+}
+
+// Remove retires a key; signatures made with it no longer verify
+// The current key cannot be removed
+func (kr *KeyRing) Remove(id string) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	if id == kr.current {
+		return fmt.Errorf("key %s is the current key, rotate before removing it", id)
+	}
+	delete(kr.keys, id)
+	return nil
+}
+
+// Current returns the signing key, false when the ring is empty
+func (kr *KeyRing) Current() (Key, bool) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	k, ok := kr.keys[kr.current]
+	return k, ok
+}
+
+// Get returns the key with the given ID
+func (kr *KeyRing) Get(id string) (Key, bool) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	k, ok := kr.keys[id]
+	return k, ok
+}
+
+// Sign returns the ID of the current key and the MAC of parts under it
+func (kr *KeyRing) Sign(parts ...string) (string, []byte, error) {
+	key, ok := kr.Current()
+	if !ok {
+		return "", nil, fmt.Errorf("key ring is empty")
+	}
+	return key.ID, MAC(key.Secret, parts...), nil
+}
+
+// Verify reports whether sum is the MAC of parts under the key keyID
+func (kr *KeyRing) Verify(keyID string, sum []byte, parts ...string) bool {
+	key, ok := kr.Get(keyID)
+	if !ok {
+		return false
+	}
+	return CheckMAC(key.Secret, sum, parts...)
+}
+
+// LoadKeyRing reads a key ring saved by Save
+func LoadKeyRing(path string) (*KeyRing, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file keyRingFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("decoding key ring %s: %w", path, err)
+	}
+
+	kr := NewKeyRing(file.Keys...)
+	if _, ok := kr.keys[file.Current]; ok {
+		kr.current = file.Current
+	}
+	return kr, nil
+}
+
+// Save writes the key ring to path, readable only by the owner
+func (kr *KeyRing) Save(path string) error {
+	kr.mu.RLock()
+	file := keyRingFile{Current: kr.current}
+	for _, k := range kr.keys {
+		file.Keys = append(file.Keys, k)
+	}
+	kr.mu.RUnlock()
+
+	// Oldest first, so loading restores the same current key even without the current field
+	sort.Slice(file.Keys, func(i, j int) bool {
+		return file.Keys[i].Created.Before(file.Keys[j].Created)
+	})
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,49 @@
+// Package security provides the signing, key management and randomness helpers used by
+// verification receipts and other tamper-evident records
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strconv"
+)
+
+// Random is the source of randomness for generated keys and IDs
+// Replace it in tests or with a hardware RNG; it must be cryptographically secure in production
+var Random io.Reader = rand.Reader
+
+// MAC returns the HMAC-SHA256 of parts under key
+// Each part is length-prefixed, so ("ab", "c") and ("a", "bc") produce different MACs
+func MAC(key []byte, parts ...string) []byte {
+	mac := hmac.New(sha256.New, key)
+	for _, part := range parts {
+		mac.Write([]byte(strconv.Itoa(len(part)) + ":" + part))
+	}
+	return mac.Sum(nil)
+}
+
+// CheckMAC reports whether sum is the MAC of parts under key, in constant time
+func CheckMAC(key []byte, sum []byte, parts ...string) bool {
+	return hmac.Equal(sum, MAC(key, parts...))
+}
+
+// RandomBytes returns n bytes read from Random
+func RandomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(Random, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// NewID returns a random 16 byte hex identifier
+func NewID() (string, error) {
+	b, err := RandomBytes(16)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
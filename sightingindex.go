@@ -0,0 +1,91 @@
+package gofacerecognition
+
+import "sync"
+
+// SightingMatch is a past sighting found by SightingIndex.Search
+type SightingMatch struct {
+	Sighting Sighting
+	Distance float64 // distance between the probe and the sighting's encoding
+}
+
+// SightingIndex answers "has this face appeared before?" over a SightingStore with a FaceIndex
+// Sightings that belong to a track are represented by the track's best shot, its largest face,
+// so a person lingering in front of a camera does not flood the results
+// It is safe for concurrent use
+type SightingIndex struct {
+	store *SightingStore
+
+	mu        sync.Mutex
+	index     *FaceIndex
+	offset    int64
+	sightings map[string]Sighting // by ID, encodings are only kept in the index
+	bestShots map[string]string   // camera/track -> sighting ID
+}
+
+// NewSightingIndex indexes every sighting of store
+func NewSightingIndex(store *SightingStore, config IndexConfig) (*SightingIndex, error) {
+	si := &SightingIndex{
+		store:     store,
+		index:     NewFaceIndex(config),
+		sightings: make(map[string]Sighting),
+		bestShots: make(map[string]string),
+	}
+	if err := si.Refresh(); err != nil {
+		return nil, err
+	}
+	return si, nil
+}
+
+// Refresh indexes sightings appended to the store since the last call
+func (si *SightingIndex) Refresh() error {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	offset, err := si.store.ScanFrom(si.offset, func(s Sighting) error {
+		si.add(s)
+		return nil
+	})
+	si.offset = offset
+	return err
+}
+
+// Len returns the number of indexed sightings
+func (si *SightingIndex) Len() int {
+	return si.index.Len()
+}
+
+// Search returns up to k sightings within tolerance of probe, closest first
+// k <= 0 returns every match; default tolerance is 0.6
+func (si *SightingIndex) Search(probe FaceEncoding, k int, tolerance float64) []SightingMatch {
+	matches := si.index.Query(probe, k, tolerance)
+
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	results := make([]SightingMatch, 0, len(matches))
+	for _, m := range matches {
+		if s, ok := si.sightings[m.ID]; ok {
+			results = append(results, SightingMatch{Sighting: s, Distance: m.Distance})
+		}
+	}
+	return results
+}
+
+// add indexes s, replacing the current best shot of its track when s shows a larger face
+func (si *SightingIndex) add(s Sighting) {
+	if s.TrackID != "" {
+		key := s.CameraID + "/" + s.TrackID
+		if prev, ok := si.bestShots[key]; ok {
+			if si.sightings[prev].Rectangle.Area() >= s.Rectangle.Area() {
+				return
+			}
+			si.index.Delete(prev)
+			delete(si.sightings, prev)
+		}
+		si.bestShots[key] = s.ID
+	}
+
+	si.index.Insert(s.ID, s.Encoding)
+	s.Encoding = FaceEncoding{}
+	si.sightings[s.ID] = s
+}
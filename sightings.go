@@ -0,0 +1,256 @@
+package gofacerecognition
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sighting is a face seen by a camera, as recorded in a SightingStore
+type Sighting struct {
+	ID         string       `json:"id"`
+	Time       time.Time    `json:"time"`
+	CameraID   string       `json:"camera_id,omitempty"`
+	Source     string       `json:"source,omitempty"`   // file or stream the frame came from
+	TrackID    string       `json:"track_id,omitempty"` // sightings of one track share it, see VideoConfig.Tracking and SightingIndex
+	Rectangle  Rectangle    `json:"rectangle"`
+	PersonID   string       `json:"person_id,omitempty"` // empty when the face was not recognized
+	Name       string       `json:"name,omitempty"`
+	Distance   float64      `json:"distance,omitempty"`
+	Confidence float64      `json:"confidence,omitempty"`
+	Snapshot   string       `json:"snapshot,omitempty"` // path of a saved face crop, if any
+	Encoding   FaceEncoding `json:"encoding"`
+}
+
+// SightingQuery selects sightings, zero fields match everything
+type SightingQuery struct {
+	Person   string    // person ID or name, names match case-insensitively
+	CameraID string    // only sightings from this camera
+	From     time.Time // inclusive
+	To       time.Time // exclusive
+	Unknown  bool      // only unrecognized faces
+	Limit    int       // maximum number of results, most recent kept
+}
+
+// Matches reports whether s is selected by the query
+func (q SightingQuery) Matches(s Sighting) bool {
+	if q.Person != "" && s.PersonID != q.Person && !strings.EqualFold(s.Name, q.Person) {
+		return false
+	}
+	if q.Unknown && s.PersonID != "" {
+		return false
+	}
+	if q.CameraID != "" && s.CameraID != q.CameraID {
+		return false
+	}
+	if !q.From.IsZero() && s.Time.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !s.Time.Before(q.To) {
+		return false
+	}
+	return true
+}
+
+// SightingStore is an append-only log of sightings stored as JSON lines
+// Appends are flushed immediately so the log survives crashes; it is safe for concurrent use
+type SightingStore struct {
+	// OnCorruptLine is called with the offset of every line a scan skips because it cannot be
+	// decoded; set it before the store is used
+	OnCorruptLine func(offset int64, err error)
+
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// OpenSightingStore opens the log at path for appending, creating it if needed
+// A partial last line, left by a crash during an append, is cut off so the next append starts on a
+// line of its own
+func OpenSightingStore(path string) (*SightingStore, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := truncatePartialLine(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("sighting store %s: %w", path, err)
+	}
+	return &SightingStore{path: path, file: f}, nil
+}
+
+// truncatePartialLine cuts f after its last newline
+func truncatePartialLine(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	end := info.Size()
+	buf := make([]byte, 4096)
+	for end > 0 {
+		n := int64(len(buf))
+		if end < n {
+			n = end
+		}
+		if _, err := f.ReadAt(buf[:n], end-n); err != nil {
+			return err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			end = end - n + int64(i) + 1
+			break
+		}
+		end -= n
+	}
+	if end == info.Size() {
+		return nil
+	}
+	return f.Truncate(end)
+}
+
+// Append records s, assigning an ID and time when they are missing
+func (st *SightingStore) Append(s Sighting) (Sighting, error) {
+	if s.ID == "" {
+		id, err := newPersonID()
+		if err != nil {
+			return s, err
+		}
+		s.ID = id
+	}
+	if s.Time.IsZero() {
+		s.Time = time.Now()
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return s, err
+	}
+	data = append(data, '\n')
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.file == nil {
+		return s, fmt.Errorf("sighting store %s is closed", st.path)
+	}
+	_, err = st.file.Write(data)
+	return s, err
+}
+
+// Query returns the sightings selected by q in time order
+func (st *SightingStore) Query(q SightingQuery) ([]Sighting, error) {
+	var result []Sighting
+	err := st.Scan(func(s Sighting) error {
+		if q.Matches(s) {
+			result = append(result, s)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Time.Before(result[j].Time) })
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[len(result)-q.Limit:]
+	}
+	return result, nil
+}
+
+// Scan calls fn for every sighting in log order, stopping at the first error
+// A truncated last line, left by a crash or an Append in progress, is ignored; other lines that
+// cannot be decoded are skipped and reported to OnCorruptLine
+func (st *SightingStore) Scan(fn func(s Sighting) error) error {
+	_, err := st.ScanFrom(0, fn)
+	return err
+}
+
+// ScanFrom is like Scan but starts at a byte offset returned by an earlier call, which makes it cheap
+// to follow a growing log; it returns the offset to resume from
+func (st *SightingStore) ScanFrom(offset int64, fn func(s Sighting) error) (int64, error) {
+	f, err := os.Open(st.path)
+	if err != nil {
+		return offset, err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+
+	r := bufio.NewReaderSize(f, 64*1024)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// Incomplete line, read it again once it is finished
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+
+		if len(bytes.TrimSpace(line)) > 0 {
+			var s Sighting
+			if err := json.Unmarshal(line, &s); err != nil {
+				if st.OnCorruptLine != nil {
+					st.OnCorruptLine(offset, err)
+				}
+			} else if err := fn(s); err != nil {
+				return offset, err
+			}
+		}
+		offset += int64(len(line))
+	}
+}
+
+// Flush syncs the log to disk, so sightings appended so far survive a power loss
+func (st *SightingStore) Flush() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.file == nil {
+		return nil
+	}
+	return st.file.Sync()
+}
+
+// Close closes the log, Query and Scan keep working
+func (st *SightingStore) Close() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.file == nil {
+		return nil
+	}
+	err := st.file.Close()
+	st.file = nil
+	return err
+}
+
+// Name implements Plugin, so a store can be added to VideoConfig.Plugins to record every face event
+func (st *SightingStore) Name() string {
+	return "sightings"
+}
+
+// HandleEvent implements EventSink, confidences assume the default tolerance
+func (st *SightingStore) HandleEvent(ev FaceEvent) error {
+	s := Sighting{
+		Time:      ev.Time,
+		CameraID:  ev.CameraID,
+		TrackID:   ev.TrackID,
+		Rectangle: ev.Rectangle,
+		PersonID:  ev.PersonID,
+		Name:      ev.Name,
+		Encoding:  ev.Encoding,
+	}
+	if ev.PersonID != "" {
+		s.Distance = ev.Distance
+		s.Confidence = DistanceToConfidence(ev.Distance, 0)
+	}
+	_, err := st.Append(s)
+	return err
+}
@@ -0,0 +1,109 @@
+package gofacerecognition
+
+import (
+	"fmt"
+	"math"
+)
+
+// smartCropDetectDim bounds the image size SmartCrop detects faces on, thumbnails need no more
+const smartCropDetectDim = 1024
+
+// SmartCrop returns a targetW x targetH thumbnail of the image, cropped to keep its faces, see SmartCropRect
+func (fr *FaceRecognizer) SmartCrop(img *ImageMatrix, targetW, targetH int) (*ImageMatrix, error) {
+	if targetW <= 0 || targetH <= 0 {
+		return nil, fmt.Errorf("target size must be positive, got %dx%d", targetW, targetH)
+	}
+
+	scaled := img.ResizeMaxDim(smartCropDetectDim)
+	locations, err := fr.FaceLocations(scaled, 1, HOG)
+	if err != nil {
+		return nil, err
+	}
+	scale := float64(img.Width) / float64(scaled.Width)
+	for i, r := range locations {
+		locations[i] = Rectangle{
+			Top:    int(float64(r.Top) * scale),
+			Right:  min(int(float64(r.Right)*scale), img.Width),
+			Bottom: min(int(float64(r.Bottom)*scale), img.Height),
+			Left:   int(float64(r.Left) * scale),
+		}
+	}
+
+	return img.Crop(SmartCropRect(img.Width, img.Height, locations, targetW, targetH)).Resize(targetW, targetH), nil
+}
+
+// SmartCropRect returns the crop window of a width x height image with the aspect ratio of
+// targetW x targetH that best frames the faces, for callers that detected them already
+// The window is as large as the aspect ratio allows and slides along the other axis. Positions are
+// scored by the face area they contain, a face cut by the border counting against the window, and
+// by how close the faces sit to the rule-of-thirds lines or the vertical center line
+// Without faces the window is centered
+func SmartCropRect(width, height int, faces []Rectangle, targetW, targetH int) Rectangle {
+	aspect := float64(targetW) / float64(targetH)
+	cropW, cropH := width, int(math.Round(float64(width)/aspect))
+	if cropH > height {
+		cropW, cropH = int(math.Round(float64(height)*aspect)), height
+	}
+	cropW, cropH = max(min(cropW, width), 1), max(min(cropH, height), 1)
+
+	window := func(x, y int) Rectangle {
+		return Rectangle{Top: y, Right: x + cropW, Bottom: y + cropH, Left: x}
+	}
+
+	// Only one axis has room to move; slide along it in at most 200 steps
+	rangeX, rangeY := width-cropW, height-cropH
+	best := window(rangeX/2, rangeY/2)
+	if len(faces) == 0 || (rangeX == 0 && rangeY == 0) {
+		return best
+	}
+
+	bestScore := math.Inf(-1)
+	steps := max(rangeX, rangeY)
+	step := max(1, steps/200)
+	for offset := 0; offset <= steps; offset += step {
+		var w Rectangle
+		if rangeX > 0 {
+			w = window(offset, 0)
+		} else {
+			w = window(0, offset)
+		}
+		// Prefer the centered window among equal scores
+		score := smartCropScore(w, faces) - 1e-6*math.Abs(float64(offset-steps/2))
+		if score > bestScore {
+			best, bestScore = w, score
+		}
+	}
+	return best
+}
+
+// smartCropScore rates how well a crop window frames the faces
+func smartCropScore(w Rectangle, faces []Rectangle) float64 {
+	cw, ch := float64(w.Width()), float64(w.Height())
+	score := 0.0
+	for _, f := range faces {
+		area := float64(f.Area())
+		if area == 0 {
+			continue
+		}
+		coverage := float64(f.Intersect(w).Area()) / area
+		switch {
+		case coverage == 0:
+			continue
+		case coverage < 1:
+			// Half a face is worse than none
+			score -= area * (1 - coverage)
+			continue
+		}
+
+		// Distance of the face center to the nearest thirds line on each axis, as a fraction of the window
+		// Faces look best on the upper third, and horizontally on a third or centered
+		cx := (float64(f.Left+f.Right)/2 - float64(w.Left)) / cw
+		cy := (float64(f.Top+f.Bottom)/2 - float64(w.Top)) / ch
+		dx := min(math.Abs(cx-1.0/3), math.Abs(cx-0.5), math.Abs(cx-2.0/3))
+		dy := math.Abs(cy - 1.0/3)
+		thirds := math.Exp(-(dx*dx + dy*dy) / (2 * 0.15 * 0.15))
+
+		score += area * (1 + 0.5*thirds)
+	}
+	return score
+}
@@ -0,0 +1,256 @@
+package gofacerecognition
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// modulePath is the module path of the package, used to find its version in the build info
+const modulePath = "github.com/shafiqaimanx/go_face_recognition"
+
+// TelemetryConfig configures opt-in Telemetry
+type TelemetryConfig struct {
+	// Endpoint receives every report as a JSON POST, see TelemetryReport; required
+	Endpoint string
+	Interval time.Duration // time between reports (default 5 minutes)
+	// InstanceID tells the reports of one process apart, e.g. the name of an edge box; the default
+	// is random per process so nothing about the machine is sent
+	InstanceID string
+	Client     *http.Client      // default a client with a 10 second timeout
+	Headers    map[string]string // added to every request, e.g. an authorization header
+	Logger     *slog.Logger      // failed reports are logged at warn level; nil logs nothing
+}
+
+// TelemetryReport is the body of a telemetry request
+// It only holds aggregate counters since the process started; it never contains images,
+// encodings, names, rectangles or anything else about the faces processed
+type TelemetryReport struct {
+	InstanceID string    `json:"instance_id"`
+	Version    string    `json:"version"` // version of the package, "(devel)" when unknown
+	GoVersion  string    `json:"go_version"`
+	OS         string    `json:"os"`
+	Arch       string    `json:"arch"`
+	Started    time.Time `json:"started"`
+	Time       time.Time `json:"time"`
+
+	Detections        uint64  `json:"detections"`
+	DetectionErrors   uint64  `json:"detection_errors"`
+	FacesDetected     uint64  `json:"faces_detected"`
+	DetectionSeconds  float64 `json:"detection_seconds"` // total time spent detecting
+	Encodings         uint64  `json:"encodings"`
+	EncodingErrors    uint64  `json:"encoding_errors"`
+	FacesEncoded      uint64  `json:"faces_encoded"`
+	EncodingSeconds   float64 `json:"encoding_seconds"`
+	PoolSize          int     `json:"pool_size"`
+	PoolInUse         int     `json:"pool_in_use"`
+	ReportsFailed     uint64  `json:"reports_failed"` // earlier reports that could not be delivered
+	NativeBuffersLive int64   `json:"native_buffers_live"`
+}
+
+// Telemetry reports aggregate health counters of a process to an endpoint chosen by the operator,
+// to monitor fleets of edge boxes centrally. Nothing is sent unless Run or Report is called
+// Set it as Config.Metrics, with MultiMetrics when other metrics are collected too
+type Telemetry struct {
+	config TelemetryConfig
+
+	mu     sync.Mutex
+	report TelemetryReport
+}
+
+// NewTelemetry creates a Telemetry for config
+func NewTelemetry(config TelemetryConfig) (*Telemetry, error) {
+	if config.Endpoint == "" {
+		return nil, fmt.Errorf("telemetry endpoint is required")
+	}
+	if config.Interval <= 0 {
+		config.Interval = 5 * time.Minute
+	}
+	if config.InstanceID == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		config.InstanceID = hex.EncodeToString(b)
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	config.Logger = orDiscard(config.Logger)
+
+	return &Telemetry{
+		config: config,
+		report: TelemetryReport{
+			InstanceID: config.InstanceID,
+			Version:    packageVersion(),
+			GoVersion:  runtime.Version(),
+			OS:         runtime.GOOS,
+			Arch:       runtime.GOARCH,
+			Started:    time.Now().UTC(),
+		},
+	}, nil
+}
+
+// packageVersion returns the module version of the package from the build info
+func packageVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+	if info.Main.Path == modulePath {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			return dep.Version
+		}
+	}
+	return "(devel)"
+}
+
+// ObserveDetection implements Metrics
+func (t *Telemetry) ObserveDetection(model DetectionModel, faces int, elapsed time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.report.Detections++
+	t.report.FacesDetected += uint64(faces)
+	t.report.DetectionSeconds += elapsed.Seconds()
+	if err != nil {
+		t.report.DetectionErrors++
+	}
+}
+
+// ObserveEncoding implements Metrics
+func (t *Telemetry) ObserveEncoding(faces int, elapsed time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.report.Encodings++
+	t.report.FacesEncoded += uint64(faces)
+	t.report.EncodingSeconds += elapsed.Seconds()
+	if err != nil {
+		t.report.EncodingErrors++
+	}
+}
+
+// SetPoolUtilization implements Metrics
+func (t *Telemetry) SetPoolUtilization(inUse, size int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.report.PoolInUse, t.report.PoolSize = inUse, size
+}
+
+// Snapshot returns the report that would be sent now
+func (t *Telemetry) Snapshot() TelemetryReport {
+	t.mu.Lock()
+	report := t.report
+	t.mu.Unlock()
+
+	allocs, frees := NativeAllocStats()
+	report.NativeBuffersLive = allocs - frees
+	report.Time = time.Now().UTC()
+	return report
+}
+
+// Report sends the current counters to the endpoint
+func (t *Telemetry) Report(ctx context.Context) error {
+	body, err := json.Marshal(t.Snapshot())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.config.Client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			err = fmt.Errorf("telemetry endpoint returned %s", resp.Status)
+		}
+	}
+	if err != nil {
+		t.mu.Lock()
+		t.report.ReportsFailed++
+		t.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Run sends a report every Interval until ctx is done, then a last one within 5 seconds
+// Failed reports are logged and retried with the next one, which carries the same cumulative counters
+func (t *Telemetry) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := t.Report(ctx); err != nil && ctx.Err() == nil {
+				t.config.Logger.Warn("telemetry report failed", "endpoint", t.config.Endpoint, "err", err)
+			}
+		case <-ctx.Done():
+			final, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := t.Report(final); err != nil {
+				t.config.Logger.Warn("final telemetry report failed", "endpoint", t.config.Endpoint, "err", err)
+			}
+			cancel()
+			return
+		}
+	}
+}
+
+// MultiMetrics returns a Metrics passing every measurement to each of metrics, nil ones are skipped
+// Stages are passed to the ones implementing StageMetrics
+func MultiMetrics(metrics ...Metrics) Metrics {
+	var m multiMetrics
+	for _, x := range metrics {
+		if x != nil {
+			m = append(m, x)
+		}
+	}
+	return m
+}
+
+type multiMetrics []Metrics
+
+func (m multiMetrics) ObserveDetection(model DetectionModel, faces int, elapsed time.Duration, err error) {
+	for _, x := range m {
+		x.ObserveDetection(model, faces, elapsed, err)
+	}
+}
+
+func (m multiMetrics) ObserveEncoding(faces int, elapsed time.Duration, err error) {
+	for _, x := range m {
+		x.ObserveEncoding(faces, elapsed, err)
+	}
+}
+
+func (m multiMetrics) SetPoolUtilization(inUse, size int) {
+	for _, x := range m {
+		x.SetPoolUtilization(inUse, size)
+	}
+}
+
+func (m multiMetrics) ObserveStage(stage string, elapsed time.Duration) {
+	for _, x := range m {
+		if s, ok := x.(StageMetrics); ok {
+			s.ObserveStage(stage, elapsed)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package gofacerecognition
+
+// FaceLocationsTiled finds faces in images too large to upsample as a whole, such as drone or
+// surveillance stills: the image is split into overlapping tiles of tileSize pixels (default 1024),
+// each tile is upsampled once and searched, and the detections are mapped back to the image
+// Memory stays bounded by the tile size, so small faces are found without upsampling the full image
+//
+// overlap (default tileSize/4) should exceed the largest face expected: a face cut by one tile's
+// border then lies whole in its neighbour, and the cut-off part is dropped. Faces found twice in the
+// overlap are merged with NMS. The result is sorted by descending score
+func (fr *FaceRecognizer) FaceLocationsTiled(img *ImageMatrix, tileSize, overlap int, model DetectionModel) ([]ScoredRectangle, error) {
+	if tileSize <= 0 {
+		tileSize = 1024
+	}
+	if overlap <= 0 {
+		overlap = tileSize / 4
+	}
+	// Tiles must advance, and a face in the overlap must fit in one of them
+	overlap = min(overlap, tileSize/2)
+
+	if img.Width <= tileSize && img.Height <= tileSize {
+		return fr.FaceLocationsWithScores(img, 1, model)
+	}
+
+	step := tileSize - overlap
+	margin := max(4, tileSize/100)
+
+	var whole, cut []ScoredRectangle
+	for _, top := range tileOrigins(img.Height, tileSize, step) {
+		for _, left := range tileOrigins(img.Width, tileSize, step) {
+			tile := Rectangle{Top: top, Left: left, Right: min(left+tileSize, img.Width), Bottom: min(top+tileSize, img.Height)}
+			faces, err := fr.FaceLocationsWithScores(img.Crop(tile), 1, model)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, f := range faces {
+				r := ScoredRectangle{
+					Rectangle: Rectangle{Top: f.Top + top, Right: f.Right + left, Bottom: f.Bottom + top, Left: f.Left + left},
+					Score:     f.Score,
+				}
+				if touchesInnerEdge(r.Rectangle, tile, img, margin) {
+					cut = append(cut, r)
+				} else {
+					whole = append(whole, r)
+				}
+			}
+		}
+	}
+
+	// A detection at a tile border that is mostly covered by a whole one is the same face cut off;
+	// the rest are faces larger than the overlap, for which the cut-off box is the best there is
+	for _, c := range cut {
+		covered := false
+		for _, w := range whole {
+			if overlapOfSmaller(c.Rectangle, w.Rectangle) > 0.5 {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			whole = append(whole, c)
+		}
+	}
+
+	return NMS(whole, 0.5), nil
+}
+
+// tileOrigins returns the start of every tile along one axis, the last tile ending at the image border
+func tileOrigins(length, tileSize, step int) []int {
+	if length <= tileSize {
+		return []int{0}
+	}
+	var origins []int
+	for start := 0; ; start += step {
+		if start+tileSize >= length {
+			return append(origins, length-tileSize)
+		}
+		origins = append(origins, start)
+	}
+}
+
+// touchesInnerEdge reports whether r reaches within margin of a tile border that is not an image border
+func touchesInnerEdge(r, tile Rectangle, img *ImageMatrix, margin int) bool {
+	return (tile.Left > 0 && r.Left-tile.Left < margin) ||
+		(tile.Top > 0 && r.Top-tile.Top < margin) ||
+		(tile.Right < img.Width && tile.Right-r.Right < margin) ||
+		(tile.Bottom < img.Height && tile.Bottom-r.Bottom < margin)
+}
@@ -0,0 +1,98 @@
+package gofacerecognition
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// StageTiming is how long one stage of a request or frame took
+type StageTiming struct {
+	Stage    string        `json:"stage"`
+	Duration time.Duration `json:"duration"`
+}
+
+// StageTimings records the stages of one request or frame, so slow ones can be diagnosed from logs
+// instead of being reproduced locally. Methods are no-ops on a nil *StageTimings
+// It is not safe for concurrent use
+type StageTimings struct {
+	start  time.Time
+	stages []StageTiming
+}
+
+// NewStageTimings starts timing a request or frame at start
+func NewStageTimings(start time.Time) *StageTimings {
+	return &StageTimings{start: start}
+}
+
+// Since records a stage that began at start and ended now
+func (t *StageTimings) Since(stage string, start time.Time) {
+	if t != nil {
+		t.stages = append(t.stages, StageTiming{Stage: stage, Duration: time.Since(start)})
+	}
+}
+
+// Stages returns the recorded stages in the order they ended
+func (t *StageTimings) Stages() []StageTiming {
+	if t == nil {
+		return nil
+	}
+	return append([]StageTiming(nil), t.stages...)
+}
+
+// Total returns the time since the start, including time outside the recorded stages
+func (t *StageTimings) Total() time.Duration {
+	if t == nil {
+		return 0
+	}
+	return time.Since(t.start)
+}
+
+// String formats the total followed by every stage, e.g. "total=5.1s decode=3ms queue=4.9s detect=180ms"
+func (t *StageTimings) String() string {
+	if t == nil {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "total=%s", t.Total().Round(time.Microsecond))
+	for _, s := range t.stages {
+		fmt.Fprintf(&b, " %s=%s", s.Stage, s.Duration.Round(time.Microsecond))
+	}
+	return b.String()
+}
+
+type stageTimingsKey struct{}
+
+// WithStageTimings returns a context carrying t, for code further down a request to record its stages
+func WithStageTimings(ctx context.Context, t *StageTimings) context.Context {
+	return context.WithValue(ctx, stageTimingsKey{}, t)
+}
+
+// StageTimingsFromContext returns the timings carried by ctx, nil when there are none
+func StageTimingsFromContext(ctx context.Context) *StageTimings {
+	t, _ := ctx.Value(stageTimingsKey{}).(*StageTimings)
+	return t
+}
+
+// SlowLog logs requests and frames that take at least Threshold, with their stage timings and
+// settings. A nil *SlowLog or a zero Threshold logs nothing
+type SlowLog struct {
+	Threshold time.Duration
+	Logger    *slog.Logger // records are logged at warn level (default slog.Default())
+}
+
+// Observe logs what when t reached the threshold and reports whether it did
+// details are the settings of the request, e.g. its RequestOptions, and are logged with %+v
+func (l *SlowLog) Observe(what string, t *StageTimings, details any) bool {
+	if l == nil || l.Threshold <= 0 || t == nil || t.Total() < l.Threshold {
+		return false
+	}
+	logger := l.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.Warn("slow request", "what", what, "total", t.Total(), "stages", t.String(), "options", fmt.Sprintf("%+v", details))
+	return true
+}
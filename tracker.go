@@ -0,0 +1,132 @@
+package gofacerecognition
+
+import "sort"
+
+// TrackerConfig configures a Tracker
+type TrackerConfig struct {
+	IoUThreshold float64 // minimum overlap for a detection to continue a track (default 0.3)
+	MaxMisses    int     // frames a track survives without a matching detection (default 5)
+}
+
+// Track is a face followed across frames
+type Track struct {
+	ID          int
+	Rectangle   Rectangle
+	Hits        int  // frames with a matching detection
+	Misses      int  // consecutive frames without a matching detection
+	IsNew       bool // true on the frame the track was created
+	Encoding    FaceEncoding
+	HasEncoding bool
+}
+
+// Tracker assigns stable IDs to face detections across consecutive frames by IoU matching
+// Encodings only need to be computed for tracks where IsNew is true or HasEncoding is false
+type Tracker struct {
+	config TrackerConfig
+	tracks []*Track
+	nextID int
+}
+
+// NewTracker creates a Tracker
+func NewTracker(config TrackerConfig) *Tracker {
+	if config.IoUThreshold <= 0 {
+		config.IoUThreshold = 0.3
+	}
+	if config.MaxMisses <= 0 {
+		config.MaxMisses = 5
+	}
+	return &Tracker{config: config, nextID: 1}
+}
+
+// Update matches the detections of a new frame to existing tracks
+// Returns one track per detection, in the same order as detections
+func (t *Tracker) Update(detections []Rectangle) []Track {
+	type pair struct {
+		track, det int
+		iou        float64
+	}
+
+	var pairs []pair
+	for ti, tr := range t.tracks {
+		for di, det := range detections {
+			if iou := tr.Rectangle.IoU(det); iou >= t.config.IoUThreshold {
+				pairs = append(pairs, pair{ti, di, iou})
+			}
+		}
+	}
+
+	// Greedy assignment, best overlaps first
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].iou > pairs[j].iou
+	})
+
+	trackUsed := make([]bool, len(t.tracks))
+	assigned := make([]*Track, len(detections))
+	for _, p := range pairs {
+		if trackUsed[p.track] || assigned[p.det] != nil {
+			continue
+		}
+		trackUsed[p.track] = true
+		tr := t.tracks[p.track]
+		tr.Rectangle = detections[p.det]
+		tr.Hits++
+		tr.Misses = 0
+		tr.IsNew = false
+		assigned[p.det] = tr
+	}
+
+	// Age out unmatched tracks
+	live := t.tracks[:0]
+	for i, tr := range t.tracks {
+		if !trackUsed[i] {
+			tr.Misses++
+			tr.IsNew = false
+			if tr.Misses > t.config.MaxMisses {
+				continue
+			}
+		}
+		live = append(live, tr)
+	}
+	t.tracks = live
+
+	// Unmatched detections start new tracks
+	result := make([]Track, len(detections))
+	for di, det := range detections {
+		if assigned[di] == nil {
+			tr := &Track{ID: t.nextID, Rectangle: det, Hits: 1, IsNew: true}
+			t.nextID++
+			t.tracks = append(t.tracks, tr)
+			assigned[di] = tr
+		}
+		result[di] = *assigned[di]
+	}
+
+	return result
+}
+
+// SetEncoding stores the encoding computed for a track so later frames can reuse it
+// Returns false if the track no longer exists
+func (t *Tracker) SetEncoding(id int, encoding FaceEncoding) bool {
+	for _, tr := range t.tracks {
+		if tr.ID == id {
+			tr.Encoding = encoding
+			tr.HasEncoding = true
+			return true
+		}
+	}
+	return false
+}
+
+// Tracks returns all live tracks, including ones not matched in the latest frame
+func (t *Tracker) Tracks() []Track {
+	tracks := make([]Track, len(t.tracks))
+	for i, tr := range t.tracks {
+		tracks[i] = *tr
+	}
+	return tracks
+}
+
+// Reset drops all tracks
+func (t *Tracker) Reset() {
+	t.tracks = nil
+}
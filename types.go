@@ -8,6 +8,13 @@ type Rectangle struct {
 	Left   int
 }
 
+// ScoredRectangle is a detected face with the detector's confidence
+// HOG scores are SVM margins and CNN scores are MMOD confidences, both centered on 0
+type ScoredRectangle struct {
+	Rectangle
+	Score float64
+}
+
 // Width returns the width of the rectangle
 func (r Rectangle) Width() int {
 	return r.Right - r.Left
@@ -18,6 +25,33 @@ func (r Rectangle) Height() int {
 	return r.Bottom - r.Top
 }
 
+// Area returns the area of the rectangle, 0 for empty rectangles
+func (r Rectangle) Area() int {
+	if r.Width() <= 0 || r.Height() <= 0 {
+		return 0
+	}
+	return r.Width() * r.Height()
+}
+
+// Intersect returns the overlapping part of two rectangles
+func (r Rectangle) Intersect(o Rectangle) Rectangle {
+	return Rectangle{
+		Top:    max(r.Top, o.Top),
+		Right:  min(r.Right, o.Right),
+		Bottom: min(r.Bottom, o.Bottom),
+		Left:   max(r.Left, o.Left),
+	}
+}
+
+// IoU returns the intersection over union of two rectangles, between 0 and 1
+func (r Rectangle) IoU(o Rectangle) float64 {
+	inter := r.Intersect(o).Area()
+	if inter == 0 {
+		return 0
+	}
+	return float64(inter) / float64(r.Area()+o.Area()-inter)
+}
+
 // Point represents a 2D point (x, y)
 type Point struct {
 	X int
@@ -78,3 +112,20 @@ type Face struct {
 type RawLandmarks struct {
 	Points []Point
 }
+
+// Gender is the estimated gender of a face
+type Gender string
+
+const (
+	GenderMale   Gender = "male"
+	GenderFemale Gender = "female"
+)
+
+// AgeGender is the age and gender estimate for one face
+type AgeGender struct {
+	Age              float64 // expected age in years
+	AgeMin           int     // lower bound of the likely age range (one standard deviation)
+	AgeMax           int     // upper bound of the likely age range
+	Gender           Gender
+	GenderConfidence float64 // probability of Gender, between 0.5 and 1
+}
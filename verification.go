@@ -0,0 +1,181 @@
+package gofacerecognition
+
+import (
+	"encoding/hex"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/shafiqaimanx/go_face_recognition/security"
+)
+
+// VerificationDecision is the final outcome of a VerificationSession
+type VerificationDecision string
+
+const (
+	DecisionVerified VerificationDecision = "verified"
+	DecisionRejected VerificationDecision = "rejected"
+)
+
+// VerificationConfig configures a VerificationSession
+type VerificationConfig struct {
+	Key         []byte            // HMAC key used to sign receipts, required unless Keys is set
+	Keys        *security.KeyRing // signs with the current key of the ring instead of Key, allowing rotation
+	MaxAttempts int               // failed attempts allowed before lockout (default 3)
+	Lockout     time.Duration     // how long the session stays locked after MaxAttempts failures (default 5 minutes)
+	Tolerance   float64           // match tolerance (default 0.6)
+	// Now returns the current time, defaults to time.Now; override it to control timestamps in integrations
+	Now func() time.Time
+}
+
+// VerificationReceipt is a tamper-evident record of a verification decision
+// Signature is the hex HMAC-SHA256 of the decision, timestamp and template ID
+type VerificationReceipt struct {
+	KeyID      string               `json:"key_id,omitempty"` // key ring key that made Signature, empty for a plain Key
+	TemplateID string               `json:"template_id"`
+	Decision   VerificationDecision `json:"decision"`
+	Timestamp  time.Time            `json:"timestamp"`
+	Attempts   int                  `json:"attempts"` // attempts used, not covered by the signature
+	Distance   float64              `json:"distance"` // distance of the deciding attempt, not covered by the signature
+	Signature  string               `json:"signature"`
+}
+
+// VerificationAttempt is the result of one probe submitted to a VerificationSession
+type VerificationAttempt struct {
+	Matched   bool
+	Distance  float64
+	Remaining int                  // attempts left before lockout
+	Receipt   *VerificationReceipt // set once the session reached a decision
+}
+
+// VerificationSession verifies probes against one enrolled template with a retry budget
+// A match produces a verified receipt; MaxAttempts failures produce a rejected receipt and lock the session
+// It is safe for concurrent use
+type VerificationSession struct {
+	mu         sync.Mutex
+	config     VerificationConfig
+	templateID string
+	templates  []FaceEncoding
+	failures   int
+	lockedTill time.Time
+}
+
+// NewVerificationSession creates a session for the person enrolled as templateID
+func NewVerificationSession(templateID string, templates []FaceEncoding, config VerificationConfig) (*VerificationSession, error) {
+	if len(config.Key) == 0 && config.Keys == nil {
+		return nil, errors.New("verification session: a signing key is required")
+	}
+	if config.Keys != nil {
+		if _, ok := config.Keys.Current(); !ok {
+			return nil, errors.New("verification session: the key ring is empty")
+		}
+	}
+	if len(templates) == 0 {
+		return nil, errors.New("verification session: no template encodings")
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 3
+	}
+	if config.Lockout <= 0 {
+		config.Lockout = 5 * time.Minute
+	}
+	if config.Tolerance <= 0 {
+		config.Tolerance = 0.6
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+
+	return &VerificationSession{
+		config:     config,
+		templateID: templateID,
+		templates:  append([]FaceEncoding(nil), templates...),
+	}, nil
+}
+
+// Attempt submits a probe
+// Returns SessionLockedError while the session is locked; the budget resets once the lockout expires
+func (s *VerificationSession) Attempt(probe FaceEncoding) (VerificationAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.config.Now()
+	if now.Before(s.lockedTill) {
+		return VerificationAttempt{}, &SessionLockedError{Until: s.lockedTill}
+	}
+	if !s.lockedTill.IsZero() {
+		s.lockedTill = time.Time{}
+		s.failures = 0
+	}
+
+	distance := math.Inf(1)
+	for _, d := range FaceDistances(s.templates, probe) {
+		distance = math.Min(distance, d)
+	}
+	attempt := VerificationAttempt{Matched: distance <= s.config.Tolerance, Distance: distance}
+
+	if attempt.Matched {
+		attempt.Receipt = s.receipt(DecisionVerified, now, s.failures+1, distance)
+		s.failures = 0
+		return attempt, nil
+	}
+
+	s.failures++
+	attempt.Remaining = s.config.MaxAttempts - s.failures
+	if attempt.Remaining <= 0 {
+		attempt.Remaining = 0
+		attempt.Receipt = s.receipt(DecisionRejected, now, s.failures, distance)
+		s.lockedTill = now.Add(s.config.Lockout)
+	}
+	return attempt, nil
+}
+
+// Locked reports whether the session is locked and until when
+func (s *VerificationSession) Locked() (bool, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.config.Now().Before(s.lockedTill), s.lockedTill
+}
+
+func (s *VerificationSession) receipt(decision VerificationDecision, now time.Time, attempts int, distance float64) *VerificationReceipt {
+	r := &VerificationReceipt{
+		TemplateID: s.templateID,
+		Decision:   decision,
+		Timestamp:  now.UTC(),
+		Attempts:   attempts,
+		Distance:   distance,
+	}
+	if s.config.Keys != nil {
+		// The ring was checked to be non-empty and keys cannot be removed while current, so Sign cannot fail
+		keyID, sum, _ := s.config.Keys.Sign(receiptFields(r)...)
+		r.KeyID = keyID
+		r.Signature = hex.EncodeToString(sum)
+		return r
+	}
+	r.Signature = hex.EncodeToString(security.MAC(s.config.Key, receiptFields(r)...))
+	return r
+}
+
+// VerifyReceipt reports whether a receipt was signed with key and has not been altered
+func VerifyReceipt(r *VerificationReceipt, key []byte) bool {
+	sig, err := hex.DecodeString(r.Signature)
+	if err != nil {
+		return false
+	}
+	return security.CheckMAC(key, sig, receiptFields(r)...)
+}
+
+// VerifyReceiptKeyRing reports whether a receipt was signed by a key that is still in the ring
+func VerifyReceiptKeyRing(r *VerificationReceipt, keys *security.KeyRing) bool {
+	sig, err := hex.DecodeString(r.Signature)
+	if err != nil {
+		return false
+	}
+	return keys.Verify(r.KeyID, sig, receiptFields(r)...)
+}
+
+// receiptFields are the signed parts of a receipt
+func receiptFields(r *VerificationReceipt) []string {
+	return []string{string(r.Decision), r.Timestamp.UTC().Format(time.RFC3339Nano), r.TemplateID}
+}
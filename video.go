@@ -0,0 +1,527 @@
+package gofacerecognition
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// VideoConfig configures a VideoProcessor
+type VideoConfig struct {
+	Workers       int             // number of frames processed in parallel (default 1)
+	FrameSkip     int             // process one frame, then skip this many
+	DropWhenBusy  bool            // drop frames instead of blocking when every worker is busy
+	UpsampleTimes int             // detection upsampling (default 1)
+	NumJitters    int             // encoding jitters (default 1)
+	Model         DetectionModel  // detection model (default HOG)
+	DB            *FaceDB         // optional, faces are matched against it when set
+	Tolerance     float64         // match tolerance for DB lookups (default 0.6)
+	CameraID      string          // source camera, DB lookups apply its calibration (see FaceDB.SetCameraCalibrations)
+	Deinterlace   DeinterlaceMode // applied to every processed frame before detection
+	Denoise       *DenoiseConfig  // optional temporal denoising of processed frames, in arrival order
+	// Plugins transform frames after the built-in preprocessing and receive the faces found, see Plugin
+	// Faces dropped by a DecisionHook are left out of the results; sink errors are reported in VideoResult.Err
+	Plugins []Plugin
+	// SlowFrameLog logs the stage timings of frames taking longer than its threshold from arrival to result
+	SlowFrameLog *SlowLog
+	// LatencyBudget picks Model, UpsampleTimes and NumJitters per frame to keep detection and encoding
+	// within its target, which replaces the fixed settings above, see AdaptiveQuality
+	LatencyBudget *LatencyBudget
+	// Tracking follows faces across frames with a Tracker and sets VideoFace.TrackID and
+	// FaceEvent.TrackID, so a SightingIndex keeps one best shot per track. Faces are only encoded when
+	// their track is new, later frames reuse the track's encoding. It needs frames in order, so
+	// NewVideoProcessor runs a single worker when it is set
+	Tracking *TrackerConfig
+}
+
+// VideoFace is a face found in a video frame
+type VideoFace struct {
+	Face
+	PersonID string // empty when the face is unknown or no DB is configured
+	Name     string
+	Distance float64
+	Decision string // set by DecisionHook plugins
+	TrackID  int    // set when VideoConfig.Tracking is, faces of one track share it
+}
+
+// VideoResult holds the faces found in one processed frame
+// Results can arrive out of order when more than one worker is used; use FrameIndex to reorder
+type VideoResult struct {
+	FrameIndex int
+	Timestamp  time.Time // when the frame was received
+	Faces      []VideoFace
+	Err        error
+	// Timings holds the duration of every stage of the frame, including each plugin call and the
+	// wait for a free worker ("queue")
+	Timings *StageTimings
+	// Settings are the Model, UpsampleTimes and NumJitters the frame was processed with
+	Settings RequestOptions
+}
+
+// VideoStats counts frames seen by a VideoProcessor
+type VideoStats struct {
+	Received  int64
+	Processed int64
+	Skipped   int64 // skipped by FrameSkip
+	Dropped   int64 // dropped because every worker was busy
+	InFlight  int64
+}
+
+// VideoProcessor runs detection and encoding over a stream of frames on a worker pool
+type VideoProcessor struct {
+	fr       *FaceRecognizer
+	config   VideoConfig
+	denoiser *TemporalDenoiser
+	quality  *AdaptiveQuality
+
+	trackMu sync.Mutex
+	tracker *Tracker
+
+	received  atomic.Int64
+	processed atomic.Int64
+	skipped   atomic.Int64
+	dropped   atomic.Int64
+	inFlight  atomic.Int64
+
+	mu       sync.Mutex
+	stopped  bool
+	stopping chan struct{} // closed by Shutdown, stops intake of every run
+	runs     sync.WaitGroup
+}
+
+type videoJob struct {
+	index int
+	ts    time.Time
+	frame image.Image
+	img   *ImageMatrix // already preprocessed frame, when preprocessing is enabled
+	err   error        // preprocessing failure
+
+	timings  *StageTimings
+	queuedAt time.Time
+}
+
+// NewVideoProcessor creates a VideoProcessor using fr for inference
+func NewVideoProcessor(fr *FaceRecognizer, config VideoConfig) *VideoProcessor {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	if config.FrameSkip < 0 {
+		config.FrameSkip = 0
+	}
+	if config.UpsampleTimes < 1 {
+		config.UpsampleTimes = 1
+	}
+	if config.NumJitters < 1 {
+		config.NumJitters = 1
+	}
+	if config.Model == "" {
+		config.Model = HOG
+	}
+	if config.Tracking != nil && config.Workers > 1 {
+		// The tracker needs frames in order, which only one worker guarantees
+		config.Workers = 1
+	}
+
+	vp := &VideoProcessor{fr: fr, config: config, stopping: make(chan struct{})}
+	if config.Denoise != nil {
+		vp.denoiser = NewTemporalDenoiser(*config.Denoise)
+	}
+	if config.LatencyBudget != nil {
+		vp.quality = NewAdaptiveQuality(*config.LatencyBudget)
+	}
+	if config.Tracking != nil {
+		vp.tracker = NewTracker(*config.Tracking)
+	}
+	return vp
+}
+
+// Stats returns a snapshot of the frame counters
+func (vp *VideoProcessor) Stats() VideoStats {
+	return VideoStats{
+		Received:  vp.received.Load(),
+		Processed: vp.processed.Load(),
+		Skipped:   vp.skipped.Load(),
+		Dropped:   vp.dropped.Load(),
+		InFlight:  vp.inFlight.Load(),
+	}
+}
+
+// Quality returns the AdaptiveQuality choosing the settings of frames, nil without a LatencyBudget
+func (vp *VideoProcessor) Quality() *AdaptiveQuality {
+	return vp.quality
+}
+
+// Run consumes frames until the channel is closed, ctx is cancelled or Shutdown is called
+// The returned channel is closed once every accepted frame has been processed
+func (vp *VideoProcessor) Run(ctx context.Context, frames <-chan image.Image) <-chan VideoResult {
+	jobs := make(chan videoJob)
+	results := make(chan VideoResult, vp.config.Workers)
+
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	if vp.stopped {
+		close(results)
+		return results
+	}
+	vp.runs.Add(1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < vp.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				result := vp.process(job)
+				vp.inFlight.Add(-1)
+				select {
+				case results <- result:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer func() {
+			close(jobs)
+			wg.Wait()
+			close(results)
+			vp.runs.Done()
+		}()
+
+		index := 0
+		for {
+			var frame image.Image
+			var ok bool
+			select {
+			case frame, ok = <-frames:
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				return
+			case <-vp.stopping:
+				return
+			}
+
+			vp.received.Add(1)
+			job := videoJob{index: index, ts: time.Now(), frame: frame}
+			job.timings = NewStageTimings(job.ts)
+			index++
+
+			if job.index%(vp.config.FrameSkip+1) != 0 {
+				vp.skipped.Add(1)
+				continue
+			}
+
+			// Temporal filters need frames in order, so preprocessing runs here rather than in the workers
+			if vp.config.Deinterlace != DeinterlaceNone || vp.denoiser != nil || len(vp.config.Plugins) > 0 {
+				job.img, job.err = vp.preprocess(ImageToMatrix(frame), job.timings)
+			}
+			job.queuedAt = time.Now()
+
+			// Counted before the send, a worker may finish the job and decrement before the send returns
+			vp.inFlight.Add(1)
+			if vp.config.DropWhenBusy {
+				select {
+				case jobs <- job:
+				default:
+					vp.inFlight.Add(-1)
+					vp.dropped.Add(1)
+				}
+				continue
+			}
+
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				vp.inFlight.Add(-1)
+				return
+			case <-vp.stopping:
+				vp.inFlight.Add(-1)
+				return
+			}
+		}
+	}()
+
+	return results
+}
+
+// Shutdown stops every run from taking new frames, waits until the frames already accepted have been
+// processed and delivered, then flushes plugins that buffer output (see Flusher)
+// Results must be read until their channel is closed for the wait to end. The recognizer and the
+// plugins stay open, close them once Shutdown returns
+func (vp *VideoProcessor) Shutdown(ctx context.Context) error {
+	vp.mu.Lock()
+	if !vp.stopped {
+		vp.stopped = true
+		close(vp.stopping)
+	}
+	vp.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		vp.runs.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return errors.Join(err, FlushPlugins(vp.config.Plugins))
+}
+
+func (vp *VideoProcessor) process(job videoJob) (result VideoResult) {
+	result = VideoResult{FrameIndex: job.index, Timestamp: job.ts, Timings: job.timings}
+	job.timings.Since("queue", job.queuedAt)
+	defer vp.processed.Add(1)
+	defer vp.finishTimings(&result)
+
+	if job.err != nil {
+		result.Err = job.err
+		return result
+	}
+
+	img := job.img
+	if img == nil {
+		start := time.Now()
+		img = ImageToMatrix(job.frame)
+		job.timings.Since("convert", start)
+	}
+
+	level := -1
+	result.Settings = RequestOptions{Model: vp.config.Model, UpsampleTimes: vp.config.UpsampleTimes, NumJitters: vp.config.NumJitters}
+	if vp.quality != nil {
+		level, result.Settings = vp.quality.Next()
+	}
+	settings := result.Settings
+
+	// Detection and encoding run on the frame after Config.Preprocessing of the recognizer, faces are
+	// tracked and reported in the coordinates of the frame
+	start := time.Now()
+	pre, original := vp.fr.preprocessImage(img)
+	if pre != img {
+		job.timings.Since("preprocess", start)
+	}
+
+	start = time.Now()
+	locations, err := vp.fr.faceLocations(pre, settings.UpsampleTimes, settings.Model)
+	detected := time.Since(start)
+	job.timings.Since("detect", start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	rects := make([]Rectangle, len(locations))
+	for i := range locations {
+		rects[i] = original(Face{Rectangle: locations[i]}).Rectangle
+	}
+	tracks := vp.track(rects)
+	if len(locations) == 0 {
+		if vp.quality != nil {
+			vp.quality.Observe(level, detected, 0, 0)
+		}
+		return result
+	}
+
+	start = time.Now()
+	encodings, encoded, err := vp.encode(pre, locations, tracks, settings.NumJitters)
+	job.timings.Since("encode", start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if vp.quality != nil {
+		vp.quality.Observe(level, detected, time.Since(start), encoded)
+	}
+
+	var sinkErrs []error
+	result.Faces = make([]VideoFace, 0, len(locations))
+	for i := range locations {
+		face := VideoFace{Face: Face{Rectangle: rects[i]}}
+		if tracks != nil {
+			face.TrackID = tracks[i].ID
+		}
+		if i < len(encodings) {
+			face.Encoding = encodings[i]
+		}
+
+		if vp.config.DB != nil {
+			start := time.Now()
+			matches := vp.config.DB.SearchFromCamera(vp.config.CameraID, face.Encoding, vp.config.Tolerance)
+			job.timings.Since("match", start)
+			if len(matches) > 0 {
+				face.PersonID = matches[0].Person.ID
+				face.Name = matches[0].Person.Name
+				face.Distance = matches[0].Distance
+			}
+		}
+
+		if len(vp.config.Plugins) > 0 {
+			ev := FaceEvent{
+				Time:       job.ts,
+				CameraID:   vp.config.CameraID,
+				FrameIndex: job.index,
+				FaceIndex:  i,
+				Rectangle:  face.Rectangle,
+				PersonID:   face.PersonID,
+				Name:       face.Name,
+				Distance:   face.Distance,
+				Encoding:   face.Encoding,
+				Quality:    AssessQuality(img, face.Rectangle, FaceLandmarks{}).Score(DefaultQualityThresholds),
+			}
+			if tracks != nil {
+				ev.TrackID = strconv.Itoa(face.TrackID)
+			}
+			keep, err := dispatchEvent(vp.config.Plugins, &ev, job.timings)
+			if err != nil {
+				sinkErrs = append(sinkErrs, err)
+			}
+			if !keep {
+				continue
+			}
+			face.PersonID, face.Name, face.Distance, face.Decision = ev.PersonID, ev.Name, ev.Distance, ev.Decision
+		}
+
+		result.Faces = append(result.Faces, face)
+	}
+	result.Err = errors.Join(sinkErrs...)
+
+	return result
+}
+
+// track updates the tracker with the faces of a frame, frames without faces age the tracks too
+// It returns nil when tracking is off
+func (vp *VideoProcessor) track(locations []Rectangle) []Track {
+	if vp.tracker == nil {
+		return nil
+	}
+	vp.trackMu.Lock()
+	defer vp.trackMu.Unlock()
+	return vp.tracker.Update(locations)
+}
+
+// encode returns the encodings of the faces of a frame and how many went through the encoder
+// With tracking on only faces of new tracks, or of tracks without an encoding yet, are encoded, the
+// others reuse the encoding cached on their track
+func (vp *VideoProcessor) encode(img *ImageMatrix, locations []Rectangle, tracks []Track, numJitters int) ([]FaceEncoding, int, error) {
+	if tracks == nil {
+		encodings, err := vp.fr.FaceEncodings(img, locations, numJitters, LandmarkLarge)
+		return encodings, len(locations), err
+	}
+
+	encodings := make([]FaceEncoding, len(locations))
+	var pending []int
+	var pendingLocations []Rectangle
+	for i, t := range tracks {
+		if t.IsNew || !t.HasEncoding {
+			pending = append(pending, i)
+			pendingLocations = append(pendingLocations, locations[i])
+			continue
+		}
+		encodings[i] = t.Encoding
+	}
+	if len(pending) == 0 {
+		return encodings, 0, nil
+	}
+
+	fresh, err := vp.fr.FaceEncodings(img, pendingLocations, numJitters, LandmarkLarge)
+	if err != nil {
+		return nil, len(pending), err
+	}
+	vp.trackMu.Lock()
+	defer vp.trackMu.Unlock()
+	for j, i := range pending {
+		if j >= len(fresh) {
+			break
+		}
+		encodings[i] = fresh[j]
+		vp.tracker.SetEncoding(tracks[i].ID, fresh[j])
+	}
+	return encodings, len(pending), nil
+}
+
+// preprocess applies the configured deinterlacing, denoising and plugin transforms to a frame
+func (vp *VideoProcessor) preprocess(img *ImageMatrix, timings *StageTimings) (*ImageMatrix, error) {
+	if vp.config.Deinterlace != DeinterlaceNone {
+		start := time.Now()
+		img = Deinterlace(img, vp.config.Deinterlace)
+		timings.Since("deinterlace", start)
+	}
+	if vp.denoiser != nil {
+		start := time.Now()
+		img = vp.denoiser.Process(img)
+		timings.Since("denoise", start)
+	}
+	return applyTransforms(vp.config.Plugins, img, timings)
+}
+
+// finishTimings reports the stages of a processed frame to the metrics and logs the frame when slow
+func (vp *VideoProcessor) finishTimings(result *VideoResult) {
+	if m, ok := vp.fr.metrics.(StageMetrics); ok {
+		for _, s := range result.Timings.Stages() {
+			m.ObserveStage(s.Stage, s.Duration)
+		}
+	}
+	vp.config.SlowFrameLog.Observe(fmt.Sprintf("frame %d of camera %q", result.FrameIndex, vp.config.CameraID), result.Timings, struct {
+		Model         DetectionModel
+		UpsampleTimes int
+		NumJitters    int
+		Faces         int
+		Err           error
+	}{result.Settings.Model, result.Settings.UpsampleTimes, result.Settings.NumJitters, len(result.Faces), result.Err})
+}
+
+// Validate returns a *ConfigError listing every invalid setting
+// NewVideoProcessor replaces them with the defaults, so validate first to catch mistakes
+func (c VideoConfig) Validate() error {
+	p := configProblems{config: "VideoConfig"}
+	p.checkNonNegative("Workers", int64(c.Workers), "use 1 per core you can spare, or 0 for the default")
+	p.checkNonNegative("FrameSkip", int64(c.FrameSkip), "use 0 to process every frame")
+	p.checkDetection(c.Model, c.UpsampleTimes, c.NumJitters)
+	p.checkTolerance("Tolerance", c.Tolerance)
+	switch c.Deinterlace {
+	case DeinterlaceNone, DeinterlaceBob, DeinterlaceWeave:
+	default:
+		p.add("Deinterlace", "unknown deinterlace mode "+string(c.Deinterlace), "use DeinterlaceNone, DeinterlaceBob or DeinterlaceWeave")
+	}
+	for i, plugin := range c.Plugins {
+		if plugin == nil {
+			p.add("Plugins", "plugin "+strconv.Itoa(i)+" is nil", "remove it from the list")
+		}
+	}
+	if t := c.Tracking; t != nil {
+		if c.Workers > 1 {
+			p.add("Tracking", fmt.Sprintf("tracking needs frames in order, %d workers process them out of order", c.Workers), "use 1 worker, or leave Tracking nil")
+		}
+		if t.IoUThreshold < 0 || t.IoUThreshold > 1 {
+			p.add("Tracking.IoUThreshold", fmt.Sprintf("%v is outside [0, 1]", t.IoUThreshold), "use 0.3, or 0 for the default")
+		}
+		p.checkNonNegative("Tracking.MaxMisses", int64(t.MaxMisses), "use 0 for the default")
+	}
+	if c.SlowFrameLog != nil {
+		p.checkNonNegative("SlowFrameLog.Threshold", int64(c.SlowFrameLog.Threshold), "use 0 to log no frames")
+	}
+	if b := c.LatencyBudget; b != nil {
+		if b.Target <= 0 {
+			p.add("LatencyBudget.Target", fmt.Sprintf("%s leaves no time for a frame", b.Target), "use the frame interval of the stream or less, e.g. 80ms")
+		}
+		for _, level := range b.Levels {
+			p.checkDetection(level.Model, level.UpsampleTimes, level.NumJitters)
+		}
+		p.checkNonNegative("LatencyBudget.Window", int64(b.Window), "use 0 for the default")
+		p.checkNonNegative("LatencyBudget.ProbeInterval", int64(b.ProbeInterval), "use 0 for the default")
+		if b.Headroom < 0 || b.Headroom > 1 {
+			p.add("LatencyBudget.Headroom", fmt.Sprintf("%v is outside [0, 1]", b.Headroom), "use a fraction such as 0.8, or 0 for the default")
+		}
+	}
+	return p.err()
+}
@@ -0,0 +1,15 @@
+package gofacerecognition
+
+import "testing"
+
+func TestNewVideoProcessorTrackingRunsOneWorker(t *testing.T) {
+	vp := NewVideoProcessor(nil, VideoConfig{Workers: 4, Tracking: &TrackerConfig{}})
+	if vp.config.Workers != 1 {
+		t.Fatalf("Workers = %d with tracking, want 1", vp.config.Workers)
+	}
+
+	vp = NewVideoProcessor(nil, VideoConfig{Workers: 4})
+	if vp.config.Workers != 4 {
+		t.Fatalf("Workers = %d without tracking, want 4", vp.config.Workers)
+	}
+}
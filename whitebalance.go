@@ -0,0 +1,115 @@
+package gofacerecognition
+
+import "math"
+
+// WhiteBalanceMethod selects how AutoWhiteBalanceWith estimates the color of the illuminant
+type WhiteBalanceMethod string
+
+const (
+	// WhiteBalanceGrayWorld assumes the scene averages to gray (default)
+	WhiteBalanceGrayWorld WhiteBalanceMethod = "gray_world"
+	// WhiteBalanceRetinex assumes the brightest pixels are white, a light variant of retinex (white patch)
+	// It works better than gray world when a single colored surface fills most of the frame
+	WhiteBalanceRetinex WhiteBalanceMethod = "retinex"
+)
+
+const (
+	// Pixels at or above this level in any channel are clipped and carry no color information
+	whiteBalanceClip = 250
+	// Fraction of the brightest pixels used as the white reference by WhiteBalanceRetinex
+	retinexTopFraction = 0.01
+	// Per-channel gains are clamped so a nearly single-colored frame is not blown out
+	maxWhiteBalanceGain = 3.0
+)
+
+// AutoWhiteBalance returns a copy of the image with its color cast removed using the gray world assumption
+func (im *ImageMatrix) AutoWhiteBalance() *ImageMatrix {
+	return im.AutoWhiteBalanceWith(WhiteBalanceGrayWorld)
+}
+
+// AutoWhiteBalanceWith returns a copy of the image with its color cast removed using the given method
+func (im *ImageMatrix) AutoWhiteBalanceWith(method WhiteBalanceMethod) *ImageMatrix {
+	var gr, gg, gb float64
+	switch method {
+	case WhiteBalanceRetinex:
+		gr, gg, gb = im.retinexGains()
+	default:
+		gr, gg, gb = im.grayWorldGains()
+	}
+
+	var lut [3][256]byte
+	for v := 0; v < 256; v++ {
+		for c, gain := range [3]float64{gr, gg, gb} {
+			lut[c][v] = byte(math.Min(255, math.Round(float64(v)*gain)))
+		}
+	}
+
+	out := im.newLike(im.Width, im.Height)
+	for y := 0; y < im.Height; y++ {
+		for x := 0; x < im.Width; x++ {
+			r, g, b := im.At(x, y)
+			out.Set(x, y, lut[0][r], lut[1][g], lut[2][b])
+		}
+	}
+	return out
+}
+
+// grayWorldGains scales each channel so its mean matches the mean of all channels
+func (im *ImageMatrix) grayWorldGains() (float64, float64, float64) {
+	var sr, sg, sb float64
+	for y := 0; y < im.Height; y++ {
+		for x := 0; x < im.Width; x++ {
+			r, g, b := im.At(x, y)
+			if max(r, g, b) >= whiteBalanceClip {
+				continue
+			}
+			sr += float64(r)
+			sg += float64(g)
+			sb += float64(b)
+		}
+	}
+	gray := (sr + sg + sb) / 3
+	return whiteBalanceGain(gray, sr), whiteBalanceGain(gray, sg), whiteBalanceGain(gray, sb)
+}
+
+// retinexGains scales each channel so the average of the brightest unclipped pixels becomes neutral
+func (im *ImageMatrix) retinexGains() (float64, float64, float64) {
+	var hist [256]int
+	n := 0
+	for y := 0; y < im.Height; y++ {
+		for x := 0; x < im.Width; x++ {
+			r, g, b := im.At(x, y)
+			if max(r, g, b) >= whiteBalanceClip {
+				continue
+			}
+			hist[luma(r, g, b)]++
+			n++
+		}
+	}
+	if n == 0 {
+		return 1, 1, 1
+	}
+	cutoff := histogramPercentile(hist, n, 1-retinexTopFraction)
+
+	var sr, sg, sb float64
+	for y := 0; y < im.Height; y++ {
+		for x := 0; x < im.Width; x++ {
+			r, g, b := im.At(x, y)
+			if max(r, g, b) >= whiteBalanceClip || luma(r, g, b) < cutoff {
+				continue
+			}
+			sr += float64(r)
+			sg += float64(g)
+			sb += float64(b)
+		}
+	}
+	white := max(sr, sg, sb)
+	return whiteBalanceGain(white, sr), whiteBalanceGain(white, sg), whiteBalanceGain(white, sb)
+}
+
+func whiteBalanceGain(target, channel float64) float64 {
+	if channel <= 0 || target <= 0 {
+		return 1
+	}
+	return math.Max(1/maxWhiteBalanceGain, math.Min(maxWhiteBalanceGain, target/channel))
+}
@@ -0,0 +1,155 @@
+package gofacerecognition
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// YUVColorSpace selects the matrix and range FromYUV420 and FromNV12 convert with
+type YUVColorSpace int
+
+const (
+	// YUVBT601 is limited-range (16-235) BT.601, the default of WebRTC and SD video decoders
+	YUVBT601 YUVColorSpace = iota
+	// YUVBT709 is limited-range BT.709, what hardware decoders produce for HD streams
+	YUVBT709
+	// YUVFullRange is full-range BT.601 as in JPEG, the conversion of image.YCbCr
+	YUVFullRange
+)
+
+// yuvCoefficients are the conversion coefficients of a color space in 16.16 fixed point
+type yuvCoefficients struct {
+	yOffset, yScale int32
+	rv, gu, gv, bu  int32
+}
+
+var yuvSpaces = map[YUVColorSpace]yuvCoefficients{
+	YUVBT601:     {16, 76309, 104597, 25675, 53279, 132201},
+	YUVBT709:     {16, 76309, 117489, 13954, 34925, 138438},
+	YUVFullRange: {0, 65536, 91881, 22554, 46802, 116130},
+}
+
+// yuvParallelRows is the frame height from which conversion is split across GOMAXPROCS goroutines
+const yuvParallelRows = 256
+
+// FromYUV420 converts a planar YUV 4:2:0 (I420) frame, as handed out by video decoders and WebRTC, to RGB
+// The U and V planes hold one sample per 2x2 block, (width+1)/2 by (height+1)/2; strides of 0 mean
+// tightly packed planes. Conversion is done in fixed point straight from the planes, with frames of
+// yuvParallelRows rows or more split across goroutines, instead of through image.YCbCr
+func FromYUV420(y, u, v []byte, width, height, yStride, uvStride int, space YUVColorSpace) (*ImageMatrix, error) {
+	chromaW, chromaH := (width+1)/2, (height+1)/2
+	if yStride == 0 {
+		yStride = width
+	}
+	if uvStride == 0 {
+		uvStride = chromaW
+	}
+	if err := checkYUVPlanes(width, height, space, yuvPlane{"Y", y, yStride, width, height},
+		yuvPlane{"U", u, uvStride, chromaW, chromaH}, yuvPlane{"V", v, uvStride, chromaW, chromaH}); err != nil {
+		return nil, err
+	}
+
+	return convertYUV(width, height, space, func(row int) ([]byte, []byte, []byte, int) {
+		c := (row / 2) * uvStride
+		return y[row*yStride:], u[c:], v[c:], 1
+	}), nil
+}
+
+// FromNV12 converts a semi-planar NV12 frame, the native output of most hardware decoders, to RGB
+// NV12 holds the Y plane followed by one plane of interleaved U and V samples per 2x2 block; strides
+// of 0 mean tightly packed planes
+func FromNV12(y, uv []byte, width, height, yStride, uvStride int, space YUVColorSpace) (*ImageMatrix, error) {
+	chromaW, chromaH := (width+1)/2, (height+1)/2
+	if yStride == 0 {
+		yStride = width
+	}
+	if uvStride == 0 {
+		uvStride = chromaW * 2
+	}
+	if err := checkYUVPlanes(width, height, space, yuvPlane{"Y", y, yStride, width, height},
+		yuvPlane{"UV", uv, uvStride, chromaW * 2, chromaH}); err != nil {
+		return nil, err
+	}
+
+	return convertYUV(width, height, space, func(row int) ([]byte, []byte, []byte, int) {
+		c := (row / 2) * uvStride
+		return y[row*yStride:], uv[c:], uv[c+1:], 2
+	}), nil
+}
+
+// yuvPlane describes a plane for checkYUVPlanes, width is in bytes
+type yuvPlane struct {
+	name          string
+	data          []byte
+	stride        int
+	width, height int
+}
+
+func checkYUVPlanes(width, height int, space YUVColorSpace, planes ...yuvPlane) error {
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("invalid frame size %dx%d", width, height)
+	}
+	if _, ok := yuvSpaces[space]; !ok {
+		return fmt.Errorf("unknown YUV color space %d", space)
+	}
+	for _, p := range planes {
+		if p.stride < p.width {
+			return fmt.Errorf("%s stride %d is less than the plane width %d", p.name, p.stride, p.width)
+		}
+		if need := (p.height-1)*p.stride + p.width; len(p.data) < need {
+			return fmt.Errorf("%s plane has %d bytes, a %dx%d frame needs %d", p.name, len(p.data), width, height, need)
+		}
+	}
+	return nil
+}
+
+// convertYUV fills an RGB image row by row; rows returns the luma row and the first U and V samples of
+// the chroma row of an image row, with the distance between consecutive U (and V) samples
+func convertYUV(width, height int, space YUVColorSpace, rows func(row int) (y, u, v []byte, step int)) *ImageMatrix {
+	k := yuvSpaces[space]
+	out := NewImageMatrix(width, height)
+
+	convertRows := func(from, to int) {
+		for row := from; row < to; row++ {
+			ys, us, vs, step := rows(row)
+			ys = ys[:width]
+			dst := out.Pixels[row*out.Stride : row*out.Stride+width*3]
+			// Each chroma sample covers two pixels of the row
+			for x, c := 0, 0; x < width; x, c = x+2, c+step {
+				cu := int32(us[c]) - 128
+				cv := int32(vs[c]) - 128
+				r, g, b := k.rv*cv, -k.gu*cu-k.gv*cv, k.bu*cu
+				l := (int32(ys[x]) - k.yOffset) * k.yScale
+				d := dst[x*3 : x*3+3]
+				d[0], d[1], d[2] = clampFixed(l+r), clampFixed(l+g), clampFixed(l+b)
+				if x+1 < width {
+					l = (int32(ys[x+1]) - k.yOffset) * k.yScale
+					d = dst[x*3+3 : x*3+6]
+					d[0], d[1], d[2] = clampFixed(l+r), clampFixed(l+g), clampFixed(l+b)
+				}
+			}
+		}
+	}
+
+	bands := 1
+	if height >= yuvParallelRows {
+		bands = min(runtime.GOMAXPROCS(0), height/64)
+	}
+	rowsPerBand := (height + bands - 1) / bands
+	parallelChunks(bands, func(i int) {
+		convertRows(i*rowsPerBand, min((i+1)*rowsPerBand, height))
+	})
+	return out
+}
+
+// clampFixed rounds a 16.16 fixed point value to a byte
+func clampFixed(v int32) byte {
+	v = (v + 1<<15) >> 16
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return byte(v)
+}